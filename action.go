@@ -0,0 +1,142 @@
+package majordomo_worker
+
+import (
+	"io"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorWorkerAction can be implemented instead of WorkerAction.Call by actions that can fail. When the returned
+// error isn't nil the request is answered with WorkerConfig.ErrorReply instead of the returned frames.
+type ErrorWorkerAction interface {
+	CallWithError(ctx RequestContext) ([][]byte, error)
+}
+
+type actionResult struct {
+	reply  [][]byte
+	routed []RoutedReply
+	err    error
+
+	// Set instead of reply by a StreamWorkerAction when the broker takes partial replies, see streamReply
+	stream io.Reader
+
+	// How long a DelayedWorkerAction's reply is held back for
+	delay time.Duration
+}
+
+func defaultErrorReply(err error) [][]byte {
+	return [][]byte{[]byte(err.Error())}
+}
+
+// What became of an action that may time out, decided by whichever of the action and the timeout comes first
+const (
+	actionRunning int32 = iota
+	actionFinished
+	actionAbandoned
+)
+
+// Calls the action, giving up on it once the action timeout has passed. A timed out action keeps running in
+// the background and its result is discarded, it is counted in Stats().AbandonedActions until it returns. The
+// request is reported by CurrentRequest() until then, or until it times out.
+func (w *mdWorker) callAction(ctx RequestContext) actionResult {
+	id := w.inFlight.start(ctx)
+	defer w.inFlight.finish(id)
+
+	if w.actionTimeout <= 0 {
+		return w.invokeAction(ctx)
+	}
+
+	state := actionRunning
+	done := make(chan actionResult, 1)
+	go func() {
+		done <- w.invokeAction(ctx)
+		if !atomic.CompareAndSwapInt32(&state, actionRunning, actionFinished) {
+			w.stats.abandonedActionFinished()
+		}
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-w.clock.After(w.actionTimeout):
+		if !atomic.CompareAndSwapInt32(&state, actionRunning, actionAbandoned) {
+			// It finished just as the timeout passed
+			return <-done
+		}
+
+		abandoned := w.stats.actionAbandoned()
+		logWarnf(w.logger, "Action timed out after %s, %d abandoned actions still running", w.actionTimeout, abandoned)
+		if w.abandonedLimitReached() {
+			logErrorf(w.logger, "Abandoned action limit of %d reached, not taking requests until some finish", w.abandonedActionLimit)
+		}
+		return actionResult{err: ErrActionTimeout}
+	}
+}
+
+// Too many actions that never returned point at something systemic, i.e. a dependency that hangs, so the worker stops
+// taking requests it would only abandon too. See WorkerConfig.AbandonedActionLimit.
+func (w *mdWorker) abandonedLimitReached() bool {
+	return w.abandonedActionLimit > 0 && w.stats.abandoned() >= w.abandonedActionLimit
+}
+
+func (w *mdWorker) invokeAction(ctx RequestContext) (result actionResult) {
+	defer w.recoverAction(&result.err)
+
+	action := w.action()
+
+	// Middleware has every optional method, the action inside it decides which is called
+	switch innermostAction(action).(type) {
+	case RoutedWorkerAction:
+		result.reply, result.routed = action.(RoutedWorkerAction).CallRouted(ctx)
+	case StreamWorkerAction:
+		result.stream, result.err = action.(StreamWorkerAction).CallStream(ctx)
+		if result.err == nil && !w.partialReplies() {
+			result.reply, result.err = readChunks(result.stream, w.chunkSize())
+			result.stream = nil
+		}
+	case DelayedWorkerAction:
+		result.reply, result.delay = action.(DelayedWorkerAction).CallDelayed(ctx)
+	case ErrorWorkerAction:
+		result.reply, result.err = action.(ErrorWorkerAction).CallWithError(ctx)
+	case ContextWorkerAction:
+		result.reply = action.(ContextWorkerAction).CallWithContext(ctx)
+	default:
+		result.reply = action.Call(ctx.Request)
+	}
+
+	if result.err == nil && result.stream == nil && w.replyValidator != nil {
+		result.err = w.replyValidator(result.reply)
+	}
+
+	return result
+}
+
+// Turns a panic in the action into an ActionPanic error, if panics are being recovered. Must be deferred.
+func (w *mdWorker) recoverAction(err *error) {
+	if !w.recoverPanics {
+		return
+	}
+
+	if r := recover(); r != nil {
+		*err = ActionPanic{Value: r, Stack: string(debug.Stack())}
+	}
+}
+
+func defaultPanicReply(recovered interface{}) [][]byte {
+	return [][]byte{[]byte("Internal error")}
+}
+
+// Logs the action's failure and returns the reply to send instead. Panics are answered with the panic reply, so
+// clients can tell bugs from errors the action meant to return, and only the log gets the stack.
+func (w *mdWorker) actionFailed(err error) [][]byte {
+	w.stats.addError()
+
+	if panicked, ok := err.(ActionPanic); ok {
+		logErrorf(w.logger, "Action failed, error: '%s'\n%s", err.Error(), panicked.Stack)
+		return w.panicReply(panicked.Value)
+	}
+
+	logErrorf(w.logger, "Action failed, error: '%s'", err.Error())
+	return w.errorReply(err)
+}
@@ -0,0 +1,92 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func actionWorker(action WorkerAction) *mdWorker {
+	return &mdWorker{
+		workerAction:  action,
+		actionTimeout: 10 * time.Millisecond,
+		stats:         newWorkerStats(realClock{}),
+		clock:         realClock{},
+		logger:        new(testLogger),
+	}
+}
+
+// Hangs until released, or forever
+func hungAction(release chan struct{}) WorkerAction {
+	return funcWorkerAction{call: func(args [][]byte) [][]byte {
+		<-release
+		return args
+	}}
+}
+
+func Test_Action_TimedOutActionCountedAsAbandoned(t *testing.T) {
+	w := actionWorker(hungAction(make(chan struct{})))
+
+	for i := 1; i <= 2; i++ {
+		result := w.callAction(RequestContext{Request: [][]byte{[]byte("hello")}})
+
+		assert.Equal(t, ErrActionTimeout, result.err)
+		assert.Equal(t, i, w.Stats().AbandonedActions)
+	}
+}
+
+func Test_Action_AbandonedActionNoLongerCountedOnceFinished(t *testing.T) {
+	release := make(chan struct{})
+	w := actionWorker(hungAction(release))
+
+	w.callAction(RequestContext{})
+	assert.Equal(t, 1, w.Stats().AbandonedActions)
+
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for w.Stats().AbandonedActions > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, w.Stats().AbandonedActions)
+}
+
+func Test_Action_FinishedActionNotAbandoned(t *testing.T) {
+	w := actionWorker(defaultWorkerAction{})
+
+	result := w.callAction(RequestContext{Request: [][]byte{[]byte("hello")}})
+
+	assert.NoError(t, result.err)
+	assert.Equal(t, 0, w.Stats().AbandonedActions)
+}
+
+func Test_Action_AbandonedLimitStopsTakingRequests(t *testing.T) {
+	w := actionWorker(hungAction(make(chan struct{})))
+	w.abandonedActionLimit = 2
+
+	w.callAction(RequestContext{})
+	assert.False(t, w.atCapacity())
+
+	w.callAction(RequestContext{})
+	assert.True(t, w.atCapacity(), "Expected no more requests once the limit is reached")
+	assert.NotEmpty(t, w.logger.(*testLogger).errors)
+}
+
+func Test_Action_PanicLoggedWithStack(t *testing.T) {
+	w := actionWorker(funcWorkerAction{call: func(args [][]byte) [][]byte {
+		panic("boom")
+	}})
+	w.recoverPanics = true
+	w.panicReply = defaultPanicReply
+
+	result := w.invokeAction(RequestContext{})
+	reply := w.actionFailed(result.err)
+
+	assert.Equal(t, [][]byte{[]byte("Internal error")}, reply)
+	errors := w.logger.(*testLogger).errors
+	if assert.Len(t, errors, 1) {
+		assert.Contains(t, errors[0]["message"], "Action panicked: boom")
+		assert.Contains(t, errors[0]["message"], "Test_Action_PanicLoggedWithStack")
+	}
+}
@@ -0,0 +1,134 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// BatchWorkerAction can be implemented alongside WorkerAction to handle several requests in one call. It must
+// return one reply per request, in the same order as the requests.
+type BatchWorkerAction interface {
+	CallBatch(requests []RequestContext) [][][]byte
+}
+
+type pendingRequest struct {
+	workerSocket *mdWorkerSocket
+	ctx          RequestContext
+}
+
+func (w *mdWorker) batching() bool {
+	return w.batchMaxSize > 0
+}
+
+// Adds the request to the current batch, dispatching the batch if it is now full
+func (w *mdWorker) addToBatch(workerSocket *mdWorkerSocket, ctx RequestContext) ([][]byte, bool) {
+	w.batch = append(w.batch, pendingRequest{workerSocket: workerSocket, ctx: ctx})
+
+	if len(w.batch) == 1 {
+		w.batchDeadline = w.clock.Now().Add(w.batchMaxWait)
+	}
+
+	if len(w.batch) < w.batchMaxSize {
+		return nil, false
+	}
+
+	return w.flushBatch(), true
+}
+
+func (w *mdWorker) batchDue() bool {
+	return len(w.batch) > 0 && !w.clock.Now().Before(w.batchDeadline)
+}
+
+// Calls the batch action with every pending request and routes each reply back to its client. Returns the
+// reply to the last request in the batch.
+func (w *mdWorker) flushBatch() [][]byte {
+	batch := w.batch
+	w.batch = nil
+
+	ctxs := make([]RequestContext, len(batch))
+	finishTraces := make([]func([][]byte) [][]byte, len(batch))
+	for i, pending := range batch {
+		ctxs[i] = pending.ctx
+		finishTraces[i] = w.startTrace(pending.ctx)
+	}
+
+	logDebugf(w.logger, "Dispatching batch of %d requests", len(batch))
+
+	actionStart := w.clock.Now()
+	w.actionMutex.RLock()
+	batchAction := w.batchAction
+	w.actionMutex.RUnlock()
+
+	replies, err := w.callBatchAction(batchAction, ctxs)
+	elapsed := w.clock.Now().Sub(actionStart)
+	w.metrics.ActionDuration(w.metricsLabel, elapsed)
+
+	// Every request in the batch waited for all of it
+	for _, ctx := range ctxs {
+		w.checkSlow(ctx, elapsed)
+	}
+
+	if err != nil {
+		// The whole batch failed together, none of it is cached
+		errorReply := w.actionFailed(err)
+		for i, pending := range batch {
+			w.recordOutcome(pending.ctx, err)
+			w.sendReply(pending.workerSocket, pending.ctx, finishTraces[i](errorReply))
+		}
+
+		w.stats.requestsDone(len(batch))
+		return errorReply
+	}
+
+	if len(replies) != len(batch) {
+		logErrorf(w.logger, "Batch action returned %d replies for %d requests", len(replies), len(batch))
+		w.stats.addError()
+	}
+
+	var reply [][]byte
+	for i, pending := range batch {
+		reply = nil
+		if i < len(replies) {
+			reply = replies[i]
+		}
+
+		w.recordOutcome(pending.ctx, nil)
+		if requestID, cacheable := w.requestID(pending.ctx); cacheable {
+			w.idempotencyCache.put(requestID, reply)
+		}
+
+		w.sendReply(pending.workerSocket, pending.ctx, finishTraces[i](reply))
+	}
+
+	w.stats.requestsDone(len(batch))
+
+	return reply
+}
+
+func (w *mdWorker) callBatchAction(batchAction BatchWorkerAction, ctxs []RequestContext) (replies [][][]byte, err error) {
+	defer w.recoverAction(&err)
+
+	return batchAction.CallBatch(ctxs), nil
+}
+
+// Polls for no longer than the time left before the pending batch is due, and only briefly while actions are running
+func (w *mdWorker) pollTimeout() time.Duration {
+	if len(w.slots) > 0 && w.pollInterval > inFlightPollInterval {
+		// Finished actions don't interrupt the poll, so don't keep their replies waiting
+		return inFlightPollInterval
+	}
+
+	if len(w.batch) == 0 {
+		return w.pollInterval
+	}
+
+	untilDue := w.batchDeadline.Sub(w.clock.Now())
+	if untilDue < 0 {
+		return 0
+	}
+
+	if untilDue < w.pollInterval {
+		return untilDue
+	}
+
+	return w.pollInterval
+}
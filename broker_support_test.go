@@ -23,14 +23,44 @@ type testBroker struct {
 }
 
 func (b testBroker) run(ctx *zmq4.Context, brokerAddress string) {
+	b.bind(ctx, brokerAddress, false)
+}
+
+// Runs the broker with ZMQ_ROUTER_HANDOVER, so a worker connecting again with the identity it had takes over from its
+// old connection rather than being turned away, see Worker.Restart
+func (b testBroker) runHandingOver(ctx *zmq4.Context, brokerAddress string) {
+	b.bind(ctx, brokerAddress, true)
+}
+
+func (b testBroker) bind(ctx *zmq4.Context, brokerAddress string, handover bool) {
 	socket, err := ctx.NewSocket(zmq4.ROUTER)
 	if err != nil {
 		panic(err)
 	}
 
 	socket.SetLinger(0)
+	if handover {
+		socket.SetRouterHandover(true)
+	}
 	socket.Bind(brokerAddress)
 
+	b.serve(socket)
+}
+
+// Runs the broker connected to a worker that binds, see WorkerConfig.Bind
+func (b testBroker) connect(ctx *zmq4.Context, workerAddress string) {
+	socket, err := ctx.NewSocket(zmq4.ROUTER)
+	if err != nil {
+		panic(err)
+	}
+
+	socket.SetLinger(0)
+	socket.Connect(workerAddress)
+
+	b.serve(socket)
+}
+
+func (b testBroker) serve(socket *zmq4.Socket) {
 	var workerId []byte
 
 	for {
@@ -0,0 +1,26 @@
+package majordomo_worker
+
+import (
+	"context"
+	"time"
+)
+
+// The client address CallAction's requests come from
+const callActionClient = "test-client"
+
+// CallAction calls action with body the way the worker would for a request from client "test-client", including
+// ContextWorkerAction, ErrorWorkerAction and RoutedWorkerAction, and returns its reply. Errors and routed replies
+// are left out, and panics aren't recovered.
+func CallAction(action WorkerAction, body ...[]byte) [][]byte {
+	w := &mdWorker{workerAction: action}
+
+	ctx := RequestContext{
+		ReplyTo:    []byte(callActionClient),
+		Request:    body,
+		RawRequest: append([][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte(callActionClient), nil}, body...),
+		ReceivedAt: time.Now(),
+		Context:    context.Background(),
+	}
+
+	return w.invokeAction(ctx).reply
+}
@@ -0,0 +1,29 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CallAction(t *testing.T) {
+	reply := CallAction(defaultWorkerAction{}, []byte("hello"))
+	assert.Equal(t, [][]byte{[]byte("hello")}, reply)
+}
+
+func Test_CallActionWithContext(t *testing.T) {
+	action := &contextWorkerAction{}
+
+	reply := CallAction(action, []byte("hello"))
+
+	assert.Equal(t, [][]byte{[]byte("hello")}, reply)
+	if assert.Len(t, action.ctxs, 1) {
+		assert.Equal(t, []byte(callActionClient), action.ctxs[0].ReplyTo)
+	}
+}
+
+func Test_CallActionDropsError(t *testing.T) {
+	assert.Equal(t, [][]byte{[]byte("hello")}, CallAction(errorWorkerAction{}, []byte("hello")))
+	assert.Nil(t, CallAction(errorWorkerAction{err: errors.New("failed")}, []byte("hello")))
+}
@@ -0,0 +1,62 @@
+package majordomo_worker
+
+import (
+	"fmt"
+
+	"github.com/pebbe/zmq4"
+)
+
+// What the zmq library the worker is linked against supports. A variable so tests can stand in for libraries built
+// without some features.
+var zmqFeatures = struct {
+	curve, ipc, pgm func() bool
+	version         func() (major, minor, patch int)
+}{
+	curve:   zmq4.HasCurve,
+	ipc:     zmq4.HasIpc,
+	pgm:     zmq4.HasPgm,
+	version: zmq4.Version,
+}
+
+// Returned by NewWorker when the config needs a feature the zmq library the worker is linked against lacks
+type UnsupportedFeatureError struct {
+	Feature string
+	Hint    string
+}
+
+func (e UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("The zmq library does not support %s, %s", e.Feature, e.Hint)
+}
+
+// Checks the zmq library has every feature the config uses, so a missing one is reported by NewWorker rather than
+// as an obscure error once a socket is configured. The library is only asked about features that are used.
+func (c WorkerConfig) validateFeatures() error {
+	if c.CurveServerKey != "" && !zmqFeatures.curve() {
+		return UnsupportedFeatureError{Feature: "CURVE security", Hint: "rebuild libzmq with libsodium or leave CurveServerKey unset"}
+	}
+
+	for _, address := range brokerAddresses(c.BrokerAddress) {
+		switch transportOf(address) {
+		case "ipc":
+			if !zmqFeatures.ipc() {
+				return UnsupportedFeatureError{Feature: "the ipc transport", Hint: fmt.Sprintf("use tcp for '%s' instead", address)}
+			}
+		case "pgm", "epgm":
+			if !zmqFeatures.pgm() {
+				return UnsupportedFeatureError{Feature: "the pgm transport", Hint: "rebuild libzmq with OpenPGM"}
+			}
+		}
+	}
+
+	if c.ZMTPHeartbeatInterval > 0 {
+		major, minor, patch := zmqFeatures.version()
+		if major < 4 || major == 4 && minor < 2 {
+			return UnsupportedFeatureError{
+				Feature: "ZMTP heartbeats",
+				Hint:    fmt.Sprintf("they need ZeroMQ 4.2 or later but %d.%d.%d is installed, leave ZMTPHeartbeatInterval unset", major, minor, patch),
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Stands in for a zmq library with the given features until the returned func is called
+func fakeZMQFeatures(curve, ipc, pgm bool, major, minor int) func() {
+	original := zmqFeatures
+
+	zmqFeatures.curve = func() bool { return curve }
+	zmqFeatures.ipc = func() bool { return ipc }
+	zmqFeatures.pgm = func() bool { return pgm }
+	zmqFeatures.version = func() (int, int, int) { return major, minor, 0 }
+
+	return func() { zmqFeatures = original }
+}
+
+func Test_Features_AllSupported(t *testing.T) {
+	defer fakeZMQFeatures(true, true, true, 4, 2)()
+
+	config := WorkerConfig{
+		BrokerAddress:         "tcp://localhost:5555,ipc:///tmp/broker,epgm://eth0;239.192.1.1:5555",
+		CurveServerKey:        "server-key",
+		ZMTPHeartbeatInterval: time.Second,
+	}
+
+	assert.NoError(t, config.validateFeatures())
+}
+
+func Test_Features_MissingCurveIsDescribed(t *testing.T) {
+	defer fakeZMQFeatures(false, true, true, 4, 2)()
+
+	config := WorkerConfig{BrokerAddress: "tcp://localhost:5555", CurveServerKey: "server-key"}
+
+	err := config.validateFeatures()
+	assert.IsType(t, UnsupportedFeatureError{}, err)
+	assert.EqualError(t, err, "The zmq library does not support CURVE security, rebuild libzmq with libsodium or leave CurveServerKey unset")
+}
+
+func Test_Features_MissingTransportIsDescribed(t *testing.T) {
+	defer fakeZMQFeatures(true, false, false, 4, 2)()
+
+	err := WorkerConfig{BrokerAddress: "ipc:///tmp/broker"}.validateFeatures()
+	assert.Equal(t, UnsupportedFeatureError{Feature: "the ipc transport", Hint: "use tcp for 'ipc:///tmp/broker' instead"}, err)
+
+	err = WorkerConfig{BrokerAddress: "pgm://eth0;239.192.1.1:5555"}.validateFeatures()
+	assert.Equal(t, UnsupportedFeatureError{Feature: "the pgm transport", Hint: "rebuild libzmq with OpenPGM"}, err)
+}
+
+func Test_Features_ZMTPHeartbeatsNeedZeroMQ42(t *testing.T) {
+	defer fakeZMQFeatures(true, true, true, 4, 1)()
+
+	config := WorkerConfig{BrokerAddress: "tcp://localhost:5555", ZMTPHeartbeatInterval: time.Second}
+
+	err := config.validateFeatures()
+	assert.IsType(t, UnsupportedFeatureError{}, err)
+	assert.Contains(t, err.Error(), "4.1.0 is installed")
+}
+
+func Test_Features_UnusedFeaturesNotChecked(t *testing.T) {
+	defer fakeZMQFeatures(false, false, false, 3, 2)()
+
+	assert.NoError(t, WorkerConfig{BrokerAddress: "tcp://localhost:5555"}.validateFeatures())
+}
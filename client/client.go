@@ -0,0 +1,97 @@
+// Package client sends requests to services through a majordomo broker. It lives in its own package as workers
+// don't need it.
+package client
+
+import (
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	majordomo_worker "github.com/ppeble/majordomo-worker-go"
+)
+
+// Returned by Send when no reply arrived within the client's timeout
+var ErrTimeout = errors.New("Timed out waiting for a reply")
+
+// Returned by Send when the broker's reply isn't a well formed reply from the requested service
+var ErrInvalidReply = errors.New("Received an invalid reply")
+
+// Client sends requests to a broker over a single socket, so it must only be used by one goroutine at a time. A
+// Client whose Send failed may still receive the reply it gave up on and should be closed, see Pool for clients
+// that are replaced when that happens.
+type Client struct {
+	socket  *zmq4.Socket
+	timeout time.Duration
+	broken  bool
+}
+
+// New connects a client to the broker at brokerAddress on the given context, waiting up to timeout for each reply
+func New(context *zmq4.Context, brokerAddress string, timeout time.Duration) (*Client, error) {
+	socket, err := context.NewSocket(zmq4.DEALER)
+	if err != nil {
+		return nil, err
+	}
+
+	socket.SetLinger(0)
+
+	if err := socket.Connect(brokerAddress); err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	return &Client{socket: socket, timeout: timeout}, nil
+}
+
+// Send sends a request to the service and returns the body of its reply
+func (c *Client) Send(service string, body ...[]byte) ([][]byte, error) {
+	reply, err := c.send(service, body)
+	if err != nil {
+		c.broken = true
+	}
+
+	return reply, err
+}
+
+func (c *Client) send(service string, body [][]byte) ([][]byte, error) {
+	request := [][]byte{nil, []byte(majordomo_worker.MD_CLIENT), []byte(service)}
+	request = append(request, body...)
+
+	if _, err := c.socket.SendMessage(request); err != nil {
+		return nil, err
+	}
+
+	poller := zmq4.NewPoller()
+	poller.Add(c.socket, zmq4.POLLIN)
+
+	for {
+		polled, err := poller.Poll(c.timeout)
+		if err == zmq4.Errno(syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(polled) == 0 {
+			return nil, ErrTimeout
+		}
+
+		break
+	}
+
+	reply, err := c.socket.RecvMessageBytes(0)
+	if err != nil {
+		return nil, err
+	}
+
+	// The empty delimiter, protocol and service come back ahead of the body
+	if len(reply) < 3 || string(reply[1]) != majordomo_worker.MD_CLIENT || string(reply[2]) != service {
+		return nil, ErrInvalidReply
+	}
+
+	return reply[3:], nil
+}
+
+func (c *Client) Close() error {
+	return c.socket.Close()
+}
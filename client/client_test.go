@@ -0,0 +1,195 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	majordomo_worker "github.com/ppeble/majordomo-worker-go"
+	"github.com/stretchr/testify/suite"
+)
+
+const testBrokerAddress = "inproc://test-client-broker"
+
+type ClientTestSuite struct {
+	suite.Suite
+
+	ctx *zmq4.Context
+}
+
+func (s *ClientTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Terminating the context also stops the broker
+func (s *ClientTestSuite) TearDownTest() {
+	s.ctx.Term()
+}
+
+// Runs a broker that echoes every request back as the reply, ignoring the first drop requests
+func (s *ClientTestSuite) runEchoBroker(drop int) {
+	socket, err := s.ctx.NewSocket(zmq4.ROUTER)
+	if err != nil {
+		panic(err)
+	}
+
+	socket.SetLinger(0)
+	if err := socket.Bind(testBrokerAddress); err != nil {
+		panic(err)
+	}
+
+	go func() {
+		defer socket.Close()
+
+		for {
+			msg, err := socket.RecvMessageBytes(0)
+			if err != nil {
+				return
+			}
+
+			if drop > 0 {
+				drop--
+				continue
+			}
+
+			// Client identity, empty delimiter, protocol, service and body are all sent back as they are
+			socket.SendMessage(msg)
+		}
+	}()
+}
+
+func (s *ClientTestSuite) Test_Send_ReturnsReplyBody() {
+	s.runEchoBroker(0)
+
+	c, err := New(s.ctx, testBrokerAddress, time.Second)
+	s.NoError(err)
+
+	reply, err := c.Send("echo", []byte("hello"), []byte(""), []byte("world"))
+
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("hello"), []byte(""), []byte("world")}, reply)
+	s.NoError(c.Close())
+}
+
+func (s *ClientTestSuite) Test_Send_EmptyReply() {
+	s.runEchoBroker(0)
+
+	c, err := New(s.ctx, testBrokerAddress, time.Second)
+	s.NoError(err)
+
+	// What a client gets when the worker's action returns nil
+	reply, err := c.Send("echo")
+
+	s.NoError(err)
+	s.Empty(reply)
+	s.NoError(c.Close())
+}
+
+func (s *ClientTestSuite) Test_Send_TimesOut() {
+	s.runEchoBroker(1)
+
+	c, err := New(s.ctx, testBrokerAddress, 50*time.Millisecond)
+	s.NoError(err)
+
+	_, err = c.Send("echo", []byte("hello"))
+
+	s.Equal(ErrTimeout, err)
+	s.True(c.broken)
+	s.NoError(c.Close())
+}
+
+// Counts the clients the pool connects
+func (s *ClientTestSuite) createPool(size int, timeout time.Duration) (*Pool, *int) {
+	pool := NewPool(s.ctx, testBrokerAddress, size, timeout)
+
+	var mutex sync.Mutex
+	created := new(int)
+	newClient := pool.newClient
+	pool.newClient = func() (*Client, error) {
+		mutex.Lock()
+		*created++
+		mutex.Unlock()
+		return newClient()
+	}
+
+	return pool, created
+}
+
+func (s *ClientTestSuite) Test_Pool_ConcurrentSends() {
+	s.runEchoBroker(0)
+	pool, created := s.createPool(3, time.Second)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			body := []byte(fmt.Sprintf("request-%d", i))
+			reply, err := pool.Send("echo", body)
+			if err == nil && (len(reply) != 1 || string(reply[0]) != string(body)) {
+				err = fmt.Errorf("request %d got reply %q", i, reply)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		s.NoError(err)
+	}
+	s.True(*created <= 3, "Expected no more clients than the pool size")
+	s.NoError(pool.Close())
+}
+
+func (s *ClientTestSuite) Test_Pool_ReplacesBrokenClient() {
+	s.runEchoBroker(1)
+	pool, created := s.createPool(1, 50*time.Millisecond)
+
+	_, err := pool.Send("echo", []byte("dropped"))
+	s.Equal(ErrTimeout, err)
+
+	reply, err := pool.Send("echo", []byte("hello"))
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("hello")}, reply)
+
+	s.Equal(2, *created, "Expected the broken client to be replaced")
+	s.NoError(pool.Close())
+}
+
+func (s *ClientTestSuite) Test_Send_RejectsReplyFromOtherProtocol() {
+	socket, err := s.ctx.NewSocket(zmq4.ROUTER)
+	if err != nil {
+		panic(err)
+	}
+	socket.SetLinger(0)
+	socket.Bind(testBrokerAddress)
+
+	c, err := New(s.ctx, testBrokerAddress, time.Second)
+	s.NoError(err)
+	defer c.Close()
+
+	go func() {
+		defer socket.Close()
+
+		msg, err := socket.RecvMessageBytes(0)
+		if err == nil {
+			socket.SendMessage(msg[0], "", majordomo_worker.MD_WORKER, "echo", "hello")
+		}
+	}()
+
+	_, err = c.Send("echo", []byte("hello"))
+	s.Equal(ErrInvalidReply, err)
+}
+
+func TestClientTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientTestSuite))
+}
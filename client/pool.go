@@ -0,0 +1,88 @@
+package client
+
+import (
+	"time"
+
+	"github.com/pebbe/zmq4"
+)
+
+// Pool shares up to size clients between goroutines, connecting them as they are needed. Clients whose Send failed
+// are closed when released and replaced by a fresh connection the next time one is needed.
+type Pool struct {
+	idle  chan *Client
+	slots chan struct{}
+
+	newClient func() (*Client, error)
+}
+
+// NewPool creates a pool of up to size clients connected to the broker at brokerAddress, see New
+func NewPool(context *zmq4.Context, brokerAddress string, size int, timeout time.Duration) *Pool {
+	return &Pool{
+		idle:  make(chan *Client, size),
+		slots: make(chan struct{}, size),
+		newClient: func() (*Client, error) {
+			return New(context, brokerAddress, timeout)
+		},
+	}
+}
+
+// Acquire hands out an idle client, or connects a new one if the pool isn't full yet, waiting for a client to be
+// released otherwise. The client must be given back with Release.
+func (p *Pool) Acquire() (*Client, error) {
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	select {
+	case c := <-p.idle:
+		return c, nil
+	case p.slots <- struct{}{}:
+		c, err := p.newClient()
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+
+		return c, nil
+	}
+}
+
+// Release gives a client back to the pool, closing it if its last Send failed
+func (p *Pool) Release(c *Client) {
+	if c.broken {
+		c.Close()
+		<-p.slots
+		return
+	}
+
+	p.idle <- c
+}
+
+// Send sends a request through one of the pool's clients, see Client.Send
+func (p *Pool) Send(service string, body ...[]byte) ([][]byte, error) {
+	c, err := p.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.Release(c)
+
+	return c.Send(service, body...)
+}
+
+// Close closes the pool's clients, which must all have been released. The context is left alone.
+func (p *Pool) Close() error {
+	var closeErr error
+	for {
+		select {
+		case c := <-p.idle:
+			<-p.slots
+			if err := c.Close(); err != nil && closeErr == nil {
+				closeErr = err
+			}
+		default:
+			return closeErr
+		}
+	}
+}
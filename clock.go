@@ -0,0 +1,27 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// Clock is the source of time for heartbeating, liveness and reconnect delays. It only exists so tests can
+// control time, you shouldn't need to set it otherwise.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
@@ -0,0 +1,73 @@
+package majordomo_worker
+
+import (
+	"sync"
+	"time"
+)
+
+// A manually advanced clock. Sleeping advances the clock rather than blocking so reconnect delays are instant.
+type fakeClock struct {
+	sync.Mutex
+
+	now     time.Time
+	sleeps  []time.Duration
+	waiters []fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeClockWaiter{at: c.now.Add(d), ch: ch})
+
+	return ch
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.Unlock()
+
+	c.Advance(d)
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+
+	var pending []fakeClockWaiter
+	for _, waiter := range c.waiters {
+		if waiter.at.After(c.now) {
+			pending = append(pending, waiter)
+		} else {
+			waiter.ch <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+func (c *fakeClock) sleepCount() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return len(c.sleeps)
+}
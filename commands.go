@@ -0,0 +1,42 @@
+package majordomo_worker
+
+// UnexpectedCommandAction decides what the worker does when a broker sends it a command other than MD_REQUEST,
+// MD_HEARTBEAT or MD_DISCONNECT
+type UnexpectedCommandAction int
+
+const (
+	// Log the command and carry on, this is the default
+	UnexpectedCommandIgnore UnexpectedCommandAction = iota
+	// Reconnect to the broker to register again, i.e. for MD_READY and MD_REPLY which only ever travel from worker to
+	// broker, so a broker sending them has lost track of what the worker is
+	UnexpectedCommandReconnect
+	// Shut the worker down as if Shutdown() had been called
+	UnexpectedCommandShutdown
+)
+
+// Copied so later changes to the config's map don't reach the worker
+func unexpectedCommandActions(configured map[string]UnexpectedCommandAction) map[string]UnexpectedCommandAction {
+	actions := make(map[string]UnexpectedCommandAction, len(configured))
+	for command, action := range configured {
+		actions[command] = action
+	}
+
+	return actions
+}
+
+func (w *mdWorker) handleUnexpectedCommand(workerSocket *mdWorkerSocket, command string) {
+	switch w.unexpectedCommands[command] {
+	case UnexpectedCommandReconnect:
+		logWarnf(w.logger, "Received unexpected command '%s' from broker at '%s', reconnecting", commandName(command), workerSocket.address)
+		w.stats.addError()
+		w.emit(EventDisconnected, workerSocket.address)
+		w.reconnectToBroker(workerSocket, 0)
+	case UnexpectedCommandShutdown:
+		logWarnf(w.logger, "Received unexpected command '%s' from broker at '%s', shutting down", commandName(command), workerSocket.address)
+		w.stats.addError()
+		w.Shutdown()
+	default:
+		// Do nothing, if we received something we don't recognize we'll just ignore it
+		logDebugf(w.logger, "Received unknown command '%s' from broker at '%s'", commandName(command), workerSocket.address)
+	}
+}
@@ -0,0 +1,36 @@
+package majordomo_worker
+
+// The label unknown commands are reported to CommandMetrics under, rather than one per unknown command
+const unknownCommandName = "UNKNOWN"
+
+// Commands read from the brokers by type, see WorkerStats.RequestsReceived
+type commandCounts struct {
+	requests, heartbeats, disconnects, unknown uint64
+}
+
+func (c *commandCounts) add(command string) {
+	switch command {
+	case MD_REQUEST:
+		c.requests++
+	case MD_HEARTBEAT:
+		c.heartbeats++
+	case MD_DISCONNECT:
+		c.disconnects++
+	default:
+		c.unknown++
+	}
+}
+
+// Counts a command read from a broker, "" for one that couldn't be decoded
+func (w *mdWorker) commandReceived(command string) {
+	w.stats.commandReceived(command)
+
+	if metrics, ok := w.metrics.(CommandMetrics); ok {
+		name := unknownCommandName
+		switch command {
+		case MD_REQUEST, MD_HEARTBEAT, MD_DISCONNECT:
+			name = commandName(command)
+		}
+		metrics.CommandReceived(w.metricsLabel, name)
+	}
+}
@@ -0,0 +1,64 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type commandMetrics struct {
+	noopMetrics
+	commands []string
+}
+
+func (m *commandMetrics) CommandReceived(serviceName string, command string) {
+	m.commands = append(m.commands, command)
+}
+
+func Test_CommandsReceived_CountedByType(t *testing.T) {
+	metrics := &commandMetrics{}
+	w := frameWorker(nil, nil)
+	w.metrics = metrics
+
+	// A DISCONNECT within the grace period is ignored, so it doesn't need a socket to reconnect
+	w.disconnectGracePeriod = time.Minute
+	workerSocket := &mdWorkerSocket{disconnectedAt: w.clock.Now()}
+
+	messages := [][][]byte{
+		{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)},
+		{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)},
+		// Not enough frames, but a request all the same
+		{nil, []byte(MD_WORKER), []byte(MD_REQUEST)},
+		{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)},
+		{nil, []byte(MD_WORKER), []byte("\x09")},
+		{nil, []byte(MD_WORKER), []byte("\x0a")},
+	}
+	for _, msg := range messages {
+		w.handleMessage(workerSocket, msg)
+	}
+
+	stats := w.Stats()
+	assert.Equal(t, uint64(1), stats.RequestsReceived)
+	assert.Equal(t, uint64(2), stats.HeartbeatsReceived)
+	assert.Equal(t, uint64(1), stats.DisconnectsReceived)
+	assert.Equal(t, uint64(2), stats.UnknownCommandsReceived)
+	assert.Equal(t, []string{"HEARTBEAT", "HEARTBEAT", "REQUEST", "DISCONNECT", "UNKNOWN", "UNKNOWN"}, metrics.commands)
+}
+
+func Test_CommandsReceived_UndecodableIsUnknown(t *testing.T) {
+	w := frameWorker(MDP02Frames{}, MDP02Frames{})
+
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte("MDPW02"), []byte("\x09")})
+
+	assert.Equal(t, uint64(1), w.Stats().UnknownCommandsReceived)
+}
+
+func Test_CommandsReceived_ZeroedByReset(t *testing.T) {
+	s := newWorkerStats(newFakeClock())
+	s.commandReceived(MD_HEARTBEAT)
+
+	s.reset()
+
+	assert.Equal(t, uint64(0), s.snapshot().HeartbeatsReceived)
+}
@@ -0,0 +1,21 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UnexpectedCommandActions_CopiedFromConfig(t *testing.T) {
+	configured := map[string]UnexpectedCommandAction{
+		MD_REPLY: UnexpectedCommandShutdown,
+		"\x09":   UnexpectedCommandReconnect,
+	}
+	actions := unexpectedCommandActions(configured)
+	configured[MD_READY] = UnexpectedCommandReconnect
+
+	assert.Equal(t, UnexpectedCommandIgnore, actions[MD_READY], "Expected later changes to the config to be left out")
+	assert.Equal(t, UnexpectedCommandShutdown, actions[MD_REPLY])
+	assert.Equal(t, UnexpectedCommandReconnect, actions["\x09"])
+	assert.Equal(t, UnexpectedCommandIgnore, actions["\x0a"])
+}
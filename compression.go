@@ -0,0 +1,161 @@
+package majordomo_worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+)
+
+// The first frame of a reply body once WorkerConfig.ReplyCompressionThreshold is set, saying how the frames after it
+// were encoded. With WorkerConfig.CompressionNegotiation requests may start with one too.
+const (
+	ReplyIdentity = "identity"
+	ReplyGzip     = "gzip"
+)
+
+// The READY metadata key WorkerConfig.CompressionNegotiation advertises the supported codecs under, comma separated
+const readyCodecsKey = "codecs"
+
+var supportedCodecs = ReplyGzip + "," + ReplyIdentity
+
+// How big a gzipped request's body may get once decoded if WorkerConfig.MaxDecodedRequestBytes isn't set
+const defaultMaxDecodedRequestBytes = 64 << 20
+
+func (w *mdWorker) maxDecodedRequestBytes() int {
+	if w.maxDecodedBytes <= 0 {
+		return defaultMaxDecodedRequestBytes
+	}
+
+	return w.maxDecodedBytes
+}
+
+// Strips the codec marker from the start of a negotiated request and decodes the rest, remembering the codec so the
+// reply is encoded to match. Unmarked requests are left as they are.
+func (w *mdWorker) decodeRequest(ctx *RequestContext) error {
+	if !w.negotiateCodecs || len(ctx.Request) == 0 {
+		return nil
+	}
+
+	switch string(ctx.Request[0]) {
+	case ReplyIdentity:
+		ctx.codec = ReplyIdentity
+		ctx.Request = ctx.Request[1:]
+	case ReplyGzip:
+		body, err := gunzipFrames(ctx.Request[1:], w.maxDecodedRequestBytes())
+		if err != nil {
+			return err
+		}
+		ctx.codec = ReplyGzip
+		ctx.Request = body
+	}
+
+	return nil
+}
+
+// Replies to negotiated requests are encoded with the request's codec, everything else as ReplyCompressionThreshold
+// says
+func (w *mdWorker) encodeReply(ctx RequestContext, reply [][]byte) [][]byte {
+	switch ctx.codec {
+	case ReplyIdentity:
+		return append([][]byte{[]byte(ReplyIdentity)}, reply...)
+	case ReplyGzip:
+		compressed, err := gzipFrames(reply)
+		if err != nil {
+			logErrorf(w.logger, "Compressing reply failed, sending it uncompressed, error: '%s'", err.Error())
+			return append([][]byte{[]byte(ReplyIdentity)}, reply...)
+		}
+		return append([][]byte{[]byte(ReplyGzip)}, compressed...)
+	default:
+		return w.compressReply(reply)
+	}
+}
+
+// Compresses every frame of replies whose body adds up to at least the threshold, and puts the marker frame saying
+// whether it did ahead of the body
+func (w *mdWorker) compressReply(reply [][]byte) [][]byte {
+	if w.compressMinBytes <= 0 {
+		return reply
+	}
+
+	if messageBytes(reply) < w.compressMinBytes {
+		return append([][]byte{[]byte(ReplyIdentity)}, reply...)
+	}
+
+	compressed, err := gzipFrames(reply)
+	if err != nil {
+		logErrorf(w.logger, "Compressing reply failed, sending it uncompressed, error: '%s'", err.Error())
+		return append([][]byte{[]byte(ReplyIdentity)}, reply...)
+	}
+
+	return append([][]byte{[]byte(ReplyGzip)}, compressed...)
+}
+
+func gzipFrames(frames [][]byte) ([][]byte, error) {
+	compressed := make([][]byte, len(frames))
+
+	for i, frame := range frames {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+
+		if _, err := writer.Write(frame); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		compressed[i] = buffer.Bytes()
+	}
+
+	return compressed, nil
+}
+
+// DecompressReply is for clients of workers with WorkerConfig.ReplyCompressionThreshold set. It reads the marker
+// frame at the start of a reply body and returns the body as the action returned it.
+func DecompressReply(body [][]byte) ([][]byte, error) {
+	if len(body) == 0 {
+		return nil, ErrUnknownCompression
+	}
+
+	switch string(body[0]) {
+	case ReplyIdentity:
+		return body[1:], nil
+	case ReplyGzip:
+		return gunzipFrames(body[1:], 0)
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
+
+// Decompresses every frame, giving up with ErrDecodedRequestTooLarge once they add up to more than maxBytes so a
+// small request can't decode to more than the worker can hold. No limit if maxBytes isn't positive.
+func gunzipFrames(frames [][]byte, maxBytes int) ([][]byte, error) {
+	decompressed := make([][]byte, len(frames))
+	remaining := int64(maxBytes)
+
+	for i, frame := range frames {
+		reader, err := gzip.NewReader(bytes.NewReader(frame))
+		if err != nil {
+			return nil, err
+		}
+
+		if maxBytes <= 0 {
+			if decompressed[i], err = ioutil.ReadAll(reader); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// A byte over the limit is enough to know it was exceeded
+		if decompressed[i], err = ioutil.ReadAll(io.LimitReader(reader, remaining+1)); err != nil {
+			return nil, err
+		}
+		remaining -= int64(len(decompressed[i]))
+		if remaining < 0 {
+			return nil, ErrDecodedRequestTooLarge
+		}
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,125 @@
+package majordomo_worker
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compressionWorker(threshold int) *mdWorker {
+	return &mdWorker{compressMinBytes: threshold, logger: new(testLogger)}
+}
+
+func Test_Compression_SmallReplySentAsIs(t *testing.T) {
+	reply := compressionWorker(100).compressReply([][]byte{[]byte("small"), []byte("reply")})
+
+	assert.Equal(t, [][]byte{[]byte(ReplyIdentity), []byte("small"), []byte("reply")}, reply)
+}
+
+func Test_Compression_LargeReplyCompressed(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 1000)
+	reply := compressionWorker(100).compressReply([][]byte{large, []byte("")})
+
+	if assert.Len(t, reply, 3) {
+		assert.Equal(t, []byte(ReplyGzip), reply[0])
+		assert.True(t, len(reply[1]) < len(large), "Expected the frame to be compressed")
+	}
+
+	decompressed, err := DecompressReply(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{large, []byte("")}, decompressed)
+}
+
+func Test_Compression_NoMarkerWhenDisabled(t *testing.T) {
+	reply := [][]byte{bytes.Repeat([]byte("a"), 1000)}
+
+	assert.Equal(t, reply, compressionWorker(0).compressReply(reply))
+}
+
+func Test_Compression_DecompressIdentity(t *testing.T) {
+	decompressed, err := DecompressReply([][]byte{[]byte(ReplyIdentity), []byte("reply")})
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("reply")}, decompressed)
+}
+
+func Test_Compression_DecompressRejectsUnknownMarker(t *testing.T) {
+	_, err := DecompressReply([][]byte{[]byte("reply")})
+	assert.Equal(t, ErrUnknownCompression, err)
+
+	_, err = DecompressReply(nil)
+	assert.Equal(t, ErrUnknownCompression, err)
+}
+
+func negotiatingWorker() *mdWorker {
+	return &mdWorker{negotiateCodecs: true, logger: new(testLogger)}
+}
+
+func Test_Compression_NegotiatedGzipRequestAndReply(t *testing.T) {
+	w := negotiatingWorker()
+	body, err := gzipFrames([][]byte{[]byte("hello")})
+	assert.NoError(t, err)
+
+	ctx := RequestContext{Request: append([][]byte{[]byte(ReplyGzip)}, body...)}
+	assert.NoError(t, w.decodeRequest(&ctx))
+	assert.Equal(t, [][]byte{[]byte("hello")}, ctx.Request)
+
+	reply := w.encodeReply(ctx, [][]byte{[]byte("world")})
+	assert.Equal(t, []byte(ReplyGzip), reply[0])
+
+	decompressed, err := DecompressReply(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("world")}, decompressed)
+}
+
+func Test_Compression_NegotiatedIdentity(t *testing.T) {
+	w := negotiatingWorker()
+
+	ctx := RequestContext{Request: [][]byte{[]byte(ReplyIdentity), []byte("hello")}}
+	assert.NoError(t, w.decodeRequest(&ctx))
+	assert.Equal(t, [][]byte{[]byte("hello")}, ctx.Request)
+	assert.Equal(t, [][]byte{[]byte(ReplyIdentity), []byte("world")}, w.encodeReply(ctx, [][]byte{[]byte("world")}))
+}
+
+func Test_Compression_UnmarkedRequestFallsBackToIdentity(t *testing.T) {
+	w := negotiatingWorker()
+
+	ctx := RequestContext{Request: [][]byte{[]byte("hello")}}
+	assert.NoError(t, w.decodeRequest(&ctx))
+	assert.Equal(t, [][]byte{[]byte("hello")}, ctx.Request)
+	assert.Equal(t, [][]byte{[]byte("world")}, w.encodeReply(ctx, [][]byte{[]byte("world")}), "Expected no marker on the reply")
+}
+
+func Test_Compression_UndecodableRequestRejected(t *testing.T) {
+	ctx := RequestContext{Request: [][]byte{[]byte(ReplyGzip), []byte("not gzip")}}
+
+	assert.Error(t, negotiatingWorker().decodeRequest(&ctx))
+}
+
+func Test_Compression_DecodedRequestSizeLimited(t *testing.T) {
+	w := negotiatingWorker()
+	w.maxDecodedBytes = 1000
+
+	// Compresses to a fraction of the limit but decodes to more than it, across frames
+	body, err := gzipFrames([][]byte{bytes.Repeat([]byte("a"), 600), bytes.Repeat([]byte("a"), 600)})
+	assert.NoError(t, err)
+
+	ctx := RequestContext{Request: append([][]byte{[]byte(ReplyGzip)}, body...)}
+	assert.Equal(t, ErrDecodedRequestTooLarge, w.decodeRequest(&ctx))
+
+	// Up to the limit is fine
+	body, err = gzipFrames([][]byte{bytes.Repeat([]byte("a"), 500), bytes.Repeat([]byte("a"), 500)})
+	assert.NoError(t, err)
+
+	ctx = RequestContext{Request: append([][]byte{[]byte(ReplyGzip)}, body...)}
+	assert.NoError(t, w.decodeRequest(&ctx))
+	assert.Equal(t, 64<<20, negotiatingWorker().maxDecodedRequestBytes(), "Expected 64MiB by default")
+}
+
+func Test_Compression_MarkersIgnoredWithoutNegotiation(t *testing.T) {
+	ctx := RequestContext{Request: [][]byte{[]byte(ReplyGzip), []byte("hello")}}
+
+	assert.NoError(t, compressionWorker(0).decodeRequest(&ctx))
+	assert.Equal(t, [][]byte{[]byte(ReplyGzip), []byte("hello")}, ctx.Request)
+}
@@ -0,0 +1,144 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// How long polls last at most while actions are running on their own goroutines
+const inFlightPollInterval = 5 * time.Millisecond
+
+// A request whose action ran on its own goroutine, waiting for Receive() to send the reply as sockets can only be
+// used from Receive()'s goroutine
+type completedRequest struct {
+	workerSocket *mdWorkerSocket
+	ctx          RequestContext
+	requestID    string
+	cacheable    bool
+	finishTrace  func([][]byte) [][]byte
+	duration     time.Duration
+	result       actionResult
+}
+
+func (w *mdWorker) concurrent() bool {
+	// Queued requests are waited for on their own goroutines even if only one can be queued at a time
+	return w.maxConcurrent > 1 || w.requests != nil
+}
+
+// Every slot is taken by a request whose reply hasn't been sent yet, so no more requests are read from the brokers
+func (w *mdWorker) atCapacity() bool {
+	return w.concurrent() && len(w.slots) == cap(w.slots) || w.abandonedLimitReached()
+}
+
+// Takes a slot and calls the action on its own goroutine. The slot is only given back once the reply has been sent,
+// so there are never more completed requests than the completed channel can hold.
+func (w *mdWorker) dispatch(workerSocket *mdWorkerSocket, ctx RequestContext, requestID string, cacheable bool) {
+	w.slots <- struct{}{}
+	finishTrace := w.startTrace(ctx)
+
+	go func() {
+		actionStart := w.clock.Now()
+		result := w.callAction(ctx)
+
+		w.completed <- completedRequest{
+			workerSocket: workerSocket,
+			ctx:          ctx,
+			requestID:    requestID,
+			cacheable:    cacheable,
+			finishTrace:  finishTrace,
+			duration:     w.clock.Now().Sub(actionStart),
+			result:       result,
+		}
+	}()
+}
+
+// Sends the reply to a request whose action has finished, returning the reply and true if there was one
+func (w *mdWorker) replyToCompleted() ([][]byte, bool) {
+	select {
+	case completed := <-w.completed:
+		return w.finishCompleted(completed), true
+	default:
+		return nil, false
+	}
+}
+
+func (w *mdWorker) finishCompleted(completed completedRequest) [][]byte {
+	defer func() { <-w.slots }()
+	defer w.stats.requestsDone(1)
+
+	w.metrics.ActionDuration(w.metricsLabel, completed.duration)
+	w.checkSlow(completed.ctx, completed.duration)
+	w.recordOutcome(completed.ctx, completed.result.err)
+
+	if completed.result.stream != nil {
+		w.streamReply(completed.workerSocket, completed.ctx, completed.result.stream)
+		return nil
+	}
+
+	reply := completed.result.reply
+	if completed.result.err != nil {
+		// Failures aren't cached so a retry gets another chance
+		reply = w.actionFailed(completed.result.err)
+	} else if completed.cacheable {
+		w.idempotencyCache.put(completed.requestID, reply)
+	}
+
+	if w.delaysReply(completed.result) {
+		w.scheduleReply(completed.workerSocket, completed.ctx, completed.finishTrace(reply), completed.result.delay)
+		return reply
+	}
+
+	w.sendReply(completed.workerSocket, completed.ctx, completed.finishTrace(reply))
+	w.sendRouted(completed.workerSocket, completed.ctx, completed.result)
+	return reply
+}
+
+// Waits for every action still running and sends their replies, i.e. before disconnecting from the brokers. Returns
+// false if they didn't all finish within the timeout, which is only applied if set.
+func (w *mdWorker) finishInFlight(timeout time.Duration) bool {
+	return w.finishInFlightUnless(timeout, nil)
+}
+
+// Waits like finishInFlight but also gives up as soon as stop is closed, i.e. to let shutdown take over
+func (w *mdWorker) finishInFlightUnless(timeout time.Duration, stop <-chan struct{}) bool {
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timedOut = w.clock.After(timeout)
+	}
+
+	for len(w.slots) > 0 {
+		select {
+		case completed := <-w.completed:
+			w.finishCompleted(completed)
+		case <-timedOut:
+			logWarnf(w.logger, "%d actions still running after %s, abandoning them", len(w.slots), timeout)
+			return false
+		case <-stop:
+			logDebugf(w.logger, "%d actions still running as shutdown began, leaving them to it", len(w.slots))
+			return false
+		}
+	}
+
+	return true
+}
+
+// Polls cut short because actions are running only cost a point of liveness once they add up to a full poll
+// interval, otherwise a busy worker would run its brokers' liveness down in no time
+func (w *mdWorker) pollCostsLiveness(timeout time.Duration) bool {
+	if len(w.slots) == 0 || timeout != inFlightPollInterval {
+		return true
+	}
+
+	return w.shortPollCostsLiveness(timeout)
+}
+
+// Adds up polls cut short, i.e. to send a scheduled reply on time, costing a point of liveness for every full poll
+// interval they come to
+func (w *mdWorker) shortPollCostsLiveness(timeout time.Duration) bool {
+	w.shortPolls += timeout
+	if w.shortPolls < w.pollInterval {
+		return false
+	}
+
+	w.shortPolls -= w.pollInterval
+	return true
+}
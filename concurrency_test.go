@@ -0,0 +1,88 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PollCostsLiveness_ShortPollsAddUpToOne(t *testing.T) {
+	w := &mdWorker{
+		pollInterval:  4 * inFlightPollInterval,
+		maxConcurrent: 2,
+		slots:         make(chan struct{}, 2),
+	}
+
+	assert.True(t, w.pollCostsLiveness(w.pollInterval), "Expected a full poll to cost liveness")
+
+	w.slots <- struct{}{}
+
+	costs := 0
+	for i := 0; i < 8; i++ {
+		if w.pollCostsLiveness(inFlightPollInterval) {
+			costs++
+		}
+	}
+	assert.Equal(t, 2, costs)
+
+	assert.True(t, w.pollCostsLiveness(time.Millisecond), "Expected polls cut short by a batch to cost liveness")
+}
+
+func Test_DrainAndReconnect_GivesUpAfterTimeout(t *testing.T) {
+	w := frameWorker(nil, nil)
+	clock := w.clock.(*fakeClock)
+
+	// An action that never finishes
+	w.slots = make(chan struct{}, 1)
+	w.slots <- struct{}{}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- w.drainAndReconnect(time.Minute)
+	}()
+
+	for {
+		clock.Lock()
+		waiting := len(clock.waiters)
+		clock.Unlock()
+
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+
+	select {
+	case err := <-drained:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Expected the drain to give up on the running action")
+	}
+	assert.Len(t, w.slots, 1, "Expected the action to be left running")
+}
+
+func Test_DrainAndReconnect_LeavesRunningActionsToShutdown(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.shutdown = make(chan struct{})
+
+	// An action that never finishes
+	w.slots = make(chan struct{}, 1)
+	w.slots <- struct{}{}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- w.drainAndReconnect(time.Minute)
+	}()
+
+	w.Shutdown()
+
+	select {
+	case err := <-drained:
+		assert.Equal(t, GracefulShutdown("Graceful Shutdown"), err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Expected the drain to stop waiting once shutdown began")
+	}
+	assert.Len(t, w.slots, 1, "Expected the action to be left to shutdown")
+}
@@ -0,0 +1,26 @@
+package majordomo_worker
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Returns a random (version 4) UUID identifying a connection to the brokers, see WorkerStats.ConnectionID
+func newConnectionID(clock Clock) string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// Only has to tell this worker's connections apart, which the time does well enough
+		return fmt.Sprintf("%x", clock.Now().UnixNano())
+	}
+
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// Starts a new connection ID, logged from then on and reported by Stats(). Called before connecting to the brokers
+// and before every reconnect.
+func (w *mdWorker) startConnection() {
+	w.stats.setConnectionID(newConnectionID(w.clock))
+}
@@ -0,0 +1,41 @@
+package majordomo_worker
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConnectionID_IsUUID(t *testing.T) {
+	id := newConnectionID(newFakeClock())
+
+	assert.True(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id), id)
+}
+
+func Test_ConnectionID_ChangesOnEveryConnection(t *testing.T) {
+	w := sendWorker()
+	assert.Empty(t, w.Stats().ConnectionID)
+
+	w.startConnection()
+	first := w.Stats().ConnectionID
+	w.startConnection()
+
+	assert.NotEmpty(t, first)
+	assert.NotEqual(t, first, w.Stats().ConnectionID)
+}
+
+func Test_ConnectionID_Logged(t *testing.T) {
+	logger := new(testLogger)
+	stats := newWorkerStats(newFakeClock())
+	w := workerLogger{logger, "test-worker", newAtomicLevel(LevelDebug), stats.currentConnectionID}
+
+	logDebug(w, "before")
+	stats.setConnectionID("abc")
+	logDebug(w, "after")
+
+	assert.Equal(t, []map[string]interface{}{
+		{"worker": "test-worker", "message": "before"},
+		{"worker": "test-worker", "connection": "abc", "message": "after"},
+	}, logger.debugs)
+}
@@ -0,0 +1,18 @@
+package majordomo_worker
+
+import (
+	"github.com/pebbe/zmq4"
+)
+
+// Creates a worker on a context of its own, made by newContext. Creating it can fail, i.e. when the process is out
+// of file descriptors, in which case the error is returned rather than a worker whose nil context would only fail
+// once a socket is opened on it.
+func newWorkerOwningContext(newContext func() (*zmq4.Context, error), logger Logger, config WorkerConfig) (Worker, error) {
+	context, err := newContext()
+	if err != nil {
+		logErrorf(logger, "Unable to create zmq context, error: '%s'", err.Error())
+		return nil, err
+	}
+
+	return newWorker(context, logger, config)
+}
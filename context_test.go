@@ -0,0 +1,22 @@
+package majordomo_worker
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Context_CreationFailureReturned(t *testing.T) {
+	logger := new(testLogger)
+	failing := func() (*zmq4.Context, error) {
+		return nil, syscall.EMFILE
+	}
+
+	worker, err := newWorkerOwningContext(failing, logger, WorkerConfig{ServiceName: "test-service"})
+
+	assert.Nil(t, worker)
+	assert.Equal(t, syscall.EMFILE, err)
+	assert.NotEmpty(t, logger.errors)
+}
@@ -0,0 +1,78 @@
+package majordomo_worker
+
+// How many failing request IDs are remembered at most, one is forgotten to make room for another
+const deadLetterTracked = 10000
+
+// Counts the failures of each request ID until its action succeeds. Only used from Receive()'s goroutine.
+type failureCounts struct {
+	limit  int
+	counts map[string]int
+}
+
+func newFailureCounts(limit int) *failureCounts {
+	return &failureCounts{limit: limit, counts: make(map[string]int)}
+}
+
+func (f *failureCounts) failed(requestID string) {
+	if _, found := f.counts[requestID]; !found && len(f.counts) >= f.limit {
+		for forget := range f.counts {
+			delete(f.counts, forget)
+			break
+		}
+	}
+
+	f.counts[requestID]++
+}
+
+func (f *failureCounts) succeeded(requestID string) {
+	delete(f.counts, requestID)
+}
+
+func (f *failureCounts) failures(requestID string) int {
+	return f.counts[requestID]
+}
+
+func (w *mdWorker) deadLettering() bool {
+	return w.deadLetterMaxFailures > 0
+}
+
+// Records whether the action failed for the request, to dead letter it once it has failed too often
+func (w *mdWorker) recordOutcome(ctx RequestContext, err error) {
+	if !w.deadLettering() {
+		return
+	}
+
+	requestID, found := w.requestFrameID(ctx)
+	if !found {
+		return
+	}
+
+	if err != nil {
+		w.failures.failed(requestID)
+	} else {
+		w.failures.succeeded(requestID)
+	}
+}
+
+// Hands a request whose action has failed too often to the dead letter handler instead of calling the action again,
+// answering it with the error reply. Returns true if it did.
+func (w *mdWorker) deadLetter(workerSocket *mdWorkerSocket, ctx RequestContext) bool {
+	if !w.deadLettering() {
+		return false
+	}
+
+	requestID, found := w.requestFrameID(ctx)
+	if !found || w.failures.failures(requestID) < w.deadLetterMaxFailures {
+		return false
+	}
+
+	logWarnf(w.logger, "Dead lettering request ID '%s', the action failed for it %d times", requestID, w.failures.failures(requestID))
+	w.stats.addError()
+
+	if w.deadLetterHandler != nil {
+		w.deadLetterHandler(ctx)
+	}
+
+	w.sendReply(workerSocket, ctx, w.errorReply(ErrDeadLettered))
+	return true
+}
@@ -0,0 +1,48 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DeadLetter_FailuresClearedOnSuccess(t *testing.T) {
+	w := &mdWorker{deadLetterMaxFailures: 2, failures: newFailureCounts(10)}
+	ctx := RequestContext{Request: [][]byte{[]byte("request-1")}}
+
+	w.recordOutcome(ctx, errors.New("boom"))
+	w.recordOutcome(ctx, errors.New("boom"))
+	assert.Equal(t, 2, w.failures.failures("request-1"))
+
+	w.recordOutcome(ctx, nil)
+	assert.Equal(t, 0, w.failures.failures("request-1"))
+}
+
+func Test_DeadLetter_NotTrackedWhenDisabled(t *testing.T) {
+	w := &mdWorker{failures: newFailureCounts(10)}
+
+	w.recordOutcome(RequestContext{Request: [][]byte{[]byte("request-1")}}, errors.New("boom"))
+
+	assert.Equal(t, 0, w.failures.failures("request-1"))
+}
+
+func Test_DeadLetter_RequestsWithoutIDNotTracked(t *testing.T) {
+	w := &mdWorker{deadLetterMaxFailures: 1, requestIDFrame: 1, failures: newFailureCounts(10)}
+
+	w.recordOutcome(RequestContext{Request: [][]byte{[]byte("body")}}, errors.New("boom"))
+
+	assert.Empty(t, w.failures.counts)
+}
+
+func Test_DeadLetter_TrackedIDsBounded(t *testing.T) {
+	f := newFailureCounts(2)
+
+	f.failed("request-1")
+	f.failed("request-2")
+	f.failed("request-3")
+	f.failed("request-3")
+
+	assert.Len(t, f.counts, 2)
+	assert.Equal(t, 2, f.failures("request-3"))
+}
@@ -0,0 +1,37 @@
+package majordomo_worker
+
+import (
+	"strconv"
+	"time"
+)
+
+const defaultDeadlineExceededReply = "Deadline exceeded"
+
+// Reads the request's deadline, sent by the client as Unix time in milliseconds. Requests without a valid
+// deadline frame have no deadline.
+func (w *mdWorker) requestDeadline(request [][]byte) time.Time {
+	if !w.propagateDeadline {
+		return time.Time{}
+	}
+
+	return w.unixMillisFrame(request, w.deadlineFrame, "request deadline")
+}
+
+// Reads a time sent as Unix time in milliseconds from the request body, zero if the frame is missing or invalid
+func (w *mdWorker) unixMillisFrame(request [][]byte, frame int, name string) time.Time {
+	if frame >= len(request) {
+		return time.Time{}
+	}
+
+	millis, err := strconv.ParseInt(string(request[frame]), 10, 64)
+	if err != nil {
+		logDebugf(w.logger, "Ignoring invalid %s '%s'", name, request[frame])
+		return time.Time{}
+	}
+
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+func (w *mdWorker) deadlineExceeded(ctx RequestContext) bool {
+	return !ctx.Deadline.IsZero() && !w.clock.Now().Before(ctx.Deadline)
+}
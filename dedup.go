@@ -0,0 +1,25 @@
+package majordomo_worker
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// How many replies are kept for WorkerConfig.DeduplicationWindow if DeduplicationCacheSize isn't set
+const defaultDeduplicationCacheSize = 1024
+
+// Hashes every frame of the body along with its length, so bodies only match if they have the same frames and not
+// merely the same bytes split differently. Hex encoded as it is logged in place of a request ID.
+func bodyHash(body [][]byte) string {
+	hash := sha256.New()
+	length := make([]byte, 8)
+
+	for _, frame := range body {
+		binary.BigEndian.PutUint64(length, uint64(len(frame)))
+		hash.Write(length)
+		hash.Write(frame)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
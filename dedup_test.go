@@ -0,0 +1,28 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BodyHash_SameForIdenticalBodies(t *testing.T) {
+	assert.Equal(t, bodyHash([][]byte{[]byte("a"), []byte("b")}), bodyHash([][]byte{[]byte("a"), []byte("b")}))
+}
+
+func Test_BodyHash_FrameBoundariesMatter(t *testing.T) {
+	assert.NotEqual(t, bodyHash([][]byte{[]byte("ab")}), bodyHash([][]byte{[]byte("a"), []byte("b")}))
+	assert.NotEqual(t, bodyHash([][]byte{[]byte("a")}), bodyHash([][]byte{[]byte("a"), nil}))
+}
+
+func Test_Deduplication_RejectedWithIdempotencyCache(t *testing.T) {
+	config := WorkerConfig{
+		BrokerAddress:        "inproc://test",
+		ServiceName:          "test-service",
+		DeduplicationWindow:  time.Minute,
+		IdempotencyCacheSize: 10,
+	}
+
+	assert.Equal(t, ErrDeduplicationWithIdempotency, config.validate())
+}
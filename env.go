@@ -0,0 +1,104 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	EnvBrokerAddress      = "MDP_BROKER"
+	EnvServiceName        = "MDP_SERVICE"
+	EnvServiceNamePrefix  = "MDP_SERVICE_PREFIX"
+	EnvHeartbeatMillis    = "MDP_HEARTBEAT_MS"
+	EnvReconnectMillis    = "MDP_RECONNECT_MS"
+	EnvPollMillis         = "MDP_POLL_MS"
+	EnvMaxLiveness        = "MDP_MAX_LIVENESS"
+	EnvConnectRetries     = "MDP_CONNECT_RETRIES"
+	EnvConnectRetryMillis = "MDP_CONNECT_RETRY_MS"
+)
+
+// Returned by ConfigFromEnv when an environment variable can't be used
+type EnvError struct {
+	Variable, Value, Reason string
+}
+
+func (e EnvError) Error() string {
+	return fmt.Sprintf("Environment variable %s='%s' %s", e.Variable, e.Value, e.Reason)
+}
+
+// ConfigFromEnv returns base with the fields that are set in the environment replaced, so settings can be changed
+// per deployment. Variables that aren't set leave the field in base alone. Times are in milliseconds.
+func ConfigFromEnv(base WorkerConfig) (WorkerConfig, error) {
+	return configFromEnv(base, os.LookupEnv)
+}
+
+func configFromEnv(config WorkerConfig, lookup func(string) (string, bool)) (WorkerConfig, error) {
+	if value, ok := lookup(EnvBrokerAddress); ok {
+		config.BrokerAddress = value
+	}
+
+	if value, ok := lookup(EnvServiceName); ok {
+		config.ServiceName = value
+	}
+
+	if value, ok := lookup(EnvServiceNamePrefix); ok {
+		config.ServiceNamePrefix = value
+	}
+
+	durations := []struct {
+		variable string
+		field    *time.Duration
+	}{
+		{EnvHeartbeatMillis, &config.HeartbeatInMillis},
+		{EnvReconnectMillis, &config.ReconnectInMillis},
+		{EnvPollMillis, &config.PollingInterval},
+		{EnvConnectRetryMillis, &config.ConnectRetryDelay},
+	}
+
+	for _, d := range durations {
+		millis, found, err := envInt(lookup, d.variable, 1)
+		if err != nil {
+			return config, err
+		}
+		if found {
+			*d.field = time.Duration(millis) * time.Millisecond
+		}
+	}
+
+	if liveness, found, err := envInt(lookup, EnvMaxLiveness, 1); err != nil {
+		return config, err
+	} else if found {
+		config.MaxHeartbeatLiveness = liveness
+	}
+
+	// Negative retries disable them, see WorkerConfig.ConnectRetries
+	if retries, found, err := envInt(lookup, EnvConnectRetries, -1); err != nil {
+		return config, err
+	} else if found {
+		config.ConnectRetries = retries
+	}
+
+	return config, nil
+}
+
+// Reads an integer that must be at least min, returning whether the variable was set
+func envInt(lookup func(string) (string, bool), variable string, min int) (int, bool, error) {
+	value, ok := lookup(variable)
+	if !ok {
+		return 0, false, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, true, EnvError{Variable: variable, Value: value, Reason: "is not a whole number"}
+	}
+
+	if n < min {
+		return 0, true, EnvError{Variable: variable, Value: value, Reason: fmt.Sprintf("must be at least %d", min)}
+	}
+
+	return n, true, nil
+}
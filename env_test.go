@@ -0,0 +1,70 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(variable string) (string, bool) {
+		value, ok := env[variable]
+		return value, ok
+	}
+}
+
+func baseConfig() WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:        "tcp://localhost:5555",
+		ServiceName:          "echo",
+		HeartbeatInMillis:    2500 * time.Millisecond,
+		ReconnectInMillis:    2500 * time.Millisecond,
+		PollingInterval:      500 * time.Millisecond,
+		MaxHeartbeatLiveness: 50,
+	}
+}
+
+func Test_Env_OverridesBaseConfig(t *testing.T) {
+	config, err := configFromEnv(baseConfig(), envLookup(map[string]string{
+		EnvBrokerAddress:      "tcp://broker:5555",
+		EnvServiceName:        "upper",
+		EnvServiceNamePrefix:  "teamA/",
+		EnvHeartbeatMillis:    "1000",
+		EnvReconnectMillis:    "2000",
+		EnvPollMillis:         "100",
+		EnvMaxLiveness:        "5",
+		EnvConnectRetries:     "-1",
+		EnvConnectRetryMillis: "300",
+	}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://broker:5555", config.BrokerAddress)
+	assert.Equal(t, "upper", config.ServiceName)
+	assert.Equal(t, "teamA/", config.ServiceNamePrefix)
+	assert.Equal(t, 1000*time.Millisecond, config.HeartbeatInMillis)
+	assert.Equal(t, 2000*time.Millisecond, config.ReconnectInMillis)
+	assert.Equal(t, 100*time.Millisecond, config.PollingInterval)
+	assert.Equal(t, 5, config.MaxHeartbeatLiveness)
+	assert.Equal(t, -1, config.ConnectRetries)
+	assert.Equal(t, 300*time.Millisecond, config.ConnectRetryDelay)
+}
+
+func Test_Env_MissingVariablesLeaveBaseAlone(t *testing.T) {
+	config, err := configFromEnv(baseConfig(), envLookup(map[string]string{}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, baseConfig(), config)
+}
+
+func Test_Env_MalformedValueIsRejected(t *testing.T) {
+	_, err := configFromEnv(baseConfig(), envLookup(map[string]string{EnvHeartbeatMillis: "2.5s"}))
+
+	assert.Equal(t, EnvError{Variable: EnvHeartbeatMillis, Value: "2.5s", Reason: "is not a whole number"}, err)
+}
+
+func Test_Env_OutOfRangeValueIsRejected(t *testing.T) {
+	_, err := configFromEnv(baseConfig(), envLookup(map[string]string{EnvMaxLiveness: "0"}))
+
+	assert.EqualError(t, err, "Environment variable MDP_MAX_LIVENESS='0' must be at least 1")
+}
@@ -0,0 +1,43 @@
+package majordomo_worker
+
+// EnvelopeLayout gives the position of each frame in the messages brokers send the worker, for brokers that don't
+// frame them the standard way. Everything from Body on is the request body.
+type EnvelopeLayout struct {
+	Protocol, Command, ReplyTo, Body int
+}
+
+// StandardEnvelopeLayout is MDP's: the empty delimiter, protocol, command, client address, another empty delimiter
+// and then the body
+var StandardEnvelopeLayout = EnvelopeLayout{Protocol: 1, Command: 2, ReplyTo: 3, Body: 5}
+
+// The zero value stands for the standard layout so it needn't be set
+func (l EnvelopeLayout) orStandard() EnvelopeLayout {
+	if l == (EnvelopeLayout{}) {
+		return StandardEnvelopeLayout
+	}
+
+	return l
+}
+
+func (l EnvelopeLayout) valid() bool {
+	if l.Protocol < 0 || l.Command < 0 || l.ReplyTo < 0 || l.Protocol == l.Command {
+		return false
+	}
+
+	// The body runs to the end of the message, so every other frame comes before it
+	return l.Protocol < l.Body && l.Command < l.Body && l.ReplyTo < l.Body
+}
+
+// Every message needs at least the protocol and command frames
+func (l EnvelopeLayout) minFrames() int {
+	if l.Protocol > l.Command {
+		return l.Protocol + 1
+	}
+
+	return l.Command + 1
+}
+
+// Requests need everything up to the body, which may be empty
+func (l EnvelopeLayout) minRequestFrames() int {
+	return l.Body
+}
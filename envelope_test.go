@@ -0,0 +1,61 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Brokers that leave out the empty delimiter frames
+var reducedEnvelopeLayout = EnvelopeLayout{Protocol: 0, Command: 1, ReplyTo: 2, Body: 3}
+
+func Test_Envelope_ZeroValueIsStandard(t *testing.T) {
+	assert.Equal(t, StandardEnvelopeLayout, EnvelopeLayout{}.orStandard())
+	assert.Equal(t, reducedEnvelopeLayout, reducedEnvelopeLayout.orStandard())
+}
+
+func Test_Envelope_Valid(t *testing.T) {
+	assert.True(t, StandardEnvelopeLayout.valid())
+	assert.True(t, reducedEnvelopeLayout.valid())
+
+	assert.False(t, EnvelopeLayout{Protocol: -1, Command: 1, ReplyTo: 2, Body: 3}.valid())
+	assert.False(t, EnvelopeLayout{Protocol: 1, Command: 1, ReplyTo: 2, Body: 3}.valid())
+	assert.False(t, EnvelopeLayout{Protocol: 0, Command: 1, ReplyTo: 3, Body: 3}.valid())
+	assert.False(t, EnvelopeLayout{Protocol: 0, Command: 4, ReplyTo: 2, Body: 3}.valid())
+}
+
+func Test_Envelope_MinFrames(t *testing.T) {
+	assert.Equal(t, 3, StandardEnvelopeLayout.minFrames())
+	assert.Equal(t, 5, StandardEnvelopeLayout.minRequestFrames())
+	assert.Equal(t, 2, reducedEnvelopeLayout.minFrames())
+	assert.Equal(t, 3, reducedEnvelopeLayout.minRequestFrames())
+	assert.Equal(t, 3, EnvelopeLayout{Protocol: 2, Command: 0, ReplyTo: 1, Body: 3}.minFrames())
+}
+
+func Test_Envelope_InvalidLayoutRejected(t *testing.T) {
+	config := WorkerConfig{
+		BrokerAddress:  "inproc://test",
+		ServiceName:    "test-service",
+		EnvelopeLayout: EnvelopeLayout{Protocol: 0, Command: 0, ReplyTo: 1, Body: 2},
+	}
+
+	assert.Equal(t, ErrInvalidEnvelopeLayout, config.validate())
+}
+
+func Test_Envelope_ShortRequestDropped(t *testing.T) {
+	clock := newFakeClock()
+	w := &mdWorker{
+		envelope: StandardEnvelopeLayout,
+		stats:    newWorkerStats(clock),
+		clock:    clock,
+		logger:   new(testLogger),
+	}
+
+	// No client address or body
+	reply, handled := w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST)})
+
+	assert.Nil(t, reply)
+	assert.False(t, handled)
+	assert.Equal(t, uint64(1), w.Stats().Errors)
+	assert.Equal(t, uint64(0), w.Stats().Requests)
+}
@@ -1,5 +1,113 @@
 package majordomo_worker
 
+import (
+	"errors"
+	"fmt"
+)
+
+// Returned by NewWorker when a broker address still can't be connected to after all connect retries, or MD_READY
+// can't be sent to it
+var ErrBrokerUnreachable = errors.New("Unable to connect to broker")
+
+// Returned by NewWorker when a broker didn't send anything within the connect confirmation timeout after MD_READY
+var ErrBrokerUnconfirmed = errors.New("Broker did not confirm the connection")
+
+// Returned by NewWorker when the configured service name can't be registered with a broker
+var (
+	ErrEmptyServiceName   = errors.New("Service name must not be empty")
+	ErrServiceNameTooLong = errors.New("Service name exceeds the maximum length")
+)
+
+// Returned by NewWorker when WorkerConfig.ServiceAliases repeats a service name the worker already registers as
+var ErrDuplicateServiceAlias = errors.New("Service alias must not repeat another service name")
+
+// Returned by NewWorker when WorkerConfig.ServiceAliases is set along with Identity, IdentityFunc or Bind
+var ErrServiceAliasesConflict = errors.New("ServiceAliases must not be set along with Identity, IdentityFunc or Bind")
+
+// Returned by NewWorker when WorkerConfig.StartupProbe still fails after WorkerConfig.StartupProbeTimeout
+var ErrStartupProbeTimeout = errors.New("Startup probe did not pass in time")
+
+// Returned by NewWorker when batching is configured but the action can't handle batches
+var ErrBatchingUnsupported = errors.New("Batching requires an action implementing BatchWorkerAction")
+
+// Returned by NewWorker when both an action and a request queue are configured, only one can handle requests
+var ErrActionWithRequestQueue = errors.New("Action must not be set along with RequestQueue")
+
+// Returned by NewWorker when both WorkerConfig.DeduplicationWindow and IdempotencyCacheSize are set
+var ErrDeduplicationWithIdempotency = errors.New("DeduplicationWindow must not be set along with IdempotencyCacheSize")
+
+// Returned by NewWorker when WorkerConfig.Weight is negative
+var ErrInvalidWeight = errors.New("Weight must not be negative")
+
+// Returned by NewWorker when WorkerConfig.LogSampleRate is negative
+var ErrInvalidLogSampleRate = errors.New("Log sample rate must not be negative")
+
+// Returned by NewWorker when WorkerConfig.SocketLinger is negative, which would wait forever on closing
+var ErrInvalidSocketLinger = errors.New("Socket linger must not be negative")
+
+// Returned by NewWorker when WorkerConfig.MaxReplyFrames is negative
+var ErrInvalidMaxReplyFrames = errors.New("Max reply frames must not be negative")
+
+// Returned by NewWorker when WorkerConfig.EnvelopeLayout has negative or clashing frames, or frames after the body
+var ErrInvalidEnvelopeLayout = errors.New("Envelope layout is invalid")
+
+// Returned by NewWorker when the heartbeat, polling and liveness settings can't work together, see WorkerConfig
+var (
+	ErrInvalidPollingInterval = errors.New("Polling interval must be positive")
+	ErrInvalidHeartbeat       = errors.New("Heartbeat interval must be positive unless heartbeats are disabled")
+	ErrPollingIntervalTooLong = errors.New("Polling interval must not be longer than the heartbeat interval")
+	ErrInvalidLiveness        = errors.New("Max heartbeat liveness must be at least 1 unless heartbeats are disabled")
+)
+
+// Passed to WorkerConfig.ErrorReply for requests dead lettered after WorkerConfig.DeadLetterMaxFailures failures
+var ErrDeadLettered = errors.New("Request failed too many times")
+
+// Passed to WorkerConfig.ErrorReply for replies over WorkerConfig.MaxReplyFrames with ReplyFramesReject
+var ErrTooManyReplyFrames = errors.New("Reply has too many frames")
+
+// Returned by DecompressReply when a reply body doesn't start with a known compression marker
+var ErrUnknownCompression = errors.New("Reply has no known compression marker")
+
+// Passed to WorkerConfig.ErrorReply for gzipped requests that decode to more than WorkerConfig.MaxDecodedRequestBytes
+var ErrDecodedRequestTooLarge = errors.New("Decoded request is too large")
+
+// Returned by SplitReplyMetadata when a reply doesn't start with 'key=value' frames followed by an empty frame
+var ErrNoReplyMetadata = errors.New("Reply has no metadata")
+
+// Returned by Close when the zmq context didn't terminate within WorkerConfig.TermTimeout
+var ErrTermTimeout = errors.New("Timed out terminating the context")
+
+// Returned by DrainAndReconnect when Receive() didn't finish draining in time
+var ErrDrainTimeout = errors.New("Timed out draining the worker")
+
+// Returned by JSONAction when given anything but a func(T) (R, error)
+var ErrInvalidJSONAction = errors.New("JSON action must be a func(T) (R, error)")
+
+// Passed to WorkerConfig.ErrorReply for requests a JSONAction can't unmarshal
+type JSONRequestError struct {
+	Err error
+}
+
+func (e JSONRequestError) Error() string {
+	return fmt.Sprintf("Invalid JSON request: %s", e.Err.Error())
+}
+
+// Passed to WorkerConfig.ErrorReply when the action runs longer than WorkerConfig.ActionTimeout
+var ErrActionTimeout = errors.New("Action timed out")
+
+// The error for an action that panicked with WorkerConfig.RecoverPanics set. It is logged, stack included, and the
+// request answered with WorkerConfig.PanicReply.
+type ActionPanic struct {
+	Value interface{}
+
+	// Stack is where the action panicked, it is logged but never sent to clients
+	Stack string
+}
+
+func (e ActionPanic) Error() string {
+	return fmt.Sprintf("Action panicked: %v", e.Value)
+}
+
 type GracefulShutdown string
 
 func (e GracefulShutdown) Error() string {
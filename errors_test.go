@@ -2,6 +2,7 @@ package majordomo_worker
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,3 +22,9 @@ func Test_GracefulShutdown_ReturnsString(t *testing.T) {
 	e := GracefulShutdown("")
 	assert.Equal(t, "Shutdown signal detected, exiting ...", e.Error())
 }
+
+func Test_SocketLinger_NegativeRejected(t *testing.T) {
+	config := WorkerConfig{BrokerAddress: "inproc://test", ServiceName: "test-service", SocketLinger: -time.Second}
+
+	assert.Equal(t, ErrInvalidSocketLinger, config.validate())
+}
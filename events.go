@@ -0,0 +1,76 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+const defaultEventBuffer = 100
+
+type WorkerEventType int
+
+const (
+	EventConnected WorkerEventType = iota
+	EventDisconnected
+	EventReconnecting
+	EventRequestReceived
+	EventReplySent
+	EventShuttingDown
+	// EventShutDown is the last event, once the worker has shut down. Its Summary says what was left undone.
+	EventShutDown
+	// The socket events are only emitted with WorkerConfig.SocketMonitoring, straight from ZeroMQ. They follow the
+	// TCP connection, so can disagree with the MDP level Connected and Disconnected for a while.
+	EventSocketConnected
+	EventSocketDisconnected
+	EventSocketConnectRetried
+)
+
+func (t WorkerEventType) String() string {
+	switch t {
+	case EventConnected:
+		return "Connected"
+	case EventDisconnected:
+		return "Disconnected"
+	case EventReconnecting:
+		return "Reconnecting"
+	case EventRequestReceived:
+		return "RequestReceived"
+	case EventReplySent:
+		return "ReplySent"
+	case EventShuttingDown:
+		return "ShuttingDown"
+	case EventShutDown:
+		return "ShutDown"
+	case EventSocketConnected:
+		return "SocketConnected"
+	case EventSocketDisconnected:
+		return "SocketDisconnected"
+	case EventSocketConnectRetried:
+		return "SocketConnectRetried"
+	default:
+		return "Unknown"
+	}
+}
+
+// WorkerEvent describes a single worker state transition. Address is the broker
+// address the event relates to and is empty for events that aren't tied to a
+// single broker connection (i.e. ShuttingDown).
+type WorkerEvent struct {
+	Type    WorkerEventType
+	Address string
+	Time    time.Time
+
+	// Summary is only set for EventShutDown
+	Summary ShutdownSummary
+}
+
+// Events are dropped rather than blocking if nobody is reading them, we never
+// want a slow consumer to stall Receive()
+func (w *mdWorker) emit(eventType WorkerEventType, address string) {
+	event := WorkerEvent{Type: eventType, Address: address, Time: w.clock.Now()}
+
+	select {
+	case w.events <- event:
+	default:
+		logDebugf(w.logger, "Event buffer full, dropping event '%s'", eventType)
+	}
+}
@@ -0,0 +1,39 @@
+package majordomo_worker
+
+import (
+	"github.com/pebbe/zmq4"
+)
+
+// WorkerFactory creates similarly configured workers, i.e. for a supervisor managing the lifecycles of many of them
+type WorkerFactory interface {
+	Create(serviceName string, action WorkerAction) (Worker, error)
+}
+
+type configWorkerFactory struct {
+	context *zmq4.Context
+	logger  Logger
+	config  WorkerConfig
+}
+
+// NewWorkerFactory returns a WorkerFactory creating workers from config, with its ServiceName and Action replaced by
+// those passed to Create, on the given context. The context is shared by the workers so none of them terminates it,
+// do so once they have all been closed.
+func NewWorkerFactory(context *zmq4.Context, logger Logger, config WorkerConfig) WorkerFactory {
+	return configWorkerFactory{context: context, logger: logger, config: config}
+}
+
+func (f configWorkerFactory) Create(serviceName string, action WorkerAction) (Worker, error) {
+	config := f.config
+	config.ServiceName = serviceName
+	config.Action = action
+
+	w, err := newWorker(f.context, f.logger, config)
+	if err != nil {
+		// Only its sockets, the context is shared with the factory's other workers
+		w.closeSockets()
+		return nil, err
+	}
+	w.sharedContext = true
+
+	return w, nil
+}
@@ -0,0 +1,131 @@
+package majordomo_worker
+
+import (
+	"fmt"
+)
+
+// FrameEncoder serializes the protocol header and command frames of the messages sent to brokers, for bridging to
+// brokers that don't use MDP's byte constants, i.e. expect JSON or length prefixed frames. The protocol is always
+// MD_WORKER and commands are the MD_* constants.
+type FrameEncoder interface {
+	EncodeProtocol(protocol string) []byte
+	EncodeCommand(command string) []byte
+}
+
+// FrameDecoder parses the protocol header and command frames of the messages received from brokers back into
+// MD_WORKER and the MD_* constants. Messages it returns an error for are dropped.
+type FrameDecoder interface {
+	DecodeProtocol(frame []byte) (string, error)
+	DecodeCommand(frame []byte) (string, error)
+}
+
+// MDPFrames encodes and decodes frames as the standard MDP byte constants, the default for both
+type MDPFrames struct{}
+
+func (MDPFrames) EncodeProtocol(protocol string) []byte {
+	return []byte(protocol)
+}
+
+func (MDPFrames) EncodeCommand(command string) []byte {
+	return []byte(command)
+}
+
+func (MDPFrames) DecodeProtocol(frame []byte) (string, error) {
+	return string(frame), nil
+}
+
+func (MDPFrames) DecodeCommand(frame []byte) (string, error) {
+	return string(frame), nil
+}
+
+// The MDP/0.2 protocol header and command frames
+const (
+	mdp02Worker = "MDPW02"
+
+	mdp02Ready      = "\x01"
+	mdp02Request    = "\x02"
+	mdp02Partial    = "\x03"
+	mdp02Final      = "\x04"
+	mdp02Heartbeat  = "\x05"
+	mdp02Disconnect = "\x06"
+)
+
+var mdp02Commands = map[string]string{
+	MD_READY:      mdp02Ready,
+	MD_REQUEST:    mdp02Request,
+	MD_PARTIAL:    mdp02Partial,
+	MD_REPLY:      mdp02Final,
+	MD_HEARTBEAT:  mdp02Heartbeat,
+	MD_DISCONNECT: mdp02Disconnect,
+}
+
+// MDP02Frames encodes and decodes frames as MDP/0.2, for brokers speaking that version. It has partial replies, so
+// the replies of StreamWorkerActions are streamed with it: MD_PARTIAL is sent as PARTIAL and MD_REPLY as FINAL.
+type MDP02Frames struct{}
+
+func (MDP02Frames) EncodeProtocol(protocol string) []byte {
+	if protocol == MD_WORKER {
+		return []byte(mdp02Worker)
+	}
+
+	return []byte(protocol)
+}
+
+func (MDP02Frames) EncodeCommand(command string) []byte {
+	if frame, found := mdp02Commands[command]; found {
+		return []byte(frame)
+	}
+
+	return []byte(command)
+}
+
+func (MDP02Frames) DecodeProtocol(frame []byte) (string, error) {
+	if string(frame) == mdp02Worker {
+		return MD_WORKER, nil
+	}
+
+	// Anything else is reported as a protocol mismatch
+	return string(frame), nil
+}
+
+func (MDP02Frames) DecodeCommand(frame []byte) (string, error) {
+	for command, encoded := range mdp02Commands {
+		if string(frame) == encoded {
+			return command, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown MDP/0.2 command 0x%x", frame)
+}
+
+func (MDP02Frames) PartialReplies() bool {
+	return true
+}
+
+// PartialReplyEncoder is implemented by FrameEncoders for protocols with partial replies, such as MDP02Frames. The
+// replies of StreamWorkerActions are streamed as MD_PARTIAL chunks with them, rather than sent as a single MD_REPLY.
+type PartialReplyEncoder interface {
+	PartialReplies() bool
+}
+
+func (w *mdWorker) partialReplies() bool {
+	encoder, ok := w.frameEncoder().(PartialReplyEncoder)
+	return ok && encoder.PartialReplies()
+}
+
+// Nil stands for the standard frames so workers built without a config needn't set them
+func (w *mdWorker) frameEncoder() FrameEncoder {
+	if w.encoder == nil {
+		return MDPFrames{}
+	}
+
+	return w.encoder
+}
+
+func (w *mdWorker) frameDecoder() FrameDecoder {
+	if w.decoder == nil {
+		return MDPFrames{}
+	}
+
+	return w.decoder
+}
@@ -0,0 +1,112 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Sends commands by name, i.e. 'READY', for brokers that want readable frames
+type namedFrames struct{}
+
+func (namedFrames) EncodeProtocol(protocol string) []byte {
+	return []byte("worker:" + protocol)
+}
+
+func (namedFrames) EncodeCommand(command string) []byte {
+	return []byte(commandName(command))
+}
+
+func (namedFrames) DecodeProtocol(frame []byte) (string, error) {
+	if string(frame) != "worker:"+MD_WORKER {
+		return "", errors.New("unknown protocol")
+	}
+	return MD_WORKER, nil
+}
+
+func (namedFrames) DecodeCommand(frame []byte) (string, error) {
+	for command, name := range commandNames {
+		if name == string(frame) {
+			return command, nil
+		}
+	}
+	return "", errors.New("unknown command")
+}
+
+func frameWorker(encoder FrameEncoder, decoder FrameDecoder) *mdWorker {
+	clock := newFakeClock()
+	return &mdWorker{
+		envelope: StandardEnvelopeLayout,
+		encoder:  encoder,
+		decoder:  decoder,
+		stats:    newWorkerStats(clock),
+		clock:    clock,
+		logger:   new(testLogger),
+	}
+}
+
+func Test_Frames_DefaultIsMDP(t *testing.T) {
+	w := frameWorker(nil, nil)
+
+	message := w.brokerMessage(MD_READY, []byte("echo"), nil)
+
+	assert.Equal(t, [][]byte{[]byte(""), []byte(MD_WORKER), []byte(MD_READY), []byte("echo")}, message)
+
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+	assert.Equal(t, uint64(0), w.Stats().Errors)
+}
+
+func Test_Frames_CustomEncoder(t *testing.T) {
+	w := frameWorker(namedFrames{}, namedFrames{})
+
+	message := w.brokerMessage(MD_READY, []byte("echo"), nil)
+
+	assert.Equal(t, [][]byte{[]byte(""), []byte("worker:MDPW01"), []byte("READY"), []byte("echo")}, message)
+}
+
+func Test_Frames_CustomDecoder(t *testing.T) {
+	w := frameWorker(namedFrames{}, namedFrames{})
+
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte("worker:MDPW01"), []byte("HEARTBEAT")})
+	assert.Equal(t, uint64(0), w.Stats().Errors)
+	assert.False(t, w.Stats().LastBrokerHeartbeat.IsZero(), "Expected the named heartbeat to be understood")
+
+	// The raw constants mean nothing to this decoder
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+	assert.Equal(t, uint64(1), w.Stats().Errors)
+
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte("worker:MDPW01"), []byte(MD_HEARTBEAT)})
+	assert.Equal(t, uint64(2), w.Stats().Errors)
+	assert.NotEmpty(t, w.logger.(*testLogger).errors)
+}
+
+func Test_Frames_EmptyServiceNameKeepsItsFrame(t *testing.T) {
+	w := frameWorker(nil, nil)
+
+	message := w.brokerMessage(MD_READY, []byte(""), [][]byte{[]byte("zone=a")})
+	assert.Equal(t, [][]byte{[]byte(""), []byte(MD_WORKER), []byte(MD_READY), []byte(""), []byte("zone=a")}, message)
+
+	message = w.brokerMessage(MD_HEARTBEAT, nil, nil)
+	assert.Equal(t, [][]byte{[]byte(""), []byte(MD_WORKER), []byte(MD_HEARTBEAT)}, message)
+}
+
+func Test_Frames_MDP02(t *testing.T) {
+	w := frameWorker(MDP02Frames{}, MDP02Frames{})
+
+	assert.Equal(t, [][]byte{[]byte(""), []byte("MDPW02"), []byte("\x04"), []byte("client")}, w.brokerMessage(MD_REPLY, []byte("client"), nil))
+	assert.Equal(t, [][]byte{[]byte(""), []byte("MDPW02"), []byte("\x03"), []byte("client")}, w.brokerMessage(MD_PARTIAL, []byte("client"), nil))
+	assert.True(t, w.partialReplies())
+
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte("MDPW02"), []byte("\x05")})
+	assert.Equal(t, uint64(0), w.Stats().Errors)
+	assert.False(t, w.Stats().LastBrokerHeartbeat.IsZero(), "Expected the MDP/0.2 heartbeat to be understood")
+
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte("MDPW02"), []byte("\x09")})
+	assert.Equal(t, uint64(1), w.Stats().Errors)
+}
+
+func Test_Frames_NoPartialRepliesByDefault(t *testing.T) {
+	assert.False(t, frameWorker(nil, nil).partialReplies())
+	assert.False(t, frameWorker(namedFrames{}, namedFrames{}).partialReplies())
+}
@@ -0,0 +1,142 @@
+package majordomo_worker
+
+import (
+	"strconv"
+	"time"
+)
+
+// Schedules the next heartbeat one interval from now, brought forward by a random amount of up to the jitter so
+// workers started together drift apart. Heartbeats are only ever early, never late, and the jitter is capped at
+// half the interval.
+func (w *mdWorker) nextHeartbeatAt() time.Time {
+	interval := w.heartbeat
+
+	jitter := w.heartbeatJitter
+	if jitter > w.heartbeat/2 {
+		jitter = w.heartbeat / 2
+	}
+
+	if jitter > 0 {
+		interval -= time.Duration(w.jitterSource.Int63n(int64(jitter) + 1))
+	}
+
+	return w.clock.Now().Add(interval)
+}
+
+// Sends a heartbeat to every broker whose heartbeat is due. Heartbeats are only ever sent from Receive()'s goroutine,
+// between polls, so shutting down has no heartbeat goroutine to stop: once Receive() has closed the sockets nothing
+// sends on them again.
+func (w *mdWorker) sendHeartbeats() {
+	if w.heartbeatsDisabled || w.manualLiveness {
+		return
+	}
+
+	for _, workerSocket := range w.sockets {
+		if workerSocket.heartbeatAt.Before(w.clock.Now()) && !workerSocket.pausedDisconnected {
+			if err := w.sendOrReconnect(workerSocket, MD_HEARTBEAT, nil, nil); err == nil {
+				w.heartbeatSent(workerSocket)
+			}
+			workerSocket.heartbeatAt = w.nextHeartbeatAt()
+		}
+	}
+}
+
+func (w *mdWorker) SendHeartbeat() error {
+	result := make(chan error, 1)
+
+	select {
+	case w.heartbeatNow <- result:
+		return <-result
+	case <-w.shutdown:
+		return GracefulShutdown("Graceful Shutdown")
+	}
+}
+
+// Sends a heartbeat to every broker whether or not it is due, returning the first send error
+func (w *mdWorker) sendHeartbeatsNow() error {
+	if w.heartbeatsDisabled {
+		return nil
+	}
+
+	var firstErr error
+	for _, workerSocket := range w.sockets {
+		if workerSocket.pausedDisconnected {
+			continue
+		}
+
+		logDebugf(w.logger, "Sending out-of-band heartbeat to broker at '%s'", workerSocket.address)
+		err := w.sendOrReconnect(workerSocket, MD_HEARTBEAT, nil, nil)
+		if err == nil {
+			w.heartbeatSent(workerSocket)
+		} else if firstErr == nil {
+			firstErr = err
+		}
+		workerSocket.heartbeatAt = w.nextHeartbeatAt()
+	}
+
+	return firstErr
+}
+
+// Brokers that advertise a heartbeat interval do so as a frame holding the interval in milliseconds after the
+// MD_HEARTBEAT command. The interval is clamped to the configured bounds and applies to every broker.
+func (w *mdWorker) negotiateHeartbeat(frame []byte) {
+	millis, err := strconv.Atoi(string(frame))
+	if err != nil || millis <= 0 {
+		logDebugf(w.logger, "Ignoring invalid heartbeat interval '%s' advertised by broker", frame)
+		return
+	}
+
+	heartbeat := time.Duration(millis) * time.Millisecond
+
+	if w.minHeartbeat > 0 && heartbeat < w.minHeartbeat {
+		heartbeat = w.minHeartbeat
+	}
+
+	if w.maxHeartbeat > 0 && heartbeat > w.maxHeartbeat {
+		heartbeat = w.maxHeartbeat
+	}
+
+	if heartbeat == w.heartbeat {
+		return
+	}
+
+	logDebugf(w.logger, "Adopting heartbeat interval of %s advertised by broker (was %s)", heartbeat, w.heartbeat)
+	w.setHeartbeat(heartbeat)
+	w.scaleLiveness(heartbeat)
+}
+
+// Gives brokers as many of the negotiated heartbeat intervals as MaxHeartbeatLiveness allowed of the configured
+// one, so a broker heartbeating less often than configured isn't given up on between its heartbeats. Liveness
+// already run down is scaled the same way.
+func (w *mdWorker) scaleLiveness(heartbeat time.Duration) {
+	configured := w.config.HeartbeatInMillis
+	if configured <= 0 || w.maxLivenessCount <= 0 {
+		return
+	}
+
+	maxLiveness := int((time.Duration(w.config.MaxHeartbeatLiveness)*heartbeat + configured - 1) / configured)
+	if maxLiveness < 1 {
+		maxLiveness = 1
+	}
+
+	for _, workerSocket := range w.sockets {
+		workerSocket.liveness = workerSocket.liveness * maxLiveness / w.maxLivenessCount
+		workerSocket.maxLiveness = maxLiveness
+	}
+
+	logDebugf(w.logger, "Scaling liveness to %d for the heartbeat interval of %s (was %d)", maxLiveness, heartbeat, w.maxLivenessCount)
+	w.maxLivenessCount = maxLiveness
+	w.stats.setLiveness(w.lowestLiveness())
+}
+
+func (w *mdWorker) setHeartbeat(heartbeat time.Duration) {
+	w.heartbeat = heartbeat
+
+	// Don't wait out a longer interval we've already scheduled
+	nextHeartbeatAt := w.clock.Now().Add(heartbeat)
+	for _, workerSocket := range w.sockets {
+		if workerSocket.heartbeatAt.After(nextHeartbeatAt) {
+			workerSocket.heartbeatAt = nextHeartbeatAt
+		}
+	}
+}
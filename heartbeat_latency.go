@@ -0,0 +1,46 @@
+package majordomo_worker
+
+import "time"
+
+// Starts timing how long the broker takes to heartbeat back. A broker that still hasn't by the time the next
+// heartbeat goes out isn't answering them, so its latency is unavailable until it does.
+func (w *mdWorker) heartbeatSent(workerSocket *mdWorkerSocket) {
+	if !workerSocket.heartbeatSentAt.IsZero() {
+		workerSocket.heartbeatLatency = 0
+	}
+	workerSocket.heartbeatSentAt = w.clock.Now()
+
+	w.stats.setHeartbeatLatency(w.highestHeartbeatLatency())
+}
+
+// Takes the broker's MD_HEARTBEAT as the answer to the last one sent to it, if it hasn't answered that already
+func (w *mdWorker) heartbeatAnswered(workerSocket *mdWorkerSocket) {
+	if workerSocket.heartbeatSentAt.IsZero() {
+		return
+	}
+
+	workerSocket.heartbeatLatency = w.clock.Now().Sub(workerSocket.heartbeatSentAt)
+	workerSocket.heartbeatSentAt = time.Time{}
+
+	w.stats.setHeartbeatLatency(w.highestHeartbeatLatency())
+}
+
+// A new connection has yet to heartbeat back
+func (w *mdWorker) resetHeartbeatLatency(workerSocket *mdWorkerSocket) {
+	workerSocket.heartbeatSentAt = time.Time{}
+	workerSocket.heartbeatLatency = 0
+
+	w.stats.setHeartbeatLatency(w.highestHeartbeatLatency())
+}
+
+// The slowest broker is the one worth knowing about
+func (w *mdWorker) highestHeartbeatLatency() time.Duration {
+	var highest time.Duration
+	for _, workerSocket := range w.sockets {
+		if workerSocket.heartbeatLatency > highest {
+			highest = workerSocket.heartbeatLatency
+		}
+	}
+
+	return highest
+}
@@ -0,0 +1,59 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HeartbeatLatency_MeasuredToBrokersNextHeartbeat(t *testing.T) {
+	w := frameWorker(nil, nil)
+	clock := w.clock.(*fakeClock)
+	workerSocket := &mdWorkerSocket{}
+	w.sockets = []*mdWorkerSocket{workerSocket}
+
+	w.heartbeatSent(workerSocket)
+	clock.Advance(30 * time.Millisecond)
+	w.heartbeatAnswered(workerSocket)
+	assert.Equal(t, 30*time.Millisecond, w.Stats().HeartbeatLatency)
+
+	// Heartbeats the worker hasn't asked for don't count
+	clock.Advance(time.Second)
+	w.heartbeatAnswered(workerSocket)
+	assert.Equal(t, 30*time.Millisecond, w.Stats().HeartbeatLatency)
+}
+
+func Test_HeartbeatLatency_UnavailableWhenBrokerDoesNotAnswer(t *testing.T) {
+	w := frameWorker(nil, nil)
+	workerSocket := &mdWorkerSocket{}
+	w.sockets = []*mdWorkerSocket{workerSocket}
+	assert.Equal(t, time.Duration(0), w.Stats().HeartbeatLatency, "Expected it to be unavailable until measured")
+
+	w.heartbeatSent(workerSocket)
+	w.clock.(*fakeClock).Advance(10 * time.Millisecond)
+	w.heartbeatAnswered(workerSocket)
+
+	w.heartbeatSent(workerSocket)
+	w.heartbeatSent(workerSocket)
+	assert.Equal(t, time.Duration(0), w.Stats().HeartbeatLatency)
+}
+
+func Test_HeartbeatLatency_SlowestBrokerReported(t *testing.T) {
+	w := frameWorker(nil, nil)
+	clock := w.clock.(*fakeClock)
+	fast, slow := &mdWorkerSocket{}, &mdWorkerSocket{}
+	w.sockets = []*mdWorkerSocket{fast, slow}
+
+	w.heartbeatSent(fast)
+	w.heartbeatSent(slow)
+	clock.Advance(5 * time.Millisecond)
+	w.heartbeatAnswered(fast)
+	clock.Advance(45 * time.Millisecond)
+	w.heartbeatAnswered(slow)
+	assert.Equal(t, 50*time.Millisecond, w.Stats().HeartbeatLatency)
+
+	// A new connection starts afresh
+	w.resetHeartbeatLatency(slow)
+	assert.Equal(t, 5*time.Millisecond, w.Stats().HeartbeatLatency)
+}
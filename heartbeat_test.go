@@ -0,0 +1,103 @@
+package majordomo_worker
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jitteredWorker(heartbeat, jitter time.Duration) *mdWorker {
+	return &mdWorker{
+		heartbeat:       heartbeat,
+		heartbeatJitter: jitter,
+		jitterSource:    rand.New(rand.NewSource(1)),
+		clock:           newFakeClock(),
+	}
+}
+
+func Test_Heartbeat_JitterVariesIntervalWithinBound(t *testing.T) {
+	w := jitteredWorker(500*time.Millisecond, 100*time.Millisecond)
+
+	intervals := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		interval := w.nextHeartbeatAt().Sub(w.clock.Now())
+
+		assert.True(t, interval >= 400*time.Millisecond, "interval %s is below the jitter bound", interval)
+		assert.True(t, interval <= 500*time.Millisecond, "interval %s is beyond the heartbeat", interval)
+		intervals[interval] = true
+	}
+
+	assert.True(t, len(intervals) > 1, "Expected intervals to vary")
+}
+
+func Test_Heartbeat_JitterCappedAtHalfTheInterval(t *testing.T) {
+	w := jitteredWorker(500*time.Millisecond, time.Hour)
+
+	for i := 0; i < 100; i++ {
+		interval := w.nextHeartbeatAt().Sub(w.clock.Now())
+		assert.True(t, interval >= 250*time.Millisecond, "interval %s is below half the heartbeat", interval)
+	}
+}
+
+func Test_Heartbeat_NoJitterByDefault(t *testing.T) {
+	w := jitteredWorker(500*time.Millisecond, 0)
+
+	assert.Equal(t, w.clock.Now().Add(500*time.Millisecond), w.nextHeartbeatAt())
+}
+
+func Test_Heartbeat_FromBrokerRecordedInStats(t *testing.T) {
+	clock := newFakeClock()
+	w := &mdWorker{
+		envelope: StandardEnvelopeLayout,
+		stats:    newWorkerStats(clock),
+		clock:    clock,
+		logger:   new(testLogger),
+	}
+
+	clock.Advance(time.Minute)
+	w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+
+	assert.Equal(t, clock.Now(), w.Stats().LastBrokerHeartbeat)
+
+	// It is state rather than a counter
+	w.Reset()
+	assert.Equal(t, clock.Now(), w.Stats().LastBrokerHeartbeat)
+}
+
+func Test_Heartbeat_SendHeartbeatAfterShutdown(t *testing.T) {
+	w := &mdWorker{shutdown: make(chan struct{}), heartbeatNow: make(chan chan error)}
+	close(w.shutdown)
+
+	assert.IsType(t, GracefulShutdown(""), w.SendHeartbeat())
+}
+
+func Test_Heartbeat_NegotiatedIntervalScalesLiveness(t *testing.T) {
+	clock := newFakeClock()
+	w := &mdWorker{
+		config:           WorkerConfig{HeartbeatInMillis: 100 * time.Millisecond, MaxHeartbeatLiveness: 5},
+		heartbeat:        100 * time.Millisecond,
+		maxLivenessCount: 5,
+		stats:            newWorkerStats(clock),
+		clock:            clock,
+		logger:           new(testLogger),
+	}
+	workerSocket := &mdWorkerSocket{liveness: 4, maxLiveness: 5}
+	w.sockets = []*mdWorkerSocket{workerSocket}
+
+	// Three times as long between heartbeats, so three times as many polls before giving up on the broker
+	w.negotiateHeartbeat([]byte("300"))
+	assert.Equal(t, 15, w.maxLivenessCount)
+	assert.Equal(t, 15, workerSocket.maxLiveness)
+	assert.Equal(t, 12, workerSocket.liveness)
+	assert.Equal(t, 12, w.Stats().Liveness)
+
+	// Rounded up so the broker isn't given less than a whole interval
+	w.negotiateHeartbeat([]byte("50"))
+	assert.Equal(t, 3, w.maxLivenessCount)
+	assert.Equal(t, 2, workerSocket.liveness)
+
+	w.heardFrom(workerSocket)
+	assert.Equal(t, 3, workerSocket.liveness)
+}
@@ -0,0 +1,88 @@
+package majordomo_worker
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// A bounded LRU of replies keyed by request ID
+type idempotencyCache struct {
+	sync.Mutex
+
+	size  int
+	ttl   time.Duration
+	clock Clock
+
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type idempotencyCacheEntry struct {
+	requestID string
+	reply     [][]byte
+	expiresAt time.Time
+}
+
+func newIdempotencyCache(size int, ttl time.Duration, clock Clock) *idempotencyCache {
+	return &idempotencyCache{
+		size:    size,
+		ttl:     ttl,
+		clock:   clock,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *idempotencyCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *idempotencyCache) get(requestID string) ([][]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	element, found := c.entries[requestID]
+	if !found {
+		return nil, false
+	}
+
+	entry := element.Value.(*idempotencyCacheEntry)
+	if c.ttl > 0 && !c.clock.Now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.reply, true
+}
+
+func (c *idempotencyCache) put(requestID string, reply [][]byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	expiresAt := c.clock.Now().Add(c.ttl)
+
+	if element, found := c.entries[requestID]; found {
+		entry := element.Value.(*idempotencyCacheEntry)
+		entry.reply = reply
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[requestID] = c.order.PushFront(&idempotencyCacheEntry{requestID: requestID, reply: reply, expiresAt: expiresAt})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *idempotencyCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*idempotencyCacheEntry).requestID)
+}
@@ -0,0 +1,59 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IdempotencyCache_ReturnsStoredReply(t *testing.T) {
+	c := newIdempotencyCache(2, 0, newFakeClock())
+	c.put("a", [][]byte{[]byte("reply-a")})
+
+	reply, found := c.get("a")
+	assert.True(t, found)
+	assert.Equal(t, [][]byte{[]byte("reply-a")}, reply)
+}
+
+func Test_IdempotencyCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newIdempotencyCache(2, 0, newFakeClock())
+	c.put("a", [][]byte{[]byte("reply-a")})
+	c.put("b", [][]byte{[]byte("reply-b")})
+	c.get("a")
+	c.put("c", [][]byte{[]byte("reply-c")})
+
+	_, found := c.get("b")
+	assert.False(t, found)
+
+	_, found = c.get("a")
+	assert.True(t, found)
+
+	_, found = c.get("c")
+	assert.True(t, found)
+}
+
+func Test_IdempotencyCache_ExpiresEntriesAfterTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newIdempotencyCache(2, time.Minute, clock)
+	c.put("a", [][]byte{[]byte("reply-a")})
+
+	clock.Advance(time.Minute)
+
+	_, found := c.get("a")
+	assert.False(t, found)
+}
+
+func Test_IdempotencyCache_Clear(t *testing.T) {
+	c := newIdempotencyCache(2, 0, newFakeClock())
+	c.put("a", [][]byte{[]byte("reply")})
+
+	c.clear()
+
+	_, found := c.get("a")
+	assert.False(t, found)
+
+	c.put("b", [][]byte{[]byte("reply")})
+	_, found = c.get("b")
+	assert.True(t, found)
+}
@@ -0,0 +1,21 @@
+package majordomo_worker
+
+// Called whenever a request arrives so the idle action only runs once the worker has been idle for a full interval
+func (w *mdWorker) postponeIdle() {
+	if w.idleAction != nil {
+		w.idleAt = w.clock.Now().Add(w.idleInterval)
+	}
+}
+
+// Runs the idle action if nothing has arrived for an interval. It is called from Receive() like heartbeats, so the
+// worker's own state needs no locking. Actions running on their own goroutines (MaxConcurrentRequests) mean the
+// worker isn't idle, so it waits for them to finish rather than overlapping them.
+func (w *mdWorker) idle() {
+	if w.idleAction == nil || w.manualLiveness || w.clock.Now().Before(w.idleAt) || len(w.slots) > 0 {
+		return
+	}
+
+	logDebugf(w.logger, "No requests for %s, calling idle action", w.idleInterval)
+	w.idleAction()
+	w.postponeIdle()
+}
@@ -0,0 +1,75 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func idleWorker(calls *int) *mdWorker {
+	w := &mdWorker{
+		idleAction:   func() { *calls++ },
+		idleInterval: 100 * time.Millisecond,
+		clock:        newFakeClock(),
+		logger:       &testLogger{},
+	}
+	w.postponeIdle()
+
+	return w
+}
+
+func Test_Idle_CalledWhenIdle(t *testing.T) {
+	calls := 0
+	w := idleWorker(&calls)
+
+	w.idle()
+	assert.Equal(t, 0, calls, "Expected no call before the interval has passed")
+
+	w.clock.(*fakeClock).Advance(100 * time.Millisecond)
+	w.idle()
+	assert.Equal(t, 1, calls)
+
+	w.idle()
+	assert.Equal(t, 1, calls, "Expected the next call to wait another interval")
+
+	w.clock.(*fakeClock).Advance(100 * time.Millisecond)
+	w.idle()
+	assert.Equal(t, 2, calls)
+}
+
+func Test_Idle_NotCalledWhileBusy(t *testing.T) {
+	calls := 0
+	w := idleWorker(&calls)
+
+	for i := 0; i < 10; i++ {
+		w.clock.(*fakeClock).Advance(60 * time.Millisecond)
+		w.postponeIdle()
+		w.idle()
+	}
+
+	assert.Equal(t, 0, calls)
+}
+
+func Test_Idle_WaitsForRunningActions(t *testing.T) {
+	calls := 0
+	w := idleWorker(&calls)
+	w.slots = make(chan struct{}, 2)
+	w.slots <- struct{}{}
+
+	w.clock.(*fakeClock).Advance(time.Hour)
+	w.idle()
+	assert.Equal(t, 0, calls, "Expected no call while an action is running")
+
+	<-w.slots
+	w.idle()
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Idle_DisabledWithoutAction(t *testing.T) {
+	w := &mdWorker{clock: newFakeClock()}
+	w.postponeIdle()
+
+	w.clock.(*fakeClock).Advance(time.Hour)
+	w.idle()
+}
@@ -0,0 +1,55 @@
+package majordomo_worker
+
+import (
+	"sync"
+)
+
+// The requests whose action is running, for Worker.CurrentRequest. Updated from the goroutines actions run on, so
+// guarded by the mutex.
+type inFlightRequests struct {
+	sync.Mutex
+
+	next     uint64
+	requests map[uint64]RequestContext
+}
+
+func (r *inFlightRequests) start(ctx RequestContext) uint64 {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.requests == nil {
+		r.requests = make(map[uint64]RequestContext)
+	}
+
+	r.next++
+	r.requests[r.next] = ctx
+
+	return r.next
+}
+
+func (r *inFlightRequests) finish(id uint64) {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.requests, id)
+}
+
+// The request that has been in flight longest, the likeliest to be stuck
+func (r *inFlightRequests) oldest() (RequestContext, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	var oldest RequestContext
+	var oldestID uint64
+	for id, ctx := range r.requests {
+		if oldestID == 0 || id < oldestID {
+			oldest, oldestID = ctx, id
+		}
+	}
+
+	return oldest, oldestID != 0
+}
+
+func (w *mdWorker) CurrentRequest() (RequestContext, bool) {
+	return w.inFlight.oldest()
+}
@@ -0,0 +1,76 @@
+package majordomo_worker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CurrentRequest_ReportedWhileActionRuns(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	w := actionWorker(funcWorkerAction{call: func(args [][]byte) [][]byte {
+		close(started)
+		<-release
+		return args
+	}})
+	w.actionTimeout = 0
+
+	_, found := w.CurrentRequest()
+	assert.False(t, found)
+
+	done := make(chan struct{})
+	go func() {
+		w.callAction(RequestContext{ReplyTo: []byte("client"), Request: [][]byte{[]byte("slow")}})
+		close(done)
+	}()
+	<-started
+
+	// Read from several goroutines at once while the action runs
+	var readers sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+
+			current, found := w.CurrentRequest()
+			assert.True(t, found)
+			assert.Equal(t, []byte("client"), current.ReplyTo)
+			assert.Equal(t, [][]byte{[]byte("slow")}, current.Request)
+		}()
+	}
+	readers.Wait()
+
+	close(release)
+	<-done
+
+	_, found = w.CurrentRequest()
+	assert.False(t, found, "Expected the request to be cleared once the action returned")
+}
+
+func Test_CurrentRequest_ClearedWhenActionTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	w := actionWorker(hungAction(release))
+
+	result := w.callAction(RequestContext{Request: [][]byte{[]byte("hung")}})
+	assert.Equal(t, ErrActionTimeout, result.err)
+
+	_, found := w.CurrentRequest()
+	assert.False(t, found)
+}
+
+func Test_CurrentRequest_OldestReported(t *testing.T) {
+	var r inFlightRequests
+	first := r.start(RequestContext{ReceivedAt: time.Unix(1, 0)})
+	r.start(RequestContext{ReceivedAt: time.Unix(2, 0)})
+
+	oldest, _ := r.oldest()
+	assert.Equal(t, time.Unix(1, 0), oldest.ReceivedAt)
+
+	r.finish(first)
+	oldest, _ = r.oldest()
+	assert.Equal(t, time.Unix(2, 0), oldest.ReceivedAt)
+}
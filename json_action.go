@@ -0,0 +1,68 @@
+package majordomo_worker
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+type jsonAction struct {
+	fn      reflect.Value
+	request reflect.Type
+}
+
+// JSONAction adapts fn, a func(T) (R, error), into an action for services speaking JSON. The first frame of each
+// request is unmarshalled into a T for fn and whatever it returns is marshalled into a single reply frame. Requests
+// that can't be unmarshalled fail with a JSONRequestError and, like errors returned by fn, are answered with
+// WorkerConfig.ErrorReply. Returns ErrInvalidJSONAction if fn has any other signature.
+func JSONAction(fn interface{}) (WorkerAction, error) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return nil, ErrInvalidJSONAction
+	}
+
+	fnType := value.Type()
+	if fnType.NumIn() != 1 || fnType.NumOut() != 2 || fnType.Out(1) != errorType {
+		return nil, ErrInvalidJSONAction
+	}
+
+	return jsonAction{fn: value, request: fnType.In(0)}, nil
+}
+
+func (a jsonAction) Call(args [][]byte) [][]byte {
+	reply, err := a.call(args)
+	if err != nil {
+		return defaultErrorReply(err)
+	}
+
+	return reply
+}
+
+func (a jsonAction) CallWithError(ctx RequestContext) ([][]byte, error) {
+	return a.call(ctx.Request)
+}
+
+func (a jsonAction) call(args [][]byte) ([][]byte, error) {
+	var body []byte
+	if len(args) > 0 {
+		body = args[0]
+	}
+
+	request := reflect.New(a.request)
+	if err := json.Unmarshal(body, request.Interface()); err != nil {
+		return nil, JSONRequestError{Err: err}
+	}
+
+	out := a.fn.Call([]reflect.Value{request.Elem()})
+	if err, _ := out[1].Interface().(error); err != nil {
+		return nil, err
+	}
+
+	reply, err := json.Marshal(out[0].Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{reply}, nil
+}
@@ -0,0 +1,85 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type greetRequest struct {
+	Name string `json:"name"`
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func greet(req greetRequest) (greetResponse, error) {
+	if req.Name == "" {
+		return greetResponse{}, errors.New("Name is required")
+	}
+
+	return greetResponse{Greeting: "Hello " + req.Name}, nil
+}
+
+func Test_JSONAction_RoundTrip(t *testing.T) {
+	action, err := JSONAction(greet)
+	assert.NoError(t, err)
+
+	reply, err := action.(ErrorWorkerAction).CallWithError(RequestContext{Request: [][]byte{[]byte(`{"name":"world"}`)}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte(`{"greeting":"Hello world"}`)}, reply)
+}
+
+func Test_JSONAction_MalformedJSONFails(t *testing.T) {
+	action, _ := JSONAction(greet)
+
+	_, err := action.(ErrorWorkerAction).CallWithError(RequestContext{Request: [][]byte{[]byte(`{"name":`)}})
+
+	assert.IsType(t, JSONRequestError{}, err)
+	assert.Contains(t, err.Error(), "Invalid JSON request")
+}
+
+func Test_JSONAction_MalformedJSONFailsTheRequest(t *testing.T) {
+	action, _ := JSONAction(greet)
+	w := actionWorker(action)
+
+	result := w.invokeAction(RequestContext{Request: [][]byte{[]byte("not json")}})
+
+	assert.IsType(t, JSONRequestError{}, result.err)
+	assert.Nil(t, result.reply)
+}
+
+func Test_JSONAction_FunctionErrorReturned(t *testing.T) {
+	action, _ := JSONAction(greet)
+
+	_, err := action.(ErrorWorkerAction).CallWithError(RequestContext{Request: [][]byte{[]byte(`{}`)}})
+	assert.EqualError(t, err, "Name is required")
+
+	// Plain Call answers with the error's message
+	assert.Equal(t, [][]byte{[]byte("Name is required")}, action.Call([][]byte{[]byte(`{}`)}))
+}
+
+func Test_JSONAction_PointerRequest(t *testing.T) {
+	action, err := JSONAction(func(req *greetRequest) (*greetResponse, error) {
+		return &greetResponse{Greeting: "Hi " + req.Name}, nil
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, [][]byte{[]byte(`{"greeting":"Hi you"}`)}, action.Call([][]byte{[]byte(`{"name":"you"}`)}))
+}
+
+func Test_JSONAction_RejectsOtherSignatures(t *testing.T) {
+	for _, fn := range []interface{}{
+		nil,
+		"not a func",
+		func(greetRequest) greetResponse { return greetResponse{} },
+		func(a, b greetRequest) (greetResponse, error) { return greetResponse{}, nil },
+		func(greetRequest) (greetResponse, string) { return greetResponse{}, "" },
+	} {
+		_, err := JSONAction(fn)
+		assert.Equal(t, ErrInvalidJSONAction, err)
+	}
+}
@@ -0,0 +1,81 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// Records that the broker was heard from, restoring its liveness
+func (w *mdWorker) heardFrom(workerSocket *mdWorkerSocket) {
+	workerSocket.liveness = w.maxLivenessCount
+	workerSocket.lastHeardAt = w.clock.Now()
+	workerSocket.consecutiveErrors = 0
+	workerSocket.graceEndsAt = time.Time{}
+}
+
+// Polls cost brokers liveness unless there are no heartbeats to restore it, or tests drive the worker themselves
+// (see WorkerConfig.ManualLiveness)
+func (w *mdWorker) livenessRunsDown() bool {
+	return !w.heartbeatsDisabled && !w.manualLiveness
+}
+
+// Asks the reconnect strategy whether to reconnect to the broker, and how long to sleep first. Without heartbeats
+// a quiet broker is no sign of a dead one, and with ManualLiveness the test is in charge, so liveness never leads to
+// a reconnect.
+//
+// With a LivenessGracePeriod the first verdict to reconnect only starts the grace period, the broker is given until
+// it ends to be heard from before the worker reconnects.
+func (w *mdWorker) shouldReconnect(workerSocket *mdWorkerSocket) (bool, time.Duration) {
+	if !w.livenessRunsDown() {
+		return false, 0
+	}
+
+	reconnect, delay := w.reconnectStrategy.ShouldReconnect(w.brokerState(workerSocket))
+	if !reconnect || w.livenessGrace <= 0 {
+		return reconnect, delay
+	}
+
+	now := w.clock.Now()
+	if workerSocket.graceEndsAt.IsZero() {
+		workerSocket.graceEndsAt = now.Add(w.livenessGrace)
+		logDebugf(w.logger, "Worker at address '%s' has lost the broker, waiting %s for it before reconnecting", workerSocket.address, w.livenessGrace)
+		return false, 0
+	}
+
+	if now.Before(workerSocket.graceEndsAt) {
+		return false, 0
+	}
+
+	workerSocket.graceEndsAt = time.Time{}
+	return true, delay
+}
+
+// Shortens the poll timeout so that it ends with the earliest grace period, see shouldReconnect
+func (w *mdWorker) untilGraceEnds(timeout time.Duration) time.Duration {
+	for _, workerSocket := range w.sockets {
+		if workerSocket.graceEndsAt.IsZero() {
+			continue
+		}
+
+		remaining := workerSocket.graceEndsAt.Sub(w.clock.Now())
+		if remaining < 0 {
+			remaining = 0
+		}
+		if remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	return timeout
+}
+
+func (w *mdWorker) brokerState(workerSocket *mdWorkerSocket) BrokerState {
+	return BrokerState{
+		Address:           workerSocket.address,
+		Liveness:          workerSocket.liveness,
+		MaxLiveness:       w.maxLivenessCount,
+		LastHeardAt:       workerSocket.lastHeardAt,
+		Now:               w.clock.Now(),
+		Heartbeat:         w.heartbeat,
+		ConsecutiveErrors: workerSocket.consecutiveErrors,
+	}
+}
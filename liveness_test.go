@@ -0,0 +1,127 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func graceWorker(grace time.Duration) (*mdWorker, *fakeClock) {
+	clock := newFakeClock()
+	w := &mdWorker{
+		envelope:          StandardEnvelopeLayout,
+		reconnectStrategy: LivenessReconnectStrategy{Delay: 50 * time.Millisecond},
+		livenessGrace:     grace,
+		maxLivenessCount:  3,
+		stats:             newWorkerStats(clock),
+		clock:             clock,
+		logger:            new(testLogger),
+	}
+	w.sockets = []*mdWorkerSocket{{address: "inproc://grace"}}
+
+	return w, clock
+}
+
+func Test_Liveness_GracePeriodHeartbeatPreventsReconnect(t *testing.T) {
+	w, clock := graceWorker(100 * time.Millisecond)
+	workerSocket := w.sockets[0]
+
+	reconnect, _ := w.shouldReconnect(workerSocket)
+	assert.False(t, reconnect, "Expected the grace period to start rather than a reconnect")
+	assert.Equal(t, 100*time.Millisecond, w.untilGraceEnds(time.Second))
+
+	clock.Advance(60 * time.Millisecond)
+	w.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+
+	clock.Advance(60 * time.Millisecond)
+	reconnect, _ = w.shouldReconnect(workerSocket)
+	assert.False(t, reconnect)
+	assert.Equal(t, time.Second, w.untilGraceEnds(time.Second), "Expected the grace period to be over")
+}
+
+func Test_Liveness_GracePeriodReconnectsOnceOver(t *testing.T) {
+	w, clock := graceWorker(100 * time.Millisecond)
+	workerSocket := w.sockets[0]
+
+	reconnect, _ := w.shouldReconnect(workerSocket)
+	assert.False(t, reconnect)
+
+	clock.Advance(60 * time.Millisecond)
+	reconnect, _ = w.shouldReconnect(workerSocket)
+	assert.False(t, reconnect)
+	assert.Equal(t, 40*time.Millisecond, w.untilGraceEnds(time.Second))
+
+	clock.Advance(40 * time.Millisecond)
+	reconnect, delay := w.shouldReconnect(workerSocket)
+	assert.True(t, reconnect)
+	assert.Equal(t, 50*time.Millisecond, delay)
+
+	// The next loss of the broker gets a grace period of its own
+	reconnect, _ = w.shouldReconnect(workerSocket)
+	assert.False(t, reconnect)
+}
+
+func Test_Liveness_NoGracePeriodByDefault(t *testing.T) {
+	w, _ := graceWorker(0)
+
+	reconnect, _ := w.shouldReconnect(w.sockets[0])
+	assert.True(t, reconnect)
+	assert.Equal(t, time.Second, w.untilGraceEnds(time.Second))
+}
+
+func Test_Liveness_NotRestoredByEmptyMessage(t *testing.T) {
+	w, _ := graceWorker(0)
+	workerSocket := w.sockets[0]
+	workerSocket.liveness = 1
+	w.receiveMiddleware = func(frames [][]byte) bool {
+		assert.Fail(t, "Expected the empty message not to reach the middleware")
+		return false
+	}
+
+	for _, msg := range [][][]byte{nil, {}} {
+		reply, handled := w.handleMessage(workerSocket, msg)
+
+		assert.Nil(t, reply)
+		assert.False(t, handled)
+		assert.Equal(t, 1, workerSocket.liveness)
+		assert.True(t, workerSocket.lastHeardAt.IsZero())
+	}
+
+	assert.Equal(t, uint64(0), w.Stats().Errors)
+	assert.Len(t, w.logger.(*testLogger).debugs, 2)
+}
+
+func Test_Liveness_ManualLivenessNeverReconnectsOrHeartbeats(t *testing.T) {
+	w, clock := graceWorker(0)
+	w.manualLiveness = true
+	workerSocket := w.sockets[0]
+
+	// Nothing from the broker for ages, with a heartbeat long overdue
+	clock.Advance(time.Hour)
+	reconnect, _ := w.shouldReconnect(workerSocket)
+	assert.False(t, reconnect)
+
+	heartbeatAt := workerSocket.heartbeatAt
+	w.sendHeartbeats()
+	assert.Equal(t, heartbeatAt, workerSocket.heartbeatAt, "Expected no heartbeat to be sent")
+}
+
+func Test_Liveness_ManualLivenessStopsOtherTimers(t *testing.T) {
+	w, clock := graceWorker(0)
+	w.manualLiveness = true
+
+	idleCalls := 0
+	w.idleAction = func() { idleCalls++ }
+	w.idleInterval = time.Second
+	w.postponeIdle()
+	clock.Advance(time.Hour)
+	w.idle()
+	assert.Equal(t, 0, idleCalls, "Expected no idle action")
+
+	assert.False(t, w.delaysReply(actionResult{delay: time.Second}), "Expected delayed replies to go straight away")
+
+	w.maxRequestsBeforeRestart = 1
+	w.requestsSinceRestart = 5
+	assert.False(t, w.restartDue(), "Expected no restart")
+}
@@ -0,0 +1,35 @@
+package majordomo_worker
+
+import (
+	"sync/atomic"
+)
+
+// Picks 1 in every N of the per-request debug lines, see WorkerConfig.LogSampleRate. Received requests and sent
+// replies are counted separately, so both are logged for a worker that replies to every request. Replies can be
+// sent from another goroutine than requests are received on, hence the atomics.
+type logSampler struct {
+	received, sent uint64
+	every          uint64
+}
+
+func newLogSampler(every int) *logSampler {
+	if every < 1 {
+		every = 1
+	}
+
+	return &logSampler{every: uint64(every)}
+}
+
+// The first request is always logged, then every Nth after it. A nil sampler logs them all.
+func (s *logSampler) sampleReceived() bool {
+	return s == nil || (atomic.AddUint64(&s.received, 1)-1)%s.every == 0
+}
+
+func (s *logSampler) sampleSent() bool {
+	return s == nil || (atomic.AddUint64(&s.sent, 1)-1)%s.every == 0
+}
+
+// Replies are the only sent commands there is one of for every request, the rest are rare enough to always log
+func sampledCommand(command string) bool {
+	return command == MD_REPLY || command == MD_PARTIAL
+}
@@ -0,0 +1,64 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LogSampling_OneInN(t *testing.T) {
+	s := newLogSampler(10)
+
+	received := 0
+	for i := 0; i < 1000; i++ {
+		if s.sampleReceived() {
+			received++
+		}
+	}
+
+	assert.Equal(t, 100, received)
+	assert.True(t, s.sampleSent(), "Expected replies to be counted apart from requests")
+}
+
+func Test_LogSampling_DefaultLogsEverything(t *testing.T) {
+	s := newLogSampler(0)
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, s.sampleReceived())
+	}
+
+	var nilSampler *logSampler
+	assert.True(t, nilSampler.sampleSent())
+}
+
+func Test_LogSampling_SampledReplyLines(t *testing.T) {
+	w := sendWorker()
+	w.logSampler = newLogSampler(4)
+	sender := &fakeSender{}
+
+	for i := 0; i < 20; i++ {
+		w.sendToBroker(sender, MD_REPLY, []byte("client"), [][]byte{[]byte("reply")})
+	}
+	w.sendToBroker(sender, MD_HEARTBEAT, nil, nil)
+	w.sendToBroker(sender, MD_HEARTBEAT, nil, nil)
+
+	assert.Len(t, sender.sent, 22)
+	assert.Len(t, w.logger.(*testLogger).debugs, 5+2, "Expected 1 in 4 replies and every heartbeat to be logged")
+}
+
+func Test_LogSampling_ErrorsAlwaysLogged(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.logSampler = newLogSampler(100)
+
+	for i := 0; i < 10; i++ {
+		w.handleMessage(&mdWorkerSocket{}, [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST)})
+	}
+
+	assert.Len(t, w.logger.(*testLogger).errors, 10)
+}
+
+func Test_LogSampling_NegativeRateIsInvalid(t *testing.T) {
+	config := WorkerConfig{BrokerAddress: "inproc://test", ServiceName: "test-service", LogSampleRate: -1}
+
+	assert.Equal(t, ErrInvalidLogSampleRate, config.validate())
+}
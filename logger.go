@@ -2,6 +2,8 @@ package majordomo_worker
 
 import (
 	"errors"
+	"fmt"
+	"sync/atomic"
 )
 
 // Copied from go-kit/log to save us from needing the entire package as a dependency
@@ -12,14 +14,75 @@ type Logger interface {
 
 var ErrMissingValue = errors.New("(MISSING)")
 
+// Level is the least severe level a worker logs at, see WorkerConfig.LogLevel
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelWarn
+	LevelError
+)
+
+// A Level that Reconfigure can change while other goroutines log
+type atomicLevel int32
+
+func newAtomicLevel(level Level) *atomicLevel {
+	l := atomicLevel(level)
+	return &l
+}
+
+func (l *atomicLevel) get() Level {
+	return Level(atomic.LoadInt32((*int32)(l)))
+}
+
+func (l *atomicLevel) set(level Level) {
+	atomic.StoreInt32((*int32)(l), int32(level))
+}
+
+// Loggers other than the worker's own log every level
+func logEnabled(logger Logger, level Level) bool {
+	if l, ok := logger.(workerLogger); ok {
+		return level >= l.level.get()
+	}
+
+	return true
+}
+
 func logDebug(logger Logger, msg string) {
-	logger.Log("level", "debug", "message", msg)
+	if logEnabled(logger, LevelDebug) {
+		logger.Log("level", "debug", "message", msg)
+	}
 }
 
 func logWarn(logger Logger, msg string) {
-	logger.Log("level", "warn", "message", msg)
+	if logEnabled(logger, LevelWarn) {
+		logger.Log("level", "warn", "message", msg)
+	}
 }
 
 func logError(logger Logger, msg string) {
-	logger.Log("level", "error", "message", msg)
+	if logEnabled(logger, LevelError) {
+		logger.Log("level", "error", "message", msg)
+	}
+}
+
+// The formatting variants only format the message if it is going to be logged, which saves the work for every
+// debug line at high request rates
+
+func logDebugf(logger Logger, format string, args ...interface{}) {
+	if logEnabled(logger, LevelDebug) {
+		logDebug(logger, fmt.Sprintf(format, args...))
+	}
+}
+
+func logWarnf(logger Logger, format string, args ...interface{}) {
+	if logEnabled(logger, LevelWarn) {
+		logWarn(logger, fmt.Sprintf(format, args...))
+	}
+}
+
+func logErrorf(logger Logger, format string, args ...interface{}) {
+	if logEnabled(logger, LevelError) {
+		logError(logger, fmt.Sprintf(format, args...))
+	}
 }
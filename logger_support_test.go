@@ -4,6 +4,10 @@ import (
 	"fmt"
 )
 
+type noopLogger struct{}
+
+func (noopLogger) Log(keyvals ...interface{}) error { return nil }
+
 type testLogger struct {
 	debugs []map[string]interface{}
 	errors []map[string]interface{}
@@ -0,0 +1,54 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Logger_LevelSkipsLessSevereLines(t *testing.T) {
+	logger := new(testLogger)
+	w := workerLogger{logger, "test-worker", newAtomicLevel(LevelWarn), nil}
+
+	logDebug(w, "debug")
+	logDebugf(w, "debug %d", 1)
+	logErrorf(w, "error %d", 1)
+
+	assert.Empty(t, logger.debugs)
+	assert.Equal(t, []map[string]interface{}{{"worker": "test-worker", "message": "error 1"}}, logger.errors)
+}
+
+func Test_Logger_DefaultLogsEverything(t *testing.T) {
+	logger := new(testLogger)
+	w := workerLogger{logger, "test-worker", newAtomicLevel(LevelDebug), nil}
+
+	logDebugf(w, "debug %d", 1)
+
+	assert.Equal(t, []map[string]interface{}{{"worker": "test-worker", "message": "debug 1"}}, logger.debugs)
+}
+
+func Test_Logger_OtherLoggersLogEverything(t *testing.T) {
+	logger := new(testLogger)
+
+	logDebugf(logger, "debug %d", 1)
+
+	assert.Len(t, logger.debugs, 1)
+}
+
+func benchmarkDebugLine(b *testing.B, level Level) {
+	logger := workerLogger{noopLogger{}, "test-worker", newAtomicLevel(level), nil}
+	msg := [][]byte{[]byte("hello"), []byte("world")}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logDebugf(logger, "Received MD_REQUEST from broker with message '%q'", msg)
+	}
+}
+
+func BenchmarkLogger_DebugLogged(b *testing.B) {
+	benchmarkDebugLine(b, LevelDebug)
+}
+
+func BenchmarkLogger_DebugSuppressed(b *testing.B) {
+	benchmarkDebugLine(b, LevelWarn)
+}
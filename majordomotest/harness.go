@@ -0,0 +1,110 @@
+// Package majordomotest runs majordomo workers against an in-process broker for benchmarks and examples. It lives in
+// its own package so test scaffolding stays out of the worker's API.
+package majordomotest
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	majordomo_worker "github.com/ppeble/majordomo-worker-go"
+)
+
+const inprocHarnessClient = "harness-client"
+
+var inprocHarnessCount uint64
+
+type noopLogger struct{}
+
+func (noopLogger) Log(keyvals ...interface{}) error { return nil }
+
+// NewInprocHarness connects a worker offering serviceName to a minimal broker in the same process over inproc://,
+// for benchmarks and examples that shouldn't pay for TCP. send hands a request body to the worker, runs Receive()
+// and returns the reply the broker got back. cleanup closes the broker and the worker and terminates their context.
+// Everything happens on the calling goroutine, so the harness must not be used from more than one at a time.
+func NewInprocHarness(serviceName string, action majordomo_worker.WorkerAction) (worker majordomo_worker.Worker, send func(body ...[]byte) ([][]byte, error), cleanup func(), err error) {
+	context, err := zmq4.NewContext()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	broker, err := context.NewSocket(zmq4.ROUTER)
+	if err != nil {
+		context.Term()
+		return nil, nil, nil, err
+	}
+	broker.SetLinger(0)
+
+	address := fmt.Sprintf("inproc://majordomo-harness-%d", atomic.AddUint64(&inprocHarnessCount, 1))
+	if err = broker.Bind(address); err != nil {
+		broker.Close()
+		context.Term()
+		return nil, nil, nil, err
+	}
+
+	factory := majordomo_worker.NewWorkerFactory(context, noopLogger{}, majordomo_worker.WorkerConfig{
+		BrokerAddress:        address,
+		HeartbeatInMillis:    time.Second,
+		ReconnectInMillis:    100 * time.Millisecond,
+		PollingInterval:      250 * time.Millisecond,
+		MaxHeartbeatLiveness: 10,
+	})
+	w, err := factory.Create(serviceName, action)
+	if err != nil {
+		broker.Close()
+		context.Term()
+		return nil, nil, nil, err
+	}
+	cleanup = func() {
+		broker.Close()
+		w.Close()
+		context.Term()
+	}
+
+	// The worker's READY tells us its identity
+	ready, err := receiveFromWorker(broker, majordomo_worker.MD_READY)
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+	workerID := ready[0]
+
+	send = func(body ...[]byte) ([][]byte, error) {
+		request := [][]byte{workerID, nil, []byte(majordomo_worker.MD_WORKER), []byte(majordomo_worker.MD_REQUEST), []byte(inprocHarnessClient), nil}
+		if _, err := broker.SendMessage(request, body); err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Receive(); err != nil {
+			return nil, err
+		}
+
+		reply, err := receiveFromWorker(broker, majordomo_worker.MD_REPLY)
+		if err != nil {
+			return nil, err
+		}
+
+		return reply[6:], nil
+	}
+
+	return w, send, cleanup, nil
+}
+
+// Receives from the worker until it sends command, skipping heartbeats and anything else in between
+func receiveFromWorker(broker *zmq4.Socket, command string) ([][]byte, error) {
+	for {
+		msg, err := broker.RecvMessageBytes(0)
+		if err == zmq4.Errno(syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(msg) >= 4 && string(msg[3]) == command {
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package majordomotest
+
+import (
+	"fmt"
+	"testing"
+)
+
+type echoAction struct{}
+
+func (echoAction) Call(args [][]byte) [][]byte {
+	return args
+}
+
+func ExampleNewInprocHarness() {
+	_, send, cleanup, err := NewInprocHarness("echo", echoAction{})
+	if err != nil {
+		panic(err)
+	}
+	defer cleanup()
+
+	reply, err := send([]byte("one"), []byte("two"))
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%s\n", reply)
+	// Output: [one two]
+}
+
+func BenchmarkInprocHarness_RoundTrip(b *testing.B) {
+	_, send, cleanup, err := NewInprocHarness("echo", echoAction{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cleanup()
+
+	body := []byte("ping")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := send(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
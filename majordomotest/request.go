@@ -0,0 +1,32 @@
+package majordomotest
+
+import (
+	"errors"
+
+	majordomo_worker "github.com/ppeble/majordomo-worker-go"
+)
+
+// TestRequestClient is the client address requests built by NewTestRequest come from
+const TestRequestClient = "test-client"
+
+// Returned by ParseTestRequest when the frames aren't an MD_REQUEST in the standard envelope
+var ErrNotARequest = errors.New("Frames are not an MD_REQUEST")
+
+// NewTestRequest builds the MD_REQUEST frames a broker sends a worker for a request to service, in the standard
+// envelope (see majordomo_worker.StandardEnvelopeLayout), for testing actions and protocols layered on MDP without a
+// broker. MDP doesn't name the service in worker requests, so it's sent as the first body frame.
+func NewTestRequest(service string, body ...[]byte) [][]byte {
+	request := [][]byte{nil, []byte(majordomo_worker.MD_WORKER), []byte(majordomo_worker.MD_REQUEST), []byte(TestRequestClient), nil, []byte(service)}
+
+	return append(request, body...)
+}
+
+// ParseTestRequest splits frames built by NewTestRequest back into the service and the body
+func ParseTestRequest(frames [][]byte) (service string, body [][]byte, err error) {
+	layout := majordomo_worker.StandardEnvelopeLayout
+	if len(frames) <= layout.Body || string(frames[layout.Protocol]) != majordomo_worker.MD_WORKER || string(frames[layout.Command]) != majordomo_worker.MD_REQUEST {
+		return "", nil, ErrNotARequest
+	}
+
+	return string(frames[layout.Body]), frames[layout.Body+1:], nil
+}
@@ -0,0 +1,30 @@
+package majordomotest
+
+import (
+	"testing"
+
+	majordomo_worker "github.com/ppeble/majordomo-worker-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TestRequest_StandardEnvelope(t *testing.T) {
+	request := NewTestRequest("echo", []byte("hello"), []byte("world"))
+
+	assert.Equal(t, [][]byte{nil, []byte(majordomo_worker.MD_WORKER), []byte(majordomo_worker.MD_REQUEST), []byte(TestRequestClient), nil, []byte("echo"), []byte("hello"), []byte("world")}, request)
+}
+
+func Test_TestRequest_ParseRoundTrips(t *testing.T) {
+	service, body, err := ParseTestRequest(NewTestRequest("echo", []byte("hello")))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "echo", service)
+	assert.Equal(t, [][]byte{[]byte("hello")}, body)
+}
+
+func Test_TestRequest_ParseRejectsOtherFrames(t *testing.T) {
+	_, _, err := ParseTestRequest([][]byte{nil, []byte(majordomo_worker.MD_WORKER), []byte(majordomo_worker.MD_HEARTBEAT)})
+	assert.Equal(t, ErrNotARequest, err)
+
+	_, _, err = ParseTestRequest([][]byte{nil, []byte(majordomo_worker.MD_CLIENT), []byte(majordomo_worker.MD_REQUEST), []byte(TestRequestClient), nil, []byte("echo")})
+	assert.Equal(t, ErrNotARequest, err)
+}
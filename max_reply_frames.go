@@ -0,0 +1,17 @@
+package majordomo_worker
+
+// Applies WorkerConfig.MaxReplyFrames to the action's reply, before anything else is added to it
+func (w *mdWorker) limitReplyFrames(ctx RequestContext, reply [][]byte) [][]byte {
+	if w.maxReplyFrames <= 0 || len(reply) <= w.maxReplyFrames {
+		return reply
+	}
+
+	if w.maxReplyFramesPolicy == ReplyFramesTruncate {
+		logWarnf(w.logger, "Reply to '%s' has %d frames, truncating to %d", ctx.ReplyTo, len(reply), w.maxReplyFrames)
+		return reply[:w.maxReplyFrames]
+	}
+
+	logWarnf(w.logger, "Reply to '%s' has %d frames, more than the limit of %d, rejecting", ctx.ReplyTo, len(reply), w.maxReplyFrames)
+	w.stats.addError()
+	return w.errorReply(ErrTooManyReplyFrames)
+}
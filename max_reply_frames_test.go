@@ -0,0 +1,65 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func maxReplyFramesWorker(limit int, policy MaxReplyFramesPolicy) *mdWorker {
+	w := frameWorker(nil, nil)
+	w.maxReplyFrames = limit
+	w.maxReplyFramesPolicy = policy
+	w.errorReply = func(err error) [][]byte {
+		return [][]byte{[]byte("ERROR"), []byte(err.Error())}
+	}
+	return w
+}
+
+func numberedFrames(n int) [][]byte {
+	reply := make([][]byte, n)
+	for i := range reply {
+		reply[i] = []byte{byte('a' + i)}
+	}
+	return reply
+}
+
+func Test_MaxReplyFrames_UnderLimit(t *testing.T) {
+	for _, policy := range []MaxReplyFramesPolicy{ReplyFramesReject, ReplyFramesTruncate} {
+		w := maxReplyFramesWorker(3, policy)
+
+		assert.Equal(t, numberedFrames(3), w.limitReplyFrames(RequestContext{}, numberedFrames(3)))
+		assert.Empty(t, w.logger.(*testLogger).errors)
+		assert.Equal(t, uint64(0), w.Stats().Errors)
+	}
+}
+
+func Test_MaxReplyFrames_OverLimitRejected(t *testing.T) {
+	w := maxReplyFramesWorker(3, ReplyFramesReject)
+
+	reply := w.limitReplyFrames(RequestContext{ReplyTo: []byte("client")}, numberedFrames(4))
+
+	assert.Equal(t, [][]byte{[]byte("ERROR"), []byte(ErrTooManyReplyFrames.Error())}, reply)
+	assert.Equal(t, uint64(1), w.Stats().Errors)
+}
+
+func Test_MaxReplyFrames_OverLimitTruncated(t *testing.T) {
+	w := maxReplyFramesWorker(3, ReplyFramesTruncate)
+
+	reply := w.limitReplyFrames(RequestContext{ReplyTo: []byte("client")}, numberedFrames(4))
+
+	assert.Equal(t, numberedFrames(3), reply)
+	assert.Equal(t, uint64(0), w.Stats().Errors)
+}
+
+func Test_MaxReplyFrames_NotLimitedByDefault(t *testing.T) {
+	w := maxReplyFramesWorker(0, ReplyFramesReject)
+
+	assert.Equal(t, numberedFrames(100), w.limitReplyFrames(RequestContext{}, numberedFrames(100)))
+}
+
+func Test_MaxReplyFrames_NegativeIsInvalid(t *testing.T) {
+	config := WorkerConfig{BrokerAddress: "inproc://test", ServiceName: "test-service", MaxReplyFrames: -1}
+
+	assert.Equal(t, ErrInvalidMaxReplyFrames, config.validate())
+}
@@ -1,6 +1,13 @@
 package majordomo_worker
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
 const (
+	MD_CLIENT = "MDPC01"
 	MD_WORKER = "MDPW01"
 
 	MD_READY      = "\x01"
@@ -8,4 +15,69 @@ const (
 	MD_REPLY      = "\x03"
 	MD_HEARTBEAT  = "\x04"
 	MD_DISCONNECT = "\x05"
+
+	// MD_PARTIAL is a chunk of a reply that MD_REPLY finishes. Only MDP/0.2 has it, see MDP02Frames.
+	MD_PARTIAL = "\x07"
 )
+
+var commandNames = map[string]string{
+	MD_READY:      "READY",
+	MD_REQUEST:    "REQUEST",
+	MD_REPLY:      "REPLY",
+	MD_HEARTBEAT:  "HEARTBEAT",
+	MD_DISCONNECT: "DISCONNECT",
+	MD_PARTIAL:    "PARTIAL",
+}
+
+// The name of a command for logging, as the commands themselves are unprintable bytes. Commands that aren't part of
+// the protocol are shown in hex.
+func commandName(command string) string {
+	if name, found := commandNames[command]; found {
+		return name
+	}
+
+	return fmt.Sprintf("0x%x", command)
+}
+
+// The READY metadata key WorkerConfig.Weight is advertised as
+const readyWeightKey = "weight"
+
+// The configured READY metadata along with the worker's weight, which takes the place of any 'weight' entry
+func (c WorkerConfig) readyMetadata() map[string]string {
+	if c.Weight == 0 && !c.CompressionNegotiation {
+		return c.ReadyMetadata
+	}
+
+	metadata := make(map[string]string, len(c.ReadyMetadata)+2)
+	for key, value := range c.ReadyMetadata {
+		metadata[key] = value
+	}
+	if c.Weight != 0 {
+		metadata[readyWeightKey] = strconv.Itoa(c.Weight)
+	}
+	if c.CompressionNegotiation {
+		metadata[readyCodecsKey] = supportedCodecs
+	}
+
+	return metadata
+}
+
+// READY metadata is sent as one 'key=value' frame per entry, sorted by key
+func encodeReadyMetadata(metadata map[string]string) [][]byte {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	frames := make([][]byte, len(keys))
+	for i, key := range keys {
+		frames[i] = []byte(key + "=" + metadata[key])
+	}
+
+	return frames
+}
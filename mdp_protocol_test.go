@@ -0,0 +1,50 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CommandName_NamesProtocolCommands(t *testing.T) {
+	assert.Equal(t, "READY", commandName(MD_READY))
+	assert.Equal(t, "REQUEST", commandName(MD_REQUEST))
+	assert.Equal(t, "REPLY", commandName(MD_REPLY))
+	assert.Equal(t, "HEARTBEAT", commandName(MD_HEARTBEAT))
+	assert.Equal(t, "DISCONNECT", commandName(MD_DISCONNECT))
+	assert.Equal(t, "PARTIAL", commandName(MD_PARTIAL))
+}
+
+func Test_CommandName_UnknownCommandsInHex(t *testing.T) {
+	assert.Equal(t, "0x06", commandName("\x06"))
+	assert.Equal(t, "0x0aff", commandName("\x0a\xff"))
+}
+
+func Test_ReadyMetadata_WeightOnlyWhenSet(t *testing.T) {
+	config := WorkerConfig{ReadyMetadata: map[string]string{"region": "eu-west"}}
+	assert.Equal(t, [][]byte{[]byte("region=eu-west")}, encodeReadyMetadata(config.readyMetadata()))
+
+	config.Weight = 4
+	assert.Equal(t, [][]byte{[]byte("region=eu-west"), []byte("weight=4")}, encodeReadyMetadata(config.readyMetadata()))
+
+	// The configured metadata itself is left alone
+	assert.Len(t, config.ReadyMetadata, 1)
+}
+
+func Test_ReadyMetadata_WeightReplacesMetadataEntry(t *testing.T) {
+	config := WorkerConfig{ReadyMetadata: map[string]string{"weight": "1"}, Weight: 3}
+
+	assert.Equal(t, [][]byte{[]byte("weight=3")}, encodeReadyMetadata(config.readyMetadata()))
+}
+
+func Test_ReadyMetadata_AdvertisesCodecs(t *testing.T) {
+	config := WorkerConfig{CompressionNegotiation: true}
+
+	assert.Equal(t, [][]byte{[]byte("codecs=gzip,identity")}, encodeReadyMetadata(config.readyMetadata()))
+}
+
+func Test_ReadyMetadata_NegativeWeightRejected(t *testing.T) {
+	config := WorkerConfig{BrokerAddress: "inproc://test", ServiceName: "test-service", Weight: -1}
+
+	assert.Equal(t, ErrInvalidWeight, config.validate())
+}
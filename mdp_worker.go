@@ -1,19 +1,35 @@
 package majordomo_worker
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"math/rand"
+	"os"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/pebbe/zmq4"
 )
 
+const defaultConnectRetries = 2
+const defaultSendRetries = 3
+
 type mdWorker struct {
-	shutdown chan bool
+	shutdown       chan struct{}
+	shutdownOnce   sync.Once
+	forceReconnect chan struct{}
+	drain          chan drainRequest
+	heartbeatNow   chan chan error
+	reconfigureNow chan reconfiguration
+	restartNow     chan chan error
+
+	// As the worker was created or last reconfigured, only written on Receive()'s goroutine so only Config() locks
+	configMutex sync.RWMutex
+	config      WorkerConfig
 
 	brokerAddress string
 	serviceName   string
+	serviceNames  []string
 
 	heartbeat        time.Duration
 	reconnect        time.Duration
@@ -21,38 +37,501 @@ type mdWorker struct {
 	maxLivenessCount int
 	heartbeatAt      time.Time
 
-	sockets []mdWorkerSocket
-	context *zmq4.Context
+	idleAction   func()
+	idleInterval time.Duration
+	idleAt       time.Time
+
+	heartbeatNegotiation       bool
+	minHeartbeat, maxHeartbeat time.Duration
+	heartbeatJitter            time.Duration
+	reconnectStrategy          ReconnectStrategy
+	livenessGrace              time.Duration
+	jitterSource               *rand.Rand
+
+	connectRetries             int
+	connectRetryDelay          time.Duration
+	connectConfirmationTimeout time.Duration
+
+	startupProbe         func() error
+	startupProbeInterval time.Duration
+	startupProbeTimeout  time.Duration
+
+	clock Clock
+
+	reconnectLimiter ReconnectLimiter
+
+	breakerMaxReconnects int
+	breakerWindow        time.Duration
+	breakerCooldown      time.Duration
+	reconnectTimes       []time.Time
+	healthFunc           func() bool
+
+	stats *workerStats
+
+	metrics Metrics
+
+	tracer     Tracer
+	traceFrame int
+
+	errorReply       func(error) [][]byte
+	panicReply       func(interface{}) [][]byte
+	requestValidator func(body [][]byte) error
+	replyValidator   func(reply [][]byte) error
+	requestFilter    func(RequestContext, [][]byte) ([][]byte, bool)
+	filteredReply    [][]byte
+	recoverPanics    bool
+	actionTimeout    time.Duration
+
+	abandonedActionLimit int
+	replyFramePrefix     [][]byte
+	maxReplyFrames       int
+	maxReplyFramesPolicy MaxReplyFramesPolicy
+
+	inFlight inFlightRequests
+
+	signals     chan os.Signal
+	stopSignals chan struct{}
+
+	shutdownTimeout  time.Duration
+	flushTimeout     time.Duration
+	afterReplies     sync.WaitGroup
+	shutdownReported bool
+	shutdownDone     bool
+	stopping         int32
+	closeOnce        sync.Once
+	closeErr         error
+
+	returnReceiveErrors bool
+
+	serviceMismatchPolicy ServiceMismatchPolicy
+	serviceFrame          int
+	serviceMismatchReply  [][]byte
+
+	readyMetadata [][]byte
+	noReply       bool
+
+	resendReplyOnReconnect bool
+	disconnectOnMismatch   bool
+	unexpectedCommands     map[string]UnexpectedCommandAction
+
+	propagateDeadline     bool
+	deadlineFrame         int
+	propagateEnqueuedAt   bool
+	enqueuedAtFrame       int
+	propagateSessionToken bool
+	sessionTokenFrame     int
+	contextExtractor      func([][]byte) context.Context
+	deadlineExceededReply [][]byte
+	state                 interface{}
+
+	idempotencyCache *idempotencyCache
+	requestIDFrame   int
+	deduplicate      bool
+
+	maxRequestsBeforeRestart int
+	requestsSinceRestart     int
+
+	deadLetterMaxFailures int
+	deadLetterHandler     func(RequestContext)
+	failures              *failureCounts
+
+	batchAction   BatchWorkerAction
+	batchMaxSize  int
+	batchMaxWait  time.Duration
+	batch         []pendingRequest
+	batchDeadline time.Time
+
+	// Set by Pause() and Resume() from any goroutine, so only accessed atomically
+	paused    int32
+	pauseMode PauseMode
+	held      []heldRequest
+
+	envelope EnvelopeLayout
+	encoder  FrameEncoder
+	decoder  FrameDecoder
 
-	workerAction WorkerAction
-	logger       Logger
+	followRedirects       bool
+	disconnectGracePeriod time.Duration
+
+	receiveMiddleware func(frames [][]byte) bool
+
+	maxConcurrent int
+	requests      chan Request
+	slots         chan struct{}
+	completed     chan completedRequest
+	shortPolls    time.Duration
+
+	// Replies held back by a DelayedWorkerAction, in the order they are due
+	scheduledReplies []scheduledReply
+
+	sockets       []*mdWorkerSocket
+	context       *zmq4.Context
+	sharedContext bool
+	termTimeout   time.Duration
+	bind          bool
+
+	heartbeatsDisabled bool
+	manualLiveness     bool
+
+	slowThreshold time.Duration
+	slowHandler   func(RequestContext, time.Duration)
+
+	actionMutex        sync.RWMutex
+	workerAction       WorkerAction
+	socketConfigurator func(*zmq4.Socket) error
+	connectHook        func(*zmq4.Socket) error
+	socketMonitoring   bool
+	identity           string
+	identityFunc       func() ([]byte, error)
+	keptIdentities     map[string][]byte
+	framesHint         int
+	curve              curveKeys
+	tcpKeepalive       tcpKeepalive
+	zmtpHeartbeat      zmtpHeartbeat
+	ipcFilePermissions os.FileMode
+	sendTimeout        time.Duration
+	socketLinger       time.Duration
+	replyTimeout       time.Duration
+	streamChunkSize    int
+	sendRetries        int
+	replyInterceptor   func(RequestContext, [][]byte) [][]byte
+	afterReply         func(RequestContext, [][]byte, error)
+	onDisconnect       func(string)
+	compressMinBytes   int
+	negotiateCodecs    bool
+	maxDecodedBytes    int
+	logger             Logger
+	logLevel           *atomicLevel
+	logSampler         *logSampler
+	name, metricsLabel string
+
+	events chan WorkerEvent
 }
 
 func newWorker(context *zmq4.Context, logger Logger, config WorkerConfig) (*mdWorker, error) {
+	name := config.workerName()
+
+	connectRetries := config.ConnectRetries
+	if connectRetries == 0 {
+		connectRetries = defaultConnectRetries
+	} else if connectRetries < 0 {
+		connectRetries = 0
+	}
+
+	termTimeout := config.TermTimeout
+	if termTimeout == 0 {
+		termTimeout = defaultTermTimeout
+	}
+
+	sendRetries := config.SendRetries
+	if sendRetries == 0 {
+		sendRetries = defaultSendRetries
+	} else if sendRetries < 0 {
+		sendRetries = 0
+	}
+
+	connectRetryDelay := config.ConnectRetryDelay
+	if connectRetryDelay <= 0 {
+		connectRetryDelay = config.ReconnectInMillis
+	}
+
+	clock := config.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	eventBuffer := config.EventBuffer
+	if eventBuffer <= 0 {
+		eventBuffer = defaultEventBuffer
+	}
+
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
+	serviceMismatchReply := config.ServiceMismatchReply
+	if serviceMismatchReply == nil {
+		serviceMismatchReply = [][]byte{[]byte(defaultServiceMismatchReply)}
+	}
+
+	filteredReply := config.FilteredReply
+	if filteredReply == nil {
+		filteredReply = [][]byte{[]byte(defaultFilteredReply)}
+	}
+
+	reconnectStrategy := config.ReconnectStrategy
+	if reconnectStrategy == nil {
+		reconnectStrategy = LivenessReconnectStrategy{ByTime: config.LivenessByTime, Delay: config.ReconnectInMillis}
+	}
+
+	maxConcurrent := config.MaxConcurrentRequests
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	action := config.Action
+	var requests chan Request
+	if config.RequestQueue > 0 {
+		requests = make(chan Request, config.RequestQueue)
+		action = queueAction{requests}
+
+		// Every queued request takes a slot until it is replied to
+		maxConcurrent = config.RequestQueue
+	}
+
+	logLevel := newAtomicLevel(config.LogLevel)
+
+	idleInterval := config.IdleInterval
+	if idleInterval <= 0 {
+		idleInterval = config.HeartbeatInMillis
+	}
+
+	errorReply := config.ErrorReply
+	if errorReply == nil {
+		errorReply = defaultErrorReply
+	}
+
+	panicReply := config.PanicReply
+	if panicReply == nil {
+		panicReply = defaultPanicReply
+	}
+
+	var batchAction BatchWorkerAction
+	if config.BatchMaxSize > 0 {
+		batchAction, _ = batchActionOf(config.Action)
+	}
+
+	var cache *idempotencyCache
+	if config.IdempotencyCacheSize > 0 {
+		cache = newIdempotencyCache(config.IdempotencyCacheSize, config.IdempotencyCacheTTL, clock)
+	}
+
+	if config.DeduplicationWindow > 0 {
+		size := config.DeduplicationCacheSize
+		if size <= 0 {
+			size = defaultDeduplicationCacheSize
+		}
+		cache = newIdempotencyCache(size, config.DeduplicationWindow, clock)
+	}
+
+	stats := newWorkerStats(clock)
+
 	w := &mdWorker{
-		context:          context,
-		brokerAddress:    config.BrokerAddress,
-		serviceName:      config.ServiceName,
-		heartbeat:        config.HeartbeatInMillis,
-		reconnect:        config.ReconnectInMillis,
-		pollInterval:     config.PollingInterval,
-		maxLivenessCount: config.MaxHeartbeatLiveness,
-		workerAction:     config.Action,
-		shutdown:         make(chan bool),
-		logger:           logger,
+		context:                    context,
+		brokerAddress:              config.BrokerAddress,
+		serviceName:                config.registeredServiceName(),
+		serviceNames:               config.registeredServiceNames(),
+		name:                       name,
+		metricsLabel:               config.metricsLabel(),
+		heartbeat:                  config.HeartbeatInMillis,
+		reconnect:                  config.ReconnectInMillis,
+		pollInterval:               config.PollingInterval,
+		heartbeatNegotiation:       config.HeartbeatNegotiation,
+		minHeartbeat:               config.MinHeartbeat,
+		maxHeartbeat:               config.MaxHeartbeat,
+		heartbeatJitter:            config.HeartbeatJitter,
+		reconnectStrategy:          reconnectStrategy,
+		startupProbe:               config.StartupProbe,
+		startupProbeInterval:       config.StartupProbeInterval,
+		startupProbeTimeout:        config.StartupProbeTimeout,
+		livenessGrace:              config.LivenessGracePeriod,
+		idleAction:                 config.IdleAction,
+		idleInterval:               idleInterval,
+		jitterSource:               rand.New(rand.NewSource(time.Now().UnixNano())),
+		maxLivenessCount:           config.MaxHeartbeatLiveness,
+		workerAction:               action,
+		requests:                   requests,
+		socketConfigurator:         config.SocketConfigurator,
+		connectHook:                config.ConnectHook,
+		socketMonitoring:           config.SocketMonitoring,
+		identity:                   config.Identity,
+		identityFunc:               config.IdentityFunc,
+		curve:                      curveKeys{server: config.CurveServerKey, public: config.CurvePublicKey, secret: config.CurveSecretKey},
+		ipcFilePermissions:         config.IPCFilePermissions,
+		zmtpHeartbeat:              zmtpHeartbeat{interval: config.ZMTPHeartbeatInterval, timeout: config.ZMTPHeartbeatTimeout, ttl: config.ZMTPHeartbeatTTL},
+		tcpKeepalive:               tcpKeepalive{enabled: config.TCPKeepalive, idle: config.TCPKeepaliveIdle, interval: config.TCPKeepaliveInterval, count: config.TCPKeepaliveCount},
+		sendTimeout:                config.SendTimeout,
+		socketLinger:               config.SocketLinger,
+		replyTimeout:               config.ReplyTimeout,
+		sendRetries:                sendRetries,
+		replyInterceptor:           config.ReplyInterceptor,
+		afterReply:                 config.AfterReply,
+		streamChunkSize:            config.StreamChunkSize,
+		onDisconnect:               config.OnDisconnect,
+		compressMinBytes:           config.ReplyCompressionThreshold,
+		negotiateCodecs:            config.CompressionNegotiation,
+		maxDecodedBytes:            config.MaxDecodedRequestBytes,
+		connectRetries:             connectRetries,
+		connectRetryDelay:          connectRetryDelay,
+		connectConfirmationTimeout: config.ConnectConfirmationTimeout,
+		clock:                      clock,
+		stats:                      stats,
+		reconnectLimiter:           config.ReconnectLimiter,
+		breakerMaxReconnects:       config.ReconnectCircuitBreakerMaxReconnects,
+		breakerWindow:              config.ReconnectCircuitBreakerWindow,
+		breakerCooldown:            config.ReconnectCircuitBreakerCooldown,
+		healthFunc:                 config.HealthFunc,
+		metrics:                    metrics,
+		tracer:                     config.Tracer,
+		errorReply:                 errorReply,
+		panicReply:                 panicReply,
+		requestValidator:           config.RequestValidator,
+		replyValidator:             config.ReplyValidator,
+		requestFilter:              config.RequestFilter,
+		filteredReply:              filteredReply,
+		recoverPanics:              config.RecoverPanics,
+		actionTimeout:              config.ActionTimeout,
+		abandonedActionLimit:       config.AbandonedActionLimit,
+		replyFramePrefix:           config.ReplyFramePrefix,
+		maxReplyFrames:             config.MaxReplyFrames,
+		maxReplyFramesPolicy:       config.MaxReplyFramesPolicy,
+		traceFrame:                 config.TraceFrame,
+		serviceMismatchPolicy:      config.ServiceMismatchPolicy,
+		serviceFrame:               config.ServiceFrame,
+		serviceMismatchReply:       serviceMismatchReply,
+		readyMetadata:              encodeReadyMetadata(config.readyMetadata()),
+		noReply:                    config.NoReply,
+		resendReplyOnReconnect:     config.ResendReplyOnReconnect,
+		disconnectOnMismatch:       config.DisconnectOnProtocolMismatch,
+		unexpectedCommands:         unexpectedCommandActions(config.UnexpectedCommands),
+		propagateDeadline:          config.PropagateDeadline,
+		deadlineFrame:              config.DeadlineFrame,
+		propagateEnqueuedAt:        config.PropagateEnqueuedAt,
+		enqueuedAtFrame:            config.EnqueuedAtFrame,
+		propagateSessionToken:      config.PropagateSessionToken,
+		sessionTokenFrame:          config.SessionTokenFrame,
+		contextExtractor:           config.ContextExtractor,
+		state:                      config.State,
+		deadlineExceededReply:      [][]byte{[]byte(defaultDeadlineExceededReply)},
+		idempotencyCache:           cache,
+		maxRequestsBeforeRestart:   config.MaxRequestsBeforeRestart,
+		requestIDFrame:             config.RequestIDFrame,
+		deduplicate:                config.DeduplicationWindow > 0,
+		deadLetterMaxFailures:      config.DeadLetterMaxFailures,
+		deadLetterHandler:          config.DeadLetterHandler,
+		failures:                   newFailureCounts(deadLetterTracked),
+		batchAction:                batchAction,
+		batchMaxSize:               config.BatchMaxSize,
+		batchMaxWait:               config.BatchMaxWait,
+		pauseMode:                  config.PauseMode,
+		envelope:                   config.EnvelopeLayout.orStandard(),
+		followRedirects:            config.FollowDisconnectRedirects,
+		disconnectGracePeriod:      config.DisconnectGracePeriod,
+		encoder:                    config.FrameEncoder,
+		decoder:                    config.FrameDecoder,
+		receiveMiddleware:          config.ReceiveMiddleware,
+		maxConcurrent:              maxConcurrent,
+		shutdownTimeout:            config.ShutdownTimeout,
+		flushTimeout:               config.FlushTimeout,
+		returnReceiveErrors:        config.ReturnReceiveErrors,
+		termTimeout:                termTimeout,
+		bind:                       config.Bind,
+		heartbeatsDisabled:         config.DisableHeartbeats,
+		manualLiveness:             config.ManualLiveness,
+		slowThreshold:              config.SlowRequestThreshold,
+		slowHandler:                config.SlowRequestHandler,
+		slots:                      make(chan struct{}, maxConcurrent),
+		completed:                  make(chan completedRequest, maxConcurrent),
+		shutdown:                   make(chan struct{}),
+		forceReconnect:             make(chan struct{}, 1),
+		drain:                      make(chan drainRequest),
+		heartbeatNow:               make(chan chan error),
+		reconfigureNow:             make(chan reconfiguration),
+		restartNow:                 make(chan chan error),
+		config:                     config,
+		logger:                     workerLogger{logger, name, logLevel, stats.currentConnectionID},
+		logLevel:                   logLevel,
+		logSampler:                 newLogSampler(config.LogSampleRate),
+		events:                     make(chan WorkerEvent, eventBuffer),
+	}
+
+	if err := config.validate(); err != nil {
+		logErrorf(w.logger, "Invalid worker config, error: '%s'", err.Error())
+		return w, err
+	}
+
+	w.postponeIdle()
+
+	if len(config.ShutdownSignals) > 0 {
+		w.handleSignals(config.ShutdownSignals)
 	}
 
 	err := w.connectToBroker()
-	return w, err
+	w.stats.setLiveness(w.lowestLiveness())
+
+	if err != nil {
+		// A worker that failed to connect is never shut down, so its signals go back to their usual handling
+		w.restoreSignals()
+		return w, err
+	}
+
+	register(w)
+	return w, nil
 }
 
 func (w *mdWorker) Receive() (msg [][]byte, err error) {
 	for {
 		select {
 		case <-w.shutdown:
+			// The channel stays closed, so every later call ends up here too
+			if w.shutdownDone {
+				return msg, GracefulShutdown("Graceful Shutdown")
+			}
+			w.shutdownDone = true
+
+			w.emitFinal(WorkerEvent{Type: EventShuttingDown, Time: w.clock.Now()})
+			if len(w.batch) > 0 {
+				w.flushBatch()
+			}
+			drained := w.finishInFlight(w.shutdownTimeout)
+			w.sendScheduledReplies(true)
+			w.disconnectFromBroker()
+			w.reportShutdown(drained)
 			w.cleanup()
 			return msg, GracefulShutdown("Graceful Shutdown")
+		case r := <-w.drain:
+			r.result <- w.drainAndReconnect(r.timeout)
+		case result := <-w.heartbeatNow:
+			result <- w.sendHeartbeatsNow()
+		case r := <-w.reconfigureNow:
+			r.result <- w.reconfigure(r.config)
+		case result := <-w.restartNow:
+			result <- w.restartKeepingIdentity()
+		case <-w.forceReconnect:
+			for _, workerSocket := range w.sockets {
+				logDebugf(w.logger, "Forcing reconnect to broker at '%s'", workerSocket.address)
+				w.reconnectToBroker(workerSocket, 0)
+			}
 		default:
+			w.sendScheduledReplies(false)
+
+			if w.restartDue() {
+				w.restart()
+			}
+
+			if reply, handled := w.resumeHeld(); handled {
+				msg = reply
+				return
+			}
+
+			if reply, replied := w.replyToCompleted(); replied {
+				msg = reply
+				return
+			}
+
+			if w.atCapacity() {
+				// Leave requests with the brokers until an action finishes, but keep heartbeating meanwhile
+				select {
+				case completed := <-w.completed:
+					msg = w.finishCompleted(completed)
+					return
+				case <-w.clock.After(w.untilReplyDue(w.pollInterval)):
+					w.sendHeartbeats()
+				}
+				continue
+			}
+
 			poller := zmq4.NewPoller()
 
 			for _, workerSocket := range w.sockets {
@@ -60,9 +539,11 @@ func (w *mdWorker) Receive() (msg [][]byte, err error) {
 			}
 
 			var polledSockets []zmq4.Polled
+			pollTimeout := w.untilGraceEnds(w.pollTimeout())
+			replyTimeout := w.untilReplyDue(pollTimeout)
 
 			for {
-				polledSockets, err = poller.Poll(w.pollInterval)
+				polledSockets, err = poller.Poll(replyTimeout)
 
 				if err != zmq4.Errno(syscall.EINTR) {
 					break
@@ -70,101 +551,866 @@ func (w *mdWorker) Receive() (msg [][]byte, err error) {
 
 			}
 
+			if zmq4.AsErrno(err) == zmq4.ETERM {
+				return nil, w.contextTerminated()
+			}
+
 			if err != nil {
-				logError(w.logger, fmt.Sprintf("Polling failed, error: %s", err.Error()))
+				if err = w.handlePollError(err); err != nil {
+					return nil, err
+				}
 				continue
 			}
 
-			if len(polledSockets) > 0 {
-				for _, polledSocket := range polledSockets {
-					msg, _ = polledSocket.Socket.RecvMessageBytes(0)
+			// Every poll costs a point of liveness, hearing from the broker restores it (see handleMessage)
+			var costsLiveness bool
+			if replyTimeout < pollTimeout {
+				costsLiveness = w.shortPollCostsLiveness(replyTimeout)
+			} else {
+				costsLiveness = w.pollCostsLiveness(pollTimeout)
+			}
+			if w.livenessRunsDown() && costsLiveness {
+				for _, workerSocket := range w.sockets {
+					workerSocket.liveness--
+				}
+			}
+
+			for _, polledSocket := range polledSockets {
+				if w.atCapacity() {
+					// Anything left unread is still there at the next poll
+					break
+				}
 
-					if len(msg) < 3 {
-						logError(w.logger, fmt.Sprintf("Received invalid message (not enough frames), received %d", len(msg)))
-						continue // ignore invalid messages
-					}
+				polledWorkerSocket := w.findWorkerSocket(polledSocket.Socket)
 
-					polledWorkerSocket := w.findWorkerSocket(polledSocket.Socket)
-					polledWorkerSocket.liveness = w.maxLivenessCount
-
-					switch command := string(msg[2]); command {
-					case MD_REQUEST:
-						logDebug(w.logger, fmt.Sprintf("Received MD_REQUEST from broker with message '%q'", msg[5:]))
-						replyTo := msg[3]
-
-						actionResponse := w.workerAction.Call(msg[5:])
-						reply := [][]byte{nil}
-						reply = append(reply, actionResponse...)
-
-						w.sendToBroker(polledWorkerSocket.socket, MD_REPLY, replyTo, reply)
-
-						msg = actionResponse
-						return
-					case MD_DISCONNECT:
-						logDebug(w.logger, "Received MD_DISCONNECT from broker")
-						polledWorkerSocket.connect() // Initiate a reconnect
-						w.sendToBroker(polledWorkerSocket.socket, MD_READY, []byte(w.serviceName), nil)
-					case MD_HEARTBEAT:
-						// Do nothing, ANY message coming in acts as a heartbeat so we handle it above
-						logDebug(w.logger, "Received MD_HEARTBEAT from broker")
-					default:
-						// Do nothing, if we received something we don't recognize we'll just ignore it
-						logDebug(w.logger, fmt.Sprintf("Received unknown command of %s'", msg[2]))
+				msg, err = w.receiveMessage(polledSocket.Socket)
+				if err != nil {
+					if err = w.handleReceiveError(polledWorkerSocket, err); err != nil {
+						return nil, err
 					}
+					continue
 				}
-			} else {
-				for _, workerSocket := range w.sockets {
-					if workerSocket.liveness--; workerSocket.liveness <= 0 {
-						logWarn(w.logger, fmt.Sprintf("Worker at address '%s' has received nothing from the broker for %d polls, sleeping for %s and reconnecting", workerSocket.address, w.maxLivenessCount, w.reconnect))
-						time.Sleep(w.reconnect)
-						workerSocket.connect()
-						w.sendToBroker(workerSocket.socket, MD_READY, []byte(w.serviceName), nil)
-					}
+
+				w.received(msg)
+
+				if reply, handled := w.handleMessage(polledWorkerSocket, msg); handled {
+					msg = reply
+					return
 				}
 			}
 
+			w.stats.setLiveness(w.lowestLiveness())
+			if metrics, ok := w.metrics.(ReconnectRateMetrics); ok {
+				// Reported every poll rather than every reconnect so it falls back once the reconnects stop
+				metrics.ReconnectRate(w.metricsLabel, w.stats.reconnectRate())
+			}
+
 			for _, workerSocket := range w.sockets {
-				if workerSocket.heartbeatAt.Before(time.Now()) {
-					w.sendToBroker(workerSocket.socket, MD_HEARTBEAT, nil, nil)
-					workerSocket.heartbeatAt = time.Now().Add(w.heartbeat)
+				w.metrics.Liveness(w.metricsLabel, workerSocket.liveness)
+
+				// A broker the pause disconnected from has no reason to heartbeat until the worker registers again
+				if workerSocket.pausedDisconnected {
+					continue
+				}
+
+				if reconnect, delay := w.shouldReconnect(workerSocket); reconnect {
+					silence := w.clock.Now().Sub(workerSocket.lastHeardAt)
+					logWarnf(w.logger, "Worker at address '%s' has received nothing from the broker for %s (liveness %d), sleeping for %s and reconnecting", workerSocket.address, silence, workerSocket.liveness, delay)
+					w.emit(EventDisconnected, workerSocket.address)
+					w.reconnectToBroker(workerSocket, delay)
 				}
 			}
+
+			w.sendHeartbeats()
+			w.idle()
+
+			if w.batchDue() {
+				msg = w.flushBatch()
+				return
+			}
 		}
 	}
 }
 
+// Handles a single message from the broker, returning the reply and true if it was a request the action handled.
+//
+// Liveness is restored by any well formed message except MD_DISCONNECT, so heartbeats and requests both count
+// but a malformed message or a broker telling us to go away does not. Empty messages, which some socket states
+// produce, are ignored before anything else looks at them.
+func (w *mdWorker) handleMessage(workerSocket *mdWorkerSocket, msg [][]byte) ([][]byte, bool) {
+	if len(msg) == 0 {
+		logDebugf(w.logger, "Received empty message from broker at '%s', ignoring it", workerSocket.address)
+		return nil, false
+	}
+
+	if w.receiveMiddleware != nil && w.receiveMiddleware(msg) {
+		return nil, false
+	}
+
+	if len(msg) < w.envelope.minFrames() {
+		logErrorf(w.logger, "Received invalid message (not enough frames), received %d", len(msg))
+		w.stats.addError()
+		return nil, false // ignore invalid messages
+	}
+
+	protocol, err := w.frameDecoder().DecodeProtocol(msg[w.envelope.Protocol])
+	if err != nil {
+		logErrorf(w.logger, "Received invalid protocol frame from broker at '%s', error: '%s'", workerSocket.address, err.Error())
+		w.stats.addError()
+		return nil, false
+	}
+
+	if protocol != MD_WORKER {
+		logWarnf(w.logger, "Protocol mismatch, broker at '%s' speaks '%s' but worker speaks '%s', dropping message", workerSocket.address, protocol, MD_WORKER)
+		w.stats.addError()
+
+		if w.disconnectOnMismatch {
+			w.sendToBroker(workerSocket.socket, MD_DISCONNECT, nil, nil)
+		}
+		return nil, false
+	}
+
+	command, err := w.frameDecoder().DecodeCommand(msg[w.envelope.Command])
+	if err != nil {
+		logErrorf(w.logger, "Received invalid command frame from broker at '%s', error: '%s'", workerSocket.address, err.Error())
+		w.stats.addError()
+		w.commandReceived("")
+		return nil, false
+	}
+	w.commandReceived(command)
+
+	if command != MD_DISCONNECT {
+		w.heardFrom(workerSocket)
+		workerSocket.unconfirmedReply = nil
+	}
+
+	switch command {
+	case MD_REQUEST:
+		if len(msg) < w.envelope.minRequestFrames() {
+			logErrorf(w.logger, "Received invalid request (not enough frames), received %d", len(msg))
+			w.stats.addError()
+			return nil, false
+		}
+
+		if w.logSampler.sampleReceived() {
+			logDebugf(w.logger, "Received command '%s' from broker with message '%q'", commandName(MD_REQUEST), msg[w.envelope.Body:])
+		}
+		if w.isPaused() {
+			w.pauseRequest(workerSocket, msg)
+			return nil, false
+		}
+		return w.handleRequest(workerSocket, msg)
+	case MD_DISCONNECT:
+		logDebugf(w.logger, "Received command '%s' from broker", commandName(MD_DISCONNECT))
+		if w.disconnectSuppressed(workerSocket) {
+			return nil, false
+		}
+		w.emit(EventDisconnected, workerSocket.address)
+		if w.onDisconnect != nil {
+			// On its own goroutine so it doesn't hold up the reconnect
+			go w.onDisconnect(workerSocket.address)
+		}
+		if w.disconnectDrain(msg) {
+			w.drainRequests(workerSocket)
+		} else if address, redirected := w.disconnectRedirect(workerSocket, msg); redirected {
+			logWarnf(w.logger, "Broker at '%s' redirected the worker to '%s'", workerSocket.address, address)
+			workerSocket.address = address
+		}
+		w.reconnectToBroker(workerSocket, 0)
+	case MD_HEARTBEAT:
+		// Liveness has already been restored above
+		logDebugf(w.logger, "Received command '%s' from broker", commandName(MD_HEARTBEAT))
+		w.stats.heartbeatReceived(w.clock.Now())
+		w.heartbeatAnswered(workerSocket)
+		if w.heartbeatNegotiation && len(msg) > w.envelope.Command+1 {
+			w.negotiateHeartbeat(msg[w.envelope.Command+1])
+		}
+	default:
+		w.handleUnexpectedCommand(workerSocket, command)
+	}
+
+	return nil, false
+}
+
+// Partial or interrupted receives are skipped, the error is only returned if Receive() can't carry on
+func (w *mdWorker) handleReceiveError(workerSocket *mdWorkerSocket, err error) error {
+	logErrorf(w.logger, "Receiving from broker at '%s' failed, error: '%s'", workerSocket.address, err.Error())
+	w.stats.addError()
+	workerSocket.consecutiveErrors++
+
+	switch zmq4.AsErrno(err) {
+	case zmq4.ETERM:
+		return w.contextTerminated()
+	case zmq4.Errno(syscall.EINTR):
+		return nil
+	case zmq4.Errno(syscall.EAGAIN):
+		// Spurious, ZeroMQ delivers multipart messages whole so one that polling reported is never left half read
+		return nil
+	}
+
+	if w.returnReceiveErrors {
+		return err
+	}
+
+	// Whatever state the socket is in (i.e. EFSM), a fresh one starts clean
+	logWarnf(w.logger, "Reconnecting to broker at '%s' after the receive error", workerSocket.address)
+	w.reconnectToBroker(workerSocket, w.reconnect)
+
+	return nil
+}
+
+// Poll errors aren't tied to one broker so every socket is reconnected, unless they're returned to the caller
+func (w *mdWorker) handlePollError(err error) error {
+	logErrorf(w.logger, "Polling failed, error: %s", err.Error())
+	w.stats.addError()
+
+	if w.returnReceiveErrors {
+		return err
+	}
+
+	for _, workerSocket := range w.sockets {
+		w.reconnectToBroker(workerSocket, w.reconnect)
+	}
+
+	return nil
+}
+
+// Returns the reply to the request and whether the action actually handled it
+func (w *mdWorker) handleRequest(workerSocket *mdWorkerSocket, msg [][]byte) ([][]byte, bool) {
+	receivedAt := w.clock.Now()
+	w.emit(EventRequestReceived, workerSocket.address)
+	w.stats.addRequest()
+	w.requestsSinceRestart++
+	w.metrics.RequestReceived(w.metricsLabel)
+	w.postponeIdle()
+
+	// Batched and concurrent requests stay queued until their reply has been sent
+	pending := false
+	w.stats.requestQueued()
+	defer func() {
+		if !pending {
+			w.stats.requestsDone(1)
+		}
+	}()
+
+	ctx := RequestContext{
+		ServiceName:   w.socketService(workerSocket),
+		BrokerAddress: workerSocket.address,
+		ReplyTo:       msg[w.envelope.ReplyTo],
+		Request:       msg[w.envelope.Body:],
+		RawRequest:    copyFrames(msg),
+		ReceivedAt:    receivedAt,
+		WorkerState:   w.state,
+	}
+	if err := w.decodeRequest(&ctx); err != nil {
+		logWarnf(w.logger, "Rejecting request from '%s' that couldn't be decoded, error: '%s'", ctx.ReplyTo, err.Error())
+		w.sendReply(workerSocket, ctx, w.errorReply(err))
+		return nil, false
+	}
+	ctx.Deadline = w.requestDeadline(ctx.Request)
+	ctx.EnqueuedAt = w.requestEnqueuedAt(ctx.Request)
+	ctx.SessionToken = w.requestSessionToken(ctx.Request)
+	w.extractContext(&ctx)
+	w.reportQueueLatency(ctx)
+
+	if !w.checkService(workerSocket, ctx) {
+		return nil, false
+	}
+
+	if w.deadlineExceeded(ctx) {
+		logWarnf(w.logger, "Dropping request, its deadline of %s has passed", ctx.Deadline)
+		w.sendReply(workerSocket, ctx, w.deadlineExceededReply)
+		return nil, false
+	}
+
+	if w.requestValidator != nil {
+		if err := w.requestValidator(ctx.Request); err != nil {
+			logWarnf(w.logger, "Rejecting invalid request, error: '%s'", err.Error())
+			w.sendReply(workerSocket, ctx, w.errorReply(err))
+			return nil, false
+		}
+	}
+
+	if w.requestFilter != nil {
+		body, drop := w.requestFilter(ctx, ctx.Request)
+		if drop {
+			logDebugf(w.logger, "Dropping request from '%s', the request filter rejected it", ctx.ReplyTo)
+			w.sendReply(workerSocket, ctx, w.filteredReply)
+			return nil, false
+		}
+		ctx.Request = body
+	}
+
+	requestID, cacheable := w.requestID(ctx)
+	if cacheable {
+		if cachedResponse, found := w.idempotencyCache.get(requestID); found {
+			logDebugf(w.logger, "Replaying cached reply for request ID '%s'", requestID)
+			w.sendReply(workerSocket, ctx, cachedResponse)
+			return cachedResponse, true
+		}
+	}
+
+	if w.deadLetter(workerSocket, ctx) {
+		return nil, false
+	}
+
+	if w.batching() {
+		pending = true
+		return w.addToBatch(workerSocket, ctx)
+	}
+
+	if w.concurrent() {
+		pending = true
+		w.dispatch(workerSocket, ctx, requestID, cacheable)
+		return nil, false
+	}
+
+	finishTrace := w.startTrace(ctx)
+
+	actionStart := w.clock.Now()
+	result := w.callAction(ctx)
+	elapsed := w.clock.Now().Sub(actionStart)
+	w.metrics.ActionDuration(w.metricsLabel, elapsed)
+	w.checkSlow(ctx, elapsed)
+	w.recordOutcome(ctx, result.err)
+
+	if result.stream != nil {
+		w.streamReply(workerSocket, ctx, result.stream)
+		return nil, true
+	}
+
+	actionResponse := result.reply
+	if result.err != nil {
+		// Failures aren't cached so a retry gets another chance
+		actionResponse = w.actionFailed(result.err)
+	} else if cacheable {
+		w.idempotencyCache.put(requestID, actionResponse)
+	}
+
+	if w.delaysReply(result) {
+		w.scheduleReply(workerSocket, ctx, finishTrace(actionResponse), result.delay)
+		return actionResponse, true
+	}
+
+	w.sendReply(workerSocket, ctx, finishTrace(actionResponse))
+	w.sendRouted(workerSocket, ctx, result)
+	return actionResponse, true
+}
+
+// Applies the service mismatch policy, returning false if the request shouldn't be processed
+func (w *mdWorker) checkService(workerSocket *mdWorkerSocket, ctx RequestContext) bool {
+	if w.serviceMismatchPolicy == ServiceCheckDisabled {
+		return true
+	}
+
+	if w.serviceFrame < len(ctx.Request) && string(ctx.Request[w.serviceFrame]) == ctx.ServiceName {
+		return true
+	}
+
+	var requestedService []byte
+	if w.serviceFrame < len(ctx.Request) {
+		requestedService = ctx.Request[w.serviceFrame]
+	}
+
+	logWarnf(w.logger, "Received request for service '%s' but worker provides '%s'", requestedService, ctx.ServiceName)
+
+	switch w.serviceMismatchPolicy {
+	case ServiceMismatchReject:
+		w.sendReply(workerSocket, ctx, w.serviceMismatchReply)
+		return false
+	case ServiceMismatchReconnect:
+		w.reconnectToBroker(workerSocket, 0)
+		return false
+	default:
+		return true
+	}
+}
+
+// Sends the requester's reply, which is resent after reconnecting if the broker may have lost it (see
+// ResendReplyOnReconnect)
+func (w *mdWorker) sendReply(workerSocket *mdWorkerSocket, ctx RequestContext, actionResponse [][]byte) {
+	reply, sent := w.deliverReply(workerSocket, ctx, actionResponse)
+
+	if sent && w.resendReplyOnReconnect {
+		workerSocket.unconfirmedReply = &sentReply{replyTo: ctx.ReplyTo, reply: reply}
+	}
+}
+
+// Sends a reply to ctx.ReplyTo, returning the frames sent after the client's address and false if replies are
+// disabled. Routed replies are sent with it directly so they never take the requester's place for resending.
+func (w *mdWorker) deliverReply(workerSocket *mdWorkerSocket, ctx RequestContext, actionResponse [][]byte) ([][]byte, bool) {
+	if w.noReply {
+		logDebugf(w.logger, "Not replying to '%s', replies are disabled", ctx.ReplyTo)
+		return nil, false
+	}
+
+	replyBody := w.limitReplyFrames(ctx, actionResponse)
+	if w.replyInterceptor != nil {
+		replyBody = w.replyInterceptor(ctx, replyBody)
+	}
+	replyBody = w.withSessionToken(ctx, w.encodeReply(ctx, replyBody))
+
+	reply := replyFrames(w.replyFramePrefix, replyBody)
+
+	err := w.sendReplyOrReconnect(workerSocket, ctx.ReplyTo, reply)
+	w.emit(EventReplySent, workerSocket.address)
+
+	if w.afterReply != nil {
+		// On its own goroutine so it doesn't hold up the next request, shutting down waits for it (see FlushTimeout)
+		w.afterReplies.Add(1)
+		go func() {
+			defer w.afterReplies.Done()
+			w.afterReply(ctx, replyBody, err)
+		}()
+	}
+
+	return reply, true
+}
+
+// The empty frame separates the client's address from the body, whose frames are sent as they are. A nil or empty
+// body is an empty reply, the delimiter with nothing after it, rather than a body of one nil frame. The prefix (see
+// WorkerConfig.ReplyFramePrefix) goes between the delimiter and the body.
+func replyFrames(prefix, body [][]byte) [][]byte {
+	reply := make([][]byte, 1, len(prefix)+len(body)+1)
+	reply[0] = []byte{}
+	reply = append(reply, prefix...)
+
+	return append(reply, body...)
+}
+
+// Sends the last reply again after reconnecting if the broker wasn't heard from since it was first sent, in case it
+// was lost with the old connection. It is only ever resent once.
+func (w *mdWorker) resendUnconfirmedReply(workerSocket *mdWorkerSocket) {
+	unconfirmed := workerSocket.unconfirmedReply
+	if unconfirmed == nil {
+		return
+	}
+
+	workerSocket.unconfirmedReply = nil
+
+	logWarnf(w.logger, "Resending reply to '%s' to broker at '%s', it may have been lost", unconfirmed.replyTo, workerSocket.address)
+	w.sendToBroker(workerSocket.socket, MD_REPLY, unconfirmed.replyTo, unconfirmed.reply)
+	w.emit(EventReplySent, workerSocket.address)
+}
+
+// Returns the request ID used by the idempotency cache, requests without one are never cached. When deduplicating
+// the hash of the whole body stands in for it.
+func (w *mdWorker) requestID(ctx RequestContext) (string, bool) {
+	if w.idempotencyCache == nil {
+		return "", false
+	}
+
+	if w.deduplicate {
+		return bodyHash(ctx.Request), true
+	}
+
+	return w.requestFrameID(ctx)
+}
+
+// The body frame at RequestIDFrame, if the request has one
+func (w *mdWorker) requestFrameID(ctx RequestContext) (string, bool) {
+	if w.requestIDFrame >= len(ctx.Request) {
+		return "", false
+	}
+
+	return string(ctx.Request[w.requestIDFrame]), true
+}
+
 func (w *mdWorker) Shutdown() {
-	logDebug(w.logger, "Worker attempting graceful shutdown...")
-	w.shutdown <- true
+	w.shutdownOnce.Do(func() {
+		logDebug(w.logger, "Worker attempting graceful shutdown...")
+		w.stop()
+		close(w.shutdown)
+	})
+}
+
+// ForceReconnect asks Receive() to reconnect to every broker at its next poll, see Worker.ForceReconnect
+func (w *mdWorker) ForceReconnect() {
+	select {
+	case w.forceReconnect <- struct{}{}:
+	default:
+		// A reconnect is already pending
+	}
+}
+
+type drainRequest struct {
+	timeout time.Duration
+	result  chan error
+}
+
+func (w *mdWorker) DrainAndReconnect(timeout time.Duration) error {
+	// Receive() would have nothing to bound waiting for the actions in hand by
+	if timeout <= 0 {
+		return ErrDrainTimeout
+	}
+
+	timedOut := w.clock.After(timeout)
+	result := make(chan error, 1)
+
+	select {
+	case w.drain <- drainRequest{timeout, result}:
+	case <-timedOut:
+		return ErrDrainTimeout
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-timedOut:
+		return ErrDrainTimeout
+	}
+}
+
+// Finishes any pending batch, tells every broker we're leaving and then connects to them again after the
+// reconnect delay, by which time an upgraded broker should be up. Actions still running after the caller's timeout
+// are abandoned as on shutdown, and once shutdown has started it is left to finish them.
+// Returns the first error reconnecting, carrying on with the other brokers regardless
+func (w *mdWorker) drainAndReconnect(timeout time.Duration) error {
+	logDebug(w.logger, "Draining and reconnecting to brokers")
+
+	if len(w.batch) > 0 {
+		w.flushBatch()
+	}
+	if !w.finishInFlightUnless(timeout, w.shutdown) && w.stopped() {
+		return GracefulShutdown("Graceful Shutdown")
+	}
+
+	w.disconnectFromBroker()
+
+	var firstErr error
+	for _, workerSocket := range w.sockets {
+		w.emit(EventDisconnected, workerSocket.address)
+		if err := w.reconnectToBroker(workerSocket, w.reconnect); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (w *mdWorker) Liveness() int {
+	return w.stats.currentLiveness()
+}
+
+// Returns the liveness of the broker closest to being considered dead. Only safe to call from Receive()'s goroutine.
+func (w *mdWorker) lowestLiveness() int {
+	lowest := 0
+	for i, workerSocket := range w.sockets {
+		if i == 0 || workerSocket.liveness < lowest {
+			lowest = workerSocket.liveness
+		}
+	}
+
+	return lowest
+}
+
+func (w *mdWorker) Stats() WorkerStats {
+	stats := w.stats.snapshot()
+	if stats.Healthy && w.healthFunc != nil {
+		stats.Healthy = w.healthFunc()
+	}
+	return stats
+}
+
+func (w *mdWorker) QueueDepth() int {
+	return w.stats.queued()
+}
+
+func (w *mdWorker) Reset() {
+	w.stats.reset()
+}
+
+func (w *mdWorker) SetAction(action WorkerAction) {
+	if action == nil {
+		logError(w.logger, "Ignoring nil action")
+		return
+	}
+
+	if err := w.setAction(action); err != nil {
+		logErrorf(w.logger, "Ignoring action, error: '%s'", err.Error())
+	}
+}
+
+func (w *mdWorker) setAction(action WorkerAction) error {
+	batchAction, ok := batchActionOf(action)
+	if w.batching() && !ok {
+		return ErrBatchingUnsupported
+	}
+
+	w.actionMutex.Lock()
+	defer w.actionMutex.Unlock()
+
+	w.workerAction = action
+	if w.batching() {
+		w.batchAction = batchAction
+	}
+	return nil
+}
+
+// Returns the current action, requests hold on to it until they're done so SetAction doesn't affect them
+func (w *mdWorker) action() WorkerAction {
+	w.actionMutex.RLock()
+	defer w.actionMutex.RUnlock()
+
+	return w.workerAction
+}
+
+func (w *mdWorker) Context() *zmq4.Context {
+	return w.context
+}
+
+func (w *mdWorker) Events() <-chan WorkerEvent {
+	return w.events
 }
 
 func (w *mdWorker) connectToBroker() (err error) {
-	addresses := strings.Split(w.brokerAddress, ",")
+	addresses := brokerAddresses(w.brokerAddress)
 
-	w.sockets = make([]mdWorkerSocket, 0)
+	w.sockets = make([]*mdWorkerSocket, 0)
 
+	if err := w.awaitStartupProbe(w.startupProbeTimeout); err != nil {
+		return err
+	}
+
+	w.startConnection()
 	for _, address := range addresses {
-		logDebug(w.logger, fmt.Sprintf("Attempting connection to broker at '%s'", address))
+		for _, serviceName := range w.serviceNames {
+			workerSocket, err := w.registerWithRetries(address, serviceName)
+			if err != nil {
+				return err
+			}
+
+			logDebugf(w.logger, "Connected successfully to broker at '%s' as '%s'", address, serviceName)
+			w.stats.addConnect()
+			w.emit(EventConnected, address)
+
+			w.sockets = append(w.sockets, workerSocket)
+		}
+	}
+
+	return
+}
+
+// Replaces the socket for a single broker and registers with it again, unless the reconnect circuit
+// breaker is open in which case the socket is left as is until the cooldown passes. Returns why the worker isn't
+// registered with the broker afterwards, which most callers leave to liveness to retry.
+func (w *mdWorker) reconnectToBroker(workerSocket *mdWorkerSocket, delay time.Duration) error {
+	if !w.allowReconnect() {
+		logWarnf(w.logger, "Reconnect circuit breaker is open, not reconnecting to broker at '%s'", workerSocket.address)
+		return ErrBrokerUnreachable
+	}
 
-		heartbeatAt := time.Now().Add(w.heartbeat)
+	if w.stopped() {
+		return GracefulShutdown("Graceful Shutdown")
+	}
+
+	w.emit(EventReconnecting, workerSocket.address)
+	w.clock.Sleep(delay)
+
+	if err := w.waitToReconnect(workerSocket); err != nil {
+		return err
+	}
+
+	// Shutdown() may have been called while we waited, in which case the sockets are about to be closed
+	if w.stopped() {
+		logDebugf(w.logger, "Shutting down, not reconnecting to broker at '%s'", workerSocket.address)
+		return GracefulShutdown("Graceful Shutdown")
+	}
+
+	if err := w.awaitStartupProbe(w.reconnectProbeTimeout()); err != nil {
+		w.stats.addError()
+		return err
+	}
+
+	w.startConnection()
+	w.resetHeartbeatLatency(workerSocket)
+	w.dropScheduledReplies(workerSocket)
+	if err := workerSocket.connect(); err != nil {
+		logErrorf(w.logger, "Reconnect to broker at '%s' failed, error: '%s'", workerSocket.address, err.Error())
+		w.stats.addError()
+		return err
+	}
+
+	if err := w.sendReadyWithRetries(workerSocket.socket, workerSocket.address, w.socketService(workerSocket)); err != nil {
+		// Not registered, so give up on the broker straight away and reconnect again after the next poll
+		workerSocket.liveness = 0
+		return ErrBrokerUnreachable
+	}
+
+	workerSocket.lastHeardAt = w.clock.Now()
+	w.resendUnconfirmedReply(workerSocket)
+	w.stats.addReconnect()
+	w.metrics.Reconnected(w.metricsLabel)
+	w.emit(EventConnected, workerSocket.address)
+
+	return nil
+}
+
+// Tracks reconnects within the circuit breaker window and trips the breaker once there have been too many
+func (w *mdWorker) allowReconnect() bool {
+	if w.breakerMaxReconnects <= 0 {
+		return true
+	}
+
+	now := w.clock.Now()
+
+	if now.Before(w.stats.unhealthyUntilTime()) {
+		return false
+	}
+
+	cutoff := now.Add(-w.breakerWindow)
+
+	recentReconnects := w.reconnectTimes[:0]
+	for _, reconnectAt := range w.reconnectTimes {
+		if reconnectAt.After(cutoff) {
+			recentReconnects = append(recentReconnects, reconnectAt)
+		}
+	}
+	w.reconnectTimes = recentReconnects
+
+	if len(w.reconnectTimes) >= w.breakerMaxReconnects {
+		logWarnf(w.logger, "%d reconnects within %s, tripping reconnect circuit breaker for %s", len(w.reconnectTimes), w.breakerWindow, w.breakerCooldown)
+		w.stats.setUnhealthyUntil(now.Add(w.breakerCooldown))
+		w.reconnectTimes = nil
+		return false
+	}
+
+	w.reconnectTimes = append(w.reconnectTimes, now)
+	return true
+}
+
+// Connects to the broker and registers as the service, retrying WorkerConfig.ConnectRetries times. ZeroMQ connects
+// in the background, so a broker that isn't up yet is only noticed when it doesn't confirm the connection.
+func (w *mdWorker) registerWithRetries(address, serviceName string) (*mdWorkerSocket, error) {
+	for attempt := 0; ; attempt++ {
+		workerSocket, err := w.register(address, serviceName)
+		if err == nil {
+			return workerSocket, nil
+		}
+
+		if attempt >= w.connectRetries {
+			return nil, err
+		}
+
+		logWarnf(w.logger, "Retrying connection to broker at '%s' in %s (%d of %d)", address, w.connectRetryDelay, attempt+1, w.connectRetries)
+		w.clock.Sleep(w.connectRetryDelay)
+	}
+}
+
+func (w *mdWorker) register(address, serviceName string) (*mdWorkerSocket, error) {
+	logDebugf(w.logger, "Attempting connection to broker at '%s'", address)
+
+	heartbeatAt := w.nextHeartbeatAt()
+
+	var monitor func(string, *zmq4.Socket) (*socketMonitor, error)
+	if w.socketMonitoring {
+		monitor = w.monitorSocket
+	}
+
+	workerSocket, err := createWorkerSocket(address, w.context, w.maxLivenessCount, heartbeatAt, w.logger, w.configureSocket, w.bind, w.socketLinger, monitor)
+	if err != nil {
+		logErrorf(w.logger, "Error connecting to broker address '%s', error: '%s'", address, err.Error())
+		return nil, ErrBrokerUnreachable
+	}
+	workerSocket.lastHeardAt = w.clock.Now()
+	workerSocket.serviceName = serviceName
+
+	if err := w.sendReadyWithRetries(workerSocket.socket, address, serviceName); err != nil {
+		workerSocket.close()
+		return nil, ErrBrokerUnreachable
+	}
+
+	if err := w.confirmConnection(workerSocket); err != nil {
+		workerSocket.close()
+		return nil, err
+	}
+
+	return workerSocket, nil
+}
+
+// Waits for the broker to send something after MD_READY, if confirmation is enabled. The message itself is left
+// on the socket for Receive() to handle.
+func (w *mdWorker) confirmConnection(workerSocket *mdWorkerSocket) error {
+	if w.connectConfirmationTimeout <= 0 {
+		return nil
+	}
+
+	poller := zmq4.NewPoller()
+	poller.Add(workerSocket.socket, zmq4.POLLIN)
+
+	var polledSockets []zmq4.Polled
+	var err error
 
-		workerSocket, err := createWorkerSocket(address, w.context, w.maxLivenessCount, heartbeatAt, w.logger)
-		if err != nil {
-			logError(w.logger, fmt.Sprintf("Error connecting to broker address '%s', error: '%s'", address, err.Error()))
+	for {
+		polledSockets, err = poller.Poll(w.connectConfirmationTimeout)
+
+		if err != zmq4.Errno(syscall.EINTR) {
+			break
+		}
+	}
+
+	if err != nil || len(polledSockets) == 0 {
+		logErrorf(w.logger, "Broker at '%s' did not confirm the connection within %s", workerSocket.address, w.connectConfirmationTimeout)
+		return ErrBrokerUnconfirmed
+	}
+
+	return nil
+}
+
+// Registers with the broker as the service, advertising any metadata after the service name
+func (w *mdWorker) sendReady(socket messageSender, serviceName string) error {
+	return w.sendToBroker(socket, MD_READY, []byte(serviceName), w.readyMetadata)
+}
+
+// Registers with the broker, retrying a READY that couldn't be sent (i.e. on a socket some transports haven't
+// connected yet) a few times before giving up with the last error
+func (w *mdWorker) sendReadyWithRetries(socket messageSender, address, serviceName string) error {
+	for attempt := 0; ; attempt++ {
+		err := w.sendReady(socket, serviceName)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= readyRetries {
+			logErrorf(w.logger, "Sending READY to broker at '%s' failed after %d retries, error: '%s'", address, readyRetries, err.Error())
+			w.stats.addError()
 			return err
 		}
 
-		w.sendToBroker(workerSocket.socket, MD_READY, []byte(w.serviceName), nil)
-		logDebug(w.logger, fmt.Sprintf("Connected successfully to broker at '%s'", address))
+		logWarnf(w.logger, "Sending READY to broker at '%s' failed, retrying in %s (%d of %d), error: '%s'", address, readyRetryDelay, attempt+1, readyRetries, err.Error())
+		w.clock.Sleep(readyRetryDelay)
+	}
+}
 
-		w.sockets = append(w.sockets, workerSocket)
+// A send that times out is retried, see WorkerConfig.SendTimeout. The error is EAGAIN if it never went through.
+func (w *mdWorker) sendToBroker(socket messageSender, command string, serviceName []byte, msg [][]byte) error {
+	return w.sendWithRetries(socket, w.sendRetries, command, serviceName, msg)
+}
+
+func (w *mdWorker) sendWithRetries(socket messageSender, retries int, command string, serviceName []byte, msg [][]byte) error {
+	message := w.brokerMessage(command, serviceName, msg)
+	_, err := socket.SendMessage(message)
+	for retry := 0; retry < retries && sendTimedOut(err); retry++ {
+		w.clock.Sleep(sendRetryDelay)
+		_, err = socket.SendMessage(message)
 	}
 
-	return
+	if err == nil {
+		w.sent(message)
+	}
+
+	if !sampledCommand(command) || w.logSampler.sampleSent() {
+		logDebugf(w.logger, "Sent command '%s' to broker with message '%q'", commandName(command), msg)
+	}
+
+	return err
 }
 
-func (w *mdWorker) sendToBroker(socket *zmq4.Socket, command string, serviceName []byte, msg [][]byte) error {
-	workerMessage := [][]byte{[]byte(""), []byte(MD_WORKER), []byte(command)}
+// A nil service name leaves the frame out, as for every command but MD_READY. An empty one is still sent as an empty
+// frame so the frames after it stay where the broker expects them.
+func (w *mdWorker) brokerMessage(command string, serviceName []byte, msg [][]byte) [][]byte {
+	encoder := w.frameEncoder()
+	workerMessage := [][]byte{[]byte(""), encoder.EncodeProtocol(MD_WORKER), encoder.EncodeCommand(command)}
 
 	if serviceName != nil {
 		workerMessage = append(workerMessage, serviceName)
@@ -174,15 +1420,11 @@ func (w *mdWorker) sendToBroker(socket *zmq4.Socket, command string, serviceName
 		workerMessage = append(workerMessage, msg...)
 	}
 
-	_, err := socket.SendMessage(workerMessage)
-
-	logDebug(w.logger, fmt.Sprintf("Sent command '%s' to broker with message '%q'", command, msg))
-
-	return err
+	return workerMessage
 }
 
-func (w *mdWorker) findWorkerSocket(polledSocket *zmq4.Socket) mdWorkerSocket {
-	var foundWorkerSocket mdWorkerSocket
+func (w *mdWorker) findWorkerSocket(polledSocket *zmq4.Socket) *mdWorkerSocket {
+	var foundWorkerSocket *mdWorkerSocket
 
 	for _, workerSocket := range w.sockets {
 		if workerSocket.socket == polledSocket {
@@ -194,11 +1436,75 @@ func (w *mdWorker) findWorkerSocket(polledSocket *zmq4.Socket) mdWorkerSocket {
 	return foundWorkerSocket
 }
 
-func (w *mdWorker) cleanup() {
+// Lets the broker know straight away that we are going so it stops routing requests to us
+// rather than waiting for our liveness to expire
+func (w *mdWorker) disconnectFromBroker() {
 	for _, workerSocket := range w.sockets {
-		workerSocket.close()
+		// Don't wait, if the broker is already gone there is nobody to tell and we'd block forever
+		if _, err := workerSocket.socket.SendMessageDontwait(w.brokerMessage(MD_DISCONNECT, nil, nil)); err != nil {
+			logErrorf(w.logger, "Failed to send MD_DISCONNECT to broker at '%s', error: '%s'", workerSocket.address, err.Error())
+			continue
+		}
+		logDebugf(w.logger, "Sent command '%s' to broker at '%s'", commandName(MD_DISCONNECT), workerSocket.address)
+
+		// Sockets are created with no linger by default so give the DISCONNECT a chance to leave when we close
+		workerSocket.disconnectLinger = w.pollInterval
+	}
+}
+
+// The context has been terminated by someone else. That can't complete until our sockets are closed so we
+// shut down, leaving the context alone.
+func (w *mdWorker) contextTerminated() error {
+	logWarn(w.logger, "Context terminated, closing worker sockets")
+	w.emitFinal(WorkerEvent{Type: EventShuttingDown, Time: w.clock.Now()})
+	deregister(w)
+	w.reportShutdown(len(w.slots) == 0)
+	w.restoreSignals()
+	w.closeSockets()
+
+	return GracefulShutdown("Context terminated")
+}
+
+// Closes every broker socket, returning the first error
+func (w *mdWorker) closeSockets() error {
+	var closeErr error
+	for _, workerSocket := range w.sockets {
+		if err := workerSocket.close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
 	}
 
-	w.context.Term()
+	return closeErr
+}
+
+// Only the first call closes anything, later ones return its result
+func (w *mdWorker) Close() error {
+	w.closeOnce.Do(func() {
+		w.closeErr = w.close()
+	})
+
+	return w.closeErr
+}
+
+func (w *mdWorker) close() error {
+	deregister(w)
+	w.reportShutdown(len(w.slots) == 0)
+	w.restoreSignals()
+	closeErr := w.closeSockets()
+
+	// The context belongs to a WorkerPool, which terminates it once all of its workers are closed
+	if w.sharedContext {
+		return closeErr
+	}
+
+	if err := w.terminateContext(); err != nil && closeErr == nil {
+		closeErr = err
+	}
+
+	return closeErr
+}
+
+func (w *mdWorker) cleanup() {
+	w.Close()
 	logDebug(w.logger, "Worker socket and context closed successfully")
 }
@@ -1,54 +1,179 @@
 package majordomo_worker
 
 import (
+	"syscall"
 	"time"
 
 	"github.com/pebbe/zmq4"
 )
 
+const (
+	bindRetries    = 10
+	bindRetryDelay = 10 * time.Millisecond
+)
+
 type mdWorkerSocket struct {
 	context               *zmq4.Context
 	socket                *zmq4.Socket
 	address               string
 	maxLiveness, liveness int
 	heartbeatAt           time.Time
+	lastHeardAt           time.Time
+	consecutiveErrors     int
 	logger                Logger
+	configure             func(address string, socket *zmq4.Socket) error
+	startMonitor          func(address string, socket *zmq4.Socket) (*socketMonitor, error)
+	monitor               *socketMonitor
+
+	// The service MD_READY registers the socket as, see WorkerConfig.ServiceAliases
+	serviceName string
+
+	// Binds to the address rather than connecting to it, see WorkerConfig.Bind
+	bind bool
+
+	// How long messages still queued when the socket is closed get to leave, see WorkerConfig.SocketLinger
+	linger time.Duration
+
+	// How long the MD_DISCONNECT sent just before closing gets to leave, when that's longer than linger
+	disconnectLinger time.Duration
+
+	// The last reply sent, until the broker is heard from again. See WorkerConfig.ResendReplyOnReconnect.
+	unconfirmedReply *sentReply
+
+	// When the broker's liveness grace period ends, zero outside of one. See WorkerConfig.LivenessGracePeriod.
+	graceEndsAt time.Time
+
+	// When the broker's last honoured MD_DISCONNECT arrived. See WorkerConfig.DisconnectGracePeriod.
+	disconnectedAt time.Time
+
+	// Set once a paused worker sent MD_DISCONNECT, until it registers again. See PauseDisconnect.
+	pausedDisconnected bool
+
+	// When the last heartbeat the broker hasn't answered yet was sent, and how long it took to answer the one before.
+	// See WorkerStats.HeartbeatLatency.
+	heartbeatSentAt  time.Time
+	heartbeatLatency time.Duration
+}
+
+type sentReply struct {
+	replyTo []byte
+	reply   [][]byte
 }
 
-func createWorkerSocket(address string, context *zmq4.Context, maxLiveness int, heartbeatAt time.Time, logger Logger) (mdWorkerSocket, error) {
-	ws := mdWorkerSocket{
-		address:     address,
-		heartbeatAt: heartbeatAt,
-		context:     context,
-		logger:      logger,
-		maxLiveness: maxLiveness,
+func createWorkerSocket(address string, context *zmq4.Context, maxLiveness int, heartbeatAt time.Time, logger Logger, configure func(address string, socket *zmq4.Socket) error, bind bool, linger time.Duration, startMonitor func(address string, socket *zmq4.Socket) (*socketMonitor, error)) (*mdWorkerSocket, error) {
+	ws := &mdWorkerSocket{
+		address:      address,
+		heartbeatAt:  heartbeatAt,
+		context:      context,
+		logger:       logger,
+		maxLiveness:  maxLiveness,
+		configure:    configure,
+		bind:         bind,
+		linger:       linger,
+		startMonitor: startMonitor,
 	}
 
 	err := ws.connect()
 	if err != nil {
-		return mdWorkerSocket{}, err
+		return nil, err
 	}
 
 	return ws, nil
 }
 
+// Connects a fresh socket to the broker. Any socket from a previous connection is only closed once the new one
+// is connected so a failed reconnect leaves us with something to poll.
 func (ws *mdWorkerSocket) connect() error {
 	socket, _ := ws.context.NewSocket(zmq4.DEALER)
-	socket.SetLinger(0)
+	socket.SetLinger(ws.linger)
+
+	// The monitor has to be watching before connecting or the first connect events are missed. Monitoring is only
+	// for visibility, so the connection goes ahead without it.
+	var monitor *socketMonitor
+	if ws.startMonitor != nil {
+		var err error
+		if monitor, err = ws.startMonitor(ws.address, socket); err != nil {
+			logWarnf(ws.logger, "Monitoring socket failed for broker address '%s', error: '%s'", ws.address, err.Error())
+		}
+	}
+
+	if ws.configure != nil {
+		if err := ws.configure(ws.address, socket); err != nil {
+			logErrorf(ws.logger, "Configuring socket failed for broker address '%s', error: '%s'", ws.address, err.Error())
+			monitor.stop()
+			socket.Close()
+			return err
+		}
+	}
 
-	err := socket.Connect(ws.address)
+	err := ws.attach(socket)
 	if err != nil {
+		monitor.stop()
+		socket.Close()
 		return err
 	}
 
+	ws.close()
 	ws.socket = socket
+	ws.monitor = monitor
 	ws.liveness = ws.maxLiveness
+	ws.consecutiveErrors = 0
+	ws.pausedDisconnected = false
 
 	return nil
 }
 
-func (ws *mdWorkerSocket) close() {
+func (ws *mdWorkerSocket) attach(socket *zmq4.Socket) error {
+	if !ws.bind {
+		return socket.Connect(ws.address)
+	}
+
+	// Only one socket can be bound to the address, so the previous one has to let go of it first. It stays open
+	// (and so can still be polled) until the new one is bound.
 	if ws.socket != nil {
-		ws.socket.Close()
+		ws.socket.Unbind(ws.address)
+	}
+
+	err := bindWithRetries(socket, ws.address)
+	if err != nil && ws.socket != nil {
+		// Take the address back so the broker can still reach the previous socket
+		ws.socket.Bind(ws.address)
+	}
+
+	return err
+}
+
+// Releasing a bound address happens in the background, so binding to it again straight away can fail with
+// EADDRINUSE for a moment
+func bindWithRetries(socket *zmq4.Socket, address string) error {
+	for attempt := 0; ; attempt++ {
+		err := socket.Bind(address)
+		if err == nil || attempt >= bindRetries || zmq4.AsErrno(err) != zmq4.Errno(syscall.EADDRINUSE) {
+			return err
+		}
+
+		time.Sleep(bindRetryDelay)
+	}
+}
+
+func (ws *mdWorkerSocket) close() error {
+	if ws.socket == nil {
+		return nil
 	}
+
+	ws.monitor.stop()
+	ws.monitor = nil
+
+	// Whatever linger the socket was configured with, unsent messages mustn't hold up terminating the context for
+	// longer than WorkerConfig.SocketLinger, or the time a DISCONNECT we've just sent was given to leave
+	linger := ws.linger
+	if ws.disconnectLinger > linger {
+		linger = ws.disconnectLinger
+	}
+	ws.socket.SetLinger(linger)
+	err := ws.socket.Close()
+	ws.socket = nil
+	ws.disconnectLinger = 0
+
+	return err
 }
@@ -0,0 +1,53 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// Metrics receives measurements from the worker as they happen. Implementations must be safe for concurrent use
+// as they are typically shared between workers. Measurements are passed the service name, or WorkerConfig.Name if it
+// is set. See the prom subpackage for a Prometheus implementation.
+type Metrics interface {
+	RequestReceived(serviceName string)
+	Reconnected(serviceName string)
+	ActionDuration(serviceName string, duration time.Duration)
+	Liveness(serviceName string, liveness int)
+}
+
+// QueueLatencyMetrics can also be implemented by Metrics to be told how long each request waited at the broker,
+// for requests whose enqueue time is known. See WorkerConfig.PropagateEnqueuedAt.
+type QueueLatencyMetrics interface {
+	QueueLatency(serviceName string, latency time.Duration)
+}
+
+// ThroughputMetrics can also be implemented by Metrics to be told the size of every message sent to or received from
+// a broker, as also counted by Stats()
+type ThroughputMetrics interface {
+	BytesReceived(serviceName string, bytes int)
+	BytesSent(serviceName string, bytes int)
+}
+
+// ReconnectRateMetrics can also be implemented by Metrics to be told the reconnects in the last minute on every poll,
+// as also reported by Stats(), i.e. to alert on a worker flapping between brokers
+type ReconnectRateMetrics interface {
+	ReconnectRate(serviceName string, perMinute float64)
+}
+
+// CommandMetrics can also be implemented by Metrics to be told of every command read from a broker, as also counted
+// by Stats(). The command is "REQUEST", "HEARTBEAT", "DISCONNECT" or "UNKNOWN" for anything else.
+type CommandMetrics interface {
+	CommandReceived(serviceName string, command string)
+}
+
+// FlushingMetrics can also be implemented by Metrics that buffer measurements, to be flushed when the worker shuts
+// down so its final measurements aren't lost
+type FlushingMetrics interface {
+	Flush()
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) RequestReceived(string)               {}
+func (noopMetrics) Reconnected(string)                   {}
+func (noopMetrics) ActionDuration(string, time.Duration) {}
+func (noopMetrics) Liveness(string, int)                 {}
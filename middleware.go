@@ -0,0 +1,125 @@
+package majordomo_worker
+
+import (
+	"io"
+	"time"
+)
+
+// Middleware wraps an action to add behaviour around it, i.e. logging, metrics or auth. Middleware built with
+// AroundMiddleware keeps the optional interfaces (ContextWorkerAction, ErrorWorkerAction and so on) of the action it
+// wraps, so the worker calls the action the way it would have unwrapped. Any other middleware only has Call.
+type Middleware func(WorkerAction) WorkerAction
+
+// Chain wraps action in the middlewares, the first of which is the outermost and so runs first
+func Chain(action WorkerAction, middlewares ...Middleware) WorkerAction {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		action = middlewares[i](action)
+	}
+
+	return action
+}
+
+// AroundMiddleware builds Middleware that runs around every call to the wrapped action, whichever method the worker
+// calls it through. around must call call exactly once, which returns the action's reply (nil for a streamed one).
+// Batches are handed to the wrapped action's CallBatch as they are.
+func AroundMiddleware(around func(ctx RequestContext, call func() [][]byte)) Middleware {
+	return func(next WorkerAction) WorkerAction {
+		return aroundAction{next: next, around: around}
+	}
+}
+
+// Has every optional method so none is hidden, the worker looks through it to see which the wrapped action has
+type aroundAction struct {
+	next   WorkerAction
+	around func(ctx RequestContext, call func() [][]byte)
+}
+
+func (a aroundAction) Call(args [][]byte) (reply [][]byte) {
+	a.around(RequestContext{Request: args}, func() [][]byte {
+		reply = a.next.Call(args)
+		return reply
+	})
+
+	return reply
+}
+
+func (a aroundAction) CallWithContext(ctx RequestContext) (reply [][]byte) {
+	a.around(ctx, func() [][]byte {
+		reply = a.next.(ContextWorkerAction).CallWithContext(ctx)
+		return reply
+	})
+
+	return reply
+}
+
+func (a aroundAction) CallWithError(ctx RequestContext) (reply [][]byte, err error) {
+	a.around(ctx, func() [][]byte {
+		reply, err = a.next.(ErrorWorkerAction).CallWithError(ctx)
+		return reply
+	})
+
+	return reply, err
+}
+
+func (a aroundAction) CallDelayed(ctx RequestContext) (reply [][]byte, sendAfter time.Duration) {
+	a.around(ctx, func() [][]byte {
+		reply, sendAfter = a.next.(DelayedWorkerAction).CallDelayed(ctx)
+		return reply
+	})
+
+	return reply, sendAfter
+}
+
+func (a aroundAction) CallRouted(ctx RequestContext) (reply [][]byte, routed []RoutedReply) {
+	a.around(ctx, func() [][]byte {
+		reply, routed = a.next.(RoutedWorkerAction).CallRouted(ctx)
+		return reply
+	})
+
+	return reply, routed
+}
+
+func (a aroundAction) CallStream(ctx RequestContext) (stream io.Reader, err error) {
+	a.around(ctx, func() [][]byte {
+		stream, err = a.next.(StreamWorkerAction).CallStream(ctx)
+		return nil
+	})
+
+	return stream, err
+}
+
+func (a aroundAction) CallBatch(requests []RequestContext) [][][]byte {
+	return a.next.(BatchWorkerAction).CallBatch(requests)
+}
+
+// The action that decides how the worker calls action, found by looking through any AroundMiddleware
+func innermostAction(action WorkerAction) WorkerAction {
+	for {
+		wrapper, ok := action.(aroundAction)
+		if !ok {
+			return action
+		}
+		action = wrapper.next
+	}
+}
+
+// The action's CallBatch, if the action inside any AroundMiddleware has one
+func batchActionOf(action WorkerAction) (BatchWorkerAction, bool) {
+	if _, ok := innermostAction(action).(BatchWorkerAction); !ok {
+		return nil, false
+	}
+
+	batchAction, ok := action.(BatchWorkerAction)
+	return batchAction, ok
+}
+
+// LoggingMiddleware logs every request, along with how long the action took and how many frames it replied with,
+// at debug level
+func LoggingMiddleware(logger Logger) Middleware {
+	return AroundMiddleware(func(ctx RequestContext, call func() [][]byte) {
+		start := time.Now()
+		reply := call()
+
+		logDebugf(logger, "Handled request of %d frames in %s, replying with %d frames", len(ctx.Request), time.Since(start), len(reply))
+	})
+}
@@ -0,0 +1,85 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Records when it is entered and left
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next WorkerAction) WorkerAction {
+		return funcWorkerAction{call: func(args [][]byte) [][]byte {
+			*calls = append(*calls, "before "+name)
+			reply := next.Call(args)
+			*calls = append(*calls, "after "+name)
+
+			return reply
+		}}
+	}
+}
+
+func Test_Chain_RunsMiddlewaresInOrderAroundCall(t *testing.T) {
+	var calls []string
+
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		calls = append(calls, "call")
+		return args
+	}}
+
+	chained := Chain(action, recordingMiddleware("first", &calls), recordingMiddleware("second", &calls))
+
+	assert.Equal(t, [][]byte{[]byte("hello")}, chained.Call([][]byte{[]byte("hello")}))
+	assert.Equal(t, []string{"before first", "before second", "call", "after second", "after first"}, calls)
+}
+
+func Test_Chain_WithoutMiddlewaresReturnsAction(t *testing.T) {
+	action := defaultWorkerAction{}
+
+	assert.Equal(t, action, Chain(action))
+}
+
+func Test_LoggingMiddleware_LogsRequest(t *testing.T) {
+	logger := new(testLogger)
+	action := Chain(defaultWorkerAction{}, LoggingMiddleware(logger))
+
+	assert.Equal(t, [][]byte{[]byte("hello")}, action.Call([][]byte{[]byte("hello")}))
+	assert.Len(t, logger.debugs, 1)
+}
+
+func Test_AroundMiddleware_KeepsOptionalInterfaces(t *testing.T) {
+	var calls []string
+	around := AroundMiddleware(func(ctx RequestContext, call func() [][]byte) {
+		calls = append(calls, "before")
+		call()
+		calls = append(calls, "after")
+	})
+
+	action := &contextWorkerAction{}
+	w := frameWorker(nil, nil)
+	w.workerAction = Chain(action, around, LoggingMiddleware(new(testLogger)))
+
+	result := w.invokeAction(RequestContext{ServiceName: "echo", Request: [][]byte{[]byte("hello")}})
+
+	assert.Equal(t, [][]byte{[]byte("hello")}, result.reply)
+	assert.Equal(t, "echo", action.ctxs[0].ServiceName)
+	assert.Equal(t, []string{"before", "after"}, calls)
+}
+
+func Test_AroundMiddleware_KeepsActionErrors(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.workerAction = Chain(errorWorkerAction{err: errors.New("failed")}, LoggingMiddleware(new(testLogger)))
+
+	result := w.invokeAction(RequestContext{Request: [][]byte{[]byte("hello")}})
+
+	assert.EqualError(t, result.err, "failed")
+}
+
+func Test_AroundMiddleware_BatchOnlyIfWrappedActionBatches(t *testing.T) {
+	_, ok := batchActionOf(Chain(&batchWorkerAction{}, LoggingMiddleware(new(testLogger))))
+	assert.True(t, ok)
+
+	_, ok = batchActionOf(Chain(defaultWorkerAction{}, LoggingMiddleware(new(testLogger))))
+	assert.False(t, ok)
+}
@@ -0,0 +1,50 @@
+package majordomo_worker
+
+import (
+	"sync"
+)
+
+// Mux is a WorkerAction that routes requests to other actions by their first frame, i.e. an RPC method name.
+// The chosen action is called with the remaining frames. Requests with an empty body or an unregistered method
+// go to Fallback, or get an empty reply if there isn't one.
+type Mux struct {
+	Fallback WorkerAction
+
+	mutex    sync.RWMutex
+	handlers map[string]WorkerAction
+}
+
+func NewMux() *Mux {
+	return &Mux{handlers: make(map[string]WorkerAction)}
+}
+
+func (m *Mux) Handle(method string, h WorkerAction) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.handlers[method] = h
+}
+
+func (m *Mux) Call(args [][]byte) [][]byte {
+	if len(args) == 0 {
+		return m.fallback(args)
+	}
+
+	m.mutex.RLock()
+	h, found := m.handlers[string(args[0])]
+	m.mutex.RUnlock()
+
+	if !found {
+		return m.fallback(args)
+	}
+
+	return h.Call(args[1:])
+}
+
+func (m *Mux) fallback(args [][]byte) [][]byte {
+	if m.Fallback == nil {
+		return nil
+	}
+
+	return m.Fallback.Call(args)
+}
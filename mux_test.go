@@ -0,0 +1,49 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMux() *Mux {
+	m := NewMux()
+	m.Handle("upper", funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("upper"), args[0]}
+	}})
+	m.Handle("lower", funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("lower"), args[0]}
+	}})
+
+	return m
+}
+
+func Test_Mux_DispatchesOnFirstFrame(t *testing.T) {
+	m := newTestMux()
+
+	assert.Equal(t, [][]byte{[]byte("upper"), []byte("a")}, m.Call([][]byte{[]byte("upper"), []byte("a")}))
+	assert.Equal(t, [][]byte{[]byte("lower"), []byte("b")}, m.Call([][]byte{[]byte("lower"), []byte("b")}))
+}
+
+func Test_Mux_UnknownMethodUsesFallback(t *testing.T) {
+	m := newTestMux()
+	m.Fallback = funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("fallback")}
+	}}
+
+	assert.Equal(t, [][]byte{[]byte("fallback")}, m.Call([][]byte{[]byte("unknown")}))
+}
+
+func Test_Mux_UnknownMethodWithoutFallbackRepliesEmpty(t *testing.T) {
+	m := newTestMux()
+
+	assert.Nil(t, m.Call([][]byte{[]byte("unknown")}))
+}
+
+func Test_Mux_EmptyBodyUsesFallback(t *testing.T) {
+	m := newTestMux()
+	m.Fallback = defaultWorkerAction{}
+
+	assert.Equal(t, [][]byte{}, m.Call([][]byte{}))
+	assert.Nil(t, NewMux().Call(nil))
+}
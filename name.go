@@ -0,0 +1,48 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Counts the workers created by this process, to number their default names
+var workersCreated uint64
+
+// The name tags the worker's log lines, defaulting to the service name followed by how many workers this process
+// has created, i.e. 'echo#2'
+func (c WorkerConfig) workerName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+
+	return fmt.Sprintf("%s#%d", c.registeredServiceName(), atomic.AddUint64(&workersCreated, 1))
+}
+
+// Metrics are labelled with the name only if one is set, so a service's series stay the same whichever order its
+// workers were created in
+func (c WorkerConfig) metricsLabel() string {
+	if c.Name != "" {
+		return c.Name
+	}
+
+	return c.registeredServiceName()
+}
+
+// Adds the worker's name and connection ID to every log line, and tells the log helpers which levels to skip
+type workerLogger struct {
+	Logger
+	name       string
+	level      *atomicLevel
+	connection func() string
+}
+
+func (l workerLogger) Log(keyvals ...interface{}) error {
+	prefix := []interface{}{"worker", l.name}
+	if l.connection != nil {
+		if id := l.connection(); id != "" {
+			prefix = append(prefix, "connection", id)
+		}
+	}
+
+	return l.Logger.Log(append(prefix, keyvals...)...)
+}
@@ -0,0 +1,41 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Name_DefaultsToNumberedServiceName(t *testing.T) {
+	config := WorkerConfig{ServiceName: "echo", ServiceNamePrefix: "teamA/"}
+
+	first := config.workerName()
+	second := config.workerName()
+
+	var n int
+	_, err := fmt.Sscanf(first, "teamA/echo#%d", &n)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("teamA/echo#%d", n+1), second)
+}
+
+func Test_Name_UsedWhenSet(t *testing.T) {
+	config := WorkerConfig{ServiceName: "echo", Name: "echo-primary"}
+
+	assert.Equal(t, "echo-primary", config.workerName())
+	assert.Equal(t, "echo-primary", config.metricsLabel())
+}
+
+func Test_Name_MetricsLabelDefaultsToServiceName(t *testing.T) {
+	config := WorkerConfig{ServiceName: "echo", ServiceNamePrefix: "teamA/"}
+
+	assert.Equal(t, "teamA/echo", config.metricsLabel())
+}
+
+func Test_Name_TagsLogLines(t *testing.T) {
+	logger := new(testLogger)
+
+	logDebug(workerLogger{logger, "echo-primary", newAtomicLevel(LevelDebug), nil}, "hello")
+
+	assert.Equal(t, []map[string]interface{}{{"worker": "echo-primary", "message": "hello"}}, logger.debugs)
+}
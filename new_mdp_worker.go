@@ -7,6 +7,5 @@ import (
 )
 
 func NewWorker(logger Logger, config WorkerConfig) (Worker, error) {
-	context, _ := zmq4.NewContext()
-	return newWorker(context, logger, config)
+	return newWorkerOwningContext(zmq4.NewContext, logger, config)
 }
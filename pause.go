@@ -0,0 +1,79 @@
+package majordomo_worker
+
+import (
+	"sync/atomic"
+)
+
+// PauseMode decides what a paused worker does with the requests brokers send it, see Worker.Pause
+type PauseMode int
+
+const (
+	// Keep requests until the worker is resumed, the broker sends no more meanwhile as it waits for the reply. This
+	// is the default.
+	PauseHold PauseMode = iota
+	// Drop the request and send MD_DISCONNECT so the broker routes further requests to other workers. The worker
+	// registers with the broker again when resumed.
+	PauseDisconnect
+)
+
+// A request received while paused, handled once the worker is resumed
+type heldRequest struct {
+	workerSocket *mdWorkerSocket
+	msg          [][]byte
+}
+
+func (w *mdWorker) Pause() {
+	if atomic.CompareAndSwapInt32(&w.paused, 0, 1) {
+		logDebug(w.logger, "Worker paused")
+	}
+}
+
+func (w *mdWorker) Resume() {
+	if atomic.CompareAndSwapInt32(&w.paused, 1, 0) {
+		logDebug(w.logger, "Worker resumed")
+	}
+}
+
+func (w *mdWorker) isPaused() bool {
+	return atomic.LoadInt32(&w.paused) == 1
+}
+
+func (w *mdWorker) pauseRequest(workerSocket *mdWorkerSocket, msg [][]byte) {
+	if w.pauseMode == PauseDisconnect {
+		logWarnf(w.logger, "Dropping request, worker is paused, disconnecting from broker at '%s'", workerSocket.address)
+		w.sendToBroker(workerSocket.socket, MD_DISCONNECT, nil, nil)
+		workerSocket.pausedDisconnected = true
+		w.emit(EventDisconnected, workerSocket.address)
+		return
+	}
+
+	logDebugf(w.logger, "Holding request from broker at '%s', worker is paused", workerSocket.address)
+	w.stats.requestQueued()
+	w.held = append(w.held, heldRequest{workerSocket: workerSocket, msg: msg})
+}
+
+// Once resumed, registers again with the brokers the pause disconnected from and handles the held requests one by
+// one, returning the reply and true if the action handled one
+func (w *mdWorker) resumeHeld() ([][]byte, bool) {
+	if w.isPaused() {
+		return nil, false
+	}
+
+	for _, workerSocket := range w.sockets {
+		if workerSocket.pausedDisconnected {
+			w.reconnectToBroker(workerSocket, 0)
+		}
+	}
+
+	for len(w.held) > 0 {
+		held := w.held[0]
+		w.held = w.held[1:]
+		w.stats.requestsDone(1)
+
+		if reply, handled := w.handleRequest(held.workerSocket, held.msg); handled {
+			return reply, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,53 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pauseWorker() *mdWorker {
+	clock := newFakeClock()
+
+	return &mdWorker{
+		stats:  newWorkerStats(clock),
+		clock:  clock,
+		logger: new(testLogger),
+	}
+}
+
+func Test_Pause_HeldRequestsCountAsQueued(t *testing.T) {
+	w := pauseWorker()
+	w.Pause()
+
+	w.pauseRequest(&mdWorkerSocket{address: "inproc://test"}, [][]byte{[]byte("request")})
+
+	assert.Len(t, w.held, 1)
+	assert.Equal(t, 1, w.QueueDepth())
+}
+
+func Test_Pause_HeldRequestsWaitForResume(t *testing.T) {
+	w := pauseWorker()
+	w.Pause()
+	w.pauseRequest(&mdWorkerSocket{address: "inproc://test"}, [][]byte{[]byte("request")})
+
+	reply, handled := w.resumeHeld()
+
+	assert.Nil(t, reply)
+	assert.False(t, handled)
+	assert.Len(t, w.held, 1)
+}
+
+func Test_Pause_ResumeWithoutPause(t *testing.T) {
+	w := pauseWorker()
+
+	w.Resume()
+	assert.False(t, w.isPaused())
+
+	w.Pause()
+	w.Pause()
+	assert.True(t, w.isPaused())
+
+	w.Resume()
+	assert.False(t, w.isPaused())
+}
@@ -0,0 +1,135 @@
+package majordomo_worker
+
+import (
+	"sync"
+
+	"github.com/pebbe/zmq4"
+)
+
+type PoolShutdownMode int
+
+const (
+	// Every worker is shut down at once, the shortest downtime. This is the default.
+	PoolShutdownParallel PoolShutdownMode = iota
+	// Workers are shut down one after the other, last created first, so brokers see them go one at a time
+	PoolShutdownSequential
+)
+
+type PoolConfig struct {
+	// Workers holds the config of every worker in the pool, in the order they are created
+	Workers []WorkerConfig
+
+	ShutdownMode PoolShutdownMode
+}
+
+// WorkerPool runs several workers in one process on a shared zmq context, calling Receive() for each of them on its
+// own goroutine. The context is only terminated once every worker has shut down.
+type WorkerPool struct {
+	context      *zmq4.Context
+	terminate    func() error
+	workers      []*mdWorker
+	shutdownMode PoolShutdownMode
+	logger       Logger
+
+	running sync.WaitGroup
+	stopped []chan struct{}
+}
+
+func NewWorkerPool(logger Logger, config PoolConfig) (*WorkerPool, error) {
+	context, err := zmq4.NewContext()
+	if err != nil {
+		return nil, err
+	}
+
+	return newWorkerPool(context, logger, config)
+}
+
+func newWorkerPool(context *zmq4.Context, logger Logger, config PoolConfig) (*WorkerPool, error) {
+	p := &WorkerPool{
+		context:      context,
+		terminate:    context.Term,
+		shutdownMode: config.ShutdownMode,
+		logger:       logger,
+	}
+
+	for _, workerConfig := range config.Workers {
+		w, err := newWorker(context, logger, workerConfig)
+		if w != nil {
+			// The pool terminates the context once all of its workers are done with it
+			w.sharedContext = true
+		}
+
+		if err != nil {
+			w.Close()
+			p.closeWorkers()
+			p.terminate()
+			return nil, err
+		}
+
+		p.workers = append(p.workers, w)
+	}
+
+	return p, nil
+}
+
+// Workers returns the pool's workers in the order they were created
+func (p *WorkerPool) Workers() []Worker {
+	workers := make([]Worker, len(p.workers))
+	for i, w := range p.workers {
+		workers[i] = w
+	}
+
+	return workers
+}
+
+// Start calls Receive() for every worker on its own goroutine until the worker shuts down
+func (p *WorkerPool) Start() {
+	p.stopped = make([]chan struct{}, len(p.workers))
+
+	for i, w := range p.workers {
+		stopped := make(chan struct{})
+		p.stopped[i] = stopped
+		p.running.Add(1)
+
+		go func(w *mdWorker) {
+			defer p.running.Done()
+			defer close(stopped)
+
+			for {
+				if _, err := w.Receive(); err != nil {
+					if _, ok := err.(GracefulShutdown); !ok {
+						logError(p.logger, "Worker stopped receiving, error: '"+err.Error()+"'")
+					}
+					return
+				}
+			}
+		}(w)
+	}
+}
+
+// Shutdown shuts every worker down according to the pool's ShutdownMode, waits for all of them and then terminates
+// the shared context, returning any error doing so. Start() must have been called.
+func (p *WorkerPool) Shutdown() error {
+	switch p.shutdownMode {
+	case PoolShutdownSequential:
+		for i := len(p.workers) - 1; i >= 0; i-- {
+			p.workers[i].Shutdown()
+			<-p.stopped[i]
+		}
+	default:
+		for _, w := range p.workers {
+			w.Shutdown()
+		}
+	}
+
+	p.running.Wait()
+
+	return p.terminate()
+}
+
+// Closes the sockets of every worker created so far
+func (p *WorkerPool) closeWorkers() {
+	for _, w := range p.workers {
+		w.Close()
+	}
+}
@@ -0,0 +1,138 @@
+// Package prom exposes majordomo worker metrics to Prometheus. It lives in its own package so the core worker
+// doesn't depend on the Prometheus client.
+package prom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements majordomo_worker.Metrics, majordomo_worker.QueueLatencyMetrics,
+// majordomo_worker.ThroughputMetrics, majordomo_worker.ReconnectRateMetrics, majordomo_worker.CommandMetrics and
+// prometheus.Collector. Register it with a Prometheus registry and pass it to the worker as WorkerConfig.Metrics, it
+// can be shared by many workers.
+type Collector struct {
+	requests       *prometheus.CounterVec
+	reconnects     *prometheus.CounterVec
+	reconnectRate  *prometheus.GaugeVec
+	actionDuration *prometheus.HistogramVec
+	queueLatency   *prometheus.HistogramVec
+	liveness       *prometheus.GaugeVec
+	bytesReceived  *prometheus.CounterVec
+	bytesSent      *prometheus.CounterVec
+	commands       *prometheus.CounterVec
+}
+
+// New creates a Collector with all metric names prefixed by namespace
+func New(namespace string) *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_requests_total",
+			Help:      "Number of requests received from the broker.",
+		}, []string{"service"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_reconnects_total",
+			Help:      "Number of times the worker reconnected to the broker.",
+		}, []string{"service"}),
+		reconnectRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_reconnects_per_minute",
+			Help:      "Number of times the worker reconnected to the broker in the last minute.",
+		}, []string{"service"}),
+		actionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_action_duration_seconds",
+			Help:      "Time taken by the worker action to handle a request.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service"}),
+		queueLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_queue_latency_seconds",
+			Help:      "Time requests waited at the broker before the worker received them.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service"}),
+		liveness: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_liveness",
+			Help:      "Polls remaining before the worker considers the broker dead.",
+		}, []string{"service"}),
+		bytesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_received_bytes_total",
+			Help:      "Bytes received from the broker, protocol frames included.",
+		}, []string{"service"}),
+		bytesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_sent_bytes_total",
+			Help:      "Bytes sent to the broker, protocol frames included.",
+		}, []string{"service"}),
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "majordomo_worker_commands_received_total",
+			Help:      "Number of commands received from the broker, by command.",
+		}, []string{"service", "command"}),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.reconnects.Describe(ch)
+	c.reconnectRate.Describe(ch)
+	c.actionDuration.Describe(ch)
+	c.queueLatency.Describe(ch)
+	c.liveness.Describe(ch)
+	c.bytesReceived.Describe(ch)
+	c.bytesSent.Describe(ch)
+	c.commands.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.reconnects.Collect(ch)
+	c.reconnectRate.Collect(ch)
+	c.actionDuration.Collect(ch)
+	c.queueLatency.Collect(ch)
+	c.liveness.Collect(ch)
+	c.bytesReceived.Collect(ch)
+	c.bytesSent.Collect(ch)
+	c.commands.Collect(ch)
+}
+
+func (c *Collector) RequestReceived(serviceName string) {
+	c.requests.WithLabelValues(serviceName).Inc()
+}
+
+func (c *Collector) Reconnected(serviceName string) {
+	c.reconnects.WithLabelValues(serviceName).Inc()
+}
+
+func (c *Collector) ReconnectRate(serviceName string, perMinute float64) {
+	c.reconnectRate.WithLabelValues(serviceName).Set(perMinute)
+}
+
+func (c *Collector) ActionDuration(serviceName string, duration time.Duration) {
+	c.actionDuration.WithLabelValues(serviceName).Observe(duration.Seconds())
+}
+
+func (c *Collector) QueueLatency(serviceName string, latency time.Duration) {
+	c.queueLatency.WithLabelValues(serviceName).Observe(latency.Seconds())
+}
+
+func (c *Collector) Liveness(serviceName string, liveness int) {
+	c.liveness.WithLabelValues(serviceName).Set(float64(liveness))
+}
+
+func (c *Collector) BytesReceived(serviceName string, bytes int) {
+	c.bytesReceived.WithLabelValues(serviceName).Add(float64(bytes))
+}
+
+func (c *Collector) BytesSent(serviceName string, bytes int) {
+	c.bytesSent.WithLabelValues(serviceName).Add(float64(bytes))
+}
+
+func (c *Collector) CommandReceived(serviceName string, command string) {
+	c.commands.WithLabelValues(serviceName, command).Inc()
+}
@@ -0,0 +1,99 @@
+package prom
+
+import (
+	"testing"
+	"time"
+
+	majordomo_worker "github.com/ppeble/majordomo-worker-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Collector_ImplementsMetrics(t *testing.T) {
+	assert.Implements(t, (*majordomo_worker.Metrics)(nil), New("test"))
+	assert.Implements(t, (*majordomo_worker.QueueLatencyMetrics)(nil), New("test"))
+	assert.Implements(t, (*majordomo_worker.ThroughputMetrics)(nil), New("test"))
+	assert.Implements(t, (*majordomo_worker.ReconnectRateMetrics)(nil), New("test"))
+	assert.Implements(t, (*majordomo_worker.CommandMetrics)(nil), New("test"))
+}
+
+func Test_Collector_ExposesMetricsWithServiceLabel(t *testing.T) {
+	c := New("test")
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	c.RequestReceived("test-service")
+	c.RequestReceived("test-service")
+	c.Reconnected("test-service")
+	c.ReconnectRate("test-service", 3)
+	c.ActionDuration("test-service", 250*time.Millisecond)
+	c.QueueLatency("test-service", 10*time.Millisecond)
+	c.Liveness("test-service", 7)
+	c.BytesReceived("test-service", 18)
+	c.BytesSent("test-service", 25)
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			assert.Equal(t, "service", metric.GetLabel()[0].GetName())
+			assert.Equal(t, "test-service", metric.GetLabel()[0].GetValue())
+
+			switch {
+			case metric.GetCounter() != nil:
+				values[family.GetName()] = metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				values[family.GetName()] = metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				values[family.GetName()] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"test_majordomo_worker_requests_total":          2,
+		"test_majordomo_worker_reconnects_total":        1,
+		"test_majordomo_worker_reconnects_per_minute":   3,
+		"test_majordomo_worker_action_duration_seconds": 1,
+		"test_majordomo_worker_queue_latency_seconds":   1,
+		"test_majordomo_worker_liveness":                7,
+		"test_majordomo_worker_received_bytes_total":    18,
+		"test_majordomo_worker_sent_bytes_total":        25,
+	}, values)
+}
+
+func Test_Collector_CommandsLabelledByCommand(t *testing.T) {
+	c := New("test")
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	c.CommandReceived("test-service", "HEARTBEAT")
+	c.CommandReceived("test-service", "HEARTBEAT")
+	c.CommandReceived("test-service", "REQUEST")
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "test_majordomo_worker_commands_received_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			assert.Equal(t, "test-service", labels["service"])
+			values[labels["command"]] = metric.GetCounter().GetValue()
+		}
+	}
+
+	assert.Equal(t, map[string]float64{"HEARTBEAT": 2, "REQUEST": 1}, values)
+}
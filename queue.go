@@ -0,0 +1,41 @@
+package majordomo_worker
+
+// Request is a request handed out by Worker.Requests(), see WorkerConfig.RequestQueue
+type Request struct {
+	RequestContext
+
+	replies chan [][]byte
+}
+
+// Reply sends the reply to the client that made the request. It may be called from any goroutine, only the first
+// reply to a request is sent.
+func (r Request) Reply(reply [][]byte) {
+	select {
+	case r.replies <- reply:
+	default:
+	}
+}
+
+// Stands in for the action when requests are pulled from Worker.Requests(). It is called on a goroutine of its own
+// (the worker runs concurrently with a slot per queued request) and waits for the reply, which Receive() then sends
+// to the broker as for any other action.
+type queueAction struct {
+	requests chan Request
+}
+
+func (a queueAction) Call(args [][]byte) [][]byte {
+	return a.CallWithContext(RequestContext{Request: args})
+}
+
+func (a queueAction) CallWithContext(ctx RequestContext) [][]byte {
+	request := Request{RequestContext: ctx, replies: make(chan [][]byte, 1)}
+
+	// There is never more than a request per slot, so the queue always has room
+	a.requests <- request
+
+	return <-request.replies
+}
+
+func (w *mdWorker) Requests() <-chan Request {
+	return w.requests
+}
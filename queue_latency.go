@@ -0,0 +1,30 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// Reads when the broker queued the request, sent as Unix time in milliseconds
+func (w *mdWorker) requestEnqueuedAt(request [][]byte) time.Time {
+	if !w.propagateEnqueuedAt {
+		return time.Time{}
+	}
+
+	return w.unixMillisFrame(request, w.enqueuedAtFrame, "request enqueue time")
+}
+
+// Passes how long the request waited at the broker to the metrics, if they want it. Clocks on different hosts
+// disagree, so a request that seems to have been received before it was queued waited no time at all.
+func (w *mdWorker) reportQueueLatency(ctx RequestContext) {
+	metrics, ok := w.metrics.(QueueLatencyMetrics)
+	if !ok || ctx.EnqueuedAt.IsZero() {
+		return
+	}
+
+	latency := ctx.ReceivedAt.Sub(ctx.EnqueuedAt)
+	if latency < 0 {
+		latency = 0
+	}
+
+	metrics.QueueLatency(w.metricsLabel, latency)
+}
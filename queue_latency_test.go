@@ -0,0 +1,64 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type queueLatencyMetrics struct {
+	noopMetrics
+	latencies []time.Duration
+}
+
+func (m *queueLatencyMetrics) QueueLatency(serviceName string, latency time.Duration) {
+	m.latencies = append(m.latencies, latency)
+}
+
+func queueLatencyWorker(metrics Metrics) *mdWorker {
+	return &mdWorker{
+		serviceName:         "test-service",
+		propagateEnqueuedAt: true,
+		enqueuedAtFrame:     1,
+		metrics:             metrics,
+		clock:               newFakeClock(),
+		logger:              &testLogger{},
+	}
+}
+
+func Test_QueueLatency_ReadFromConfiguredFrame(t *testing.T) {
+	w := queueLatencyWorker(noopMetrics{})
+	enqueuedAt := w.clock.Now().Add(-time.Second)
+
+	request := [][]byte{[]byte("body"), []byte(fmt.Sprintf("%d", enqueuedAt.UnixNano()/int64(time.Millisecond)))}
+	assert.True(t, enqueuedAt.Equal(w.requestEnqueuedAt(request)))
+
+	assert.True(t, w.requestEnqueuedAt([][]byte{[]byte("body")}).IsZero(), "Expected no enqueue time without the frame")
+	assert.True(t, w.requestEnqueuedAt([][]byte{[]byte("body"), []byte("soon")}).IsZero(), "Expected no enqueue time for an invalid frame")
+
+	w.propagateEnqueuedAt = false
+	assert.True(t, w.requestEnqueuedAt(request).IsZero(), "Expected no enqueue time unless enabled")
+}
+
+func Test_QueueLatency_ReportedToMetrics(t *testing.T) {
+	metrics := &queueLatencyMetrics{}
+	w := queueLatencyWorker(metrics)
+	now := w.clock.Now()
+
+	w.reportQueueLatency(RequestContext{ReceivedAt: now, EnqueuedAt: now.Add(-250 * time.Millisecond)})
+	// The broker's clock is ahead of ours
+	w.reportQueueLatency(RequestContext{ReceivedAt: now, EnqueuedAt: now.Add(time.Second)})
+	// The broker didn't say
+	w.reportQueueLatency(RequestContext{ReceivedAt: now})
+
+	assert.Equal(t, []time.Duration{250 * time.Millisecond, 0}, metrics.latencies)
+}
+
+func Test_QueueLatency_IgnoredByPlainMetrics(t *testing.T) {
+	w := queueLatencyWorker(noopMetrics{})
+	now := w.clock.Now()
+
+	w.reportQueueLatency(RequestContext{ReceivedAt: now, EnqueuedAt: now.Add(-time.Second)})
+}
@@ -0,0 +1,38 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RequestQueue_OnlyFirstReplySent(t *testing.T) {
+	request := Request{replies: make(chan [][]byte, 1)}
+
+	request.Reply([][]byte{[]byte("first")})
+	request.Reply([][]byte{[]byte("second")})
+
+	assert.Equal(t, [][]byte{[]byte("first")}, <-request.replies)
+}
+
+func Test_RequestQueue_ActionWaitsForReply(t *testing.T) {
+	action := queueAction{make(chan Request, 1)}
+
+	go func() {
+		request := <-action.requests
+		request.Reply([][]byte{[]byte("reply to"), request.Request[0]})
+	}()
+
+	reply := action.CallWithContext(RequestContext{Request: [][]byte{[]byte("hello")}})
+
+	assert.Equal(t, [][]byte{[]byte("reply to"), []byte("hello")}, reply)
+}
+
+func Test_RequestQueue_RejectedAlongsideAction(t *testing.T) {
+	config := timingConfig(time.Second, 500*time.Millisecond, 10)
+	config.RequestQueue = 1
+	config.Action = defaultWorkerAction{}
+
+	assert.Equal(t, ErrActionWithRequestQueue, config.validate())
+}
@@ -0,0 +1,41 @@
+package majordomo_worker
+
+import "github.com/pebbe/zmq4"
+
+// Messages with more frames than this don't get the frame slice sized up any further for later messages
+const maxFramesHint = 32
+
+// What receiveMessage needs from a broker socket
+type frameReceiver interface {
+	RecvBytes(flags zmq4.Flag) ([]byte, error)
+	GetRcvmore() (bool, error)
+}
+
+// Receives every frame of a message as RecvMessageBytes does, but into a frame slice sized for the largest message
+// seen so far rather than one grown frame by frame. The frames themselves can't be pooled: zmq4 copies each one into
+// a slice of its own, and they outlive the request anyway in whatever the action, or Receive()'s caller, keeps.
+func (w *mdWorker) receiveMessage(socket frameReceiver) ([][]byte, error) {
+	msg := make([][]byte, 0, w.framesHint)
+
+	for {
+		frame, err := socket.RecvBytes(0)
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, frame)
+
+		more, err := socket.GetRcvmore()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	if len(msg) > w.framesHint && len(msg) <= maxFramesHint {
+		w.framesHint = len(msg)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,57 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const customCommand = "\x09"
+
+func Test_ReceiveMiddleware_HandlesCustomCommand(t *testing.T) {
+	w := frameWorker(nil, nil)
+	var custom [][]byte
+	w.receiveMiddleware = func(frames [][]byte) bool {
+		if len(frames) > 2 && string(frames[2]) == customCommand {
+			custom = frames
+			return true
+		}
+		return false
+	}
+
+	message := [][]byte{nil, []byte(MD_WORKER), []byte(customCommand), []byte("extension")}
+	reply, handled := w.handleMessage(&mdWorkerSocket{}, message)
+
+	assert.Nil(t, reply)
+	assert.False(t, handled)
+	assert.Equal(t, message, custom)
+	assert.Equal(t, uint64(0), w.Stats().Errors, "Expected the worker not to see the custom command")
+}
+
+func Test_ReceiveMiddleware_PassesThrough(t *testing.T) {
+	w := frameWorker(nil, nil)
+	var seen [][][]byte
+	w.receiveMiddleware = func(frames [][]byte) bool {
+		seen = append(seen, frames)
+		return false
+	}
+
+	workerSocket := &mdWorkerSocket{}
+	w.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+
+	assert.Len(t, seen, 1)
+	assert.Equal(t, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)}, seen[0])
+	assert.False(t, w.Stats().LastBrokerHeartbeat.IsZero(), "Expected the heartbeat to reach the worker")
+	assert.False(t, workerSocket.lastHeardAt.IsZero())
+}
+
+func Test_ReceiveMiddleware_HandledMessageDoesNotRestoreLiveness(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.receiveMiddleware = func(frames [][]byte) bool { return true }
+
+	workerSocket := &mdWorkerSocket{liveness: 1}
+	w.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+
+	assert.Equal(t, 1, workerSocket.liveness)
+	assert.True(t, w.Stats().LastBrokerHeartbeat.IsZero())
+}
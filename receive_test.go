@@ -0,0 +1,82 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Hands out the same message's frames over and over
+type fakeReceiver struct {
+	frames [][]byte
+	next   int
+	err    error
+}
+
+func (r *fakeReceiver) RecvBytes(flags zmq4.Flag) ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	frame := r.frames[r.next]
+	r.next = (r.next + 1) % len(r.frames)
+	return frame, nil
+}
+
+func (r *fakeReceiver) GetRcvmore() (bool, error) {
+	return r.next != 0, nil
+}
+
+func requestFrames() [][]byte {
+	return [][]byte{[]byte("broker"), {}, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), {}, []byte("hello")}
+}
+
+func Test_ReceiveMessage_ReadsEveryFrame(t *testing.T) {
+	w := &mdWorker{}
+	receiver := &fakeReceiver{frames: requestFrames()}
+
+	msg, err := w.receiveMessage(receiver)
+	assert.NoError(t, err)
+	assert.Equal(t, requestFrames(), msg)
+	assert.Equal(t, 7, w.framesHint)
+
+	// Fewer frames don't size it down again
+	msg, err = w.receiveMessage(&fakeReceiver{frames: requestFrames()[:4]})
+	assert.NoError(t, err)
+	assert.Len(t, msg, 4)
+	assert.Equal(t, 7, cap(msg))
+}
+
+func Test_ReceiveMessage_ReturnsError(t *testing.T) {
+	receiveErr := errors.New("socket closed")
+
+	msg, err := (&mdWorker{}).receiveMessage(&fakeReceiver{frames: requestFrames(), err: receiveErr})
+	assert.Equal(t, receiveErr, err)
+	assert.Nil(t, msg)
+}
+
+func benchmarkReceiveMessage(b *testing.B, sized bool) {
+	w := &mdWorker{}
+	receiver := &fakeReceiver{frames: requestFrames()}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !sized {
+			w.framesHint = 0
+		}
+		if _, err := w.receiveMessage(receiver); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Grows the frame slice frame by frame, as RecvMessageBytes does
+func BenchmarkReceiveMessage_Growing(b *testing.B) {
+	benchmarkReceiveMessage(b, false)
+}
+
+func BenchmarkReceiveMessage_Sized(b *testing.B) {
+	benchmarkReceiveMessage(b, true)
+}
@@ -0,0 +1,138 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// The WorkerConfig fields Reconfigure may change, everything else is fixed once the worker is created
+var reconfigurableFields = map[string]bool{
+	"HeartbeatInMillis":    true,
+	"ReconnectInMillis":    true,
+	"PollingInterval":      true,
+	"MaxHeartbeatLiveness": true,
+	"LogLevel":             true,
+	"Action":               true,
+}
+
+// Returned by Reconfigure when the config changes a field that can't be changed at runtime
+type ReconfigureError struct {
+	Field string
+}
+
+func (e ReconfigureError) Error() string {
+	return fmt.Sprintf("WorkerConfig.%s can't be changed at runtime", e.Field)
+}
+
+type reconfiguration struct {
+	config WorkerConfig
+	result chan error
+}
+
+func (w *mdWorker) Reconfigure(config WorkerConfig) error {
+	result := make(chan error, 1)
+
+	select {
+	case w.reconfigureNow <- reconfiguration{config, result}:
+		return <-result
+	case <-w.shutdown:
+		return GracefulShutdown("Graceful Shutdown")
+	}
+}
+
+// Applies a new config on Receive()'s goroutine, so the timings are in effect from the next poll
+func (w *mdWorker) reconfigure(config WorkerConfig) error {
+	if field, changed := changedField(w.config, config); changed {
+		return ReconfigureError{field}
+	}
+
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	if config.Action != nil {
+		if err := w.setAction(config.Action); err != nil {
+			return err
+		}
+	}
+
+	logDebugf(w.logger, "Reconfiguring with heartbeat %s, reconnect %s, polling interval %s and liveness %d", config.HeartbeatInMillis, config.ReconnectInMillis, config.PollingInterval, config.MaxHeartbeatLiveness)
+
+	w.logLevel.set(config.LogLevel)
+	w.pollInterval = config.PollingInterval
+	w.reconnect = config.ReconnectInMillis
+
+	if config.ReconnectStrategy == nil {
+		w.reconnectStrategy = LivenessReconnectStrategy{ByTime: config.LivenessByTime, Delay: config.ReconnectInMillis}
+	}
+
+	if config.HeartbeatInMillis != w.config.HeartbeatInMillis {
+		w.setHeartbeat(config.HeartbeatInMillis)
+
+		if config.IdleInterval <= 0 {
+			w.idleInterval = config.HeartbeatInMillis
+		}
+	}
+
+	// Brokers keep whatever liveness they have left, up to the new maximum
+	w.maxLivenessCount = config.MaxHeartbeatLiveness
+	for _, workerSocket := range w.sockets {
+		if workerSocket.liveness > w.maxLivenessCount {
+			workerSocket.liveness = w.maxLivenessCount
+		}
+	}
+	w.stats.setLiveness(w.lowestLiveness())
+
+	w.configMutex.Lock()
+	w.config = config
+	w.configMutex.Unlock()
+
+	return nil
+}
+
+func (w *mdWorker) Config() WorkerConfig {
+	w.configMutex.RLock()
+	config := w.config
+	w.configMutex.RUnlock()
+
+	// SetAction doesn't go through the config
+	config.Action = w.action()
+
+	return config
+}
+
+// Returns the first field other than the reconfigurable ones that differs between the configs
+func changedField(current, config WorkerConfig) (string, bool) {
+	a, b := reflect.ValueOf(current), reflect.ValueOf(config)
+
+	for i := 0; i < a.NumField(); i++ {
+		name := a.Type().Field(i).Name
+		if !reconfigurableFields[name] && !sameValue(a.Field(i), b.Field(i)) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// Functions can't be compared, so they're taken to be the same if they share their code. Closures made by the same
+// function literal share it whatever they capture, so changing one for another isn't noticed and the worker keeps
+// the one it has.
+func sameValue(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Interface {
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+
+		a, b = a.Elem(), b.Elem()
+		if a.Type() != b.Type() {
+			return false
+		}
+	}
+
+	if a.Kind() == reflect.Func {
+		return a.Pointer() == b.Pointer()
+	}
+
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
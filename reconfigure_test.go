@@ -0,0 +1,106 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reconfigureConfig() WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:        "inproc://test",
+		ServiceName:          "test-service",
+		HeartbeatInMillis:    time.Second,
+		ReconnectInMillis:    time.Second,
+		PollingInterval:      100 * time.Millisecond,
+		MaxHeartbeatLiveness: 5,
+		ErrorReply:           defaultErrorReply,
+	}
+}
+
+func reconfigureWorker(config WorkerConfig) *mdWorker {
+	w := frameWorker(nil, nil)
+	w.config = config
+	w.heartbeat = config.HeartbeatInMillis
+	w.pollInterval = config.PollingInterval
+	w.maxLivenessCount = config.MaxHeartbeatLiveness
+	w.logLevel = newAtomicLevel(config.LogLevel)
+	w.sockets = []*mdWorkerSocket{{liveness: 5, heartbeatAt: w.clock.Now().Add(config.HeartbeatInMillis)}}
+	return w
+}
+
+func Test_Reconfigure_AppliesTimings(t *testing.T) {
+	w := reconfigureWorker(reconfigureConfig())
+
+	config := reconfigureConfig()
+	config.HeartbeatInMillis = 200 * time.Millisecond
+	config.ReconnectInMillis = 2 * time.Second
+	config.PollingInterval = 50 * time.Millisecond
+	config.MaxHeartbeatLiveness = 3
+	config.LogLevel = LevelWarn
+
+	assert.NoError(t, w.reconfigure(config))
+	assert.Equal(t, 200*time.Millisecond, w.heartbeat)
+	assert.Equal(t, w.clock.Now().Add(200*time.Millisecond), w.sockets[0].heartbeatAt, "Expected the next heartbeat brought forward")
+	assert.Equal(t, 2*time.Second, w.reconnect)
+	assert.Equal(t, 50*time.Millisecond, w.pollInterval)
+	assert.Equal(t, 3, w.sockets[0].liveness)
+	assert.Equal(t, 3, w.Stats().Liveness)
+	assert.Equal(t, LevelWarn, w.logLevel.get())
+}
+
+func Test_Reconfigure_RejectsFixedFields(t *testing.T) {
+	w := reconfigureWorker(reconfigureConfig())
+
+	config := reconfigureConfig()
+	config.BrokerAddress = "inproc://elsewhere"
+	config.HeartbeatInMillis = 200 * time.Millisecond
+
+	assert.Equal(t, ReconfigureError{"BrokerAddress"}, w.reconfigure(config))
+	assert.Equal(t, time.Second, w.heartbeat, "Expected nothing to be applied")
+	assert.EqualError(t, ReconfigureError{"BrokerAddress"}, "WorkerConfig.BrokerAddress can't be changed at runtime")
+}
+
+func Test_Reconfigure_ValidatesConfig(t *testing.T) {
+	w := reconfigureWorker(reconfigureConfig())
+
+	config := reconfigureConfig()
+	config.PollingInterval = 2 * time.Second
+
+	assert.Equal(t, ErrPollingIntervalTooLong, w.reconfigure(config))
+	assert.Equal(t, 100*time.Millisecond, w.pollInterval)
+}
+
+func Test_Reconfigure_ReplacesAction(t *testing.T) {
+	w := reconfigureWorker(reconfigureConfig())
+
+	config := reconfigureConfig()
+	config.Action = errorWorkerAction{}
+
+	assert.NoError(t, w.reconfigure(config))
+	assert.Equal(t, errorWorkerAction{}, w.action())
+}
+
+func Test_Reconfigure_AfterShutdown(t *testing.T) {
+	w := &mdWorker{shutdown: make(chan struct{}), reconfigureNow: make(chan reconfiguration)}
+	close(w.shutdown)
+
+	assert.IsType(t, GracefulShutdown(""), w.Reconfigure(reconfigureConfig()))
+}
+
+func Test_Reconfigure_ConfigReflectsChanges(t *testing.T) {
+	w := reconfigureWorker(reconfigureConfig())
+	w.workerAction = defaultWorkerAction{}
+
+	config := w.Config()
+	assert.Equal(t, "test-service", config.ServiceName)
+	assert.Equal(t, defaultWorkerAction{}, config.Action, "Expected the current action")
+
+	config.HeartbeatInMillis = 200 * time.Millisecond
+	assert.NoError(t, w.reconfigure(config))
+	assert.Equal(t, 200*time.Millisecond, w.Config().HeartbeatInMillis)
+
+	w.setAction(errorWorkerAction{})
+	assert.Equal(t, errorWorkerAction{}, w.Config().Action)
+}
@@ -0,0 +1,43 @@
+package majordomo_worker
+
+import (
+	"context"
+)
+
+// ReconnectLimiter throttles reconnects to the broker. Share one between all the workers in a process so they
+// don't all reconnect at once when a broker restarts. *rate.Limiter from golang.org/x/time/rate implements it.
+type ReconnectLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Waits for the limiter to allow a reconnect, returning ErrBrokerUnreachable if it won't. The wait is cancelled once
+// Shutdown() is called, returning a GracefulShutdown error, as a limiter shared through an outage can take a while.
+func (w *mdWorker) waitToReconnect(workerSocket *mdWorkerSocket) error {
+	if w.reconnectLimiter == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-w.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := w.reconnectLimiter.Wait(ctx); err != nil {
+		if w.stopped() {
+			logDebugf(w.logger, "Shutting down, no longer waiting to reconnect to broker at '%s'", workerSocket.address)
+			return GracefulShutdown("Graceful Shutdown")
+		}
+
+		logErrorf(w.logger, "Reconnect limiter refused reconnect to broker at '%s', error: '%s'", workerSocket.address, err.Error())
+		w.stats.addError()
+		return ErrBrokerUnreachable
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+const (
+	reconnectRateWindow = time.Minute
+
+	// A worker reconnecting more often than this a minute is flapping whatever the exact rate is
+	reconnectRateSamples = 128
+)
+
+// A ring buffer of the most recent reconnect times, giving the reconnects per minute without keeping every reconnect
+type reconnectTimes struct {
+	times [reconnectRateSamples]time.Time
+	next  int
+	count int
+}
+
+func (r *reconnectTimes) add(at time.Time) {
+	r.times[r.next] = at
+	r.next = (r.next + 1) % reconnectRateSamples
+	if r.count < reconnectRateSamples {
+		r.count++
+	}
+}
+
+// Counts the reconnects in the minute up to now, walking back from the newest so it stops at the first one older
+func (r *reconnectTimes) perMinute(now time.Time) float64 {
+	recent := 0
+	for i := 1; i <= r.count; i++ {
+		at := r.times[(r.next-i+reconnectRateSamples)%reconnectRateSamples]
+		if now.Sub(at) >= reconnectRateWindow {
+			break
+		}
+		recent++
+	}
+
+	return float64(recent)
+}
+
+func (r *reconnectTimes) reset() {
+	*r = reconnectTimes{}
+}
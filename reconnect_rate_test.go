@@ -0,0 +1,49 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReconnectRate_CountsReconnectsInTheLastMinute(t *testing.T) {
+	clock := newFakeClock()
+	s := newWorkerStats(clock)
+
+	for i := 0; i < 5; i++ {
+		s.addReconnect()
+		clock.Advance(10 * time.Second)
+	}
+
+	assert.Equal(t, float64(5), s.snapshot().ReconnectRate)
+
+	// The first two reconnects were 50s and 40s ago, these take them past the minute
+	clock.Advance(20 * time.Second)
+	assert.Equal(t, float64(3), s.snapshot().ReconnectRate)
+	assert.Equal(t, uint64(5), s.snapshot().Reconnects)
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, float64(0), s.reconnectRate())
+}
+
+func Test_ReconnectRate_TopsOutAtTheRingSize(t *testing.T) {
+	clock := newFakeClock()
+	s := newWorkerStats(clock)
+
+	for i := 0; i < reconnectRateSamples+10; i++ {
+		s.addReconnect()
+		clock.Advance(time.Millisecond)
+	}
+
+	assert.Equal(t, float64(reconnectRateSamples), s.reconnectRate())
+}
+
+func Test_ReconnectRate_ZeroedByReset(t *testing.T) {
+	s := newWorkerStats(newFakeClock())
+	s.addReconnect()
+
+	s.reset()
+
+	assert.Equal(t, float64(0), s.reconnectRate())
+}
@@ -0,0 +1,38 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// BrokerState is what a ReconnectStrategy gets to decide on, as of the end of a poll
+type BrokerState struct {
+	Address string
+	// Liveness counts down by one every poll and is reset to MaxLiveness whenever the broker is heard from
+	Liveness, MaxLiveness int
+	LastHeardAt           time.Time
+	Now                   time.Time
+	Heartbeat             time.Duration
+	// ConsecutiveErrors counts the receive errors since the broker was last heard from
+	ConsecutiveErrors int
+}
+
+// ReconnectStrategy decides, after every poll, whether to reconnect to a broker and how long to sleep before doing
+// so. It is called from Receive() once for each broker.
+type ReconnectStrategy interface {
+	ShouldReconnect(state BrokerState) (reconnect bool, delay time.Duration)
+}
+
+// LivenessReconnectStrategy is the default ReconnectStrategy. It reconnects after Delay once a broker's liveness has
+// run out or, with ByTime, once the broker has been silent for MaxLiveness heartbeat intervals.
+type LivenessReconnectStrategy struct {
+	ByTime bool
+	Delay  time.Duration
+}
+
+func (s LivenessReconnectStrategy) ShouldReconnect(state BrokerState) (bool, time.Duration) {
+	if s.ByTime {
+		return state.Now.Sub(state.LastHeardAt) >= time.Duration(state.MaxLiveness)*state.Heartbeat, s.Delay
+	}
+
+	return state.Liveness <= 0, s.Delay
+}
@@ -0,0 +1,33 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LivenessReconnectStrategy_ReconnectsOnceLivenessRunsOut(t *testing.T) {
+	strategy := LivenessReconnectStrategy{Delay: 50 * time.Millisecond}
+
+	reconnect, _ := strategy.ShouldReconnect(BrokerState{Liveness: 1, MaxLiveness: 3})
+	assert.False(t, reconnect)
+
+	reconnect, delay := strategy.ShouldReconnect(BrokerState{Liveness: 0, MaxLiveness: 3})
+	assert.True(t, reconnect)
+	assert.Equal(t, 50*time.Millisecond, delay)
+}
+
+func Test_LivenessReconnectStrategy_ByTimeReconnectsSilentBroker(t *testing.T) {
+	strategy := LivenessReconnectStrategy{ByTime: true, Delay: 50 * time.Millisecond}
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	state := BrokerState{Liveness: 0, MaxLiveness: 3, Heartbeat: time.Second, Now: now, LastHeardAt: now.Add(-2 * time.Second)}
+	reconnect, _ := strategy.ShouldReconnect(state)
+	assert.False(t, reconnect, "Expected poll count to be ignored")
+
+	state.LastHeardAt = now.Add(-3 * time.Second)
+	reconnect, delay := strategy.ShouldReconnect(state)
+	assert.True(t, reconnect)
+	assert.Equal(t, 50*time.Millisecond, delay)
+}
@@ -0,0 +1,59 @@
+package majordomo_worker
+
+// Whether the worker has handled WorkerConfig.MaxRequestsBeforeRestart requests since it last restarted. With
+// ManualLiveness it only restarts when asked to with Restart().
+func (w *mdWorker) restartDue() bool {
+	return w.maxRequestsBeforeRestart > 0 && !w.manualLiveness && w.requestsSinceRestart >= w.maxRequestsBeforeRestart
+}
+
+// Disconnects from the brokers and connects afresh, dropping cached replies, as if the worker had been restarted.
+// Stats carry on counting. Actions in hand get ShutdownTimeout to finish, as when a broker asks the worker to drain.
+// Returns the first error reconnecting.
+func (w *mdWorker) restart() error {
+	logDebugf(w.logger, "Restarting after %d requests", w.requestsSinceRestart)
+	w.requestsSinceRestart = 0
+
+	if w.idempotencyCache != nil {
+		w.idempotencyCache.clear()
+	}
+
+	return w.drainAndReconnect(w.shutdownTimeout)
+}
+
+func (w *mdWorker) Restart() error {
+	result := make(chan error, 1)
+
+	select {
+	case w.restartNow <- result:
+		return <-result
+	case <-w.shutdown:
+		return GracefulShutdown("Graceful Shutdown")
+	}
+}
+
+// Restarts as restart() does but connects to each broker again with the identity it knew the worker by, which is
+// always set on the socket (see socketIdentity) so it can be read back. IdentityFunc isn't asked for a new one. With
+// ServiceAliases a broker knows the worker by one identity per service, so those are left to be generated afresh.
+func (w *mdWorker) restartKeepingIdentity() error {
+	if len(w.serviceNames) > 1 {
+		return w.restart()
+	}
+
+	identities := make(map[string][]byte, len(w.sockets))
+	for _, workerSocket := range w.sockets {
+		identity, err := workerSocket.socket.GetIdentity()
+		if err != nil {
+			return err
+		}
+
+		// Nothing to keep if generating one failed, ZeroMQ's own can't be read back
+		if identity != "" {
+			identities[workerSocket.address] = []byte(identity)
+		}
+	}
+
+	w.keptIdentities = identities
+	defer func() { w.keptIdentities = nil }()
+
+	return w.restart()
+}
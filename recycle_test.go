@@ -0,0 +1,14 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Restart_AfterShutdown(t *testing.T) {
+	w := &mdWorker{shutdown: make(chan struct{}), restartNow: make(chan chan error)}
+	close(w.shutdown)
+
+	assert.IsType(t, GracefulShutdown(""), w.Restart())
+}
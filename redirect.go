@@ -0,0 +1,58 @@
+package majordomo_worker
+
+// The frame after MD_DISCONNECT that asks the worker to drain rather than reconnect straight away
+const DisconnectDrain = "drain"
+
+// Reports whether an MD_DISCONNECT asks the worker to drain, with DisconnectDrain as the first frame after the command
+func (w *mdWorker) disconnectDrain(msg [][]byte) bool {
+	return len(msg) > w.envelope.Command+1 && string(msg[w.envelope.Command+1]) == DisconnectDrain
+}
+
+// Finishes the batch and the requests in hand, replying to each, without reading any more requests meanwhile. Like
+// shutting down it gives the actions up to ShutdownTimeout, after which they're abandoned and left running.
+func (w *mdWorker) drainRequests(workerSocket *mdWorkerSocket) {
+	logWarnf(w.logger, "Broker at '%s' asked the worker to drain, finishing %d requests in hand before registering again", workerSocket.address, len(w.slots)+len(w.batch))
+
+	if len(w.batch) > 0 {
+		w.flushBatch()
+	}
+	w.finishInFlight(w.shutdownTimeout)
+}
+
+// Returns the address an MD_DISCONNECT redirects the worker to, if WorkerConfig.FollowDisconnectRedirects is set
+// and it has one. The redirect is the first frame after the command.
+func (w *mdWorker) disconnectRedirect(workerSocket *mdWorkerSocket, msg [][]byte) (string, bool) {
+	if !w.followRedirects || len(msg) <= w.envelope.Command+1 {
+		return "", false
+	}
+
+	address := string(msg[w.envelope.Command+1])
+	if address == "" || address == workerSocket.address {
+		return "", false
+	}
+
+	if err := validateTransport(address, w.curve.enabled()); err != nil {
+		logWarnf(w.logger, "Ignoring redirect from broker at '%s', error: '%s'", workerSocket.address, err.Error())
+		w.stats.addError()
+		return "", false
+	}
+
+	return address, true
+}
+
+// Reports whether an MD_DISCONNECT arrived within WorkerConfig.DisconnectGracePeriod of the last one the worker
+// reconnected for, in which case it is ignored. Otherwise it starts a new grace period.
+func (w *mdWorker) disconnectSuppressed(workerSocket *mdWorkerSocket) bool {
+	if w.disconnectGracePeriod <= 0 {
+		return false
+	}
+
+	now := w.clock.Now()
+	if !workerSocket.disconnectedAt.IsZero() && now.Sub(workerSocket.disconnectedAt) < w.disconnectGracePeriod {
+		logWarnf(w.logger, "Ignoring '%s' from broker at '%s', the last one was only %s ago", commandName(MD_DISCONNECT), workerSocket.address, now.Sub(workerSocket.disconnectedAt))
+		return true
+	}
+
+	workerSocket.disconnectedAt = now
+	return false
+}
@@ -0,0 +1,76 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DisconnectGracePeriod_SuppressesUntilItEnds(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.disconnectGracePeriod = time.Second
+	workerSocket := &mdWorkerSocket{address: "inproc://test"}
+
+	assert.False(t, w.disconnectSuppressed(workerSocket), "Expected the first disconnect to be honoured")
+
+	w.clock.(*fakeClock).Advance(500 * time.Millisecond)
+	assert.True(t, w.disconnectSuppressed(workerSocket))
+	assert.True(t, w.disconnectSuppressed(workerSocket))
+
+	// Measured from the disconnect honoured, not the ones ignored since
+	w.clock.(*fakeClock).Advance(500 * time.Millisecond)
+	assert.False(t, w.disconnectSuppressed(workerSocket))
+}
+
+func Test_DisconnectGracePeriod_EveryDisconnectHonouredByDefault(t *testing.T) {
+	w := frameWorker(nil, nil)
+	workerSocket := &mdWorkerSocket{address: "inproc://test"}
+
+	assert.False(t, w.disconnectSuppressed(workerSocket))
+	assert.False(t, w.disconnectSuppressed(workerSocket))
+}
+
+func Test_DisconnectDrain_OnlyWithDrainFrame(t *testing.T) {
+	w := frameWorker(nil, nil)
+	disconnect := [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)}
+
+	assert.False(t, w.disconnectDrain(disconnect))
+	assert.True(t, w.disconnectDrain(append(disconnect, []byte(DisconnectDrain))))
+	assert.False(t, w.disconnectDrain(append(disconnect, []byte("tcp://elsewhere:5555"))))
+}
+
+func Test_DisconnectDrain_GivesUpAfterShutdownTimeout(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.shutdownTimeout = time.Minute
+	clock := w.clock.(*fakeClock)
+
+	// An action that never finishes
+	w.slots = make(chan struct{}, 1)
+	w.slots <- struct{}{}
+
+	drained := make(chan struct{})
+	go func() {
+		w.drainRequests(&mdWorkerSocket{address: "inproc://test"})
+		close(drained)
+	}()
+
+	for {
+		clock.Lock()
+		waiting := len(clock.waiters)
+		clock.Unlock()
+
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		assert.Fail(t, "Expected the drain to give up on the running action")
+	}
+	assert.Len(t, w.slots, 1, "Expected the action to be left running")
+}
@@ -0,0 +1,77 @@
+package majordomo_worker
+
+import (
+	"sort"
+	"sync"
+)
+
+// WorkerState is what a worker is doing, as reported by ActiveWorkers
+type WorkerState string
+
+const (
+	WorkerRunning      WorkerState = "running"
+	WorkerPaused       WorkerState = "paused"
+	WorkerShuttingDown WorkerState = "shutting down"
+)
+
+// WorkerInfo describes a live worker, see ActiveWorkers
+type WorkerInfo struct {
+	// Name is the worker's name, see WorkerConfig.Name
+	Name        string
+	ServiceName string
+	State       WorkerState
+	Stats       WorkerStats
+}
+
+// Every worker created that hasn't been closed yet, for admin views of the process
+var registry = struct {
+	sync.Mutex
+	workers map[*mdWorker]struct{}
+}{workers: make(map[*mdWorker]struct{})}
+
+func register(w *mdWorker) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.workers[w] = struct{}{}
+}
+
+func deregister(w *mdWorker) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	delete(registry.workers, w)
+}
+
+// ActiveWorkers describes every worker in the process that connected to its brokers and hasn't been closed yet,
+// sorted by name. It may be called from any goroutine, i.e. to serve an admin endpoint.
+func ActiveWorkers() []WorkerInfo {
+	registry.Lock()
+	defer registry.Unlock()
+
+	infos := make([]WorkerInfo, 0, len(registry.workers))
+	for w := range registry.workers {
+		infos = append(infos, w.info())
+	}
+
+	sort.Sort(byName(infos))
+
+	return infos
+}
+
+type byName []WorkerInfo
+
+func (infos byName) Len() int           { return len(infos) }
+func (infos byName) Less(i, j int) bool { return infos[i].Name < infos[j].Name }
+func (infos byName) Swap(i, j int)      { infos[i], infos[j] = infos[j], infos[i] }
+
+func (w *mdWorker) info() WorkerInfo {
+	state := WorkerRunning
+	if w.stopped() {
+		state = WorkerShuttingDown
+	} else if w.isPaused() {
+		state = WorkerPaused
+	}
+
+	return WorkerInfo{Name: w.name, ServiceName: w.serviceName, State: state, Stats: w.Stats()}
+}
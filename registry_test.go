@@ -0,0 +1,61 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func registryWorker(name string) *mdWorker {
+	return &mdWorker{name: name, serviceName: "test-service", stats: newWorkerStats(newFakeClock()), logger: new(testLogger)}
+}
+
+// Other tests' workers may be registered too
+func findWorker(name string) (WorkerInfo, bool) {
+	for _, info := range ActiveWorkers() {
+		if info.Name == name {
+			return info, true
+		}
+	}
+
+	return WorkerInfo{}, false
+}
+
+func Test_Registry_ReflectsRegisteredWorkers(t *testing.T) {
+	first := registryWorker("registry-test-1")
+	second := registryWorker("registry-test-2")
+
+	register(first)
+	register(second)
+
+	_, found := findWorker("registry-test-1")
+	assert.True(t, found)
+	_, found = findWorker("registry-test-2")
+	assert.True(t, found)
+
+	deregister(first)
+
+	_, found = findWorker("registry-test-1")
+	assert.False(t, found)
+	_, found = findWorker("registry-test-2")
+	assert.True(t, found)
+
+	deregister(second)
+}
+
+func Test_Registry_ReportsState(t *testing.T) {
+	w := registryWorker("registry-test-state")
+	register(w)
+	defer deregister(w)
+
+	info, _ := findWorker("registry-test-state")
+	assert.Equal(t, WorkerInfo{Name: "registry-test-state", ServiceName: "test-service", State: WorkerRunning, Stats: WorkerStats{Healthy: true}}, info)
+
+	w.Pause()
+	info, _ = findWorker("registry-test-state")
+	assert.Equal(t, WorkerPaused, info.State)
+
+	w.stop()
+	info, _ = findWorker("registry-test-state")
+	assert.Equal(t, WorkerShuttingDown, info.State)
+}
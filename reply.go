@@ -0,0 +1,79 @@
+package majordomo_worker
+
+import (
+	"bytes"
+)
+
+// Reply builds the frames of a reply for an action to return, the zero value is an empty reply:
+//
+//	var reply Reply
+//	return reply.AddString("OK").AddFrame(body).Frames()
+//
+// Metadata, i.e. a status code or content type, can be set apart from the body for clients to read with
+// SplitReplyMetadata. A reply with metadata starts with one 'key=value' frame per key, sorted by key, then an empty
+// frame and then the body frames.
+type Reply struct {
+	frames   [][]byte
+	metadata map[string]string
+}
+
+// AddFrame appends a frame to the reply, the frame isn't copied
+func (r *Reply) AddFrame(frame []byte) *Reply {
+	r.frames = append(r.frames, frame)
+	return r
+}
+
+func (r *Reply) AddString(frame string) *Reply {
+	return r.AddFrame([]byte(frame))
+}
+
+// SetMetadata sets a metadata frame sent ahead of the body, replacing any value already set for key. Keys must not
+// be empty or contain '=', values can be anything.
+func (r *Reply) SetMetadata(key, value string) *Reply {
+	if r.metadata == nil {
+		r.metadata = make(map[string]string)
+	}
+
+	r.metadata[key] = value
+	return r
+}
+
+// Frames returns the reply's frames, nil if none were added. Replies with metadata start with it, see Reply.
+func (r *Reply) Frames() [][]byte {
+	if len(r.metadata) == 0 {
+		return r.frames
+	}
+
+	frames := append(encodeReadyMetadata(r.metadata), []byte{})
+	return append(frames, r.frames...)
+}
+
+// SplitReplyMetadata is for clients of workers that reply with Reply.SetMetadata. It returns the metadata and the
+// body of a reply, or ErrNoReplyMetadata if the reply doesn't start with metadata.
+func SplitReplyMetadata(reply [][]byte) (map[string]string, [][]byte, error) {
+	metadata := make(map[string]string)
+
+	for i, frame := range reply {
+		if len(frame) == 0 {
+			return metadata, reply[i+1:], nil
+		}
+
+		separator := bytes.IndexByte(frame, '=')
+		if separator < 1 {
+			return nil, nil, ErrNoReplyMetadata
+		}
+		metadata[string(frame[:separator])] = string(frame[separator+1:])
+	}
+
+	return nil, nil, ErrNoReplyMetadata
+}
+
+// ReplyFromStrings returns a reply with one frame per string
+func ReplyFromStrings(frames ...string) [][]byte {
+	var reply Reply
+	for _, frame := range frames {
+		reply.AddString(frame)
+	}
+
+	return reply.Frames()
+}
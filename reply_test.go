@@ -0,0 +1,78 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Reply_EmptyHasNoFrames(t *testing.T) {
+	var reply Reply
+
+	assert.Nil(t, reply.Frames())
+	assert.Nil(t, ReplyFromStrings())
+}
+
+func Test_Reply_KeepsFramesInOrder(t *testing.T) {
+	var reply Reply
+	reply.AddString("OK").AddFrame([]byte{0x01, 0x02}).AddString("")
+
+	assert.Equal(t, [][]byte{[]byte("OK"), {0x01, 0x02}, []byte("")}, reply.Frames())
+}
+
+func Test_Reply_FromStrings(t *testing.T) {
+	assert.Equal(t, [][]byte{[]byte("OK"), []byte("done")}, ReplyFromStrings("OK", "done"))
+}
+
+func Test_ReplyFrames_NilBodyIsEmptyReply(t *testing.T) {
+	assert.Equal(t, [][]byte{{}}, replyFrames(nil, nil))
+	assert.Equal(t, [][]byte{{}}, replyFrames(nil, [][]byte{}))
+}
+
+func Test_ReplyFrames_BodyAfterDelimiter(t *testing.T) {
+	assert.Equal(t, [][]byte{{}, []byte("OK"), nil}, replyFrames(nil, [][]byte{[]byte("OK"), nil}))
+}
+
+func Test_ReplyFrames_PrefixBetweenDelimiterAndBody(t *testing.T) {
+	prefix := [][]byte{[]byte("tag"), []byte("eu-west")}
+
+	assert.Equal(t, [][]byte{{}, []byte("tag"), []byte("eu-west"), []byte("OK")}, replyFrames(prefix, [][]byte{[]byte("OK")}))
+	assert.Equal(t, [][]byte{{}, []byte("tag"), []byte("eu-west")}, replyFrames(prefix, nil), "Expected the prefix on empty replies too")
+}
+
+func Test_Reply_MetadataAheadOfBody(t *testing.T) {
+	var reply Reply
+	reply.AddString("body").SetMetadata("status", "404").SetMetadata("content-type", "text/plain").AddFrame(nil)
+
+	assert.Equal(t, [][]byte{[]byte("content-type=text/plain"), []byte("status=404"), {}, []byte("body"), nil}, reply.Frames())
+}
+
+func Test_Reply_MetadataRoundTrip(t *testing.T) {
+	var reply Reply
+	reply.SetMetadata("status", "200").SetMetadata("query", "a=b").AddString("").AddString("data")
+
+	metadata, body, err := SplitReplyMetadata(reply.Frames())
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"status": "200", "query": "a=b"}, metadata)
+	assert.Equal(t, [][]byte{[]byte(""), []byte("data")}, body)
+}
+
+func Test_Reply_MetadataWithoutBody(t *testing.T) {
+	var reply Reply
+	reply.SetMetadata("status", "204")
+
+	metadata, body, err := SplitReplyMetadata(reply.Frames())
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"status": "204"}, metadata)
+	assert.Empty(t, body)
+}
+
+func Test_Reply_SplitWithoutMetadata(t *testing.T) {
+	_, _, err := SplitReplyMetadata(ReplyFromStrings("OK", "done"))
+	assert.Equal(t, ErrNoReplyMetadata, err)
+
+	_, _, err = SplitReplyMetadata(ReplyFromStrings("status=200"))
+	assert.Equal(t, ErrNoReplyMetadata, err)
+}
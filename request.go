@@ -0,0 +1,81 @@
+package majordomo_worker
+
+import (
+	"context"
+	"time"
+)
+
+// RequestContext describes a single MD_REQUEST received from the broker
+type RequestContext struct {
+	// ServiceName is the service the worker registered with the broker as
+	ServiceName string
+
+	// BrokerAddress is the address of the broker that routed the request
+	BrokerAddress string
+
+	// ReplyTo is the client envelope the reply is routed back to
+	ReplyTo []byte
+
+	// Request is the request body, as passed to the WorkerAction
+	Request [][]byte
+
+	// RawRequest is every frame of the MD_REQUEST as received from the broker, for actions that need custom
+	// framing. It is a copy, changing it has no effect on the request.
+	RawRequest [][]byte
+
+	// Deadline is when the client stops waiting for a reply, zero if it didn't send one.
+	// See WorkerConfig.PropagateDeadline.
+	Deadline time.Time
+
+	// ReceivedAt is when the worker read the request from the broker
+	ReceivedAt time.Time
+
+	// EnqueuedAt is when the broker queued the request, zero if it didn't say. See WorkerConfig.PropagateEnqueuedAt.
+	EnqueuedAt time.Time
+
+	// SessionToken identifies the client's session, nil if it didn't send one. See WorkerConfig.PropagateSessionToken.
+	SessionToken []byte
+
+	// WorkerState is the worker's WorkerConfig.State, nil if it has none. Actions type assert it back:
+	//
+	//	db := ctx.WorkerState.(*sql.DB)
+	WorkerState interface{}
+
+	// Context carries what WorkerConfig.ContextExtractor read from the request, i.e. a deadline or trace ID, for
+	// passing on to libraries that take a context.Context. It is context.Background() if there is no extractor.
+	Context context.Context
+
+	// The codec a negotiated request was encoded with, which the reply is encoded with too
+	codec string
+}
+
+// ContextWorkerAction can be implemented instead of WorkerAction.Call to receive the whole RequestContext
+type ContextWorkerAction interface {
+	CallWithContext(ctx RequestContext) [][]byte
+}
+
+// Builds ctx.Context with WorkerConfig.ContextExtractor. A deadline it sets becomes the request's deadline, unless
+// the client sent an earlier one.
+func (w *mdWorker) extractContext(ctx *RequestContext) {
+	if w.contextExtractor != nil {
+		ctx.Context = w.contextExtractor(ctx.Request)
+	}
+	if ctx.Context == nil {
+		ctx.Context = context.Background()
+		return
+	}
+
+	if deadline, ok := ctx.Context.Deadline(); ok && (ctx.Deadline.IsZero() || deadline.Before(ctx.Deadline)) {
+		ctx.Deadline = deadline
+	}
+}
+
+func copyFrames(frames [][]byte) [][]byte {
+	copied := make([][]byte, len(frames))
+	for i, frame := range frames {
+		copied[i] = make([]byte, len(frame))
+		copy(copied[i], frame)
+	}
+
+	return copied
+}
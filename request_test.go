@@ -0,0 +1,50 @@
+package majordomo_worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExtractContext_BackgroundWithoutExtractor(t *testing.T) {
+	w := frameWorker(nil, nil)
+	ctx := RequestContext{}
+
+	w.extractContext(&ctx)
+
+	assert.Equal(t, context.Background(), ctx.Context)
+	assert.True(t, ctx.Deadline.IsZero())
+}
+
+func Test_ExtractContext_EarlierDeadlineWins(t *testing.T) {
+	now := time.Now()
+	w := frameWorker(nil, nil)
+	w.contextExtractor = func(body [][]byte) context.Context {
+		ctx, cancel := context.WithDeadline(context.Background(), now.Add(time.Minute))
+		defer cancel()
+		return ctx
+	}
+
+	ctx := RequestContext{}
+	w.extractContext(&ctx)
+	assert.Equal(t, now.Add(time.Minute), ctx.Deadline)
+
+	// The client's is earlier
+	ctx = RequestContext{Deadline: now.Add(time.Second)}
+	w.extractContext(&ctx)
+	assert.Equal(t, now.Add(time.Second), ctx.Deadline)
+}
+
+func Test_ExtractContext_NilFromExtractorIsBackground(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.contextExtractor = func(body [][]byte) context.Context {
+		return nil
+	}
+
+	ctx := RequestContext{}
+	w.extractContext(&ctx)
+
+	assert.Equal(t, context.Background(), ctx.Context)
+}
@@ -0,0 +1,30 @@
+package majordomo_worker
+
+// RoutedReply is a reply addressed to a client other than the one that made the request
+type RoutedReply struct {
+	ReplyTo []byte
+	Reply   [][]byte
+}
+
+// RoutedWorkerAction can be implemented instead of WorkerAction.Call by actions that answer more than one client,
+// i.e. to fan a request's results out or to complete requests they were aggregating. The reply goes to the client
+// that made the request as usual, so the broker knows the worker is done with it, and each routed reply is then sent
+// to its own client. Brokers must tolerate replies for clients whose requests they didn't route to the worker.
+type RoutedWorkerAction interface {
+	CallRouted(ctx RequestContext) (reply [][]byte, routed []RoutedReply)
+}
+
+// Sends the replies an action routed to other clients, which go through everything the requester's reply does apart
+// from being resent after a reconnect (see ResendReplyOnReconnect)
+func (w *mdWorker) sendRouted(workerSocket *mdWorkerSocket, ctx RequestContext, result actionResult) {
+	if result.err != nil {
+		return
+	}
+
+	for _, routed := range result.routed {
+		routedCtx := ctx
+		routedCtx.ReplyTo = routed.ReplyTo
+
+		w.deliverReply(workerSocket, routedCtx, routed.Reply)
+	}
+}
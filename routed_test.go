@@ -0,0 +1,30 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type routedWorkerAction struct {
+	routed []RoutedReply
+}
+
+func (a routedWorkerAction) Call(args [][]byte) [][]byte {
+	panic("Call should not be used when CallRouted is available")
+}
+
+func (a routedWorkerAction) CallRouted(ctx RequestContext) ([][]byte, []RoutedReply) {
+	return ctx.Request, a.routed
+}
+
+func Test_Routed_ActionResultCarriesRoutedReplies(t *testing.T) {
+	routed := []RoutedReply{{ReplyTo: []byte("client-2"), Reply: [][]byte{[]byte("to client-2")}}}
+	w := &mdWorker{workerAction: routedWorkerAction{routed}}
+
+	result := w.callAction(RequestContext{Request: [][]byte{[]byte("hello")}})
+
+	assert.NoError(t, result.err)
+	assert.Equal(t, [][]byte{[]byte("hello")}, result.reply)
+	assert.Equal(t, routed, result.routed)
+}
@@ -0,0 +1,100 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// DelayedWorkerAction can be implemented instead of WorkerAction.Call by actions whose reply mustn't be sent straight
+// away, i.e. for rate shaping. The reply is sent once sendAfter has passed, so clients and brokers must be willing to
+// wait that much longer for it. Brokers don't send a worker another request until it has replied, so the worker only
+// carries on with other requests meanwhile if it has slots to spare (MaxConcurrentRequests) or other brokers to serve.
+// Replies still waiting when the worker reconnects to their broker are dropped, the broker has forgotten the requests.
+// A zero or negative delay sends it straight away.
+type DelayedWorkerAction interface {
+	CallDelayed(ctx RequestContext) (reply [][]byte, sendAfter time.Duration)
+}
+
+// A reply held back until sendAt, see DelayedWorkerAction. Sent from Receive() like every other reply.
+type scheduledReply struct {
+	workerSocket *mdWorkerSocket
+	ctx          RequestContext
+	reply        [][]byte
+	sendAt       time.Time
+}
+
+// Whether the action asked for its reply to be held back. With ManualLiveness it never is, as the worker doesn't act
+// on time passing of its own accord.
+func (w *mdWorker) delaysReply(result actionResult) bool {
+	return result.err == nil && result.delay > 0 && !w.manualLiveness
+}
+
+// Holds the reply back until the delay has passed, keeping the replies in the order they are due. The request stays
+// in the queue depth until then.
+func (w *mdWorker) scheduleReply(workerSocket *mdWorkerSocket, ctx RequestContext, reply [][]byte, delay time.Duration) {
+	w.stats.requestQueued()
+
+	scheduled := scheduledReply{workerSocket: workerSocket, ctx: ctx, reply: reply, sendAt: w.clock.Now().Add(delay)}
+	logDebugf(w.logger, "Scheduling reply to '%s' for %s from now", ctx.ReplyTo, delay)
+
+	i := len(w.scheduledReplies)
+	for i > 0 && w.scheduledReplies[i-1].sendAt.After(scheduled.sendAt) {
+		i--
+	}
+
+	w.scheduledReplies = append(w.scheduledReplies, scheduledReply{})
+	copy(w.scheduledReplies[i+1:], w.scheduledReplies[i:])
+	w.scheduledReplies[i] = scheduled
+}
+
+// Sends the scheduled replies that are due, or every one of them if all is set, i.e. when shutting down
+func (w *mdWorker) sendScheduledReplies(all bool) {
+	now := w.clock.Now()
+
+	sent := 0
+	for _, scheduled := range w.scheduledReplies {
+		if !all && scheduled.sendAt.After(now) {
+			break
+		}
+
+		w.sendReply(scheduled.workerSocket, scheduled.ctx, scheduled.reply)
+		sent++
+	}
+
+	if sent > 0 {
+		w.scheduledReplies = w.scheduledReplies[sent:]
+		w.stats.requestsDone(sent)
+	}
+}
+
+// Drops the replies scheduled for a broker the worker is reconnecting to, the new connection knows nothing of the
+// requests they answer
+func (w *mdWorker) dropScheduledReplies(workerSocket *mdWorkerSocket) {
+	kept := w.scheduledReplies[:0]
+	for _, scheduled := range w.scheduledReplies {
+		if scheduled.workerSocket == workerSocket {
+			logWarnf(w.logger, "Reconnecting to broker at '%s', dropping reply to '%s' scheduled before", workerSocket.address, scheduled.ctx.ReplyTo)
+			w.stats.requestsDone(1)
+			continue
+		}
+		kept = append(kept, scheduled)
+	}
+
+	w.scheduledReplies = kept
+}
+
+// Shortens the poll timeout so the next scheduled reply isn't sent late
+func (w *mdWorker) untilReplyDue(timeout time.Duration) time.Duration {
+	if len(w.scheduledReplies) == 0 {
+		return timeout
+	}
+
+	untilDue := w.scheduledReplies[0].sendAt.Sub(w.clock.Now())
+	if untilDue < 0 {
+		return 0
+	}
+	if untilDue < timeout {
+		return untilDue
+	}
+
+	return timeout
+}
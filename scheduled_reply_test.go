@@ -0,0 +1,84 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Echoes the request once the delay has passed
+type delayedAction struct {
+	delay time.Duration
+}
+
+func (a delayedAction) Call(args [][]byte) [][]byte {
+	panic("Call should not be used when CallDelayed is available")
+}
+
+func (a delayedAction) CallDelayed(ctx RequestContext) ([][]byte, time.Duration) {
+	return ctx.Request, a.delay
+}
+
+func Test_ScheduledReply_DelayFromAction(t *testing.T) {
+	w := actionWorker(delayedAction{delay: time.Second})
+	w.actionTimeout = 0
+
+	result := w.invokeAction(RequestContext{Request: [][]byte{[]byte("hello")}})
+
+	assert.NoError(t, result.err)
+	assert.Equal(t, [][]byte{[]byte("hello")}, result.reply)
+	assert.Equal(t, time.Second, result.delay)
+}
+
+func Test_ScheduledReply_KeptInOrderDue(t *testing.T) {
+	w := frameWorker(nil, nil)
+
+	w.scheduleReply(nil, RequestContext{ReplyTo: []byte("late")}, nil, 3*time.Second)
+	w.scheduleReply(nil, RequestContext{ReplyTo: []byte("early")}, nil, time.Second)
+	w.scheduleReply(nil, RequestContext{ReplyTo: []byte("middle")}, nil, 2*time.Second)
+
+	var order []string
+	for _, scheduled := range w.scheduledReplies {
+		order = append(order, string(scheduled.ctx.ReplyTo))
+	}
+	assert.Equal(t, []string{"early", "middle", "late"}, order)
+	assert.Equal(t, 3, w.stats.queued(), "Expected scheduled replies to count as queued")
+}
+
+func Test_ScheduledReply_PollEndsWhenDue(t *testing.T) {
+	w := frameWorker(nil, nil)
+	assert.Equal(t, time.Second, w.untilReplyDue(time.Second))
+
+	w.scheduleReply(nil, RequestContext{}, nil, 300*time.Millisecond)
+	assert.Equal(t, 300*time.Millisecond, w.untilReplyDue(time.Second))
+	assert.Equal(t, 100*time.Millisecond, w.untilReplyDue(100*time.Millisecond))
+
+	w.clock.(*fakeClock).Advance(time.Second)
+	assert.Equal(t, time.Duration(0), w.untilReplyDue(time.Second))
+}
+
+func Test_ScheduledReply_NothingSentBeforeDue(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.scheduleReply(nil, RequestContext{}, nil, time.Second)
+
+	w.sendScheduledReplies(false)
+
+	assert.Len(t, w.scheduledReplies, 1)
+}
+
+func Test_ScheduledReply_DroppedOnReconnectToTheirBroker(t *testing.T) {
+	w := frameWorker(nil, nil)
+	reconnecting := &mdWorkerSocket{address: "tcp://first"}
+	other := &mdWorkerSocket{address: "tcp://second"}
+
+	w.scheduleReply(reconnecting, RequestContext{ReplyTo: []byte("forgotten")}, nil, time.Second)
+	w.scheduleReply(other, RequestContext{ReplyTo: []byte("kept")}, nil, 2*time.Second)
+
+	w.dropScheduledReplies(reconnecting)
+
+	if assert.Len(t, w.scheduledReplies, 1) {
+		assert.Equal(t, []byte("kept"), w.scheduledReplies[0].ctx.ReplyTo)
+	}
+	assert.Equal(t, 1, w.stats.queued())
+}
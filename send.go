@@ -0,0 +1,66 @@
+package majordomo_worker
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/pebbe/zmq4"
+)
+
+// How long to wait before retrying a send that timed out
+const sendRetryDelay = time.Millisecond
+
+// How many more times a READY that couldn't be sent is tried, and how long to wait in between
+const (
+	readyRetries    = 3
+	readyRetryDelay = 10 * time.Millisecond
+)
+
+// The part of *zmq4.Socket used to send to brokers
+type messageSender interface {
+	SendMessage(parts ...interface{}) (int, error)
+}
+
+// Only returned by sends once SendTimeout is set, without it sends block instead
+func sendTimedOut(err error) bool {
+	return err != nil && zmq4.AsErrno(err) == zmq4.Errno(syscall.EAGAIN)
+}
+
+// Sends to the broker, reconnecting if it still isn't reading once the send has been retried. Returns the send's
+// error, if any.
+func (w *mdWorker) sendOrReconnect(workerSocket *mdWorkerSocket, command string, serviceName []byte, msg [][]byte) error {
+	err := w.sendToBroker(workerSocket.socket, command, serviceName, msg)
+	if !sendTimedOut(err) {
+		return err
+	}
+
+	logWarnf(w.logger, "Sending to broker at '%s' timed out after %d retries, reconnecting", workerSocket.address, w.sendRetries)
+	w.stats.addError()
+	w.reconnectToBroker(workerSocket, w.reconnect)
+
+	return err
+}
+
+// Sends MD_REPLY with WorkerConfig.ReplyTimeout, if set, as the socket's send timeout in place of SendTimeout. The
+// action has already finished, so a reply the broker won't take isn't retried: the worker reconnects straight away.
+func (w *mdWorker) sendReplyOrReconnect(workerSocket *mdWorkerSocket, replyTo []byte, reply [][]byte) error {
+	if w.replyTimeout <= 0 {
+		return w.sendOrReconnect(workerSocket, MD_REPLY, replyTo, reply)
+	}
+
+	socket := workerSocket.socket
+	sendTimeout, _ := socket.GetSndtimeo()
+	socket.SetSndtimeo(w.replyTimeout)
+	err := w.sendWithRetries(socket, 0, MD_REPLY, replyTo, reply)
+	socket.SetSndtimeo(sendTimeout)
+
+	if !sendTimedOut(err) {
+		return err
+	}
+
+	logWarnf(w.logger, "Sending reply to broker at '%s' timed out after %s, reconnecting", workerSocket.address, w.replyTimeout)
+	w.stats.addError()
+	w.reconnectToBroker(workerSocket, w.reconnect)
+
+	return err
+}
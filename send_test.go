@@ -0,0 +1,121 @@
+package majordomo_worker
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fails the first sends with the given errors, then succeeds
+type fakeSender struct {
+	errs []error
+	sent [][]interface{}
+}
+
+func (s *fakeSender) SendMessage(parts ...interface{}) (int, error) {
+	s.sent = append(s.sent, parts)
+
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+func sendWorker() *mdWorker {
+	clock := newFakeClock()
+
+	return &mdWorker{
+		sendRetries: defaultSendRetries,
+		metrics:     noopMetrics{},
+		stats:       newWorkerStats(clock),
+		clock:       clock,
+		logger:      new(testLogger),
+	}
+}
+
+func Test_Send_RetriesAfterTimeout(t *testing.T) {
+	w := sendWorker()
+	sender := &fakeSender{errs: []error{zmq4.Errno(syscall.EAGAIN)}}
+
+	err := w.sendToBroker(sender, MD_HEARTBEAT, nil, nil)
+
+	assert.NoError(t, err)
+	assert.Len(t, sender.sent, 2)
+	assert.Equal(t, 1, w.clock.(*fakeClock).sleepCount())
+	assert.Equal(t, uint64(0), w.Stats().Reconnects)
+	assert.Equal(t, uint64(0), w.Stats().Errors)
+}
+
+func Test_Send_GivesUpAfterRetries(t *testing.T) {
+	w := sendWorker()
+	eagain := zmq4.Errno(syscall.EAGAIN)
+	sender := &fakeSender{errs: []error{eagain, eagain, eagain, eagain}}
+
+	err := w.sendToBroker(sender, MD_HEARTBEAT, nil, nil)
+
+	assert.True(t, sendTimedOut(err))
+	assert.Len(t, sender.sent, 1+defaultSendRetries)
+}
+
+func Test_Send_OtherErrorsNotRetried(t *testing.T) {
+	w := sendWorker()
+	sender := &fakeSender{errs: []error{zmq4.ETERM}}
+
+	err := w.sendToBroker(sender, MD_HEARTBEAT, nil, nil)
+
+	assert.Equal(t, zmq4.ETERM, err)
+	assert.Len(t, sender.sent, 1)
+}
+
+func Test_Send_RetriesDisabled(t *testing.T) {
+	w := sendWorker()
+	w.sendRetries = 0
+	sender := &fakeSender{errs: []error{zmq4.Errno(syscall.EAGAIN)}}
+
+	err := w.sendToBroker(sender, MD_HEARTBEAT, nil, nil)
+
+	assert.True(t, sendTimedOut(err))
+	assert.Len(t, sender.sent, 1)
+}
+
+func Test_Send_ReplyNotRetried(t *testing.T) {
+	w := sendWorker()
+	sender := &fakeSender{errs: []error{zmq4.Errno(syscall.EAGAIN)}}
+
+	err := w.sendWithRetries(sender, 0, MD_REPLY, []byte("client"), replyFrames(nil, nil))
+
+	assert.True(t, sendTimedOut(err))
+	assert.Len(t, sender.sent, 1)
+	assert.Equal(t, 0, w.clock.(*fakeClock).sleepCount())
+}
+
+func Test_Send_ReadyRetriedAfterFailure(t *testing.T) {
+	w := sendWorker()
+	w.serviceName = "echo"
+	sender := &fakeSender{errs: []error{zmq4.Errno(syscall.EHOSTUNREACH)}}
+
+	err := w.sendReadyWithRetries(sender, "tcp://broker:5555", "echo")
+
+	assert.NoError(t, err)
+	assert.Len(t, sender.sent, 2)
+	assert.Equal(t, []time.Duration{readyRetryDelay}, w.clock.(*fakeClock).sleeps)
+	assert.Equal(t, uint64(0), w.Stats().Errors)
+}
+
+func Test_Send_ReadyGivesUpAfterRetries(t *testing.T) {
+	w := sendWorker()
+	unreachable := zmq4.Errno(syscall.EHOSTUNREACH)
+	sender := &fakeSender{errs: []error{unreachable, unreachable, unreachable, unreachable}}
+
+	err := w.sendReadyWithRetries(sender, "tcp://broker:5555", "echo")
+
+	assert.Equal(t, unreachable, err)
+	assert.Len(t, sender.sent, readyRetries+1)
+	assert.Equal(t, uint64(1), w.Stats().Errors)
+}
@@ -0,0 +1,48 @@
+package majordomo_worker
+
+// The service names the worker registers with every broker as, ServiceName first and then any aliases
+func (c WorkerConfig) registeredServiceNames() []string {
+	names := []string{c.registeredServiceName()}
+	for _, alias := range c.ServiceAliases {
+		names = append(names, c.ServiceNamePrefix+alias)
+	}
+
+	return names
+}
+
+func (c WorkerConfig) validateServiceAliases(maxServiceNameLength int) error {
+	if len(c.ServiceAliases) == 0 {
+		return nil
+	}
+
+	if c.Identity != "" || c.IdentityFunc != nil || c.Bind {
+		return ErrServiceAliasesConflict
+	}
+
+	seen := map[string]bool{c.ServiceName: true}
+	for _, alias := range c.ServiceAliases {
+		if len(alias) == 0 {
+			return ErrEmptyServiceName
+		}
+
+		if len(c.ServiceNamePrefix+alias) > maxServiceNameLength {
+			return ErrServiceNameTooLong
+		}
+
+		if seen[alias] {
+			return ErrDuplicateServiceAlias
+		}
+		seen[alias] = true
+	}
+
+	return nil
+}
+
+// The service the socket is registered as. Sockets only have one of their own once connected to a broker.
+func (w *mdWorker) socketService(workerSocket *mdWorkerSocket) string {
+	if workerSocket.serviceName == "" {
+		return w.serviceName
+	}
+
+	return workerSocket.serviceName
+}
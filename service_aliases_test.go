@@ -0,0 +1,54 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func aliasConfig(aliases ...string) WorkerConfig {
+	return WorkerConfig{BrokerAddress: "inproc://test", ServiceName: "accounts", ServiceAliases: aliases}
+}
+
+func Test_ServiceAliases_RegisteredAfterServiceName(t *testing.T) {
+	config := aliasConfig("users", "members")
+	config.ServiceNamePrefix = "teamA/"
+
+	assert.Equal(t, []string{"teamA/accounts", "teamA/users", "teamA/members"}, config.registeredServiceNames())
+	assert.NoError(t, config.validateServiceAliases(defaultMaxServiceNameLength))
+}
+
+func Test_ServiceAliases_NoneByDefault(t *testing.T) {
+	assert.Equal(t, []string{"accounts"}, aliasConfig().registeredServiceNames())
+}
+
+func Test_ServiceAliases_Invalid(t *testing.T) {
+	long := aliasConfig("subscribers")
+	long.MaxServiceNameLength = len("accounts")
+
+	identity := aliasConfig("users")
+	identity.Identity = "worker-1"
+
+	bind := aliasConfig("users")
+	bind.Bind = true
+
+	assert.Equal(t, ErrEmptyServiceName, aliasConfig("").validate())
+	assert.Equal(t, ErrServiceNameTooLong, long.validate())
+	assert.Equal(t, ErrDuplicateServiceAlias, aliasConfig("accounts").validate())
+	assert.Equal(t, ErrDuplicateServiceAlias, aliasConfig("users", "users").validate())
+	assert.Equal(t, ErrServiceAliasesConflict, identity.validate())
+	assert.Equal(t, ErrServiceAliasesConflict, bind.validate())
+}
+
+func Test_ServiceAliases_RequestsCheckedAgainstSocketService(t *testing.T) {
+	w := frameWorker(nil, nil)
+	w.serviceName = "accounts"
+	w.serviceMismatchPolicy = ServiceMismatchReject
+
+	workerSocket := &mdWorkerSocket{serviceName: "users"}
+	ctx := RequestContext{ServiceName: w.socketService(workerSocket), Request: [][]byte{[]byte("users")}}
+
+	assert.Equal(t, "users", ctx.ServiceName)
+	assert.True(t, w.checkService(workerSocket, ctx))
+	assert.Equal(t, "accounts", w.socketService(&mdWorkerSocket{}))
+}
@@ -0,0 +1,23 @@
+package majordomo_worker
+
+// Reads the client's session token, nil if the request doesn't have one
+func (w *mdWorker) requestSessionToken(request [][]byte) []byte {
+	if !w.propagateSessionToken || w.sessionTokenFrame >= len(request) {
+		return nil
+	}
+
+	return request[w.sessionTokenFrame]
+}
+
+// Puts the session token ahead of the reply body so the broker or client can route the session's next request back
+// here. Requests without one get an empty frame in its place, so the reply body always starts with the token.
+func (w *mdWorker) withSessionToken(ctx RequestContext, reply [][]byte) [][]byte {
+	if !w.propagateSessionToken {
+		return reply
+	}
+
+	withToken := make([][]byte, 0, len(reply)+1)
+	withToken = append(withToken, ctx.SessionToken)
+
+	return append(withToken, reply...)
+}
@@ -0,0 +1,42 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sessionWorker() *mdWorker {
+	return &mdWorker{propagateSessionToken: true, sessionTokenFrame: 1}
+}
+
+func Test_SessionToken_ReadFromFrame(t *testing.T) {
+	token := sessionWorker().requestSessionToken([][]byte{[]byte("body"), []byte("session-1")})
+
+	assert.Equal(t, []byte("session-1"), token)
+}
+
+func Test_SessionToken_MissingFrame(t *testing.T) {
+	assert.Nil(t, sessionWorker().requestSessionToken([][]byte{[]byte("body")}))
+}
+
+func Test_SessionToken_IgnoredUnlessPropagated(t *testing.T) {
+	w := &mdWorker{sessionTokenFrame: 1}
+	request := [][]byte{[]byte("body"), []byte("session-1")}
+	reply := [][]byte{[]byte("reply")}
+
+	assert.Nil(t, w.requestSessionToken(request))
+	assert.Equal(t, reply, w.withSessionToken(RequestContext{SessionToken: []byte("session-1")}, reply))
+}
+
+func Test_SessionToken_EchoedAheadOfReply(t *testing.T) {
+	reply := sessionWorker().withSessionToken(RequestContext{SessionToken: []byte("session-1")}, [][]byte{[]byte("reply")})
+
+	assert.Equal(t, [][]byte{[]byte("session-1"), []byte("reply")}, reply)
+}
+
+func Test_SessionToken_EmptyFrameWhenRequestHadNone(t *testing.T) {
+	reply := sessionWorker().withSessionToken(RequestContext{}, [][]byte{[]byte("reply")})
+
+	assert.Equal(t, [][]byte{nil, []byte("reply")}, reply)
+}
@@ -0,0 +1,103 @@
+package majordomo_worker
+
+import (
+	"sync/atomic"
+)
+
+// ShutdownSummary reports what was left undone when the worker shut down, see EventShutDown
+type ShutdownSummary struct {
+	// Dropped is the number of requests received that were never replied to
+	Dropped int
+	// Drained is false if running actions didn't finish within WorkerConfig.ShutdownTimeout, or were abandoned by Close()
+	Drained bool
+}
+
+// Flushes AfterReply callbacks and metrics, then emits EventShutDown with the summary. Only the first time the
+// worker shuts down is reported.
+func (w *mdWorker) reportShutdown(drained bool) {
+	if w.shutdownReported {
+		return
+	}
+	w.shutdownReported = true
+
+	w.flush()
+
+	summary := ShutdownSummary{Dropped: w.stats.queued(), Drained: drained}
+	if summary.Dropped > 0 {
+		logWarnf(w.logger, "Shutting down with %d requests not replied to", summary.Dropped)
+	}
+
+	w.emitFinal(WorkerEvent{Type: EventShutDown, Time: w.clock.Now(), Summary: summary})
+}
+
+// Waits up to WorkerConfig.FlushTimeout for AfterReply callbacks still running, then flushes metrics that buffer
+func (w *mdWorker) flush() {
+	if w.flushTimeout > 0 {
+		w.waitForAfterReplies()
+	}
+
+	if metrics, ok := w.metrics.(FlushingMetrics); ok {
+		metrics.Flush()
+	}
+}
+
+func (w *mdWorker) waitForAfterReplies() {
+	done := make(chan struct{})
+	go func() {
+		w.afterReplies.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-w.clock.After(w.flushTimeout):
+		logWarnf(w.logger, "AfterReply callbacks still running after %s, not waiting for them", w.flushTimeout)
+	}
+}
+
+// Unlike emit(), the shutdown events are never dropped as they're the last word observers get. If the buffer is full
+// a reader gets up to WorkerConfig.FlushTimeout to make room, after which the oldest buffered event makes way.
+func (w *mdWorker) emitFinal(event WorkerEvent) {
+	if w.events == nil {
+		return
+	}
+
+	select {
+	case w.events <- event:
+		return
+	default:
+	}
+
+	if w.flushTimeout > 0 {
+		select {
+		case w.events <- event:
+			return
+		case <-w.clock.After(w.flushTimeout):
+		}
+	}
+
+	for {
+		select {
+		case w.events <- event:
+			return
+		default:
+		}
+
+		select {
+		case dropped := <-w.events:
+			logDebugf(w.logger, "Event buffer full, dropping event '%s' to make room for '%s'", dropped.Type, event.Type)
+		default:
+		}
+	}
+}
+
+// Marks the worker as shutting down so a reconnect already under way gives up rather than open a socket that
+// Receive() would then have to close again. Called before Receive() is told to shut down, which may take a while if
+// it is sleeping before a reconnect.
+func (w *mdWorker) stop() {
+	atomic.StoreInt32(&w.stopping, 1)
+}
+
+func (w *mdWorker) stopped() bool {
+	return atomic.LoadInt32(&w.stopping) == 1
+}
@@ -0,0 +1,201 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func shutdownWorker() *mdWorker {
+	clock := newFakeClock()
+
+	return &mdWorker{
+		stats:  newWorkerStats(clock),
+		events: make(chan WorkerEvent, 5),
+		clock:  clock,
+		logger: new(testLogger),
+	}
+}
+
+func Test_Shutdown_SummaryCountsRequestsNotRepliedTo(t *testing.T) {
+	w := shutdownWorker()
+	w.stats.requestQueued()
+	w.stats.requestQueued()
+	w.stats.requestsDone(1)
+
+	w.reportShutdown(false)
+
+	if assert.Equal(t, 1, len(w.events)) {
+		event := <-w.events
+		assert.Equal(t, EventShutDown, event.Type)
+		assert.Equal(t, "ShutDown", event.Type.String())
+		assert.Equal(t, ShutdownSummary{Dropped: 1, Drained: false}, event.Summary)
+	}
+}
+
+func Test_Shutdown_OnlyReportedOnce(t *testing.T) {
+	w := shutdownWorker()
+
+	// i.e. Close() after a graceful shutdown
+	w.reportShutdown(true)
+	w.reportShutdown(false)
+
+	if assert.Equal(t, 1, len(w.events)) {
+		assert.Equal(t, ShutdownSummary{Dropped: 0, Drained: true}, (<-w.events).Summary)
+	}
+}
+
+// Shuts the worker down as soon as it sleeps, i.e. while waiting to reconnect
+type stoppingClock struct {
+	*fakeClock
+	w *mdWorker
+}
+
+func (c stoppingClock) Sleep(d time.Duration) {
+	c.fakeClock.Sleep(d)
+	c.w.stop()
+}
+
+func Test_Shutdown_DuringReconnectDelaySkipsReconnect(t *testing.T) {
+	w := shutdownWorker()
+	w.clock = stoppingClock{w.clock.(*fakeClock), w}
+	workerSocket := &mdWorkerSocket{address: "inproc://test"}
+
+	w.reconnectToBroker(workerSocket, time.Second)
+
+	assert.Nil(t, workerSocket.socket)
+	assert.Equal(t, uint64(0), w.stats.snapshot().Reconnects)
+	if assert.Equal(t, 1, len(w.events)) {
+		assert.Equal(t, EventReconnecting, (<-w.events).Type)
+	}
+}
+
+func Test_Shutdown_NoReconnectOnceStopped(t *testing.T) {
+	w := shutdownWorker()
+	w.stop()
+
+	w.reconnectToBroker(&mdWorkerSocket{address: "inproc://test"}, time.Second)
+
+	assert.Empty(t, w.events)
+	assert.Equal(t, 0, w.clock.(*fakeClock).sleepCount())
+}
+
+func Test_Shutdown_SafeToCallMoreThanOnce(t *testing.T) {
+	w := shutdownWorker()
+	w.shutdown = make(chan struct{})
+
+	w.Shutdown()
+	w.Shutdown()
+
+	assert.True(t, w.stopped())
+	select {
+	case <-w.shutdown:
+	default:
+		assert.Fail(t, "Expected the shutdown channel to be closed")
+	}
+}
+
+type flushingMetrics struct {
+	noopMetrics
+	flushed int
+}
+
+func (m *flushingMetrics) Flush() {
+	m.flushed++
+}
+
+func Test_Shutdown_FinalEventDeliveredWhenBufferFull(t *testing.T) {
+	w := shutdownWorker()
+	for len(w.events) < cap(w.events) {
+		w.emit(EventReplySent, "inproc://test")
+	}
+
+	w.reportShutdown(true)
+
+	var last WorkerEvent
+	for len(w.events) > 0 {
+		last = <-w.events
+	}
+	assert.Equal(t, EventShutDown, last.Type, "Expected an older event to make way for ShutDown")
+}
+
+func Test_Shutdown_FinalEventWaitsForReader(t *testing.T) {
+	w := shutdownWorker()
+	w.flushTimeout = time.Second
+	for len(w.events) < cap(w.events) {
+		w.emit(EventReplySent, "inproc://test")
+	}
+
+	read := make(chan WorkerEvent, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		read <- <-w.events
+	}()
+
+	w.reportShutdown(true)
+
+	assert.Equal(t, EventReplySent, (<-read).Type, "Expected the reader to get the event it was owed")
+	for len(w.events) > 1 {
+		assert.Equal(t, EventReplySent, (<-w.events).Type)
+	}
+	assert.Equal(t, EventShutDown, (<-w.events).Type)
+}
+
+func Test_Shutdown_WaitsForAfterReply(t *testing.T) {
+	w := shutdownWorker()
+	w.flushTimeout = time.Second
+
+	finished := make(chan struct{})
+	w.afterReplies.Add(1)
+	go func() {
+		defer w.afterReplies.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(finished)
+	}()
+
+	w.reportShutdown(true)
+
+	select {
+	case <-finished:
+	default:
+		assert.Fail(t, "Expected AfterReply to finish before the worker shut down")
+	}
+}
+
+func Test_Shutdown_FlushTimeoutUsesTheClock(t *testing.T) {
+	w := shutdownWorker()
+	w.flushTimeout = time.Hour
+	clock := w.clock.(*fakeClock)
+
+	// Never finishes, only the clock moving on lets the worker shut down
+	w.afterReplies.Add(1)
+	defer w.afterReplies.Done()
+
+	go func() {
+		for {
+			clock.Lock()
+			waiting := len(clock.waiters)
+			clock.Unlock()
+
+			if waiting > 0 {
+				clock.Advance(time.Hour)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	w.reportShutdown(true)
+}
+
+func Test_Shutdown_FlushesMetrics(t *testing.T) {
+	metrics := &flushingMetrics{}
+	w := shutdownWorker()
+	w.metrics = metrics
+
+	w.reportShutdown(true)
+	w.reportShutdown(true)
+
+	assert.Equal(t, 1, metrics.flushed)
+}
@@ -0,0 +1,33 @@
+package majordomo_worker
+
+import (
+	"os"
+	"os/signal"
+)
+
+// Shuts the worker down gracefully on any of the given signals until the worker is cleaned up
+func (w *mdWorker) handleSignals(signals []os.Signal) {
+	w.signals = make(chan os.Signal, 1)
+	w.stopSignals = make(chan struct{})
+
+	signal.Notify(w.signals, signals...)
+
+	go func(signals chan os.Signal, stop chan struct{}) {
+		select {
+		case sig := <-signals:
+			logDebugf(w.logger, "Received signal '%s', shutting down", sig)
+			w.Shutdown()
+		case <-stop:
+		}
+	}(w.signals, w.stopSignals)
+}
+
+func (w *mdWorker) restoreSignals() {
+	if w.signals == nil {
+		return
+	}
+
+	signal.Stop(w.signals)
+	close(w.stopSignals)
+	w.signals = nil
+}
@@ -0,0 +1,19 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+// Reports a request whose action took longer than the slow request threshold, if one is set
+func (w *mdWorker) checkSlow(ctx RequestContext, elapsed time.Duration) {
+	if w.slowThreshold <= 0 || elapsed <= w.slowThreshold {
+		return
+	}
+
+	if w.slowHandler != nil {
+		w.slowHandler(ctx, elapsed)
+		return
+	}
+
+	logWarnf(w.logger, "Request from '%s' took %s, longer than %s", ctx.ReplyTo, elapsed, w.slowThreshold)
+}
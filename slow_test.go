@@ -0,0 +1,52 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type slowRequest struct {
+	ctx     RequestContext
+	elapsed time.Duration
+}
+
+func slowRequestWorker(threshold time.Duration) (*mdWorker, *[]slowRequest) {
+	var slow []slowRequest
+	w := &mdWorker{
+		logger:        new(testLogger),
+		slowThreshold: threshold,
+		slowHandler: func(ctx RequestContext, elapsed time.Duration) {
+			slow = append(slow, slowRequest{ctx, elapsed})
+		},
+	}
+
+	return w, &slow
+}
+
+func Test_SlowRequest_HandlerCalledWhenThresholdExceeded(t *testing.T) {
+	w, slow := slowRequestWorker(100 * time.Millisecond)
+	ctx := RequestContext{ReplyTo: []byte("client-1"), Request: [][]byte{[]byte("body")}}
+
+	w.checkSlow(ctx, 150*time.Millisecond)
+
+	assert.Equal(t, []slowRequest{{ctx, 150 * time.Millisecond}}, *slow)
+}
+
+func Test_SlowRequest_FastRequestIgnored(t *testing.T) {
+	w, slow := slowRequestWorker(100 * time.Millisecond)
+
+	w.checkSlow(RequestContext{}, 50*time.Millisecond)
+	w.checkSlow(RequestContext{}, 100*time.Millisecond)
+
+	assert.Empty(t, *slow)
+}
+
+func Test_SlowRequest_DisabledWithoutThreshold(t *testing.T) {
+	w, slow := slowRequestWorker(0)
+
+	w.checkSlow(RequestContext{}, time.Hour)
+
+	assert.Empty(t, *slow)
+}
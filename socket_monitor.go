@@ -0,0 +1,117 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pebbe/zmq4"
+)
+
+const (
+	monitoredEvents = zmq4.EVENT_CONNECTED | zmq4.EVENT_DISCONNECTED | zmq4.EVENT_CONNECT_RETRIED |
+		zmq4.EVENT_ACCEPTED | zmq4.EVENT_MONITOR_STOPPED
+
+	// How often the monitor goroutine checks whether it's been stopped while no events arrive
+	monitorPollInterval = 10 * time.Millisecond
+)
+
+// Numbers the inproc endpoints monitors publish to, which must be unique within the zmq context
+var monitorCount uint64
+
+// Watches the ZeroMQ events of a single broker socket. The PAIR socket the events arrive on belongs to the monitor's
+// goroutine, which closes it before signalling done so the context can still be terminated.
+type socketMonitor struct {
+	watched  *zmq4.Socket
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+func startSocketMonitor(context *zmq4.Context, watched *zmq4.Socket, onEvent func(zmq4.Event, string)) (*socketMonitor, error) {
+	endpoint := fmt.Sprintf("inproc://majordomo-worker-monitor-%d", atomic.AddUint64(&monitorCount, 1))
+	if err := watched.Monitor(endpoint, monitoredEvents); err != nil {
+		return nil, err
+	}
+
+	events, err := context.NewSocket(zmq4.PAIR)
+	if err != nil {
+		watched.Monitor("", 0)
+		return nil, err
+	}
+
+	events.SetLinger(0)
+	events.SetRcvtimeo(monitorPollInterval)
+	if err := events.Connect(endpoint); err != nil {
+		watched.Monitor("", 0)
+		events.Close()
+		return nil, err
+	}
+
+	m := &socketMonitor{watched: watched, stopping: make(chan struct{}), done: make(chan struct{})}
+	go m.run(events, onEvent)
+
+	return m, nil
+}
+
+func (m *socketMonitor) run(events *zmq4.Socket, onEvent func(zmq4.Event, string)) {
+	defer close(m.done)
+	defer events.Close()
+
+	for {
+		select {
+		case <-m.stopping:
+			return
+		default:
+		}
+
+		event, address, _, err := events.RecvEvent(0)
+		if err != nil {
+			if zmq4.AsErrno(err) == zmq4.Errno(syscall.EAGAIN) {
+				continue
+			}
+			return
+		}
+
+		if event == zmq4.EVENT_MONITOR_STOPPED {
+			return
+		}
+
+		onEvent(event, address)
+	}
+}
+
+// Stops watching and waits for the monitor's goroutine to let go of its socket. Must be called before the watched
+// socket is closed, from the goroutine that owns it.
+func (m *socketMonitor) stop() {
+	if m == nil {
+		return
+	}
+
+	m.watched.Monitor("", 0)
+	close(m.stopping)
+	<-m.done
+}
+
+// Translates a socket event into a worker event, logging it either way. Connect retries and disconnects are
+// warnings as they mean the broker can't be reached, whatever MDP liveness says.
+func (w *mdWorker) socketEvent(address string) func(zmq4.Event, string) {
+	return func(event zmq4.Event, endpoint string) {
+		switch event {
+		case zmq4.EVENT_CONNECTED, zmq4.EVENT_ACCEPTED:
+			logDebugf(w.logger, "Socket connected to broker address '%s' (%s)", address, endpoint)
+			w.emit(EventSocketConnected, address)
+		case zmq4.EVENT_DISCONNECTED:
+			logWarnf(w.logger, "Socket disconnected from broker address '%s' (%s)", address, endpoint)
+			w.emit(EventSocketDisconnected, address)
+		case zmq4.EVENT_CONNECT_RETRIED:
+			logWarnf(w.logger, "Socket retrying connection to broker address '%s' (%s)", address, endpoint)
+			w.emit(EventSocketConnectRetried, address)
+		}
+	}
+}
+
+// Starts monitoring a new broker socket, see WorkerConfig.SocketMonitoring
+func (w *mdWorker) monitorSocket(address string, socket *zmq4.Socket) (*socketMonitor, error) {
+	return startSocketMonitor(w.context, socket, w.socketEvent(address))
+}
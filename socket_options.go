@@ -0,0 +1,200 @@
+package majordomo_worker
+
+import (
+	"crypto/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pebbe/zmq4"
+)
+
+type curveKeys struct {
+	server, public, secret string
+}
+
+func (k curveKeys) enabled() bool {
+	return k.server != ""
+}
+
+// Socket level heartbeats, handled by ZeroMQ itself and never seen by the worker. Disabled unless interval is set,
+// a zero timeout or ttl leaves ZeroMQ's default in place.
+type zmtpHeartbeat struct {
+	interval, timeout, ttl time.Duration
+}
+
+// The setters for ZMTP heartbeat options, which ZeroMQ offers no getters for, so tests can see what was set
+type zmtpHeartbeatSocket interface {
+	SetHeartbeatIvl(time.Duration) error
+	SetHeartbeatTimeout(time.Duration) error
+	SetHeartbeatTtl(time.Duration) error
+}
+
+// Zero idle and interval times and a zero count leave the operating system's defaults in place
+type tcpKeepalive struct {
+	enabled        bool
+	idle, interval time.Duration
+	count          int
+}
+
+// Applies the configured socket options, then the user's SocketConfigurator and lastly the ConnectHook, to a new
+// broker socket. Nothing may be applied after the hook as it's promised to run immediately before connecting. Options
+// that don't apply to the address's transport have already been rejected by WorkerConfig.validate().
+func (w *mdWorker) configureSocket(address string, socket *zmq4.Socket) error {
+	if identity := w.socketIdentity(address); identity != nil {
+		if err := socket.SetIdentity(string(identity)); err != nil {
+			return err
+		}
+	}
+
+	if w.curve.enabled() {
+		if err := socket.SetCurveServerkey(w.curve.server); err != nil {
+			return err
+		}
+		if err := socket.SetCurvePublickey(w.curve.public); err != nil {
+			return err
+		}
+		if err := socket.SetCurveSecretkey(w.curve.secret); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.applyTCPKeepalive(address, socket); err != nil {
+		return err
+	}
+
+	if _, err := w.applyZMTPHeartbeat(socket); err != nil {
+		return err
+	}
+
+	if w.sendTimeout > 0 {
+		if err := socket.SetSndtimeo(w.sendTimeout); err != nil {
+			return err
+		}
+	}
+
+	w.applyIPCFilePermissions(address)
+
+	if w.socketConfigurator != nil {
+		if err := w.socketConfigurator(socket); err != nil {
+			return err
+		}
+	}
+
+	if w.connectHook != nil {
+		return w.connectHook(socket)
+	}
+
+	return nil
+}
+
+// Returns the identity for a new socket. The identity func is asked afresh on every connect, if it fails the static
+// identity is used instead. Without either a random one is generated for every connect, rather than left to ZeroMQ,
+// so Restart() can read it back and keep it. nil leaves it to ZeroMQ after all.
+func (w *mdWorker) socketIdentity(address string) []byte {
+	if identity, ok := w.keptIdentities[address]; ok {
+		return identity
+	}
+
+	if w.identityFunc != nil {
+		identity, err := w.identityFunc()
+		if err == nil {
+			return identity
+		}
+
+		logErrorf(w.logger, "Identity func failed, falling back to the default identity, error: '%s'", err.Error())
+	}
+
+	if w.identity == "" {
+		return randomIdentity()
+	}
+
+	return []byte(w.identity)
+}
+
+// Like ZeroMQ's own but without the leading zero byte, which ZeroMQ reserves for the identities it generates
+func randomIdentity() []byte {
+	identity := make([]byte, 8)
+	if _, err := rand.Read(identity); err != nil {
+		return nil
+	}
+	identity[0] |= 0x80
+
+	return identity
+}
+
+// Turns on TCP keepalives for tcp addresses, returning whether it did. ZeroMQ takes the times in whole seconds.
+func (w *mdWorker) applyTCPKeepalive(address string, socket *zmq4.Socket) (bool, error) {
+	if !w.tcpKeepalive.enabled || transportOf(address) != "tcp" {
+		return false, nil
+	}
+
+	if err := socket.SetTcpKeepalive(1); err != nil {
+		return false, err
+	}
+
+	if w.tcpKeepalive.idle > 0 {
+		if err := socket.SetTcpKeepaliveIdle(int(w.tcpKeepalive.idle / time.Second)); err != nil {
+			return false, err
+		}
+	}
+
+	if w.tcpKeepalive.interval > 0 {
+		if err := socket.SetTcpKeepaliveIntvl(int(w.tcpKeepalive.interval / time.Second)); err != nil {
+			return false, err
+		}
+	}
+
+	if w.tcpKeepalive.count > 0 {
+		if err := socket.SetTcpKeepaliveCnt(w.tcpKeepalive.count); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Turns on ZMTP heartbeats, returning whether it did. They need ZeroMQ 4.2, older versions fail the connection.
+func (w *mdWorker) applyZMTPHeartbeat(socket zmtpHeartbeatSocket) (bool, error) {
+	if w.zmtpHeartbeat.interval <= 0 {
+		return false, nil
+	}
+
+	if err := socket.SetHeartbeatIvl(w.zmtpHeartbeat.interval); err != nil {
+		return false, err
+	}
+
+	if w.zmtpHeartbeat.timeout > 0 {
+		if err := socket.SetHeartbeatTimeout(w.zmtpHeartbeat.timeout); err != nil {
+			return false, err
+		}
+	}
+
+	if w.zmtpHeartbeat.ttl > 0 {
+		if err := socket.SetHeartbeatTtl(w.zmtpHeartbeat.ttl); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Sets the permissions of an ipc address's socket file. Other transports, and abstract ipc addresses, have no file.
+// Failing to change them isn't fatal as the file normally belongs to the broker.
+func (w *mdWorker) applyIPCFilePermissions(address string) bool {
+	path := strings.TrimPrefix(address, "ipc://")
+	if w.ipcFilePermissions == 0 || transportOf(address) != "ipc" || strings.HasPrefix(path, "@") {
+		return false
+	}
+
+	if err := os.Chmod(path, w.ipcFilePermissions); err != nil {
+		if os.IsNotExist(err) {
+			logDebugf(w.logger, "Not setting permissions of '%s', it doesn't exist yet", path)
+		} else {
+			logWarnf(w.logger, "Setting permissions of '%s' failed, error: '%s'", path, err.Error())
+		}
+		return false
+	}
+
+	return true
+}
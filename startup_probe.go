@@ -0,0 +1,63 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+const (
+	defaultStartupProbeInterval = 100 * time.Millisecond
+	maxStartupProbeInterval     = 5 * time.Second
+)
+
+// Runs the startup probe until it passes, doubling the wait between attempts from startupProbeInterval up to
+// maxStartupProbeInterval. Gives up with ErrStartupProbeTimeout once timeout has passed, if set, and with
+// GracefulShutdown as soon as the worker is shutting down.
+func (w *mdWorker) awaitStartupProbe(timeout time.Duration) error {
+	if w.startupProbe == nil {
+		return nil
+	}
+
+	interval := w.startupProbeInterval
+	if interval <= 0 {
+		interval = defaultStartupProbeInterval
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = w.clock.Now().Add(timeout)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if w.stopped() {
+			return GracefulShutdown("Graceful Shutdown")
+		}
+
+		err := w.startupProbe()
+		if err == nil {
+			return nil
+		}
+
+		if !deadline.IsZero() && !w.clock.Now().Add(interval).Before(deadline) {
+			logErrorf(w.logger, "Startup probe still failing after %d attempts, error: '%s'", attempt, err.Error())
+			return ErrStartupProbeTimeout
+		}
+
+		logWarnf(w.logger, "Startup probe failed, retrying in %s (attempt %d), error: '%s'", interval, attempt, err.Error())
+		w.clock.Sleep(interval)
+
+		interval *= 2
+		if interval > maxStartupProbeInterval {
+			interval = maxStartupProbeInterval
+		}
+	}
+}
+
+// Reconnecting happens in Receive(), which can't heartbeat any other broker while it waits, so the probe is given no
+// longer than a heartbeat interval (or StartupProbeTimeout if that's shorter) before the reconnect is abandoned
+func (w *mdWorker) reconnectProbeTimeout() time.Duration {
+	if w.startupProbeTimeout > 0 && w.startupProbeTimeout < w.heartbeat {
+		return w.startupProbeTimeout
+	}
+
+	return w.heartbeat
+}
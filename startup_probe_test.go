@@ -0,0 +1,94 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Fails the given number of times, then passes
+func flakyProbe(failures int, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= failures {
+			return errors.New("Cache still warming")
+		}
+		return nil
+	}
+}
+
+func probeWorker(probe func() error, interval, timeout time.Duration) (*mdWorker, *fakeClock) {
+	clock := newFakeClock()
+	return &mdWorker{
+		startupProbe:         probe,
+		startupProbeInterval: interval,
+		startupProbeTimeout:  timeout,
+		clock:                clock,
+		logger:               new(testLogger),
+	}, clock
+}
+
+func Test_StartupProbe_RetriedWithBackoffUntilItPasses(t *testing.T) {
+	calls := 0
+	w, clock := probeWorker(flakyProbe(2, &calls), 10*time.Millisecond, 0)
+
+	assert.NoError(t, w.awaitStartupProbe(w.startupProbeTimeout))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, clock.sleeps)
+}
+
+func Test_StartupProbe_BackoffCapped(t *testing.T) {
+	calls := 0
+	w, clock := probeWorker(flakyProbe(3, &calls), 4*time.Second, 0)
+
+	assert.NoError(t, w.awaitStartupProbe(w.startupProbeTimeout))
+	assert.Equal(t, []time.Duration{4 * time.Second, maxStartupProbeInterval, maxStartupProbeInterval}, clock.sleeps)
+}
+
+func Test_StartupProbe_GivesUpAfterTimeout(t *testing.T) {
+	calls := 0
+	w, clock := probeWorker(flakyProbe(100, &calls), 10*time.Millisecond, 100*time.Millisecond)
+
+	assert.Equal(t, ErrStartupProbeTimeout, w.awaitStartupProbe(w.startupProbeTimeout))
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}, clock.sleeps)
+}
+
+func Test_StartupProbe_NoneByDefault(t *testing.T) {
+	w, clock := probeWorker(nil, 0, 0)
+
+	assert.NoError(t, w.awaitStartupProbe(w.startupProbeTimeout))
+	assert.Empty(t, clock.sleeps)
+}
+
+func Test_StartupProbe_StopsRetryingOnShutdown(t *testing.T) {
+	w, clock := probeWorker(nil, 10*time.Millisecond, 0)
+	w.shutdown = make(chan struct{})
+
+	calls := 0
+	w.startupProbe = func() error {
+		calls++
+		if calls == 2 {
+			w.Shutdown()
+		}
+		return errors.New("Cache still warming")
+	}
+
+	assert.IsType(t, GracefulShutdown(""), w.awaitStartupProbe(0))
+	assert.Equal(t, 2, calls)
+	assert.Len(t, clock.sleeps, 2)
+}
+
+func Test_StartupProbe_ReconnectBoundedByHeartbeat(t *testing.T) {
+	calls := 0
+	w, _ := probeWorker(flakyProbe(100, &calls), 10*time.Millisecond, 0)
+	w.heartbeat = 100 * time.Millisecond
+
+	assert.Equal(t, ErrStartupProbeTimeout, w.awaitStartupProbe(w.reconnectProbeTimeout()))
+	assert.Equal(t, 4, calls)
+
+	w.startupProbeTimeout = 30 * time.Millisecond
+	assert.Equal(t, 30*time.Millisecond, w.reconnectProbeTimeout())
+}
@@ -0,0 +1,286 @@
+package majordomo_worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerStats is a point in time snapshot of a worker's counters
+type WorkerStats struct {
+	Requests   uint64
+	Reconnects uint64
+	Errors     uint64
+
+	// ReconnectRate is the number of reconnects in the last minute, to alert on a worker flapping between brokers
+	// rather than working out the rate from Reconnects. It tops out at 128.
+	ReconnectRate float64
+
+	// ConnectionID is a UUID that changes every time the worker connects or reconnects to a broker, and is logged as
+	// 'connection'. Unlike the worker's name it tells the lines logged before and after a reconnect apart.
+	ConnectionID string
+
+	// Connects counts the connections made to each broker when the worker was created, Reconnects only those made
+	// after that
+	Connects uint64
+
+	// RequestsReceived, HeartbeatsReceived, DisconnectsReceived and UnknownCommandsReceived count the commands read
+	// from the brokers by type, i.e. to tell a worker starved of requests from a broker sending nonsense. Unlike
+	// Requests they include requests that were invalid or arrived while paused. Unknown commands include those the
+	// FrameDecoder couldn't decode.
+	RequestsReceived        uint64
+	HeartbeatsReceived      uint64
+	DisconnectsReceived     uint64
+	UnknownCommandsReceived uint64
+
+	// TotalBytesReceived and TotalBytesSent add up the frames of every message read from and sent to the brokers,
+	// heartbeats and protocol frames included
+	TotalBytesReceived uint64
+	TotalBytesSent     uint64
+
+	// QueueDepth is the number of requests received but not replied to yet, i.e. waiting for a batch
+	QueueDepth int
+
+	// Liveness is the lowest liveness of any broker, as of the last poll
+	Liveness int
+
+	// Healthy is false while the reconnect circuit breaker is open or WorkerConfig.HealthFunc returns false
+	Healthy bool
+
+	// LastBrokerHeartbeat is when a broker last sent MD_HEARTBEAT, requests don't count. A worker busy with requests
+	// whose brokers have stopped heartbeating may be on a link that is about to fail.
+	LastBrokerHeartbeat time.Time
+
+	// HeartbeatLatency is how long the slowest broker took to send MD_HEARTBEAT after the worker last heartbeated it,
+	// approximating how responsive the brokers are. It is zero, unavailable, until a broker has answered, and for
+	// brokers that don't answer before the worker's next heartbeat is due.
+	HeartbeatLatency time.Duration
+
+	// AbandonedActions is the number of actions that ran past WorkerConfig.ActionTimeout and still haven't returned.
+	// Each holds on to a goroutine, so one that keeps rising points at actions that hang.
+	AbandonedActions int
+}
+
+// Stats are written by the Receive() goroutine but may be read from anywhere
+type workerStats struct {
+	// Updated with atomics as they change with every message, first in the struct so they are 64 bit aligned
+	bytesReceived, bytesSent uint64
+
+	sync.Mutex
+
+	clock Clock
+
+	requests, reconnects, errors uint64
+	connects                     uint64
+	commandsReceived             commandCounts
+	queueDepth, liveness         int
+	abandonedActions             int
+	unhealthyUntil               time.Time
+	lastBrokerHeartbeat          time.Time
+	heartbeatLatency             time.Duration
+	reconnectTimes               reconnectTimes
+	connectionID                 string
+}
+
+func newWorkerStats(clock Clock) *workerStats {
+	return &workerStats{clock: clock}
+}
+
+func (s *workerStats) addRequest() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.requests++
+}
+
+func (s *workerStats) requestQueued() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.queueDepth++
+}
+
+func (s *workerStats) requestsDone(count int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.queueDepth -= count
+}
+
+func (s *workerStats) queued() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.queueDepth
+}
+
+// Returns how many abandoned actions are now running
+func (s *workerStats) actionAbandoned() int {
+	s.Lock()
+	defer s.Unlock()
+
+	s.abandonedActions++
+	return s.abandonedActions
+}
+
+func (s *workerStats) abandonedActionFinished() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.abandonedActions--
+}
+
+func (s *workerStats) abandoned() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.abandonedActions
+}
+
+func (s *workerStats) setLiveness(liveness int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.liveness = liveness
+}
+
+func (s *workerStats) currentLiveness() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.liveness
+}
+
+func (s *workerStats) addConnect() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.connects++
+}
+
+func (s *workerStats) setConnectionID(id string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.connectionID = id
+}
+
+func (s *workerStats) currentConnectionID() string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.connectionID
+}
+
+func (s *workerStats) addReconnect() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.reconnects++
+	s.reconnectTimes.add(s.clock.Now())
+}
+
+func (s *workerStats) reconnectRate() float64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.reconnectTimes.perMinute(s.clock.Now())
+}
+
+func (s *workerStats) addError() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.errors++
+}
+
+func (s *workerStats) commandReceived(command string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.commandsReceived.add(command)
+}
+
+func (s *workerStats) addBytesReceived(bytes int) {
+	atomic.AddUint64(&s.bytesReceived, uint64(bytes))
+}
+
+func (s *workerStats) addBytesSent(bytes int) {
+	atomic.AddUint64(&s.bytesSent, uint64(bytes))
+}
+
+func (s *workerStats) heartbeatReceived(at time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastBrokerHeartbeat = at
+}
+
+func (s *workerStats) setHeartbeatLatency(latency time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.heartbeatLatency = latency
+}
+
+func (s *workerStats) setUnhealthyUntil(until time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.unhealthyUntil = until
+}
+
+func (s *workerStats) unhealthyUntilTime() time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.unhealthyUntil
+}
+
+// Zeroes the counters and the reconnect rate. The connection ID, queue depth, liveness, last heartbeat, abandoned
+// actions and circuit breaker health are state, so are left alone.
+func (s *workerStats) reset() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.requests = 0
+	s.connects = 0
+	s.reconnects = 0
+	s.errors = 0
+	s.commandsReceived = commandCounts{}
+	s.reconnectTimes.reset()
+	atomic.StoreUint64(&s.bytesReceived, 0)
+	atomic.StoreUint64(&s.bytesSent, 0)
+}
+
+func (s *workerStats) snapshot() WorkerStats {
+	s.Lock()
+	defer s.Unlock()
+
+	return WorkerStats{
+		Requests:   s.requests,
+		Reconnects: s.reconnects,
+		Errors:     s.errors,
+		Connects:   s.connects,
+
+		ConnectionID:  s.connectionID,
+		ReconnectRate: s.reconnectTimes.perMinute(s.clock.Now()),
+
+		RequestsReceived:        s.commandsReceived.requests,
+		HeartbeatsReceived:      s.commandsReceived.heartbeats,
+		DisconnectsReceived:     s.commandsReceived.disconnects,
+		UnknownCommandsReceived: s.commandsReceived.unknown,
+
+		TotalBytesReceived: atomic.LoadUint64(&s.bytesReceived),
+		TotalBytesSent:     atomic.LoadUint64(&s.bytesSent),
+
+		QueueDepth: s.queueDepth,
+		Liveness:   s.liveness,
+		Healthy:    !s.clock.Now().Before(s.unhealthyUntil),
+
+		LastBrokerHeartbeat: s.lastBrokerHeartbeat,
+		HeartbeatLatency:    s.heartbeatLatency,
+
+		AbandonedActions: s.abandonedActions,
+	}
+}
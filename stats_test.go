@@ -0,0 +1,92 @@
+package majordomo_worker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Stats_ResetZeroesCounters(t *testing.T) {
+	s := newWorkerStats(newFakeClock())
+	s.addRequest()
+	s.addConnect()
+	s.addReconnect()
+	s.addError()
+
+	s.reset()
+
+	assert.Equal(t, WorkerStats{Healthy: true}, s.snapshot())
+}
+
+func Test_Stats_ResetLeavesHealthAlone(t *testing.T) {
+	clock := newFakeClock()
+	s := newWorkerStats(clock)
+	s.setUnhealthyUntil(clock.Now().Add(time.Minute))
+
+	s.reset()
+
+	assert.False(t, s.snapshot().Healthy)
+}
+
+func Test_Stats_HealthFuncAndedWithCircuitBreaker(t *testing.T) {
+	w := frameWorker(nil, nil)
+	healthy := true
+	w.healthFunc = func() bool { return healthy }
+
+	assert.True(t, w.Stats().Healthy)
+
+	healthy = false
+	assert.False(t, w.Stats().Healthy)
+
+	healthy = true
+	w.stats.setUnhealthyUntil(w.clock.Now().Add(time.Minute))
+	assert.False(t, w.Stats().Healthy)
+}
+
+func Test_Stats_QueueDepthSurvivesReset(t *testing.T) {
+	s := newWorkerStats(newFakeClock())
+	s.requestQueued()
+	s.requestQueued()
+	s.requestsDone(1)
+
+	s.reset()
+
+	assert.Equal(t, 1, s.queued())
+	assert.Equal(t, WorkerStats{QueueDepth: 1, Healthy: true}, s.snapshot())
+}
+
+// Run with -race
+func Test_Stats_ResetAndSnapshotAreSafeConcurrently(t *testing.T) {
+	s := newWorkerStats(newFakeClock())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.addRequest()
+				s.addReconnect()
+				s.addError()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.reset()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.reset()
+	assert.Equal(t, WorkerStats{Healthy: true}, s.snapshot())
+}
@@ -0,0 +1,103 @@
+package majordomo_worker
+
+import (
+	"io"
+)
+
+// How much of a streamed reply goes in each frame if WorkerConfig.StreamChunkSize isn't set
+const defaultStreamChunkSize = 64 * 1024
+
+// StreamWorkerAction can be implemented instead of WorkerAction.Call by actions whose replies are too big to build in
+// memory, i.e. a file being served. The reply is read from the returned reader in chunks of StreamChunkSize bytes
+// and closed afterwards if it is an io.Closer. Brokers speaking a protocol with partial replies (see MDP02Frames) are
+// sent each chunk as it is read, others get a single MD_REPLY with a frame per chunk once the reader is exhausted.
+// A returned error is answered with WorkerConfig.ErrorReply.
+type StreamWorkerAction interface {
+	CallStream(ctx RequestContext) (io.Reader, error)
+}
+
+func (w *mdWorker) chunkSize() int {
+	if w.streamChunkSize <= 0 {
+		return defaultStreamChunkSize
+	}
+
+	return w.streamChunkSize
+}
+
+// Reads a chunk of up to size bytes, returning io.EOF along with the stream's last chunk
+func readChunk(stream io.Reader, size int) ([]byte, error) {
+	chunk := make([]byte, size)
+
+	n, err := io.ReadFull(stream, chunk)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return chunk[:n], err
+}
+
+// Reads the whole stream into a frame per chunk, for brokers without partial replies
+func readChunks(stream io.Reader, size int) ([][]byte, error) {
+	defer closeStream(stream)
+
+	var chunks [][]byte
+	for {
+		chunk, err := readChunk(stream, size)
+		if len(chunk) > 0 {
+			chunks = append(chunks, chunk)
+		}
+
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func closeStream(stream io.Reader) {
+	if closer, ok := stream.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// Sends the stream as an MD_PARTIAL per chunk, finishing with an MD_REPLY holding the last. Each chunk is only sent
+// once the next has been read, so the last one always goes out as MD_REPLY. A stream that fails part way through
+// is finished with ErrorReply. Every message is encoded on its own (see encodeReply), so each carries its own marker.
+func (w *mdWorker) streamReply(workerSocket *mdWorkerSocket, ctx RequestContext, stream io.Reader) {
+	defer closeStream(stream)
+
+	if w.noReply {
+		logDebugf(w.logger, "Not replying to '%s', replies are disabled", ctx.ReplyTo)
+		return
+	}
+
+	size := w.chunkSize()
+	chunk, err := readChunk(stream, size)
+
+	for err == nil {
+		var next []byte
+		next, err = readChunk(stream, size)
+		if err != nil && (err != io.EOF || len(next) == 0) {
+			break
+		}
+
+		if sendErr := w.sendOrReconnect(workerSocket, MD_PARTIAL, ctx.ReplyTo, replyFrames(w.replyFramePrefix, w.encodeReply(ctx, [][]byte{chunk}))); sendErr != nil {
+			logErrorf(w.logger, "Streaming reply to '%s' failed, error: '%s'", ctx.ReplyTo, sendErr.Error())
+			w.stats.addError()
+			return
+		}
+		chunk = next
+	}
+
+	var reply [][]byte
+	if err != nil && err != io.EOF {
+		reply = w.actionFailed(err)
+	} else if len(chunk) > 0 {
+		reply = [][]byte{chunk}
+	}
+
+	w.sendReplyOrReconnect(workerSocket, ctx.ReplyTo, replyFrames(w.replyFramePrefix, w.encodeReply(ctx, reply)))
+	w.emit(EventReplySent, workerSocket.address)
+}
@@ -0,0 +1,91 @@
+package majordomo_worker
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Replies with the given bytes, or fails part way through with err
+type readerAction struct {
+	data []byte
+	err  error
+}
+
+func (a readerAction) Call(args [][]byte) [][]byte {
+	panic("Call should not be used when CallStream is available")
+}
+
+func (a readerAction) CallStream(ctx RequestContext) (io.Reader, error) {
+	if a.err != nil {
+		return io.MultiReader(bytes.NewReader(a.data), failingReader{a.err}), nil
+	}
+
+	return bytes.NewReader(a.data), nil
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// Deterministic bytes that don't repeat every chunk
+func streamData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 / 3)
+	}
+
+	return data
+}
+
+func Test_Stream_BufferedWithoutPartialReplies(t *testing.T) {
+	w := actionWorker(readerAction{data: []byte("abcdefgh")})
+	w.actionTimeout = 0
+	w.streamChunkSize = 3
+
+	result := w.invokeAction(RequestContext{})
+
+	assert.NoError(t, result.err)
+	assert.Nil(t, result.stream)
+	assert.Equal(t, [][]byte{[]byte("abc"), []byte("def"), []byte("gh")}, result.reply)
+}
+
+func Test_Stream_StreamedWithPartialReplies(t *testing.T) {
+	w := actionWorker(readerAction{data: []byte("abcdefgh")})
+	w.actionTimeout = 0
+	w.encoder = MDP02Frames{}
+
+	result := w.invokeAction(RequestContext{})
+
+	assert.NoError(t, result.err)
+	assert.NotNil(t, result.stream)
+	assert.Nil(t, result.reply)
+}
+
+func Test_Stream_ReadErrorFailsBufferedReply(t *testing.T) {
+	w := actionWorker(readerAction{data: []byte("abc"), err: errors.New("disk gone")})
+	w.actionTimeout = 0
+
+	result := w.invokeAction(RequestContext{})
+
+	assert.EqualError(t, result.err, "disk gone")
+	assert.Nil(t, result.reply)
+}
+
+func Test_Stream_ChunksEndWithEOF(t *testing.T) {
+	chunks, err := readChunks(bytes.NewReader([]byte("abcdef")), 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("abc"), []byte("def")}, chunks)
+
+	chunks, err = readChunks(bytes.NewReader(nil), 3)
+	assert.NoError(t, err)
+	assert.Empty(t, chunks)
+}
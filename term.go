@@ -0,0 +1,29 @@
+package majordomo_worker
+
+import (
+	"time"
+)
+
+const defaultTermTimeout = 5 * time.Second
+
+// Terminates the context, which blocks until every socket on it is closed. A socket left open (i.e. an auxiliary
+// socket, see Worker.Context) would hang shutdown forever, so it is given up on after the term timeout. The context
+// is still terminated in the background once the socket is closed.
+func (w *mdWorker) terminateContext() error {
+	if w.termTimeout < 0 {
+		return w.context.Term()
+	}
+
+	terminated := make(chan error, 1)
+	go func() {
+		terminated <- w.context.Term()
+	}()
+
+	select {
+	case err := <-terminated:
+		return err
+	case <-w.clock.After(w.termTimeout):
+		logWarnf(w.logger, "Context still not terminated after %s, a socket on it hasn't been closed", w.termTimeout)
+		return ErrTermTimeout
+	}
+}
@@ -0,0 +1,30 @@
+package majordomo_worker
+
+func messageBytes(msg [][]byte) int {
+	size := 0
+	for _, frame := range msg {
+		size += len(frame)
+	}
+
+	return size
+}
+
+// Counts every frame of a message read from a broker, envelope included
+func (w *mdWorker) received(msg [][]byte) {
+	size := messageBytes(msg)
+	w.stats.addBytesReceived(size)
+
+	if metrics, ok := w.metrics.(ThroughputMetrics); ok {
+		metrics.BytesReceived(w.metricsLabel, size)
+	}
+}
+
+// Counts every frame of a message sent to a broker, envelope included
+func (w *mdWorker) sent(msg [][]byte) {
+	size := messageBytes(msg)
+	w.stats.addBytesSent(size)
+
+	if metrics, ok := w.metrics.(ThroughputMetrics); ok {
+		metrics.BytesSent(w.metricsLabel, size)
+	}
+}
@@ -0,0 +1,63 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type throughputMetrics struct {
+	noopMetrics
+	received, sent []int
+}
+
+func (m *throughputMetrics) BytesReceived(serviceName string, bytes int) {
+	m.received = append(m.received, bytes)
+}
+
+func (m *throughputMetrics) BytesSent(serviceName string, bytes int) {
+	m.sent = append(m.sent, bytes)
+}
+
+func throughputWorker(metrics Metrics) *mdWorker {
+	return &mdWorker{
+		serviceName: "test-service",
+		metrics:     metrics,
+		stats:       newWorkerStats(newFakeClock()),
+	}
+}
+
+func Test_Throughput_CountsEveryFrame(t *testing.T) {
+	metrics := new(throughputMetrics)
+	w := throughputWorker(metrics)
+
+	w.received([][]byte{[]byte(""), []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), []byte(""), []byte("hello")})
+	w.sent([][]byte{[]byte(""), []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+	w.sent([][]byte{[]byte("12345")})
+
+	stats := w.stats.snapshot()
+	assert.Equal(t, uint64(18), stats.TotalBytesReceived)
+	assert.Equal(t, uint64(12), stats.TotalBytesSent)
+	assert.Equal(t, []int{18}, metrics.received)
+	assert.Equal(t, []int{7, 5}, metrics.sent)
+}
+
+func Test_Throughput_MetricsWithoutThroughputStillCounted(t *testing.T) {
+	w := throughputWorker(noopMetrics{})
+
+	w.received([][]byte{[]byte("hello")})
+
+	assert.Equal(t, uint64(5), w.stats.snapshot().TotalBytesReceived)
+}
+
+func Test_Throughput_ResetZeroesBytes(t *testing.T) {
+	w := throughputWorker(noopMetrics{})
+	w.received([][]byte{[]byte("hello")})
+	w.sent([][]byte{[]byte("hello")})
+
+	w.stats.reset()
+
+	stats := w.stats.snapshot()
+	assert.Equal(t, uint64(0), stats.TotalBytesReceived)
+	assert.Equal(t, uint64(0), stats.TotalBytesSent)
+}
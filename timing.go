@@ -0,0 +1,27 @@
+package majordomo_worker
+
+// Rejects heartbeat, polling and liveness settings that would have the worker reconnect for no reason
+func (c WorkerConfig) validateTiming() error {
+	if c.PollingInterval <= 0 {
+		return ErrInvalidPollingInterval
+	}
+
+	// Without heartbeats nothing depends on the heartbeat interval and liveness never runs out
+	if c.DisableHeartbeats {
+		return nil
+	}
+
+	if c.HeartbeatInMillis <= 0 {
+		return ErrInvalidHeartbeat
+	}
+
+	if c.PollingInterval > c.HeartbeatInMillis {
+		return ErrPollingIntervalTooLong
+	}
+
+	if c.MaxHeartbeatLiveness < 1 {
+		return ErrInvalidLiveness
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func timingConfig(heartbeat, poll time.Duration, liveness int) WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:        "inproc://test",
+		ServiceName:          "test-service",
+		HeartbeatInMillis:    heartbeat,
+		PollingInterval:      poll,
+		MaxHeartbeatLiveness: liveness,
+	}
+}
+
+func Test_Timing_ValidCombinationsAccepted(t *testing.T) {
+	assert.NoError(t, timingConfig(time.Second, 500*time.Millisecond, 50).validate())
+	assert.NoError(t, timingConfig(time.Second, time.Second, 1).validate())
+}
+
+func Test_Timing_PollingIntervalMustBePositive(t *testing.T) {
+	assert.Equal(t, ErrInvalidPollingInterval, timingConfig(time.Second, 0, 10).validate())
+	assert.Equal(t, ErrInvalidPollingInterval, timingConfig(time.Second, -time.Millisecond, 10).validate())
+}
+
+func Test_Timing_HeartbeatMustBePositive(t *testing.T) {
+	assert.Equal(t, ErrInvalidHeartbeat, timingConfig(0, 10*time.Millisecond, 10).validate())
+}
+
+func Test_Timing_PollingIntervalLongerThanHeartbeatRejected(t *testing.T) {
+	assert.Equal(t, ErrPollingIntervalTooLong, timingConfig(100*time.Millisecond, 250*time.Millisecond, 10).validate())
+}
+
+func Test_Timing_LivenessMustBeAtLeastOne(t *testing.T) {
+	assert.Equal(t, ErrInvalidLiveness, timingConfig(time.Second, 500*time.Millisecond, 0).validate())
+	assert.Equal(t, ErrInvalidLiveness, timingConfig(time.Second, 500*time.Millisecond, -1).validate())
+}
+
+func Test_Timing_HeartbeatSettingsIgnoredWhenDisabled(t *testing.T) {
+	config := timingConfig(0, 250*time.Millisecond, 0)
+	config.DisableHeartbeats = true
+
+	assert.NoError(t, config.validate())
+}
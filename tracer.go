@@ -0,0 +1,27 @@
+package majordomo_worker
+
+// Tracer is called around every call to the action so requests can be traced. Implementations must be safe for
+// concurrent use.
+type Tracer interface {
+	// StartRequest is called before the action with the request's trace header frame, nil if it doesn't have one.
+	// The returned function is called with the action's reply once it is done and returns the frames to send.
+	StartRequest(ctx RequestContext, header []byte) func(reply [][]byte) [][]byte
+}
+
+func untraced(reply [][]byte) [][]byte {
+	return reply
+}
+
+// Starts tracing the request if there is a Tracer, returning the function that finishes the trace
+func (w *mdWorker) startTrace(ctx RequestContext) func([][]byte) [][]byte {
+	if w.tracer == nil {
+		return untraced
+	}
+
+	var header []byte
+	if w.traceFrame < len(ctx.Request) {
+		header = ctx.Request[w.traceFrame]
+	}
+
+	return w.tracer.StartRequest(ctx, header)
+}
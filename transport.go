@@ -0,0 +1,63 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"strings"
+)
+
+var supportedTransports = map[string]bool{
+	"tcp":    true,
+	"ipc":    true,
+	"inproc": true,
+	"pgm":    true,
+	"epgm":   true,
+}
+
+// Returned by NewWorker when a broker address can't be used, either because of its transport or because of an
+// option that doesn't work with that transport
+type TransportError struct {
+	Address string
+	Reason  string
+}
+
+func (e TransportError) Error() string {
+	return fmt.Sprintf("Broker address '%s' %s", e.Address, e.Reason)
+}
+
+func brokerAddresses(brokerAddress string) []string {
+	return strings.Split(brokerAddress, ",")
+}
+
+func transportOf(address string) string {
+	i := strings.Index(address, "://")
+	if i < 0 {
+		return ""
+	}
+
+	return address[:i]
+}
+
+func (c WorkerConfig) validateTransports() error {
+	for _, address := range brokerAddresses(c.BrokerAddress) {
+		if err := validateTransport(address, c.CurveServerKey != ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateTransport(address string, curve bool) error {
+	transport := transportOf(address)
+
+	if !supportedTransports[transport] {
+		return TransportError{Address: address, Reason: fmt.Sprintf("uses unsupported transport '%s'", transport)}
+	}
+
+	// Security mechanisms are part of the ZMTP handshake which inproc connections don't perform
+	if curve && transport == "inproc" {
+		return TransportError{Address: address, Reason: "can't use CURVE security, it is not supported over inproc"}
+	}
+
+	return nil
+}
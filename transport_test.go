@@ -0,0 +1,176 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Transport_SupportedTransportsAreValid(t *testing.T) {
+	for _, address := range []string{"tcp://localhost:5555", "ipc:///tmp/broker", "inproc://broker"} {
+		config := WorkerConfig{BrokerAddress: address}
+		assert.NoError(t, config.validateTransports(), address)
+	}
+}
+
+func Test_Transport_UnsupportedTransportIsRejected(t *testing.T) {
+	config := WorkerConfig{BrokerAddress: "tcp://localhost:5555,udp://localhost:5556"}
+
+	assert.Equal(t,
+		TransportError{Address: "udp://localhost:5556", Reason: "uses unsupported transport 'udp'"},
+		config.validateTransports(),
+	)
+}
+
+func Test_Transport_MissingTransportIsRejected(t *testing.T) {
+	config := WorkerConfig{BrokerAddress: "localhost:5555"}
+
+	assert.Error(t, config.validateTransports())
+}
+
+func Test_Transport_CurveAllowedOverTcpAndIpc(t *testing.T) {
+	for _, address := range []string{"tcp://localhost:5555", "ipc:///tmp/broker"} {
+		config := WorkerConfig{BrokerAddress: address, CurveServerKey: "server-key"}
+		assert.NoError(t, config.validateTransports(), address)
+	}
+}
+
+func Test_Transport_CurveRejectedOverInproc(t *testing.T) {
+	config := WorkerConfig{BrokerAddress: "inproc://broker", CurveServerKey: "server-key"}
+
+	err := config.validateTransports()
+	if assert.IsType(t, TransportError{}, err) {
+		assert.Equal(t, "Broker address 'inproc://broker' can't use CURVE security, it is not supported over inproc", err.Error())
+	}
+}
+
+func Test_Transport_IPCFilePermissionsAppliedToIpcAddress(t *testing.T) {
+	file, err := ioutil.TempFile("", "majordomo-worker-ipc")
+	if !assert.NoError(t, err) {
+		return
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	w := &mdWorker{ipcFilePermissions: 0640, logger: new(testLogger)}
+
+	assert.True(t, w.applyIPCFilePermissions("ipc://"+file.Name()))
+
+	info, err := os.Stat(file.Name())
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	}
+}
+
+func Test_Transport_IPCFilePermissionsSkippedForOtherTransports(t *testing.T) {
+	w := &mdWorker{ipcFilePermissions: 0600, logger: new(testLogger)}
+
+	for _, address := range []string{"tcp://localhost:5555", "inproc://broker", "ipc://@abstract-broker"} {
+		assert.False(t, w.applyIPCFilePermissions(address), address)
+	}
+}
+
+func Test_Transport_IPCFilePermissionsSkippedWhenNotSet(t *testing.T) {
+	w := &mdWorker{logger: new(testLogger)}
+
+	assert.False(t, w.applyIPCFilePermissions("ipc:///tmp/broker"))
+}
+
+func Test_Transport_TCPKeepaliveSkippedForOtherTransports(t *testing.T) {
+	w := &mdWorker{tcpKeepalive: tcpKeepalive{enabled: true}}
+
+	// The socket is never touched for these
+	for _, address := range []string{"ipc:///tmp/broker", "inproc://broker"} {
+		applied, err := w.applyTCPKeepalive(address, nil)
+		assert.NoError(t, err)
+		assert.False(t, applied, address)
+	}
+}
+
+func Test_Transport_TCPKeepaliveDisabledByDefault(t *testing.T) {
+	w := &mdWorker{}
+
+	applied, err := w.applyTCPKeepalive("tcp://localhost:5555", nil)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+}
+
+type recordingZMTPHeartbeatSocket struct {
+	interval, timeout, ttl time.Duration
+}
+
+func (s *recordingZMTPHeartbeatSocket) SetHeartbeatIvl(value time.Duration) error {
+	s.interval = value
+	return nil
+}
+
+func (s *recordingZMTPHeartbeatSocket) SetHeartbeatTimeout(value time.Duration) error {
+	s.timeout = value
+	return nil
+}
+
+func (s *recordingZMTPHeartbeatSocket) SetHeartbeatTtl(value time.Duration) error {
+	s.ttl = value
+	return nil
+}
+
+func Test_Transport_ZMTPHeartbeatOptionsSet(t *testing.T) {
+	w := &mdWorker{zmtpHeartbeat: zmtpHeartbeat{interval: time.Second, timeout: 3 * time.Second, ttl: 5 * time.Second}}
+	socket := &recordingZMTPHeartbeatSocket{}
+
+	applied, err := w.applyZMTPHeartbeat(socket)
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, recordingZMTPHeartbeatSocket{interval: time.Second, timeout: 3 * time.Second, ttl: 5 * time.Second}, *socket)
+}
+
+func Test_Transport_ZMTPHeartbeatDisabledWithoutInterval(t *testing.T) {
+	w := &mdWorker{zmtpHeartbeat: zmtpHeartbeat{timeout: 3 * time.Second}}
+	socket := &recordingZMTPHeartbeatSocket{}
+
+	applied, err := w.applyZMTPHeartbeat(socket)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, recordingZMTPHeartbeatSocket{}, *socket)
+}
+
+func Test_Identity_FuncPreferredOverStatic(t *testing.T) {
+	w := &mdWorker{identity: "static", identityFunc: func() ([]byte, error) { return []byte("dynamic"), nil }, logger: new(testLogger)}
+
+	assert.Equal(t, []byte("dynamic"), w.socketIdentity("tcp://localhost:5555"))
+}
+
+func Test_Identity_FallsBackWhenFuncFails(t *testing.T) {
+	logger := new(testLogger)
+	failing := func() ([]byte, error) { return nil, errors.New("lease unavailable") }
+
+	w := &mdWorker{identity: "static", identityFunc: failing, logger: logger}
+	assert.Equal(t, []byte("static"), w.socketIdentity("tcp://localhost:5555"))
+	assert.NotEmpty(t, logger.errors)
+
+	// Without a static identity a random one is generated
+	w = &mdWorker{identityFunc: failing, logger: logger}
+	assert.Len(t, w.socketIdentity("tcp://localhost:5555"), 8)
+}
+
+func Test_Identity_GeneratedAfreshForEveryConnect(t *testing.T) {
+	w := &mdWorker{logger: new(testLogger)}
+
+	first := w.socketIdentity("tcp://localhost:5555")
+	second := w.socketIdentity("tcp://localhost:5555")
+
+	assert.NotEqual(t, first, second)
+	assert.NotEqual(t, byte(0), first[0], "Expected no leading zero byte, ZeroMQ reserves it")
+}
+
+func Test_Identity_KeptOverFuncOnRestart(t *testing.T) {
+	w := &mdWorker{identityFunc: func() ([]byte, error) { return []byte("dynamic"), nil }, logger: new(testLogger)}
+	w.keptIdentities = map[string][]byte{"tcp://localhost:5555": []byte("kept")}
+
+	assert.Equal(t, []byte("kept"), w.socketIdentity("tcp://localhost:5555"))
+	assert.Equal(t, []byte("dynamic"), w.socketIdentity("tcp://localhost:5556"))
+}
@@ -1,21 +1,640 @@
 package majordomo_worker
 
 import (
+	"context"
+	"os"
 	"time"
+
+	"github.com/pebbe/zmq4"
+)
+
+const (
+	defaultMaxServiceNameLength = 255
+	defaultServiceMismatchReply = "Service mismatch"
+	defaultFilteredReply        = "Request filtered"
 )
 
+// WorkerAction is called with the request body exactly as the client sent it, one slice per frame (empty frames
+// included, nothing is joined or split), and every frame it returns is sent back to the client as a frame of its own.
+// Returning nil or no frames sends an empty reply, one with no body frames at all.
 type WorkerAction interface {
 	Call([][]byte) [][]byte
 }
 
 type Worker interface {
+	// Shutdown has Receive() finish what it is doing, tell the brokers it is going and close the worker, after which
+	// Receive() returns a GracefulShutdown error, as does every later call. It returns straight away and may be called
+	// from any goroutine, any number of times.
 	Shutdown()
+	// Close closes the broker sockets and terminates the context straight away, without telling the broker or
+	// flushing pending batches, and returns the first error doing so. It is safe to call whether or not Receive()
+	// was ever called, and after Shutdown(), but not while Receive() is running. Only the first call closes anything,
+	// later ones return its result.
+	Close() error
+
+	// ForceReconnect makes the worker reconnect and register again with every broker at the next poll, i.e. ahead of
+	// a rolling broker upgrade or to test resilience. It may be called from any goroutine.
+	ForceReconnect()
+	// DrainAndReconnect has Receive() finish the request or batch in hand, send MD_DISCONNECT to every broker and
+	// reconnect after ReconnectInMillis, i.e. for a rolling broker upgrade. It returns once that is done, with the
+	// first error reconnecting if any, or ErrDrainTimeout if Receive() doesn't get it done within timeout, in which
+	// case it may still happen later. Actions still running after timeout are abandoned rather than waited for.
+	DrainAndReconnect(timeout time.Duration) error
+	// SendHeartbeat has Receive() heartbeat every broker straight away, restarting the heartbeat interval, i.e. to
+	// reassure brokers after expensive work. It may be called from any goroutine and returns once the heartbeats have
+	// been sent, with the first send error if any, so Receive() has to be running. Receive() only gets to it between
+	// polls. It does nothing with heartbeats disabled and returns a GracefulShutdown error once shut down.
+	SendHeartbeat() error
+	// Pause stops the worker handling requests, i.e. for a maintenance window, while it stays connected and keeps
+	// heartbeating. Requests that arrive meanwhile are held or the broker is disconnected from, see
+	// WorkerConfig.PauseMode. Resume handles any held requests and registers again with disconnected brokers. Both
+	// may be called from any goroutine.
+	Pause()
+	Resume()
+	// Requests hands out requests for the caller to reply to, in place of an action. It is nil unless
+	// WorkerConfig.RequestQueue is set.
+	Requests() <-chan Request
+	// Liveness is the lowest liveness of any broker as of the last poll, see WorkerConfig.MaxHeartbeatLiveness
+	Liveness() int
 	Receive() ([][]byte, error)
+	Events() <-chan WorkerEvent
+	Stats() WorkerStats
+	// QueueDepth is the number of requests received but not replied to yet, as also reported by Stats()
+	QueueDepth() int
+	// CurrentRequest returns the request whose action has been running longest, if any, i.e. to see what a stuck
+	// worker is doing. A request is no longer reported once its action returns or times out. Batches aren't
+	// reported. The RequestContext holds the request body, so redact it before logging it anywhere public. It may be
+	// called from any goroutine.
+	CurrentRequest() (RequestContext, bool)
+	// Reset zeroes the counters reported by Stats() without touching the broker connections
+	Reset()
+
+	// SetAction replaces the action used for subsequent requests, a request already being handled finishes with
+	// the previous one. It may be called from any goroutine.
+	SetAction(WorkerAction)
+	// Restart disconnects from every broker and registers with them again, reusing the worker's zmq context and the
+	// identity each broker knew it by, i.e. after reloading the action or config. Requests in hand are finished first
+	// and cached replies dropped, while stats carry on counting. Like SendHeartbeat it is handed to Receive(), which
+	// has to be running, and returns a GracefulShutdown error once shut down. It returns the first error registering
+	// again, liveness then has the worker retry as it would after losing the broker. Brokers must set
+	// ZMQ_ROUTER_HANDOVER to let the new connection take over the identity from the old one.
+	Restart() error
+	// Reconfigure applies a changed copy of the worker's config at runtime, i.e. to tune a long-running daemon
+	// without restarting it. Only HeartbeatInMillis, ReconnectInMillis, PollingInterval, MaxHeartbeatLiveness,
+	// LogLevel and Action may differ from the config the worker was created or last reconfigured with, anything else
+	// is rejected with a ReconfigureError naming the field. The config is validated as NewWorker does. Timings apply
+	// from the next poll, sockets created on reconnecting use the new liveness. Like SendHeartbeat it is handed to
+	// Receive(), which has to be running, and returns a GracefulShutdown error once shut down. Func fields are only
+	// compared by their code, so a closure swapped for another made by the same function literal isn't rejected, but
+	// it isn't used either. Start from Config() rather than the config passed to NewWorker.
+	Reconfigure(WorkerConfig) error
+	// Config returns the worker's config as it was created or last reconfigured with, along with the current action,
+	// i.e. with the ServiceName and Action a WorkerFactory gave it. It may be called from any goroutine.
+	Config() WorkerConfig
+
+	// Context returns the zmq context the worker's sockets belong to, so auxiliary sockets can share it. The
+	// context is safe to use from any goroutine but sockets are not, and it is terminated when the worker shuts down,
+	// or for a WorkerPool's workers once the whole pool has shut down.
+	Context() *zmq4.Context
 }
 
 type WorkerConfig struct {
+	// Heartbeats are only sent between polls, so PollingInterval must not be longer than HeartbeatInMillis or they
+	// go out late. A broker is considered dead after MaxHeartbeatLiveness (at least 1) polls without hearing from it,
+	// so PollingInterval * MaxHeartbeatLiveness should be several heartbeat intervals or a broker that is merely
+	// quiet between heartbeats gets reconnected to.
+	//
+	// ServiceName is what brokers register the worker under, so it must not be empty: NewWorker returns
+	// ErrEmptyServiceName rather than connect. MD_READY always carries it as a frame of its own.
 	BrokerAddress, ServiceName                            string
 	HeartbeatInMillis, ReconnectInMillis, PollingInterval time.Duration
 	MaxHeartbeatLiveness                                  int
 	Action                                                WorkerAction
+
+	// ServiceNamePrefix is prepended to ServiceName wherever the worker uses it, i.e. 'teamA/' to namespace services
+	// on a broker shared between teams. MaxServiceNameLength applies to the prefixed name.
+	ServiceNamePrefix string
+
+	// ServiceAliases are further service names, prefixed as ServiceName is, that the worker registers with every
+	// broker as and serves with the same Action. Brokers only take one MD_READY per connection so each alias gets a
+	// socket of its own, and RequestContext.ServiceName says which one a request came in on. Aliases can't be used
+	// with Identity, IdentityFunc or Bind, which would have the sockets share an identity or address.
+	ServiceAliases []string
+
+	// Name tells the process's workers apart in their log lines, which carry it as 'worker', and in metrics, where
+	// it replaces the service name. It is unrelated to the socket identity brokers see. Log lines default to the
+	// service name numbered by how many workers the process has created, i.e. 'echo#2'.
+	Name string
+
+	// LogLevel is the least severe level logged, so LevelWarn leaves out the debug lines logged for every message.
+	// Defaults to LevelDebug.
+	LogLevel Level
+
+	// LogSampleRate logs the debug lines for received requests and sent replies for only 1 in every LogSampleRate of
+	// them, for workers handling too many requests to log each one. Other lines, warnings and errors included, are
+	// always logged. Defaults to logging every request.
+	LogSampleRate int
+
+	// EventBuffer is the size of the channel returned by Events(), defaults to 100
+	EventBuffer int
+
+	// SocketConfigurator is called with every newly created broker socket before it connects, including on
+	// reconnects. It can be used to set any zmq4 socket option that isn't otherwise exposed here. Returning an
+	// error fails the connection attempt.
+	SocketConfigurator func(*zmq4.Socket) error
+
+	// ConnectHook is called with every broker socket immediately before it connects (or binds), after all the other
+	// socket options and the SocketConfigurator have been applied, including on reconnects. It's for setup that has
+	// to come last, i.e. registering the socket with a monitor. Returning an error fails the connection attempt.
+	ConnectHook func(*zmq4.Socket) error
+
+	// SocketMonitoring watches each broker socket's ZeroMQ events, emitting EventSocketConnected,
+	// EventSocketDisconnected and EventSocketConnectRetried from Events() and logging them. These follow the TCP
+	// connection itself rather than MDP liveness. Each reconnect replaces the monitor along with the socket.
+	SocketMonitoring bool
+
+	// Identity is the socket identity the broker sees the worker as, instead of a random one generated for every
+	// connect and reconnect. IdentityFunc, if set, is called for a fresh identity on every connect and reconnect, i.e.
+	// to include a lease ID. Identity (or a generated one) is used if it fails. Identities must be 1 to 255 bytes and
+	// not start with a zero byte.
+	Identity     string
+	IdentityFunc func() ([]byte, error)
+
+	// ConnectRetries is how many more times the initial connection to each broker is attempted before giving up
+	// with ErrBrokerUnreachable or ErrBrokerUnconfirmed, waiting ConnectRetryDelay (defaults to ReconnectInMillis)
+	// between attempts. Defaults to 2, set it negative to disable retries. ZeroMQ connects in the background, so
+	// without ConnectConfirmationTimeout a broker that is down isn't noticed and only socket setup errors are retried.
+	ConnectRetries    int
+	ConnectRetryDelay time.Duration
+
+	// StartupProbe is called before every MD_READY, on connecting and on each reconnect, so a worker whose resources
+	// (caches, connection pools) aren't usable yet or any longer doesn't register. While it returns an error it is
+	// retried, waiting StartupProbeInterval (100ms if not set) at first and twice as long after each failure, up to
+	// 5s. NewWorker gives up with ErrStartupProbeTimeout after StartupProbeTimeout, retrying forever if it isn't set.
+	// A reconnect waits no longer than a heartbeat interval (or StartupProbeTimeout if shorter), then is abandoned and
+	// tried again at the next poll. Shutting down stops the retries.
+	StartupProbe         func() error
+	StartupProbeInterval time.Duration
+	StartupProbeTimeout  time.Duration
+
+	// MaxServiceNameLength is the longest ServiceName (in bytes) that is accepted, defaults to 255
+	MaxServiceNameLength int
+
+	// Clock defaults to the system clock, it can be replaced to control heartbeat and reconnect timing in tests
+	Clock Clock
+
+	// ReplyInterceptor is called with the action's response just before it is sent to the broker and returns the
+	// frames that are actually sent, i.e. to add tracing frames. Returning nil sends an empty reply.
+	ReplyInterceptor func(ctx RequestContext, reply [][]byte) [][]byte
+
+	// ReplyCompressionThreshold gzips every frame of replies whose body adds up to at least that many bytes. Every
+	// reply body then starts with a marker frame, ReplyGzip or ReplyIdentity for smaller replies sent as they are,
+	// which DecompressReply reads on the client. Replies are compressed after ReplyInterceptor, and the marker comes
+	// after any session token (see PropagateSessionToken).
+	ReplyCompressionThreshold int
+
+	// CompressionNegotiation lets clients choose the codec per request rather than the worker deciding. The codecs
+	// supported are advertised in READY metadata as 'codecs=gzip,identity'. A request whose body starts with a
+	// ReplyGzip or ReplyIdentity marker frame is decoded before anything else sees it and its reply is encoded the
+	// same way, marker first. Unmarked requests are handled as they are, replies to them as
+	// ReplyCompressionThreshold says. Requests that fail to decode are answered with ErrorReply, as are gzipped ones
+	// whose body decodes to more than MaxDecodedRequestBytes (64MiB if not set). Streamed replies are encoded a chunk
+	// at a time, each MD_PARTIAL starting with its own marker frame.
+	CompressionNegotiation bool
+	MaxDecodedRequestBytes int
+
+	// StreamChunkSize is how many bytes of a StreamWorkerAction's reply go in each frame, 64KiB if not set
+	StreamChunkSize int
+
+	// AfterReply is called once a reply has been handed to the broker socket, with the frames sent (after
+	// ReplyInterceptor) and the send's error, i.e. to commit analytics once the client has its answer. It runs on a
+	// goroutine of its own so it doesn't hold up the next request, and must not touch the worker's sockets.
+	AfterReply func(ctx RequestContext, reply [][]byte, err error)
+
+	// OnDisconnect is called with the broker's address whenever a broker sends MD_DISCONNECT, i.e. to flush caches or
+	// log an incident. It runs on a goroutine of its own while the worker reconnects, and must not touch the worker's
+	// sockets. Brokers given up on for lack of heartbeats don't call it, see EventDisconnected for those.
+	OnDisconnect func(address string)
+
+	// ReconnectLimiter, if set, is waited on before every reconnect to the broker (not the initial connect). The
+	// context passed to Wait is cancelled once Shutdown() is called.
+	ReconnectLimiter ReconnectLimiter
+
+	// If the worker reconnects more than ReconnectCircuitBreakerMaxReconnects times within
+	// ReconnectCircuitBreakerWindow it stops reconnecting and reports itself unhealthy in Stats() for
+	// ReconnectCircuitBreakerCooldown. Disabled unless ReconnectCircuitBreakerMaxReconnects is set.
+	ReconnectCircuitBreakerMaxReconnects int
+	ReconnectCircuitBreakerWindow        time.Duration
+	ReconnectCircuitBreakerCooldown      time.Duration
+
+	// HealthFunc, if set, is consulted by Stats() so a worker that is connected but degraded, i.e. its downstream
+	// dependencies are down, reports itself unhealthy. Healthy is only true if both the circuit breaker is closed and
+	// HealthFunc returns true. It is called on the caller's goroutine and should be quick.
+	HealthFunc func() bool
+
+	// IdempotencyCacheSize enables replaying the reply for duplicate requests instead of calling the action again.
+	// Requests are identified by the body frame at index RequestIDFrame, the cache holds at most
+	// IdempotencyCacheSize replies for IdempotencyCacheTTL (forever if not set).
+	IdempotencyCacheSize int
+	IdempotencyCacheTTL  time.Duration
+	RequestIDFrame       int
+
+	// DeduplicationWindow replays the reply for requests whose body is identical to one answered within that long,
+	// for idempotent operations whose requests carry no ID (see IdempotencyCacheSize for those that do). Bodies are
+	// compared by a SHA-256 hash of their frames, the replies of at most DeduplicationCacheSize (1024 if not set)
+	// recent requests are kept. Can't be combined with IdempotencyCacheSize.
+	DeduplicationWindow    time.Duration
+	DeduplicationCacheSize int
+
+	// DeadLetterMaxFailures stops calling the action for a request it has failed for that many times, i.e. a poison
+	// message its client keeps retrying. Requests are identified by the body frame at RequestIDFrame. Such a request
+	// is passed to DeadLetterHandler, if set, and answered with ErrorReply(ErrDeadLettered).
+	DeadLetterMaxFailures int
+	DeadLetterHandler     func(RequestContext)
+
+	// Metrics receives request, reconnect, action duration and liveness measurements, i.e. prom.New()
+	Metrics Metrics
+
+	// Brokers that include the requested service in the request body can have it checked against ServiceName.
+	// ServiceFrame is the index of that frame in the body and ServiceMismatchPolicy decides what happens when it
+	// doesn't match. Rejected requests are answered with ServiceMismatchReply.
+	ServiceMismatchPolicy ServiceMismatchPolicy
+	ServiceFrame          int
+	ServiceMismatchReply  [][]byte
+
+	// ShutdownSignals, if set, are handled by the worker by calling Shutdown(). Leave it empty if you handle
+	// signals yourself. Default signal handling is restored once the worker is shut down.
+	ShutdownSignals []os.Signal
+
+	// ShutdownTimeout is how long a graceful shutdown, or a drain a broker asks for (see DisconnectDrain), waits for
+	// actions still running (see MaxConcurrentRequests) before abandoning them, forever if not set. EventShutDown
+	// reports how many requests were never replied to.
+	ShutdownTimeout time.Duration
+
+	// MaxRequestsBeforeRestart restarts the worker after every so many requests, to contain actions (or the
+	// libraries they use) that leak memory: it sends MD_DISCONNECT, drops cached replies and connects to the brokers
+	// afresh, once the last request's reply has been sent. Stats carry on counting. Never restarts if not set.
+	MaxRequestsBeforeRestart int
+
+	// ReturnReceiveErrors makes Receive() return errors polling or receiving from the brokers to the caller, who can
+	// call Receive() again to carry on. By default the sockets concerned are reconnected instead. Either way
+	// interrupted and spurious receives are retried, and a terminated context shuts the worker down.
+	ReturnReceiveErrors bool
+
+	// FlushTimeout bounds how long shutting down waits for AfterReply callbacks still running, and for a reader to
+	// make room for the ShuttingDown and ShutDown events if Events() is full. Those two are never dropped, older
+	// events are dropped to make room for them instead. Metrics implementing FlushingMetrics are flushed as well.
+	// Not waiting at all if not set.
+	FlushTimeout time.Duration
+
+	// TermTimeout is how long Close() (and so a graceful shutdown) waits for the zmq context to terminate, which
+	// only happens once every socket on it is closed, before returning ErrTermTimeout. Defaults to 5 seconds, set it
+	// negative to wait forever.
+	TermTimeout time.Duration
+
+	// BatchMaxSize enables batching, Action must also implement BatchWorkerAction. Requests are collected until
+	// there are BatchMaxSize of them or BatchMaxWait has passed since the first one arrived and are then passed to
+	// CallBatch together. Receive() returns once a batch has been dispatched.
+	BatchMaxSize int
+	BatchMaxWait time.Duration
+
+	// MaxConcurrentRequests lets the action handle up to that many requests at once, each on its own goroutine, so
+	// the action must be safe for concurrent use. Once they are all taken the worker stops reading from the brokers
+	// until one finishes. Receive() returns once a reply has been sent. Defaults to 1, handling each request in
+	// Receive() before reading the next. Only useful with brokers that send a worker more than one request at a time,
+	// and ignored when batching.
+	MaxConcurrentRequests int
+
+	// RequestQueue, in place of Action, has Receive() put requests on Worker.Requests() for the caller to answer with
+	// Request.Reply() from any goroutine, i.e. to feed them into a pipeline of its own. Up to that many requests can
+	// be waiting for a reply, once they are the worker stops reading from the brokers as with MaxConcurrentRequests
+	// (which it replaces). Receive() still has to be called as usual, it is what sends the replies. The channel is
+	// never closed.
+	RequestQueue int
+
+	// CurveServerKey enables CURVE security with the broker, whose public key it is. CurvePublicKey and
+	// CurveSecretKey are the worker's own key pair. All keys are Z85 encoded. Not supported for inproc addresses.
+	CurveServerKey, CurvePublicKey, CurveSecretKey string
+
+	// IPCFilePermissions, if set, are applied to the socket file of ipc broker addresses before connecting. The file
+	// is created by the broker so this only works if the worker's user owns it. Ignored for other transports.
+	IPCFilePermissions os.FileMode
+
+	// TCPKeepalive turns on TCP keepalives for tcp broker addresses so connections through NAT and firewalls aren't
+	// silently dropped while idle. TCPKeepaliveIdle is how long a connection is idle before the first probe,
+	// TCPKeepaliveInterval the time between probes (both rounded down to whole seconds) and TCPKeepaliveCount how many
+	// unanswered probes drop the connection. Any left unset keep the operating system's defaults.
+	TCPKeepalive                           bool
+	TCPKeepaliveIdle, TCPKeepaliveInterval time.Duration
+	TCPKeepaliveCount                      int
+
+	// ZMTPHeartbeatInterval turns on ZeroMQ's own heartbeats (ZeroMQ 4.2 and later), sent that often on every broker
+	// connection. The connection is dropped if nothing comes back within ZMTPHeartbeatTimeout, and ZMTPHeartbeatTTL
+	// tells the broker to drop it if it hears nothing for that long. They notice dead TCP connections sooner but
+	// never reach the worker, so they neither restore MDP liveness nor replace MD_HEARTBEAT.
+	ZMTPHeartbeatInterval, ZMTPHeartbeatTimeout, ZMTPHeartbeatTTL time.Duration
+
+	// SlowRequestThreshold reports requests whose action takes longer than it to SlowRequestHandler, which is
+	// passed how long it took, or as a warning if no handler is set. Every request in a batch took as long as the
+	// batch. The handler is called from Receive(), so it should be quick.
+	SlowRequestThreshold time.Duration
+	SlowRequestHandler   func(ctx RequestContext, elapsed time.Duration)
+
+	// Bind makes the worker bind to each broker address and wait for the broker to connect to it, rather than
+	// connecting out. MD_READY is only sent once a broker has connected, so creating the worker blocks until then
+	// unless SendTimeout is set. Reconnects release the address before binding a fresh socket to it.
+	Bind bool
+
+	// DisableHeartbeats is for brokers that don't implement heartbeating and are confused by MD_HEARTBEAT. The
+	// worker sends none and, as a quiet broker is then no sign of a dead one, never reconnects because of liveness.
+	// A broker that goes away is only noticed by other means: ZMTP heartbeats or TCP keepalive on the connection, or
+	// sends failing with a SendTimeout. Until then the worker waits for requests that won't come.
+	DisableHeartbeats bool
+
+	// ManualLiveness is for tests of actions that drive the worker purely by feeding it messages, without the worker
+	// doing anything of its own accord as time passes: liveness never runs down, so the worker never reconnects
+	// because of it, and heartbeats are only sent when asked for with SendHeartbeat(). Unlike DisableHeartbeats the
+	// brokers are still heartbeated on request. IdleAction is never called, DelayedWorkerAction replies are sent
+	// straight away and MaxRequestsBeforeRestart is ignored, Restart() still works. Batches and ActionTimeout are
+	// part of what the action is tested with so they're left alone. Don't use it in production, a dead broker is
+	// never noticed.
+	ManualLiveness bool
+
+	// SendTimeout bounds sending a message to a broker, which otherwise blocks while the broker isn't reading. A
+	// send that times out is retried SendRetries more times (defaults to 3, set it negative to disable retries) a
+	// millisecond apart, in case the broker is only momentarily slow, before the worker reconnects to it.
+	SendTimeout time.Duration
+	SendRetries int
+
+	// ReplyTimeout bounds sending MD_REPLY in place of SendTimeout, so a broker that won't take replies can't stall
+	// the worker after the action has finished, whatever SendTimeout is. A reply that times out isn't retried, the
+	// worker logs it and reconnects to the broker.
+	ReplyTimeout time.Duration
+
+	// SocketLinger is how long messages still queued when a broker socket is closed, on reconnects and shutdown, get
+	// to reach the broker, i.e. a reply sent just before. Closing the worker waits for up to that long. Defaults to
+	// discarding them straight away, except for the MD_DISCONNECT sent on shutdown or DrainAndReconnect, which always
+	// gets at least the polling interval.
+	SocketLinger time.Duration
+
+	// PauseMode is what a paused worker does with the requests brokers send it, see Worker.Pause
+	PauseMode PauseMode
+
+	// EnvelopeLayout gives the frame positions of messages received from brokers that don't frame them the standard
+	// way, i.e. leave out the empty delimiter. Defaults to StandardEnvelopeLayout.
+	EnvelopeLayout EnvelopeLayout
+
+	// FollowDisconnectRedirects lets a broker hand the worker over to another endpoint by sending the new address as
+	// a frame after the MD_DISCONNECT command. The worker then reconnects there instead of to the broker it had. Only
+	// turn it on for trusted brokers: anything able to speak to the worker as a broker can send it elsewhere, along
+	// with the requests it would have handled. Redirects with an unsupported transport are ignored.
+	FollowDisconnectRedirects bool
+
+	// DisconnectGracePeriod debounces brokers that send MD_DISCONNECT over and over: after reconnecting for one, any
+	// more from the same broker within the grace period are logged and ignored, rather than each costing another
+	// reconnect. They don't call OnDisconnect or emit EventDisconnected either. Every MD_DISCONNECT is honoured if
+	// not set.
+	DisconnectGracePeriod time.Duration
+
+	// FrameEncoder and FrameDecoder serialize and parse the protocol header and command frames, for brokers that
+	// don't use the MDP byte constants. Both default to MDPFrames.
+	FrameEncoder FrameEncoder
+	FrameDecoder FrameDecoder
+
+	// ReceiveMiddleware is called with every message read from a broker, heartbeats and disconnects included, before
+	// the worker looks at it, i.e. for telemetry or protocol extensions. Messages it returns handled for are left
+	// entirely to it: they aren't checked, answered or counted towards the broker's liveness.
+	ReceiveMiddleware func(frames [][]byte) (handled bool)
+
+	// HeartbeatNegotiation adopts the heartbeat interval a broker advertises in its MD_HEARTBEAT (as a frame
+	// holding milliseconds) in place of HeartbeatInMillis, bounded by MinHeartbeat and MaxHeartbeat if set.
+	// MaxHeartbeatLiveness is scaled to match, so brokers get as long to be heard from in heartbeats as before.
+	HeartbeatNegotiation       bool
+	MinHeartbeat, MaxHeartbeat time.Duration
+
+	// HeartbeatJitter brings every heartbeat forward by a random amount of up to HeartbeatJitter (capped at half the
+	// heartbeat interval) so a fleet of workers started together doesn't heartbeat in step
+	HeartbeatJitter time.Duration
+
+	// LivenessByTime considers a broker dead once nothing has been heard from it for MaxHeartbeatLiveness heartbeat
+	// intervals, rather than for MaxHeartbeatLiveness polls. Polls end early whenever any broker sends something or a
+	// batch is due, so counting them only roughly tracks how long a silent but still open connection has been quiet.
+	LivenessByTime bool
+
+	// LivenessGracePeriod gives a broker the worker has given up on one more chance: rather than reconnecting straight
+	// away it keeps polling for this long, and only reconnects if nothing arrives meanwhile. Keeps brief network blips
+	// from costing a full reconnect. Reconnects straight away if not set.
+	LivenessGracePeriod time.Duration
+
+	// ReconnectStrategy decides after every poll whether to reconnect to each broker, and how long to sleep first.
+	// Defaults to a LivenessReconnectStrategy following MaxHeartbeatLiveness, LivenessByTime and ReconnectInMillis.
+	ReconnectStrategy ReconnectStrategy
+
+	// IdleAction is called once nothing has arrived for IdleInterval (defaults to HeartbeatInMillis) and again every
+	// IdleInterval for as long as that lasts, i.e. to keep pooled connections warm. It is called from Receive(),
+	// between requests, so heartbeats wait for it and it should be kept short. With MaxConcurrentRequests it waits
+	// until no actions are running.
+	IdleAction   func()
+	IdleInterval time.Duration
+
+	// PropagateDeadline reads a deadline, as Unix time in milliseconds, from the request body frame at index
+	// DeadlineFrame into RequestContext.Deadline. Requests whose deadline has already passed are answered with
+	// "Deadline exceeded" instead of calling the action.
+	PropagateDeadline bool
+	DeadlineFrame     int
+
+	// PropagateEnqueuedAt reads when the broker queued the request, as Unix time in milliseconds, from the request
+	// body frame at index EnqueuedAtFrame into RequestContext.EnqueuedAt. How long the request waited is then passed
+	// to Metrics, if it implements QueueLatencyMetrics.
+	PropagateEnqueuedAt bool
+	EnqueuedAtFrame     int
+
+	// PropagateSessionToken reads a session token from the request body frame at index SessionTokenFrame into
+	// RequestContext.SessionToken and echoes it as the first frame of the reply body, ahead of the action's frames
+	// (an empty frame if the request had none). Brokers or clients can use it to send a session's requests to the
+	// same worker, the worker itself doesn't route anything.
+	PropagateSessionToken bool
+	SessionTokenFrame     int
+
+	// ContextExtractor builds RequestContext.Context from the request body, i.e. for deadlines, trace IDs or auth
+	// carried in frames of the service's own. A deadline set on it also becomes RequestContext.Deadline, unless the
+	// client sent an earlier one with PropagateDeadline, so requests past it aren't passed to the action. Without it
+	// the context is context.Background().
+	ContextExtractor func(body [][]byte) context.Context
+
+	// State is handed to the action with every request as RequestContext.WorkerState, for dependencies such as a
+	// database pool that would otherwise be globals. The same action type can then serve workers with different
+	// State. The worker never looks at it, so it must be safe for the action to use concurrently if requests are.
+	State interface{}
+
+	// ReadyMetadata is advertised to the broker on every MD_READY as one 'key=value' frame per entry, sorted by
+	// key, after the service name. Brokers that don't understand it ignore the extra frames.
+	ReadyMetadata map[string]string
+
+	// Weight advertises the worker's relative capacity to brokers that balance load by it, i.e. 2 for a machine
+	// twice the size of its peers, as a 'weight=N' READY metadata frame. Standard brokers ignore it like any other
+	// metadata. Nothing is sent if not set, and it must not be negative.
+	Weight int
+
+	// NoReply is for services that are pure sinks: the action's result is discarded instead of being sent back as
+	// an MD_REPLY. MDP has no other way for a worker to acknowledge a request, so only use this with brokers that
+	// don't wait for a reply before handing the worker its next request, and clients that don't wait for one.
+	NoReply bool
+
+	// ResendReplyOnReconnect sends the last reply to a requester (not any routed replies) again, once, after
+	// reconnecting to a broker that hadn't been heard from since the reply was sent, as it may have been lost with the
+	// old connection. Clients may then receive the same reply twice.
+	ResendReplyOnReconnect bool
+
+	// Messages from a broker speaking another version of the protocol are always dropped, with
+	// DisconnectOnProtocolMismatch the broker is also sent MD_DISCONNECT so it can forget about the worker
+	DisconnectOnProtocolMismatch bool
+
+	// UnexpectedCommands decides, by command, what happens when a broker sends anything but MD_REQUEST, MD_HEARTBEAT
+	// or MD_DISCONNECT. Commands without an entry are ignored.
+	UnexpectedCommands map[string]UnexpectedCommandAction
+
+	// ConnectConfirmationTimeout makes NewWorker wait, after sending MD_READY, for the broker to send anything
+	// (usually its first heartbeat) and fail with ErrBrokerUnconfirmed if nothing arrives in time. Make sure it is
+	// longer than the broker's heartbeat interval. Disabled unless set.
+	ConnectConfirmationTimeout time.Duration
+
+	// Tracer is started around every call to the action with the request body frame at index TraceFrame as the
+	// trace header
+	Tracer     Tracer
+	TraceFrame int
+
+	// ErrorReply builds the reply sent when the action fails, by returning an error (see ErrorWorkerAction) or
+	// running longer than ActionTimeout. Defaults to a single frame holding the error's message.
+	ErrorReply func(err error) [][]byte
+
+	// PanicReply builds the reply sent when the action panics with RecoverPanics set, from the value it panicked
+	// with, so clients can tell bugs from errors. Defaults to a single "Internal error" frame, the panic and its
+	// stack are only logged.
+	PanicReply func(recovered interface{}) [][]byte
+
+	// RequestValidator is called with the body of every request before the action. Requests it returns an error for
+	// are answered with ErrorReply without calling the action, i.e. to check the number or size of frames.
+	RequestValidator func(body [][]byte) error
+
+	// ReplyValidator is called with the frames the action returns, before anything else is done with them. Replies
+	// it returns an error for are treated as the action failing with that error, so the client is sent ErrorReply
+	// rather than malformed data. Not called for batches.
+	ReplyValidator func(reply [][]byte) error
+
+	// RequestFilter is called with every valid request before the action, i.e. for maintenance or canary routing.
+	// Returning drop answers the request with FilteredReply ("Request filtered" if not set) without calling the
+	// action, otherwise the action is called with the body it returns, which may be the one it was given.
+	RequestFilter func(ctx RequestContext, body [][]byte) (newBody [][]byte, drop bool)
+	FilteredReply [][]byte
+
+	// RecoverPanics answers requests whose action panics with PanicReply instead of crashing
+	RecoverPanics bool
+
+	// ActionTimeout is how long the action may take before the request is answered with ErrActionTimeout. The
+	// action isn't interrupted, whatever it returns afterwards is discarded. Batches are never timed out.
+	ActionTimeout time.Duration
+
+	// AbandonedActionLimit stops the worker taking requests while that many timed out actions are still running (see
+	// WorkerStats.AbandonedActions), leaving them with the brokers for other workers. It carries on heartbeating and
+	// takes requests again as they finish. Never stops if not set.
+	AbandonedActionLimit int
+
+	// ReplyFramePrefix is sent ahead of the body of every reply, partial ones included, for brokers that require an
+	// application envelope such as a routing tag. The frames go after the empty delimiter, so the reply is the
+	// protocol header, the client's address, the delimiter, ReplyFramePrefix and then the body.
+	ReplyFramePrefix [][]byte
+
+	// MaxReplyFrames guards against accidentally huge replies, those with more frames than this are handled as
+	// MaxReplyFramesPolicy says before being sent, with a warning logged. Not limited if not set.
+	MaxReplyFrames       int
+	MaxReplyFramesPolicy MaxReplyFramesPolicy
+}
+
+type ServiceMismatchPolicy int
+
+const (
+	// The service isn't checked at all, this is the default
+	ServiceCheckDisabled ServiceMismatchPolicy = iota
+	// Reply with ServiceMismatchReply without calling the action
+	ServiceMismatchReject
+	// Log a warning and call the action anyway
+	ServiceMismatchProcess
+	// Drop the request and reconnect to the broker to register again
+	ServiceMismatchReconnect
+)
+
+type MaxReplyFramesPolicy int
+
+const (
+	// Answer with ErrorReply(ErrTooManyReplyFrames) instead, this is the default
+	ReplyFramesReject MaxReplyFramesPolicy = iota
+	// Send only the first MaxReplyFrames frames
+	ReplyFramesTruncate
+)
+
+// The service name the worker registers with the broker as
+func (c WorkerConfig) registeredServiceName() string {
+	return c.ServiceNamePrefix + c.ServiceName
+}
+
+func (c WorkerConfig) validate() error {
+	maxServiceNameLength := c.MaxServiceNameLength
+	if maxServiceNameLength <= 0 {
+		maxServiceNameLength = defaultMaxServiceNameLength
+	}
+
+	if len(c.ServiceName) == 0 {
+		return ErrEmptyServiceName
+	}
+
+	if len(c.registeredServiceName()) > maxServiceNameLength {
+		return ErrServiceNameTooLong
+	}
+
+	if err := c.validateServiceAliases(maxServiceNameLength); err != nil {
+		return err
+	}
+
+	if err := c.validateTransports(); err != nil {
+		return err
+	}
+
+	if err := c.validateFeatures(); err != nil {
+		return err
+	}
+
+	if c.DeduplicationWindow > 0 && c.IdempotencyCacheSize > 0 {
+		return ErrDeduplicationWithIdempotency
+	}
+
+	if c.Weight < 0 {
+		return ErrInvalidWeight
+	}
+
+	if c.LogSampleRate < 0 {
+		return ErrInvalidLogSampleRate
+	}
+
+	if c.SocketLinger < 0 {
+		return ErrInvalidSocketLinger
+	}
+
+	if c.MaxReplyFrames < 0 {
+		return ErrInvalidMaxReplyFrames
+	}
+
+	if c.RequestQueue > 0 && c.Action != nil {
+		return ErrActionWithRequestQueue
+	}
+
+	if _, ok := batchActionOf(c.Action); c.BatchMaxSize > 0 && !ok {
+		return ErrBatchingUnsupported
+	}
+
+	if !c.EnvelopeLayout.orStandard().valid() {
+		return ErrInvalidEnvelopeLayout
+	}
+
+	return c.validateTiming()
 }
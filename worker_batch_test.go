@@ -0,0 +1,149 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerBatchTestSuite struct {
+	suite.Suite
+
+	ctx *zmq4.Context
+
+	brokerAddress, serviceName           string
+	heartbeatInMillis, reconnectInMillis int
+	pollInterval, heartbeatLiveness      int
+
+	logger *testLogger
+}
+
+func (s *WorkerBatchTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+
+	s.brokerAddress = "inproc://test-worker"
+	s.serviceName = "test-service"
+	s.heartbeatInMillis = 500
+	s.reconnectInMillis = 50
+	s.pollInterval = 250
+	s.heartbeatLiveness = 10
+
+	s.logger = new(testLogger)
+}
+
+func (s *WorkerBatchTestSuite) TearDownTest() {
+	s.ctx.Term()
+}
+
+func (s *WorkerBatchTestSuite) createWorker(action WorkerAction, maxSize int, maxWait time.Duration) *mdWorker {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		BatchMaxSize:         maxSize,
+		BatchMaxWait:         maxWait,
+	}
+
+	w, err := newWorker(s.ctx, s.logger, config)
+	if err != nil {
+		panic(err)
+	}
+
+	return w
+}
+
+func (s *WorkerBatchTestSuite) Test_Batch_DispatchedWhenFull() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := &batchWorkerAction{}
+	worker := s.createWorker(action, 2, time.Hour)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client-1"), []byte(""), []byte("one"))
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client-2"), []byte(""), []byte("two"))
+
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("batched-two")}, msg)
+
+	if s.Equal(1, len(action.batches)) {
+		s.Equal(2, len(action.batches[0]))
+	}
+	s.Equal(0, worker.QueueDepth())
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte("client-1"), workerMsg[4])
+	s.Equal([][]byte{[]byte("batched-one")}, workerMsg[6:])
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte("client-2"), workerMsg[4])
+	s.Equal([][]byte{[]byte("batched-two")}, workerMsg[6:])
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerBatchTestSuite) Test_Batch_DispatchedAfterMaxWait() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := &batchWorkerAction{}
+	worker := s.createWorker(action, 10, 50*time.Millisecond)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client-1"), []byte(""), []byte("one"))
+
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("batched-one")}, msg)
+
+	if s.Equal(1, len(action.batches)) {
+		s.Equal(1, len(action.batches[0]))
+	}
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte("client-1"), workerMsg[4])
+	s.Equal([][]byte{[]byte("batched-one")}, workerMsg[6:])
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerBatchTestSuite) Test_Batch_RequiresBatchAction() {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               defaultWorkerAction{},
+		BatchMaxSize:         2,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrBatchingUnsupported, err)
+
+	worker.cleanup()
+}
+
+func TestWorkerBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerBatchTestSuite))
+}
@@ -0,0 +1,343 @@
+package majordomo_worker
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerConcurrencyTestSuite struct {
+	suite.Suite
+
+	ctx *zmq4.Context
+
+	brokerAddress, serviceName           string
+	heartbeatInMillis, reconnectInMillis int
+	pollInterval, heartbeatLiveness      int
+
+	logger *testLogger
+}
+
+func (s *WorkerConcurrencyTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+
+	s.brokerAddress = "inproc://test-worker"
+	s.serviceName = "test-service"
+	s.heartbeatInMillis = 500
+	s.reconnectInMillis = 50
+	s.pollInterval = 250
+	s.heartbeatLiveness = 10
+
+	s.logger = new(testLogger)
+}
+
+func (s *WorkerConcurrencyTestSuite) TearDownTest() {
+	s.ctx.Term()
+}
+
+func (s *WorkerConcurrencyTestSuite) createWorker(action WorkerAction, maxConcurrent int) *mdWorker {
+	config := WorkerConfig{
+		BrokerAddress:         s.brokerAddress,
+		ServiceName:           s.serviceName,
+		HeartbeatInMillis:     time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:     time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:       time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:  s.heartbeatLiveness,
+		Action:                action,
+		MaxConcurrentRequests: maxConcurrent,
+	}
+
+	w, err := newWorker(s.ctx, s.logger, config)
+	if err != nil {
+		panic(err)
+	}
+
+	return w
+}
+
+// Counts how many calls are running at once, each call takes a while so a burst of requests overlaps
+func concurrencyTrackingAction(running, maxRunning *int32) WorkerAction {
+	return funcWorkerAction{call: func(args [][]byte) [][]byte {
+		now := atomic.AddInt32(running, 1)
+		for {
+			max := atomic.LoadInt32(maxRunning)
+			if now <= max || atomic.CompareAndSwapInt32(maxRunning, max, now) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(running, -1)
+
+		return args
+	}}
+}
+
+func (s *WorkerConcurrencyTestSuite) Test_Concurrency_NeverExceedsLimit() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var running, maxRunning int32
+	worker := s.createWorker(concurrencyTrackingAction(&running, &maxRunning), 3)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	requests := 10
+	go func() {
+		for i := 0; i < requests; i++ {
+			sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+		}
+	}()
+
+	for i := 0; i < requests; i++ {
+		msg, err := worker.Receive()
+		s.NoError(err)
+		s.Equal([][]byte{[]byte("hello")}, msg)
+	}
+
+	s.True(atomic.LoadInt32(&maxRunning) <= 3, "Expected at most 3 concurrent calls, saw %d", maxRunning)
+	s.True(atomic.LoadInt32(&maxRunning) > 1, "Expected calls to overlap")
+	s.Equal(0, worker.QueueDepth())
+
+	for i := 0; i < requests; i++ {
+		workerMsg := readUntilNonHeartbeat(broker)
+		s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConcurrencyTestSuite) Test_DisconnectDrain_InFlightRequestFinishesBeforeReconnect() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	started := make(chan struct{})
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return [][]byte{[]byte("done")}
+	}}
+	worker := s.createWorker(action, 2)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	<-started
+	sendWorkerMessage(broker, MD_DISCONNECT, []byte(DisconnectDrain))
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected the in-flight request's REPLY first")
+	s.Equal([]byte("done"), workerMsg[6])
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY once drained")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConcurrencyTestSuite) Test_Concurrency_OverlappingRepliesRoutedToEachClient() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	// The first request takes longest, so the second overtakes it
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		if string(args[0]) == "slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return [][]byte{[]byte("reply to"), args[0]}
+	}}
+	worker := s.createWorker(action, 2)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go func() {
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client-1"), []byte(""), []byte("slow"))
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client-2"), []byte(""), []byte("fast"))
+	}()
+
+	for i := 0; i < 2; i++ {
+		_, err := worker.Receive()
+		s.NoError(err)
+	}
+
+	var order []string
+	replies := map[string][][]byte{}
+	for i := 0; i < 2; i++ {
+		workerMsg := readUntilNonHeartbeat(broker)
+		if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+			order = append(order, string(workerMsg[4]))
+			replies[string(workerMsg[4])] = workerMsg[6:]
+		}
+	}
+
+	s.Equal([]string{"client-2", "client-1"}, order, "Expected the fast request to be answered first")
+	s.Equal([][]byte{[]byte("reply to"), []byte("slow")}, replies["client-1"])
+	s.Equal([][]byte{[]byte("reply to"), []byte("fast")}, replies["client-2"])
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConcurrencyTestSuite) Test_Concurrency_SynchronousByDefault() {
+	var running, maxRunning int32
+	worker := s.createWorker(concurrencyTrackingAction(&running, &maxRunning), 0)
+
+	s.False(worker.concurrent())
+
+	reply, handled := worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+	s.True(handled, "Expected the request to be handled before handleMessage returns")
+	s.Equal([][]byte{[]byte("hello")}, reply)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConcurrencyTestSuite) Test_Concurrency_ShutdownWaitsForRunningActions() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var running, maxRunning int32
+	worker := s.createWorker(concurrencyTrackingAction(&running, &maxRunning), 2)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+	s.Equal(1, worker.QueueDepth())
+
+	go worker.Shutdown()
+
+	// Receive() may send the reply and return before it notices the shutdown
+	var err error
+	for err == nil {
+		_, err = worker.Receive()
+	}
+	s.IsType(GracefulShutdown(""), err)
+	s.Equal(int32(0), atomic.LoadInt32(&running))
+	s.Equal(0, worker.QueueDepth())
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected the REPLY before the worker went away")
+	s.Equal(ShutdownSummary{Dropped: 0, Drained: true}, lastEvent(worker).Summary)
+
+	broker.shutdown <- struct{}{}
+}
+
+func (s *WorkerConcurrencyTestSuite) Test_Concurrency_ShutdownReportsAbandonedRequest() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		<-release
+		return args
+	}}
+
+	worker := s.createWorker(action, 2)
+	worker.shutdownTimeout = 50 * time.Millisecond
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+
+	go worker.Shutdown()
+	_, err := worker.Receive()
+	s.IsType(GracefulShutdown(""), err)
+
+	event := lastEvent(worker)
+	s.Equal(EventShutDown, event.Type)
+	s.Equal(ShutdownSummary{Dropped: 1, Drained: false}, event.Summary)
+
+	broker.shutdown <- struct{}{}
+}
+
+// Reads every buffered event, returning the last one
+func lastEvent(worker *mdWorker) WorkerEvent {
+	var event WorkerEvent
+	for len(worker.Events()) > 0 {
+		event = <-worker.Events()
+	}
+
+	return event
+}
+
+func TestWorkerConcurrencyTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerConcurrencyTestSuite))
+}
+
+func (s *WorkerConcurrencyTestSuite) Test_RequestQueue_RepliesRoutedToRequester() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		RequestQueue:         2,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go func() {
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client-1"), []byte(""), []byte("first"))
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client-2"), []byte(""), []byte("second"))
+	}()
+
+	// Both requests are pulled before either is answered, then they are answered the other way round
+	go func() {
+		first := <-worker.Requests()
+		second := <-worker.Requests()
+
+		second.Reply([][]byte{[]byte("reply to"), second.Request[0]})
+		first.Reply([][]byte{[]byte("reply to"), first.Request[0]})
+	}()
+
+	for i := 0; i < 2; i++ {
+		_, err := worker.Receive()
+		s.NoError(err)
+	}
+
+	replies := map[string][][]byte{}
+	for i := 0; i < 2; i++ {
+		workerMsg := readUntilNonHeartbeat(broker)
+		if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+			replies[string(workerMsg[4])] = workerMsg[6:]
+		}
+	}
+
+	s.Equal([][]byte{[]byte("reply to"), []byte("first")}, replies["client-1"])
+	s.Equal([][]byte{[]byte("reply to"), []byte("second")}, replies["client-2"])
+	s.Equal(0, worker.QueueDepth())
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
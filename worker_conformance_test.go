@@ -0,0 +1,166 @@
+package majordomo_worker
+
+import (
+	"testing"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/suite"
+)
+
+// Drives a worker through each MDP/Worker (MDPW01) exchange against the test broker and checks every frame the
+// worker sends against the spec, https://rfc.zeromq.org/spec/7/. Run it on its own to validate framing changes:
+//
+//	go test -run TestWorkerConformanceTestSuite
+type WorkerConformanceTestSuite struct {
+	suite.Suite
+
+	ctx *zmq4.Context
+
+	brokerAddress, serviceName           string
+	heartbeatInMillis, reconnectInMillis int
+	pollInterval, heartbeatLiveness      int
+
+	logger *testLogger
+}
+
+func (s *WorkerConformanceTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+
+	s.brokerAddress = "inproc://test-worker"
+	s.serviceName = "test-service"
+	s.heartbeatInMillis = 50
+	s.reconnectInMillis = 50
+	s.pollInterval = 10
+	s.heartbeatLiveness = 20
+
+	s.logger = new(testLogger)
+}
+
+func (s *WorkerConformanceTestSuite) TearDownTest() {
+	s.ctx.Term()
+}
+
+func (s *WorkerConformanceTestSuite) createWorker() *mdWorker {
+	return createWorker(
+		s.ctx,
+		s.brokerAddress,
+		s.serviceName,
+		s.heartbeatInMillis,
+		s.reconnectInMillis,
+		s.pollInterval,
+		s.heartbeatLiveness,
+		defaultWorkerAction{},
+		s.logger,
+	)
+}
+
+// Every message from a worker is the broker's routing frame, an empty frame, the protocol header and the command,
+// followed by exactly the frames the command carries
+func (s *WorkerConformanceTestSuite) assertWorkerMessage(msg [][]byte, command string, frames ...[]byte) {
+	if !s.Len(msg, 4+len(frames), "Expected %s with %d frames after the command", commandName(command), len(frames)) {
+		return
+	}
+
+	s.NotEmpty(msg[0], "Expected the worker's identity")
+	s.Empty(msg[1], "Expected an empty frame")
+	s.Equal([]byte(MD_WORKER), msg[2], "Expected the protocol header")
+	s.Equal(commandName(command), commandName(string(msg[3])))
+
+	for i, frame := range frames {
+		s.Equal(frame, msg[4+i], "Frame %d of %s", 4+i, commandName(command))
+	}
+}
+
+func (s *WorkerConformanceTestSuite) readFromWorker(broker testBroker) [][]byte {
+	broker.performReceive <- struct{}{}
+	return <-broker.receivedFromWorker
+}
+
+func (s *WorkerConformanceTestSuite) Test_Conformance_ReadyNamesService() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker()
+
+	s.assertWorkerMessage(s.readFromWorker(broker), MD_READY, []byte(s.serviceName))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConformanceTestSuite) Test_Conformance_HeartbeatHasNoFrames() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker()
+	s.readFromWorker(broker)
+
+	go worker.Receive()
+
+	// The broker stays quiet, so the worker's next message is a heartbeat well before its liveness runs out
+	s.assertWorkerMessage(s.readFromWorker(broker), MD_HEARTBEAT)
+
+	broker.shutdown <- struct{}{}
+	worker.Shutdown()
+}
+
+func (s *WorkerConformanceTestSuite) Test_Conformance_ReplyAddressedToClient() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker()
+	s.readFromWorker(broker)
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("frame-1"), []byte(""), []byte("frame-3"))
+	_, err := worker.Receive()
+	s.NoError(err)
+
+	// The client's address and an empty frame, then the body frame for frame, empty ones included
+	s.assertWorkerMessage(readUntilNonHeartbeat(broker), MD_REPLY,
+		[]byte("client"), []byte(""), []byte("frame-1"), []byte(""), []byte("frame-3"))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConformanceTestSuite) Test_Conformance_BrokerDisconnectRegistersAgain() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker()
+	ready := s.readFromWorker(broker)
+
+	sendWorkerMessage(broker, MD_DISCONNECT)
+	go worker.Receive()
+
+	// A worker the broker disconnected reconnects on a fresh socket and starts over with READY
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.assertWorkerMessage(workerMsg, MD_READY, []byte(s.serviceName))
+	s.NotEqual(ready[0], workerMsg[0], "Expected a new socket identity")
+
+	broker.shutdown <- struct{}{}
+	worker.Shutdown()
+}
+
+func (s *WorkerConformanceTestSuite) Test_Conformance_ShutdownDisconnectsFromBroker() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker()
+	s.readFromWorker(broker)
+
+	go worker.Receive()
+	worker.Shutdown()
+
+	s.assertWorkerMessage(readUntilNonHeartbeat(broker), MD_DISCONNECT)
+
+	broker.shutdown <- struct{}{}
+}
+
+func TestWorkerConformanceTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerConformanceTestSuite))
+}
@@ -1,7 +1,10 @@
 package majordomo_worker
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -89,15 +92,15 @@ func (s *WorkerConnectTestSuite) Test_Create_LogsConnectionAndReady() {
 
 	if s.NotEmpty(s.logger.debugs) {
 		s.Equal(
-			map[string]interface{}{"message": fmt.Sprintf("Attempting connection to broker at '%s'", s.brokerAddress)},
+			map[string]interface{}{"worker": worker.name, "message": fmt.Sprintf("Attempting connection to broker at '%s'", s.brokerAddress)},
 			s.logger.debugs[0],
 		)
 		s.Equal(
-			map[string]interface{}{"message": fmt.Sprintf("Sent command '%s' to broker with message '%q'", MD_READY, [][]byte{})},
+			map[string]interface{}{"worker": worker.name, "message": fmt.Sprintf("Sent command 'READY' to broker with message '%q'", [][]byte{})},
 			s.logger.debugs[1],
 		)
 		s.Equal(
-			map[string]interface{}{"message": fmt.Sprintf("Connected successfully to broker at '%s'", s.brokerAddress)},
+			map[string]interface{}{"worker": worker.name, "message": fmt.Sprintf("Connected successfully to broker at '%s'", s.brokerAddress)},
 			s.logger.debugs[2],
 		)
 	}
@@ -106,6 +109,35 @@ func (s *WorkerConnectTestSuite) Test_Create_LogsConnectionAndReady() {
 	worker.cleanup()
 }
 
+func (s *WorkerConnectTestSuite) Test_Create_NameTagsEveryLogLine() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		Name:                 "test-worker-1",
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+	})
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	if s.NotEmpty(s.logger.debugs) {
+		for _, line := range s.logger.debugs {
+			s.Equal("test-worker-1", line["worker"])
+		}
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
 func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfConnectionFails() {
 	config := WorkerConfig{
 		BrokerAddress:        "bad://some-bad-address",
@@ -141,6 +173,1602 @@ func (s *WorkerConnectTestSuite) Test_Create_HandlesMultipleBrokerAddresses() {
 	worker.cleanup()
 }
 
-func TestWorkerConnectTestSuite(t *testing.T) {
-	suite.Run(t, new(WorkerConnectTestSuite))
+// Every broker is active at once, each request is answered on the socket it came in on
+func (s *WorkerConnectTestSuite) Test_Receive_RepliesToTheBrokerTheRequestCameFrom() {
+	first, second := createBroker(), createBroker()
+	go first.run(s.ctx, "inproc://test-worker-1")
+	go second.run(s.ctx, "inproc://test-worker-2")
+
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return append([][]byte{[]byte("echo")}, args...)
+	}}
+
+	config := WorkerConfig{
+		BrokerAddress:        "inproc://test-worker-1,inproc://test-worker-2",
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Minute,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// Registered with both
+	for _, broker := range []testBroker{first, second} {
+		broker.performReceive <- struct{}{}
+		workerMsg := <-broker.receivedFromWorker
+		s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY")
+	}
+
+	sendWorkerMessage(second, MD_REQUEST, []byte("client-2"), []byte(""), []byte("two"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	sendWorkerMessage(first, MD_REQUEST, []byte("client-1"), []byte(""), []byte("one"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	workerMsg := readUntilNonHeartbeat(second)
+	s.Equal([]byte("client-2"), workerMsg[4])
+	s.Equal([][]byte{[]byte("echo"), []byte("two")}, workerMsg[6:])
+
+	workerMsg = readUntilNonHeartbeat(first)
+	s.Equal([]byte("client-1"), workerMsg[4])
+	s.Equal([][]byte{[]byte("echo"), []byte("one")}, workerMsg[6:])
+
+	first.shutdown <- struct{}{}
+	second.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Stats_InitialConnectsNotCountedAsReconnects() {
+	config := WorkerConfig{
+		BrokerAddress:        "inproc://test-worker,inproc://test-worker",
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	stats := worker.Stats()
+	s.Equal(uint64(2), stats.Connects)
+	s.Equal(uint64(0), stats.Reconnects)
+
+	worker.reconnectToBroker(worker.sockets[0], 0)
+
+	stats = worker.Stats()
+	s.Equal(uint64(2), stats.Connects)
+	s.Equal(uint64(1), stats.Reconnects)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Registry_TracksWorkersUntilClosed() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	info, found := findWorker(worker.name)
+	if s.True(found, "Expected the worker to be registered") {
+		s.Equal(s.serviceName, info.ServiceName)
+		s.Equal(WorkerRunning, info.State)
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+
+	_, found = findWorker(worker.name)
+	s.False(found, "Expected the worker to be gone once closed")
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_SocketConfiguratorRunsOnEveryConnect() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	configured := make(chan *zmq4.Socket, 5)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		SocketConfigurator: func(socket *zmq4.Socket) error {
+			configured <- socket
+			return nil
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+	s.Equal(1, len(configured))
+
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	// A DISCONNECT forces the worker to reconnect which must configure the new socket
+	sendWorkerMessage(broker, MD_DISCONNECT)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	s.Equal(2, len(configured))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_OnDisconnect_CalledOncePerDisconnect() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	disconnects := make(chan string, 2)
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		OnDisconnect: func(address string) {
+			disconnects <- address
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	sendWorkerMessage(broker, MD_DISCONNECT)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	select {
+	case address := <-disconnects:
+		s.Equal(s.brokerAddress, address)
+	case <-time.After(time.Second):
+		s.Fail("Expected OnDisconnect to be called")
+	}
+
+	select {
+	case <-disconnects:
+		s.Fail("Expected OnDisconnect to be called only once")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_TCPKeepaliveSetOnTcpSocket() {
+	config := WorkerConfig{
+		BrokerAddress:        "tcp://127.0.0.1:5999",
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		TCPKeepalive:         true,
+		TCPKeepaliveIdle:     60 * time.Second,
+		TCPKeepaliveInterval: 10 * time.Second,
+		TCPKeepaliveCount:    5,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	assertKeepalive := func(socket *zmq4.Socket) {
+		keepalive, _ := socket.GetTcpKeepalive()
+		s.Equal(1, keepalive)
+		idle, _ := socket.GetTcpKeepaliveIdle()
+		s.Equal(60, idle)
+		interval, _ := socket.GetTcpKeepaliveIntvl()
+		s.Equal(10, interval)
+		count, _ := socket.GetTcpKeepaliveCnt()
+		s.Equal(5, count)
+	}
+
+	assertKeepalive(worker.sockets[0].socket)
+
+	// Reconnecting creates a new socket, which must get the same options
+	worker.reconnectToBroker(worker.sockets[0], 0)
+	assertKeepalive(worker.sockets[0].socket)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_TCPKeepaliveSkippedForOtherTransports() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		TCPKeepalive:         true,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	keepalive, _ := worker.sockets[0].socket.GetTcpKeepalive()
+	s.Equal(-1, keepalive, "Expected the default for an inproc socket")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ConnectHookRunsLastBeforeEveryConnect() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var calls []string
+	identities := make(chan string, 5)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		Identity:             "hooked-worker",
+		SocketConfigurator: func(socket *zmq4.Socket) error {
+			calls = append(calls, "configurator")
+			return nil
+		},
+		ConnectHook: func(socket *zmq4.Socket) error {
+			calls = append(calls, "hook")
+			identity, _ := socket.GetIdentity()
+			identities <- identity
+			return nil
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+	s.Equal([]string{"configurator", "hook"}, calls)
+	s.Equal("hooked-worker", <-identities, "Expected the other options to be applied before the hook")
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY once the hooked socket connected")
+
+	go worker.Receive()
+
+	sendWorkerMessage(broker, MD_DISCONNECT)
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	s.Equal([]string{"configurator", "hook", "configurator", "hook"}, calls)
+	s.Equal("hooked-worker", <-identities)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfConnectHookFails() {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		ConnectHook: func(socket *zmq4.Socket) error {
+			return errors.New("monitor unavailable")
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrBrokerUnreachable, err)
+	s.NotEmpty(s.logger.errors)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfSocketConfiguratorFails() {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		SocketConfigurator: func(socket *zmq4.Socket) error {
+			return errors.New("bad option")
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrBrokerUnreachable, err)
+	s.NotEmpty(s.logger.errors)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_RetriesInitialConnect() {
+	attempts := 0
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		ConnectRetries:       3,
+		ConnectRetryDelay:    time.Duration(1) * time.Millisecond,
+		SocketConfigurator: func(socket *zmq4.Socket) error {
+			// The 'broker' only becomes available on the third attempt
+			if attempts++; attempts < 3 {
+				return errors.New("broker not up yet")
+			}
+			return nil
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+	s.Equal(3, attempts)
+	s.Equal(1, len(worker.sockets))
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnsBrokerUnreachableWhenRetriesExhausted() {
+	attempts := 0
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		ConnectRetries:       2,
+		SocketConfigurator: func(socket *zmq4.Socket) error {
+			attempts++
+			return errors.New("broker never comes up")
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrBrokerUnreachable, err)
+	s.Equal(3, attempts)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfServiceNameEmpty() {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          "",
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrEmptyServiceName, err)
+	s.Empty(worker.sockets)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfOnlyPrefixGiven() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          "",
+		ServiceNamePrefix:    "teamA/",
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+	}
+
+	// The prefix alone would register a service nobody asked for
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrEmptyServiceName, err)
+	s.Empty(worker.sockets, "Expected no connection to the broker")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) probedConfig(probe func() error, timeout time.Duration) WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		StartupProbe:         probe,
+		StartupProbeInterval: time.Millisecond,
+		StartupProbeTimeout:  timeout,
+	}
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReadyOnceStartupProbePasses() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := 0
+	worker, err := newWorker(s.ctx, s.logger, s.probedConfig(flakyProbe(2, &calls), 0))
+	s.NoError(err)
+	s.Equal(3, calls)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfStartupProbeNeverPasses() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := 0
+	worker, err := newWorker(s.ctx, s.logger, s.probedConfig(flakyProbe(100, &calls), 10*time.Millisecond))
+	s.Equal(ErrStartupProbeTimeout, err)
+	s.Empty(worker.sockets, "Expected no connection to the broker")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Reconnect_SkippedWhileStartupProbeFails() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	failing := false
+	probe := func() error {
+		if failing {
+			return errors.New("Database unreachable")
+		}
+		return nil
+	}
+	worker, err := newWorker(s.ctx, s.logger, s.probedConfig(probe, 10*time.Millisecond))
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	failing = true
+	worker.reconnectToBroker(worker.sockets[0], 0)
+	s.Equal(uint64(0), worker.Stats().Reconnects, "Expected no READY while the probe fails")
+
+	failing = false
+	worker.reconnectToBroker(worker.sockets[0], 0)
+	s.Equal(uint64(1), worker.Stats().Reconnects)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfPrefixedServiceNameTooLong() {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          "service",
+		ServiceNamePrefix:    "team/",
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		MaxServiceNameLength: 10,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrServiceNameTooLong, err)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfServiceNameTooLong() {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          "service-name-too-long",
+		HeartbeatInMillis:    time.Duration(1) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1) * time.Millisecond,
+		PollingInterval:      time.Duration(1) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		MaxServiceNameLength: 10,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrServiceNameTooLong, err)
+	s.Empty(worker.sockets)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_UnicodeServiceNameRoundTripsInReady() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	s.serviceName = "サービス-ß-✓"
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	broker.performReceive <- struct{}{}
+
+	workerMsg := <-broker.receivedFromWorker
+	if s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY") {
+		s.Equal(s.serviceName, string(workerMsg[4]))
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Reconnect_CircuitBreakerTripsAndRecovers() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	clock := newFakeClock()
+
+	config := WorkerConfig{
+		BrokerAddress:                        s.brokerAddress,
+		ServiceName:                          s.serviceName,
+		HeartbeatInMillis:                    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:                    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:                      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:                 1000,
+		Action:                               s.defaultAction,
+		Clock:                                clock,
+		ReconnectCircuitBreakerMaxReconnects: 2,
+		ReconnectCircuitBreakerWindow:        time.Minute,
+		ReconnectCircuitBreakerCooldown:      time.Hour,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	// The first two DISCONNECTs are honoured
+	for i := 0; i < 2; i++ {
+		sendWorkerMessage(broker, MD_DISCONNECT)
+		workerMsg := readUntilNonHeartbeat(broker)
+		s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	}
+
+	// The third one trips the breaker
+	sendWorkerMessage(broker, MD_DISCONNECT)
+
+	timeout := time.After(5 * time.Second)
+	for worker.Stats().Healthy {
+		select {
+		case <-timeout:
+			s.FailNow("Circuit breaker never tripped")
+		default:
+			time.Sleep(time.Duration(s.pollInterval) * time.Millisecond)
+		}
+	}
+	s.Equal(uint64(2), worker.Stats().Reconnects)
+
+	// Once the cooldown passes we are healthy and reconnect again
+	clock.Advance(time.Hour)
+	s.True(worker.Stats().Healthy)
+
+	sendWorkerMessage(broker, MD_DISCONNECT)
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after cooldown")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Ready_IncludesMetadataOnEveryConnect() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ReadyMetadata:        map[string]string{"version": "1.2.3", "region": "eu-west"},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	expectedMetadata := [][]byte{[]byte("region=eu-west"), []byte("version=1.2.3")}
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	if s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY") {
+		s.Equal([]byte(s.serviceName), workerMsg[4])
+		s.Equal(expectedMetadata, workerMsg[5:])
+	}
+
+	go worker.Receive()
+
+	sendWorkerMessage(broker, MD_DISCONNECT)
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect") {
+		s.Equal([]byte(s.serviceName), workerMsg[4])
+		s.Equal(expectedMetadata, workerMsg[5:])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) readyWithWeight(weight int) [][]byte {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		Weight:               weight,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+
+	return workerMsg
+}
+
+func (s *WorkerConnectTestSuite) Test_Ready_IncludesWeight() {
+	workerMsg := s.readyWithWeight(2)
+
+	s.Equal([]byte(s.serviceName), workerMsg[4])
+	s.Equal([][]byte{[]byte("weight=2")}, workerMsg[5:])
+}
+
+func (s *WorkerConnectTestSuite) Test_Ready_NoWeightUnlessSet() {
+	workerMsg := s.readyWithWeight(0)
+
+	s.Len(workerMsg, 5, "Expected nothing after the service name")
+}
+
+func (s *WorkerConnectTestSuite) confirmationConfig() WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:              s.brokerAddress,
+		ServiceName:                s.serviceName,
+		HeartbeatInMillis:          time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:          time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:            time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:       s.heartbeatLiveness,
+		Action:                     s.defaultAction,
+		ConnectConfirmationTimeout: time.Duration(50) * time.Millisecond,
+	}
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ReturnErrorIfConnectionNotConfirmed() {
+	// Nothing is bound to the address so READY goes nowhere
+	worker, err := newWorker(s.ctx, s.logger, s.confirmationConfig())
+	s.Equal(ErrBrokerUnconfirmed, err)
+	s.Empty(worker.sockets)
+
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_ConnectionConfirmedByBrokerHeartbeat() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	go func() {
+		broker.performReceive <- struct{}{}
+		<-broker.receivedFromWorker
+		sendWorkerMessage(broker, MD_HEARTBEAT)
+	}()
+
+	config := s.confirmationConfig()
+	config.ConnectConfirmationTimeout = time.Second
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+	s.Equal(1, len(worker.sockets))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Create_RetriesUntilLateBrokerConfirms() {
+	config := s.confirmationConfig()
+	config.ConnectRetries = 10
+	config.ConnectRetryDelay = time.Duration(10) * time.Millisecond
+
+	broker := createBroker()
+	go func() {
+		// Comes up after the first attempt has gone unconfirmed
+		time.Sleep(100 * time.Millisecond)
+		go broker.run(s.ctx, s.brokerAddress)
+
+		broker.performReceive <- struct{}{}
+		<-broker.receivedFromWorker
+		sendWorkerMessage(broker, MD_HEARTBEAT)
+	}()
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+	s.Equal(1, len(worker.sockets))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) createResendingWorker(action WorkerAction) *mdWorker {
+	config := WorkerConfig{
+		BrokerAddress:          s.brokerAddress,
+		ServiceName:            s.serviceName,
+		HeartbeatInMillis:      time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:      time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:        time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:   s.heartbeatLiveness,
+		Action:                 action,
+		ResendReplyOnReconnect: true,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	return worker
+}
+
+func (s *WorkerConnectTestSuite) Test_Reconnect_ResendsUnconfirmedReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createResendingWorker(s.defaultAction)
+	workerSocket := worker.sockets[0]
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+
+	// The broker goes away before we hear from it again, so the reply may never have reached a client
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)})
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected resent REPLY") {
+		s.Equal([]byte("client"), workerMsg[4])
+		s.Equal([][]byte{[]byte("hello")}, workerMsg[6:])
+	}
+
+	// Only ever resent once
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)})
+	worker.sendToBroker(workerSocket.socket, MD_HEARTBEAT, nil, [][]byte{[]byte("marker")})
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	broker.performReceive <- struct{}{}
+	workerMsg = <-broker.receivedFromWorker
+	s.Equal([][]byte{[]byte(MD_HEARTBEAT), []byte("marker")}, workerMsg[3:], "Expected no REPLY")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Reconnect_DoesNotResendConfirmedReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createResendingWorker(s.defaultAction)
+	workerSocket := worker.sockets[0]
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+
+	// Hearing from the broker after the reply means the connection was still up
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)})
+	worker.sendToBroker(workerSocket.socket, MD_HEARTBEAT, nil, [][]byte{[]byte("marker")})
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	broker.performReceive <- struct{}{}
+	workerMsg = <-broker.receivedFromWorker
+	s.Equal([][]byte{[]byte(MD_HEARTBEAT), []byte("marker")}, workerMsg[3:], "Expected no REPLY")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Reconnect_ResendsRequesterReplyNotRoutedOnes() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	routed := []RoutedReply{{ReplyTo: []byte("other-client"), Reply: [][]byte{[]byte("routed")}}}
+	worker := s.createResendingWorker(routedWorkerAction{routed})
+	workerSocket := worker.sockets[0]
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte("client"), workerMsg[4], "Expected the requester's REPLY")
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte("other-client"), workerMsg[4], "Expected the routed REPLY")
+
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)})
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected resent REPLY") {
+		s.Equal([]byte("client"), workerMsg[4])
+		s.Equal([][]byte{[]byte("hello")}, workerMsg[6:])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+// Sorts times earliest first
+type byTime []time.Time
+
+func (t byTime) Len() int           { return len(t) }
+func (t byTime) Less(i, j int) bool { return t[i].Before(t[j]) }
+func (t byTime) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+func (s *WorkerConnectTestSuite) Test_Reconnect_SharedLimiterSpreadsReconnects() {
+	limiter := &intervalLimiter{interval: 50 * time.Millisecond}
+
+	var mutex sync.Mutex
+	var connectedAt []time.Time
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ReconnectLimiter:     limiter,
+		SocketConfigurator: func(socket *zmq4.Socket) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			connectedAt = append(connectedAt, time.Now())
+			return nil
+		},
+	}
+
+	var workers []*mdWorker
+	for i := 0; i < 3; i++ {
+		worker, err := newWorker(s.ctx, s.logger, config)
+		s.NoError(err)
+		workers = append(workers, worker)
+	}
+
+	// The initial connects aren't limited
+	connectedAt = nil
+
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker *mdWorker) {
+			defer wg.Done()
+			worker.reconnectToBroker(worker.sockets[0], 0)
+		}(worker)
+	}
+	wg.Wait()
+
+	if s.Equal(3, len(connectedAt)) {
+		sort.Sort(byTime(connectedAt))
+
+		for i := 1; i < len(connectedAt); i++ {
+			s.True(connectedAt[i].Sub(connectedAt[i-1]) >= 40*time.Millisecond, "Reconnects should be spread out")
+		}
+	}
+
+	// The workers share the suite's context, which is terminated in TearDownTest
+	for _, worker := range workers {
+		worker.closeSockets()
+	}
+}
+
+func (s *WorkerConnectTestSuite) Test_Reconnect_ShutdownCancelsLimiterWait() {
+	limiter := blockingLimiter{waiting: make(chan struct{})}
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ReconnectLimiter:     limiter,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	reconnected := make(chan error, 1)
+	go func() {
+		reconnected <- worker.reconnectToBroker(worker.sockets[0], 0)
+	}()
+
+	<-limiter.waiting
+	worker.Shutdown()
+
+	select {
+	case err := <-reconnected:
+		s.Equal(GracefulShutdown("Graceful Shutdown"), err)
+	case <-time.After(time.Second):
+		s.Fail("Expected Shutdown() to cancel waiting on the limiter")
+	}
+	s.Empty(s.logger.errors, "Expected the cancelled wait not to be logged as a refusal")
+
+	worker.closeSockets()
+}
+
+func (s *WorkerConnectTestSuite) Test_ForceReconnect_RegistersAgainWithNewIdentity() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY")
+	identity := workerMsg[0]
+
+	go worker.Receive()
+	worker.ForceReconnect()
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after forced reconnect") {
+		s.NotEqual(identity, workerMsg[0], "Expected a new socket identity")
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_ForceReconnect_StartsNewConnectionID() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	connectionID := worker.Stats().ConnectionID
+	s.NotEmpty(connectionID)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+	worker.ForceReconnect()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after forced reconnect")
+	s.NotEqual(connectionID, worker.Stats().ConnectionID, "Expected a new connection ID")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_SendHeartbeat_SentStraightAway() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	// Heartbeats are nowhere near due
+	worker := s.createWorker(60000, s.reconnectInMillis, s.defaultAction)
+	workerSocket := worker.sockets[0]
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	heartbeatAt := workerSocket.heartbeatAt
+	time.Sleep(5 * time.Millisecond)
+
+	s.NoError(worker.sendHeartbeatsNow())
+	s.True(workerSocket.heartbeatAt.After(heartbeatAt), "Expected the heartbeat interval to restart")
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_HEARTBEAT), workerMsg[3], "Expected HEARTBEAT")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_SendHeartbeat_SentByReceive() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(60000, s.reconnectInMillis, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+	s.NoError(worker.SendHeartbeat())
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_HEARTBEAT), workerMsg[3], "Expected HEARTBEAT")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Reconfigure_ChangesHeartbeatLive() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	// Heartbeats are nowhere near due
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Minute,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+	}
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	config.HeartbeatInMillis = time.Duration(s.pollInterval) * time.Millisecond
+	s.NoError(worker.Reconfigure(config))
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_HEARTBEAT), workerMsg[3], "Expected HEARTBEAT at the new interval")
+
+	config.BrokerAddress = "inproc://elsewhere"
+	s.Equal(ReconfigureError{"BrokerAddress"}, worker.Reconfigure(config))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_IdentityFunc_CalledOnEveryReconnect() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := 0
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		IdentityFunc: func() ([]byte, error) {
+			calls++
+			return []byte(fmt.Sprintf("lease-%d", calls)), nil
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte("lease-1"), workerMsg[0])
+
+	for i := 2; i <= 3; i++ {
+		worker.reconnectToBroker(worker.sockets[0], 0)
+
+		workerMsg = readUntilNonHeartbeat(broker)
+		if s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect") {
+			s.Equal([]byte(fmt.Sprintf("lease-%d", i)), workerMsg[0])
+		}
+	}
+	s.Equal(3, calls)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Identity_StaticUsedWhenIdentityFuncFails() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		Identity:             "static-worker",
+		IdentityFunc: func() ([]byte, error) {
+			return nil, errors.New("lease unavailable")
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte("static-worker"), workerMsg[0])
+	s.NotEmpty(s.logger.errors)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Liveness_DrainedLivenessReconnects() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	s.Equal(s.heartbeatLiveness, worker.Liveness())
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.decrementLiveness(s.heartbeatLiveness)
+
+	go worker.Receive()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_DrainAndReconnect_FinishesRequestAndReconnects() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowAction := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		close(started)
+		<-release
+		return args
+	}}
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, slowAction)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	identity := workerMsg[0]
+
+	go func() {
+		for {
+			if _, err := worker.Receive(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	<-started
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- worker.DrainAndReconnect(5 * time.Second)
+	}()
+
+	close(release)
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected the in-flight request to be replied to") {
+		s.Equal([][]byte{[]byte("hello")}, workerMsg[6:])
+	}
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT")
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect") {
+		s.NotEqual(identity, workerMsg[0], "Expected a new socket identity")
+	}
+
+	s.NoError(<-drained)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_DrainAndReconnect_ReturnsReconnectError() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	configErr := errors.New("bad option")
+	connects := 0
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		SocketConfigurator: func(socket *zmq4.Socket) error {
+			// Only the first connect succeeds, so the reconnect after draining fails
+			connects++
+			if connects > 1 {
+				return configErr
+			}
+			return nil
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go func() {
+		for {
+			if _, err := worker.Receive(); err != nil {
+				return
+			}
+		}
+	}()
+
+	s.Equal(configErr, worker.DrainAndReconnect(5*time.Second))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+// Over tcp, unlike inproc, the DISCONNECT is still queued when the old socket closes straight after sending it
+func (s *WorkerConnectTestSuite) Test_DrainAndReconnect_SendsDisconnectOverTcpWithoutSocketLinger() {
+	address := "tcp://127.0.0.1:5992"
+
+	broker := createBroker()
+	go broker.run(s.ctx, address)
+
+	worker := createWorker(s.ctx, address, s.serviceName, s.heartbeatInMillis, s.reconnectInMillis, s.pollInterval,
+		s.heartbeatLiveness, s.defaultAction, s.logger)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go func() {
+		for {
+			if _, err := worker.Receive(); err != nil {
+				return
+			}
+		}
+	}()
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- worker.DrainAndReconnect(5 * time.Second)
+	}()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT")
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	s.NoError(<-drained)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_DrainAndReconnect_TimesOutWithoutReceive() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	s.Equal(ErrDrainTimeout, worker.DrainAndReconnect(10*time.Millisecond))
+
+	worker.cleanup()
+}
+
+func TestWorkerConnectTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerConnectTestSuite))
+}
+
+func (s *WorkerConnectTestSuite) bindConfig(address string) WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:        address,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		Bind:                 true,
+	}
+}
+
+func (s *WorkerConnectTestSuite) Test_Bind_BrokerConnectsToWorker() {
+	broker := createBroker()
+	go broker.connect(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, s.bindConfig(s.brokerAddress))
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY")
+
+	go worker.Receive()
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+	s.Equal([]byte("hello"), workerMsg[6])
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Bind_ReconnectBindsAddressAgain() {
+	address := "tcp://127.0.0.1:5998"
+
+	broker := createBroker()
+	go broker.connect(s.ctx, address)
+
+	worker, err := newWorker(s.ctx, s.logger, s.bindConfig(address))
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY")
+
+	// The new socket can only bind once the old one has released the address, the broker then connects again
+	worker.reconnectToBroker(worker.sockets[0], 0)
+
+	broker.performReceive <- struct{}{}
+	workerMsg = <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	s.Equal(uint64(1), worker.Stats().Reconnects)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_SocketMonitoring_EmitsSocketConnected() {
+	address := "tcp://127.0.0.1:5997"
+
+	broker := createBroker()
+	go broker.run(s.ctx, address)
+
+	config := WorkerConfig{
+		BrokerAddress:        address,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		SocketMonitoring:     true,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	s.True(waitForEvent(worker, EventSocketConnected), "Expected the socket's connect to be observed")
+
+	// The replacement socket gets a monitor of its own
+	worker.reconnectToBroker(worker.sockets[0], 0)
+
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	s.True(waitForEvent(worker, EventSocketConnected), "Expected the reconnect to be observed")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func waitForEvent(worker *mdWorker, eventType WorkerEventType) bool {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event := <-worker.Events():
+			if event.Type == eventType {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+func (s *WorkerConnectTestSuite) redirectConfig(follow bool) WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:             s.brokerAddress,
+		ServiceName:               s.serviceName,
+		HeartbeatInMillis:         time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:         time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:           time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:      s.heartbeatLiveness,
+		Action:                    s.defaultAction,
+		FollowDisconnectRedirects: follow,
+	}
+}
+
+func (s *WorkerConnectTestSuite) Test_Redirect_ReconnectsToNewAddress() {
+	newAddress := s.brokerAddress + "-redirected"
+
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+	newBroker := createBroker()
+	go newBroker.run(s.ctx, newAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, s.redirectConfig(true))
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT), []byte(newAddress)})
+
+	newBroker.performReceive <- struct{}{}
+	workerMsg := <-newBroker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY at the redirected address")
+	s.Equal(newAddress, worker.sockets[0].address)
+
+	broker.shutdown <- struct{}{}
+	newBroker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_DisconnectGracePeriod_OneReconnectForRepeatedDisconnects() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := s.redirectConfig(false)
+	config.DisconnectGracePeriod = time.Minute
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	for i := 0; i < 3; i++ {
+		worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)})
+	}
+
+	s.Equal(uint64(1), worker.Stats().Reconnects)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Redirect_IgnoredUnlessEnabled() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, s.redirectConfig(false))
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT), []byte("inproc://elsewhere")})
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY at the same address")
+	s.Equal(s.brokerAddress, worker.sockets[0].address)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerConnectTestSuite) Test_Redirect_InvalidAddressIgnored() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, s.redirectConfig(true))
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT), []byte("udp://10.0.0.1:5555")})
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY at the same address")
+	s.Equal(s.brokerAddress, worker.sockets[0].address)
+	s.Equal(uint64(1), worker.Stats().Errors)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
 }
@@ -0,0 +1,79 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerFactoryTestSuite struct {
+	suite.Suite
+
+	ctx    *zmq4.Context
+	logger *testLogger
+}
+
+func (s *WorkerFactoryTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+
+	s.logger = new(testLogger)
+}
+
+func (s *WorkerFactoryTestSuite) TearDownTest() {
+	s.ctx.Term()
+}
+
+func (s *WorkerFactoryTestSuite) factory() WorkerFactory {
+	return NewWorkerFactory(s.ctx, s.logger, WorkerConfig{
+		// No broker needed, inproc connects succeed before anything binds
+		BrokerAddress:        "inproc://test-factory",
+		HeartbeatInMillis:    500 * time.Millisecond,
+		ReconnectInMillis:    50 * time.Millisecond,
+		PollingInterval:      10 * time.Millisecond,
+		MaxHeartbeatLiveness: 10,
+	})
+}
+
+func (s *WorkerFactoryTestSuite) Test_Create_WorkersShareTheContext() {
+	factory := s.factory()
+
+	first, err := factory.Create("first-service", defaultWorkerAction{})
+	s.NoError(err)
+	second, err := factory.Create("second-service", errorWorkerAction{})
+	s.NoError(err)
+
+	s.True(first.Context() == s.ctx, "Expected the factory's context")
+	s.True(second.Context() == s.ctx, "Expected the factory's context")
+
+	s.Equal("first-service", first.(*mdWorker).serviceName)
+	s.Equal("second-service", second.(*mdWorker).serviceName)
+	s.IsType(errorWorkerAction{}, second.(*mdWorker).action())
+	s.Equal("second-service", second.Config().ServiceName, "Expected the config the worker was created with")
+	s.IsType(errorWorkerAction{}, second.Config().Action)
+
+	// Neither terminates the context, which TearDownTest does
+	s.NoError(first.Close())
+	s.NoError(second.Close())
+}
+
+func (s *WorkerFactoryTestSuite) Test_Create_ReturnsConfigErrors() {
+	worker, err := s.factory().Create("", defaultWorkerAction{})
+
+	s.Nil(worker)
+	s.Equal(ErrEmptyServiceName, err)
+
+	// The failed worker left the shared context alone
+	worker, err = s.factory().Create("service", defaultWorkerAction{})
+	s.NoError(err)
+	s.NoError(worker.Close())
+}
+
+func TestWorkerFactoryTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerFactoryTestSuite))
+}
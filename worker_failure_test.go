@@ -0,0 +1,402 @@
+package majordomo_worker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerFailureTestSuite struct {
+	suite.Suite
+
+	ctx *zmq4.Context
+
+	brokerAddress, serviceName           string
+	heartbeatInMillis, reconnectInMillis int
+	pollInterval, heartbeatLiveness      int
+
+	logger *testLogger
+}
+
+func (s *WorkerFailureTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+
+	s.brokerAddress = "inproc://test-worker"
+	s.serviceName = "test-service"
+	s.heartbeatInMillis = 500
+	s.reconnectInMillis = 50
+	s.pollInterval = 250
+	s.heartbeatLiveness = 10
+
+	s.logger = new(testLogger)
+}
+
+func (s *WorkerFailureTestSuite) TearDownTest() {
+	s.ctx.Term()
+}
+
+func (s *WorkerFailureTestSuite) config(action WorkerAction) WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		ErrorReply: func(err error) [][]byte {
+			return [][]byte{[]byte("ERROR"), []byte(err.Error())}
+		},
+	}
+}
+
+// Sends a single request to a new worker and returns the reply the broker received
+func (s *WorkerFailureTestSuite) request(config WorkerConfig) [][]byte {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+
+	return workerMsg[6:]
+}
+
+func (s *WorkerFailureTestSuite) Test_ErrorReply_SentWhenActionReturnsError() {
+	reply := s.request(s.config(errorWorkerAction{err: errors.New("boom")}))
+
+	s.Equal([][]byte{[]byte("ERROR"), []byte("boom")}, reply)
+}
+
+func (s *WorkerFailureTestSuite) Test_ErrorReply_DefaultsToErrorMessage() {
+	config := s.config(errorWorkerAction{err: errors.New("boom")})
+	config.ErrorReply = nil
+
+	s.Equal([][]byte{[]byte("boom")}, s.request(config))
+}
+
+func (s *WorkerFailureTestSuite) Test_ErrorReply_NotSentOnSuccess() {
+	reply := s.request(s.config(errorWorkerAction{}))
+
+	s.Equal([][]byte{[]byte("hello")}, reply)
+}
+
+func (s *WorkerFailureTestSuite) Test_PanicReply_SentWhenActionPanics() {
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		panic("boom")
+	}}
+
+	config := s.config(action)
+	config.RecoverPanics = true
+
+	// Not ErrorReply, and the panic itself isn't sent
+	s.Equal([][]byte{[]byte("Internal error")}, s.request(config))
+}
+
+func (s *WorkerFailureTestSuite) Test_PanicReply_DiffersFromErrorReply() {
+	panicking := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		panic("boom")
+	}}
+
+	config := s.config(panicking)
+	config.RecoverPanics = true
+	config.PanicReply = func(recovered interface{}) [][]byte {
+		return [][]byte{[]byte("PANIC"), []byte(fmt.Sprint(recovered))}
+	}
+	s.Equal([][]byte{[]byte("PANIC"), []byte("boom")}, s.request(config))
+
+	config.Action = errorWorkerAction{err: errors.New("no such order")}
+	s.Equal([][]byte{[]byte("ERROR"), []byte("no such order")}, s.request(config))
+}
+
+func (s *WorkerFailureTestSuite) Test_ErrorReply_SentWhenActionTimesOut() {
+	release := make(chan struct{})
+	defer close(release)
+
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		<-release
+		return args
+	}}
+
+	config := s.config(action)
+	config.ActionTimeout = 10 * time.Millisecond
+
+	s.Equal([][]byte{[]byte("ERROR"), []byte(ErrActionTimeout.Error())}, s.request(config))
+}
+
+func (s *WorkerFailureTestSuite) Test_PanicReply_SentForEveryRequestInPanickingBatch() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := s.config(panickingBatchAction{})
+	config.RecoverPanics = true
+	config.BatchMaxSize = 2
+	config.BatchMaxWait = time.Hour
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client-1"), []byte(""), []byte("one"))
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client-2"), []byte(""), []byte("two"))
+
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	expected := [][]byte{[]byte("Internal error")}
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte("client-1"), workerMsg[4])
+	s.Equal(expected, workerMsg[6:])
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte("client-2"), workerMsg[4])
+	s.Equal(expected, workerMsg[6:])
+
+	s.Equal(0, worker.QueueDepth())
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+type panickingBatchAction struct{}
+
+func (panickingBatchAction) Call(args [][]byte) [][]byte {
+	return args
+}
+
+func (panickingBatchAction) CallBatch(requests []RequestContext) [][][]byte {
+	panic("boom")
+}
+
+// Accepts bodies of exactly two frames
+func twoFrameValidator(body [][]byte) error {
+	if len(body) != 2 {
+		return fmt.Errorf("expected 2 frames, got %d", len(body))
+	}
+
+	return nil
+}
+
+func (s *WorkerFailureTestSuite) Test_RequestValidator_RejectsInvalidRequest() {
+	called := false
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		called = true
+		return args
+	}}
+
+	config := s.config(action)
+	config.RequestValidator = twoFrameValidator
+
+	// The validator only sees the single body frame, not the envelope
+	s.Equal([][]byte{[]byte("ERROR"), []byte("expected 2 frames, got 1")}, s.request(config))
+	s.False(called, "Expected the action to be skipped")
+}
+
+func (s *WorkerFailureTestSuite) Test_RequestValidator_PassesValidRequestToAction() {
+	var validated [][]byte
+
+	config := s.config(defaultWorkerAction{})
+	config.RequestValidator = func(body [][]byte) error {
+		validated = body
+		return nil
+	}
+
+	s.Equal([][]byte{[]byte("hello")}, s.request(config))
+	s.Equal([][]byte{[]byte("hello")}, validated)
+}
+
+func (s *WorkerFailureTestSuite) Test_ReplyValidator_ReplacesInvalidReply() {
+	config := s.config(defaultWorkerAction{})
+	config.ReplyValidator = twoFrameValidator
+
+	// The echoed single frame isn't what clients expect
+	s.Equal([][]byte{[]byte("ERROR"), []byte("expected 2 frames, got 1")}, s.request(config))
+	s.NotEmpty(s.logger.errors, "Expected the invalid reply to be logged")
+}
+
+func (s *WorkerFailureTestSuite) Test_ReplyValidator_PassesValidReply() {
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("status"), args[0]}
+	}}
+
+	var validated [][]byte
+	config := s.config(action)
+	config.ReplyValidator = func(reply [][]byte) error {
+		validated = reply
+		return twoFrameValidator(reply)
+	}
+
+	s.Equal([][]byte{[]byte("status"), []byte("hello")}, s.request(config))
+	s.Equal([][]byte{[]byte("status"), []byte("hello")}, validated)
+}
+
+func (s *WorkerFailureTestSuite) Test_ReplyValidator_NotCalledForFailedAction() {
+	called := false
+	config := s.config(errorWorkerAction{err: errors.New("boom")})
+	config.ReplyValidator = func(reply [][]byte) error {
+		called = true
+		return nil
+	}
+
+	s.Equal([][]byte{[]byte("ERROR"), []byte("boom")}, s.request(config))
+	s.False(called)
+}
+
+func (s *WorkerFailureTestSuite) Test_RequestFilter_DropsRequest() {
+	called := false
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		called = true
+		return args
+	}}
+
+	config := s.config(action)
+	config.RequestFilter = func(ctx RequestContext, body [][]byte) ([][]byte, bool) {
+		return nil, true
+	}
+
+	s.Equal([][]byte{[]byte(defaultFilteredReply)}, s.request(config))
+	s.False(called, "Expected the action to be skipped")
+}
+
+func (s *WorkerFailureTestSuite) Test_RequestFilter_DroppedWithConfiguredReply() {
+	config := s.config(defaultWorkerAction{})
+	config.RequestFilter = func(ctx RequestContext, body [][]byte) ([][]byte, bool) {
+		return nil, true
+	}
+	config.FilteredReply = [][]byte{[]byte("MAINTENANCE")}
+
+	s.Equal([][]byte{[]byte("MAINTENANCE")}, s.request(config))
+}
+
+func (s *WorkerFailureTestSuite) Test_RequestFilter_PassesRequestThrough() {
+	var filtered RequestContext
+
+	config := s.config(defaultWorkerAction{})
+	config.RequestFilter = func(ctx RequestContext, body [][]byte) ([][]byte, bool) {
+		filtered = ctx
+		return body, false
+	}
+
+	s.Equal([][]byte{[]byte("hello")}, s.request(config))
+	s.Equal([][]byte{[]byte("hello")}, filtered.Request)
+	s.Equal(s.serviceName, filtered.ServiceName)
+}
+
+func (s *WorkerFailureTestSuite) Test_RequestFilter_RewritesBody() {
+	config := s.config(defaultWorkerAction{})
+	config.RequestFilter = func(ctx RequestContext, body [][]byte) ([][]byte, bool) {
+		return append([][]byte{[]byte("canary")}, body...), false
+	}
+
+	s.Equal([][]byte{[]byte("canary"), []byte("hello")}, s.request(config))
+}
+
+func (s *WorkerFailureTestSuite) Test_DeadLetter_AfterFailureBudget() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := 0
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		calls++
+		panic("poison")
+	}}
+
+	var deadLettered [][]byte
+	config := s.config(action)
+	config.RecoverPanics = true
+	config.DeadLetterMaxFailures = 2
+	config.DeadLetterHandler = func(ctx RequestContext) {
+		deadLettered = ctx.Request
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	for i := 0; i < 2; i++ {
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("request-1"))
+		_, err = worker.Receive()
+		s.NoError(err)
+
+		workerMsg := readUntilNonHeartbeat(broker)
+		s.Equal([]byte("Action panicked: poison"), workerMsg[7])
+	}
+
+	// Dead lettered without calling the action, Receive() carries on to the next request
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("request-1"))
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("request-2"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([][]byte{[]byte("ERROR"), []byte(ErrDeadLettered.Error())}, workerMsg[6:])
+	s.Equal([][]byte{[]byte("request-1")}, deadLettered)
+	s.Equal(3, calls, "Expected the action to be called twice for request-1 and once for request-2")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerFailureTestSuite) Test_MaxReplyFrames_UnderLimitSentAsIs() {
+	for _, policy := range []MaxReplyFramesPolicy{ReplyFramesReject, ReplyFramesTruncate} {
+		config := s.config(funcWorkerAction{call: func(args [][]byte) [][]byte {
+			return [][]byte{[]byte("a"), []byte("b")}
+		}})
+		config.MaxReplyFrames = 2
+		config.MaxReplyFramesPolicy = policy
+
+		s.Equal([][]byte{[]byte("a"), []byte("b")}, s.request(config))
+	}
+}
+
+func (s *WorkerFailureTestSuite) Test_MaxReplyFrames_OverLimitRejected() {
+	config := s.config(funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	}})
+	config.MaxReplyFrames = 2
+
+	s.Equal([][]byte{[]byte("ERROR"), []byte(ErrTooManyReplyFrames.Error())}, s.request(config))
+}
+
+func (s *WorkerFailureTestSuite) Test_MaxReplyFrames_OverLimitTruncated() {
+	config := s.config(funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	}})
+	config.MaxReplyFrames = 2
+	config.MaxReplyFramesPolicy = ReplyFramesTruncate
+
+	s.Equal([][]byte{[]byte("a"), []byte("b")}, s.request(config))
+}
+
+func TestWorkerFailureTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerFailureTestSuite))
+}
@@ -0,0 +1,150 @@
+package majordomo_worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerPauseTestSuite struct {
+	suite.Suite
+
+	ctx *zmq4.Context
+
+	brokerAddress, serviceName           string
+	heartbeatInMillis, reconnectInMillis int
+	pollInterval, heartbeatLiveness      int
+
+	logger *testLogger
+}
+
+func (s *WorkerPauseTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+
+	s.brokerAddress = "inproc://test-worker"
+	s.serviceName = "test-service"
+	s.heartbeatInMillis = 50
+	s.reconnectInMillis = 50
+	s.pollInterval = 10
+	s.heartbeatLiveness = 10
+
+	s.logger = new(testLogger)
+}
+
+func (s *WorkerPauseTestSuite) TearDownTest() {
+	s.ctx.Term()
+}
+
+func (s *WorkerPauseTestSuite) createWorker(action WorkerAction, mode PauseMode) *mdWorker {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		PauseMode:            mode,
+	}
+
+	w, err := newWorker(s.ctx, s.logger, config)
+	if err != nil {
+		panic(err)
+	}
+
+	return w
+}
+
+// Records every call on a channel, so the test goroutine can see calls made from Receive()
+func recordingAction(calls chan [][]byte) WorkerAction {
+	return funcWorkerAction{call: func(args [][]byte) [][]byte {
+		calls <- args
+		return [][]byte{[]byte("reply")}
+	}}
+}
+
+func (s *WorkerPauseTestSuite) receiveInBackground(worker *mdWorker) chan [][]byte {
+	replies := make(chan [][]byte, 1)
+	go func() {
+		reply, _ := worker.Receive()
+		replies <- reply
+	}()
+
+	return replies
+}
+
+func (s *WorkerPauseTestSuite) Test_Pause_HoldsRequestButKeepsHeartbeating() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := make(chan [][]byte, 1)
+	worker := s.createWorker(recordingAction(calls), PauseHold)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.Pause()
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	replies := s.receiveInBackground(worker)
+
+	for i := 0; i < 3; i++ {
+		broker.performReceive <- struct{}{}
+		workerMsg := <-broker.receivedFromWorker
+		s.Equal([]byte(MD_HEARTBEAT), workerMsg[3], "Expected only heartbeats while paused")
+	}
+	s.Len(calls, 0, "Expected the action not to be called while paused")
+
+	worker.Resume()
+
+	s.Equal([][]byte{[]byte("reply")}, <-replies)
+	s.Equal([][]byte{[]byte("hello")}, <-calls)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3])
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerPauseTestSuite) Test_Pause_DisconnectModeDisconnectsAndRegistersOnResume() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := make(chan [][]byte, 1)
+	worker := s.createWorker(recordingAction(calls), PauseDisconnect)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.Pause()
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	replies := s.receiveInBackground(worker)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT for a request received while paused")
+
+	worker.Resume()
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY once resumed")
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("again"))
+
+	s.Equal([][]byte{[]byte("reply")}, <-replies)
+	s.Equal([][]byte{[]byte("again")}, <-calls, "Expected the dropped request never to reach the action")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func TestWorkerPauseTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerPauseTestSuite))
+}
@@ -0,0 +1,113 @@
+package majordomo_worker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pebbe/zmq4"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerPoolTestSuite struct {
+	suite.Suite
+
+	ctx    *zmq4.Context
+	logger *testLogger
+}
+
+// Every test's pool terminates the context, so there's no TearDownTest
+func (s *WorkerPoolTestSuite) SetupTest() {
+	var err error
+	s.ctx, err = zmq4.NewContext()
+	if err != nil {
+		panic(err)
+	}
+
+	s.logger = new(testLogger)
+}
+
+func (s *WorkerPoolTestSuite) poolConfig(mode PoolShutdownMode, workers int) PoolConfig {
+	config := PoolConfig{ShutdownMode: mode}
+	for i := 0; i < workers; i++ {
+		config.Workers = append(config.Workers, WorkerConfig{
+			// No broker needed, inproc connects succeed before anything binds
+			BrokerAddress:        fmt.Sprintf("inproc://test-pool-%d", i),
+			ServiceName:          fmt.Sprintf("test-service-%d", i),
+			HeartbeatInMillis:    500 * time.Millisecond,
+			ReconnectInMillis:    50 * time.Millisecond,
+			PollingInterval:      10 * time.Millisecond,
+			MaxHeartbeatLiveness: 10,
+			Action:               defaultWorkerAction{},
+		})
+	}
+
+	return config
+}
+
+// Creates a pool on the suite's context, counting how often the pool terminates it
+func (s *WorkerPoolTestSuite) createPool(mode PoolShutdownMode, workers int) (*WorkerPool, *int) {
+	pool, err := newWorkerPool(s.ctx, s.logger, s.poolConfig(mode, workers))
+	if err != nil {
+		panic(err)
+	}
+
+	terminated := new(int)
+	terminate := pool.terminate
+	pool.terminate = func() error {
+		*terminated++
+		return terminate()
+	}
+
+	return pool, terminated
+}
+
+// Returns when each worker shut down, in the order they were created
+func (s *WorkerPoolTestSuite) shutDownAt(pool *WorkerPool) []time.Time {
+	var times []time.Time
+	for _, worker := range pool.workers {
+		event := lastEvent(worker)
+		s.Equal(EventShutDown, event.Type)
+		times = append(times, event.Time)
+	}
+
+	return times
+}
+
+func (s *WorkerPoolTestSuite) Test_Shutdown_ParallelStopsEveryWorker() {
+	pool, terminated := s.createPool(PoolShutdownParallel, 3)
+	pool.Start()
+
+	s.NoError(pool.Shutdown())
+
+	s.Len(s.shutDownAt(pool), 3)
+	s.Equal(1, *terminated, "Expected the shared context to be terminated once")
+}
+
+func (s *WorkerPoolTestSuite) Test_Shutdown_SequentialStopsWorkersInReverseOrder() {
+	pool, terminated := s.createPool(PoolShutdownSequential, 3)
+	pool.Start()
+
+	s.NoError(pool.Shutdown())
+
+	times := s.shutDownAt(pool)
+	if s.Len(times, 3) {
+		s.True(times[2].Before(times[1]), "Expected the last worker created to shut down first")
+		s.True(times[1].Before(times[0]), "Expected the first worker created to shut down last")
+	}
+	s.Equal(1, *terminated, "Expected the shared context to be terminated once")
+}
+
+func (s *WorkerPoolTestSuite) Test_Create_ClosesCreatedWorkersIfOneFails() {
+	config := s.poolConfig(PoolShutdownParallel, 2)
+	config.Workers[1].ServiceName = ""
+
+	pool, err := newWorkerPool(s.ctx, s.logger, config)
+
+	s.Nil(pool)
+	s.Error(err)
+}
+
+func TestWorkerPoolTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerPoolTestSuite))
+}
@@ -1,7 +1,11 @@
 package majordomo_worker
 
 import (
+	"os"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/pebbe/zmq4"
 	"github.com/stretchr/testify/suite"
@@ -68,6 +72,445 @@ func (s *WorkerShutdownTestSuite) Test_Shutdown() {
 	worker.Shutdown()
 }
 
+func (s *WorkerShutdownTestSuite) Test_Shutdown_SendsDisconnectToBroker() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(1000, 1000, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+	worker.Shutdown()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT") {
+		s.Equal([]byte(""), workerMsg[1])
+		s.Equal([]byte(MD_WORKER), workerMsg[2])
+		s.Equal(4, len(workerMsg))
+	}
+
+	broker.shutdown <- struct{}{}
+}
+
+// Over tcp, unlike inproc, the DISCONNECT is still queued when the socket closes straight after sending it
+func (s *WorkerShutdownTestSuite) Test_Shutdown_SendsDisconnectOverTcpWithoutSocketLinger() {
+	address := "tcp://127.0.0.1:5993"
+
+	broker := createBroker()
+	go broker.run(s.ctx, address)
+
+	config := s.config()
+	config.BrokerAddress = address
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	received := make(chan error, 1)
+	go func() {
+		_, err := worker.Receive()
+		received <- err
+	}()
+	worker.Shutdown()
+	<-received
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT")
+
+	broker.shutdown <- struct{}{}
+}
+
+func (s *WorkerShutdownTestSuite) Test_Shutdown_OnConfiguredSignal() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(1000) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(1000) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ShutdownSignals:      []os.Signal{syscall.SIGUSR1},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	receiveErr := make(chan error, 1)
+	go func() {
+		_, err := worker.Receive()
+		receiveErr <- err
+	}()
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT")
+
+	broker.shutdown <- struct{}{}
+
+	err = <-receiveErr
+	s.IsType(GracefulShutdown(""), err)
+	s.Nil(worker.signals)
+}
+
+func (s *WorkerShutdownTestSuite) Test_Signals_RestoredWhenConnectFails() {
+	config := WorkerConfig{
+		BrokerAddress:              s.brokerAddress,
+		ServiceName:                s.serviceName,
+		HeartbeatInMillis:          time.Duration(1000) * time.Millisecond,
+		ReconnectInMillis:          time.Duration(1000) * time.Millisecond,
+		PollingInterval:            time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:       s.heartbeatLiveness,
+		Action:                     s.defaultAction,
+		ShutdownSignals:            []os.Signal{syscall.SIGUSR1},
+		ConnectRetries:             -1,
+		ConnectConfirmationTimeout: time.Duration(50) * time.Millisecond,
+	}
+
+	// Nothing is bound to the address so the connection is never confirmed
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.Equal(ErrBrokerUnconfirmed, err)
+	s.Nil(worker.signals)
+
+	worker.cleanup()
+}
+
+func (s *WorkerShutdownTestSuite) Test_Shutdown_WhenContextTerminated() {
+	worker := s.createWorker(1000, 1000, s.defaultAction)
+
+	receiveErr := make(chan error, 1)
+	go func() {
+		_, err := worker.Receive()
+		receiveErr <- err
+	}()
+
+	// Only returns once the worker has closed its sockets
+	s.ctx.Term()
+
+	err := <-receiveErr
+	s.IsType(GracefulShutdown(""), err)
+	for _, workerSocket := range worker.sockets {
+		s.Nil(workerSocket.socket)
+	}
+}
+
+func (s *WorkerShutdownTestSuite) Test_Close_BeforeReceive() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(1000, 1000, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	broker.shutdown <- struct{}{}
+
+	s.NoError(worker.Close())
+	for _, workerSocket := range worker.sockets {
+		s.Nil(workerSocket.socket)
+	}
+
+	_, err := s.ctx.NewSocket(zmq4.DEALER)
+	s.Error(err, "Expected the context to be terminated")
+}
+
+func (s *WorkerShutdownTestSuite) Test_Close_AfterShutdown() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(1000, 1000, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	receiveErr := make(chan error, 1)
+	go func() {
+		_, err := worker.Receive()
+		receiveErr <- err
+	}()
+
+	// The context can only be terminated once the broker's socket is closed too
+	broker.shutdown <- struct{}{}
+
+	worker.Shutdown()
+	s.IsType(GracefulShutdown(""), <-receiveErr)
+
+	s.NoError(worker.Close())
+	s.NoError(worker.Close())
+}
+
+func (s *WorkerShutdownTestSuite) config() WorkerConfig {
+	return WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+	}
+}
+
+func (s *WorkerShutdownTestSuite) Test_Close_DiscardsPendingMessagesWhateverTheLinger() {
+	config := s.config()
+	config.SocketConfigurator = func(socket *zmq4.Socket) error {
+		// Wait forever to deliver unsent messages
+		return socket.SetLinger(-1)
+	}
+
+	// No broker is bound, so the READY and anything after it stay queued
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+	worker.sendHeartbeats()
+
+	closed := make(chan error, 1)
+	go func() { closed <- worker.Close() }()
+
+	select {
+	case err := <-closed:
+		s.NoError(err)
+	case <-time.After(time.Second):
+		s.Fail("Expected Close() not to wait for pending messages")
+	}
+}
+
+func (s *WorkerShutdownTestSuite) Test_SocketLinger_AppliedToBrokerSockets() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := s.config()
+	config.SocketLinger = 200 * time.Millisecond
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	linger, err := worker.sockets[0].socket.GetLinger()
+	s.NoError(err)
+	s.Equal(200*time.Millisecond, linger)
+
+	worker.reconnectToBroker(worker.sockets[0], 0)
+
+	linger, err = worker.sockets[0].socket.GetLinger()
+	s.NoError(err)
+	s.Equal(200*time.Millisecond, linger, "Expected reconnects to keep the linger")
+
+	broker.shutdown <- struct{}{}
+	worker.Close()
+}
+
+func (s *WorkerShutdownTestSuite) Test_Close_SocketLingerFlushesFinalReply() {
+	address := "tcp://127.0.0.1:5994"
+
+	broker := createBroker()
+	go broker.run(s.ctx, address)
+
+	config := s.config()
+	config.BrokerAddress = address
+	config.SocketLinger = time.Second
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("last"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	// Closed straight after replying, the reply may not have left yet
+	s.NoError(worker.Close())
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected the final REPLY to arrive") {
+		s.Equal([][]byte{[]byte("last")}, workerMsg[6:])
+	}
+
+	broker.shutdown <- struct{}{}
+}
+
+func (s *WorkerShutdownTestSuite) Test_Close_GivesUpOnTermAfterTimeout() {
+	config := s.config()
+	config.TermTimeout = 50 * time.Millisecond
+
+	// Its own context, which is left to terminate in the background
+	ctx, err := zmq4.NewContext()
+	s.NoError(err)
+
+	worker, err := newWorker(ctx, s.logger, config)
+	s.NoError(err)
+
+	// An auxiliary socket that is never closed keeps the context from terminating
+	auxiliary, err := worker.Context().NewSocket(zmq4.PUB)
+	s.NoError(err)
+
+	start := time.Now()
+	s.Equal(ErrTermTimeout, worker.Close())
+	s.True(time.Since(start) < time.Second, "Expected Close() to give up on the context")
+
+	// Lets the context terminate in the background
+	auxiliary.Close()
+}
+
+func (s *WorkerShutdownTestSuite) Test_Shutdown_ClosedChannelStopsReceiveOnce() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(1000, 1000, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	broker.shutdown <- struct{}{}
+	close(worker.shutdown)
+
+	_, err := worker.Receive()
+	s.IsType(GracefulShutdown(""), err)
+
+	// Later calls return straight away rather than shutting down again
+	_, err = worker.Receive()
+	s.IsType(GracefulShutdown(""), err)
+
+	shuttingDown := 0
+	for len(worker.Events()) > 0 {
+		if event := <-worker.Events(); event.Type == EventShuttingDown {
+			shuttingDown++
+		}
+	}
+	s.Equal(1, shuttingDown)
+}
+
+// Heartbeats are sent by Receive() itself, so once it has returned from shutting down nothing is left to send on the
+// closed sockets. Run with -race.
+func (s *WorkerShutdownTestSuite) Test_Shutdown_NeverRacesHeartbeats() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	// Due at every poll
+	worker := s.createWorker(1, 1000, s.defaultAction)
+	worker.pollInterval = time.Millisecond
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	received := make(chan error)
+	go func() {
+		for {
+			if _, err := worker.Receive(); err != nil {
+				received <- err
+				return
+			}
+		}
+	}()
+
+	var heartbeats sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		heartbeats.Add(1)
+		go func() {
+			defer heartbeats.Done()
+			for {
+				if _, ok := worker.SendHeartbeat().(GracefulShutdown); ok {
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	worker.Shutdown()
+
+	s.IsType(GracefulShutdown(""), <-received)
+	heartbeats.Wait()
+
+	broker.shutdown <- struct{}{}
+}
+
+func (s *WorkerShutdownTestSuite) Test_Shutdown_DuringReconnectDelay() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := s.config()
+	config.ReconnectInMillis = 200 * time.Millisecond
+	config.MaxHeartbeatLiveness = 2
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	receiveErr := make(chan error, 1)
+	go func() {
+		_, err := worker.Receive()
+		receiveErr <- err
+	}()
+
+	// The broker is silent, so the worker soon runs out of liveness and sleeps before reconnecting
+	for event := range worker.Events() {
+		if event.Type == EventReconnecting {
+			break
+		}
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.Shutdown()
+	s.IsType(GracefulShutdown(""), <-receiveErr)
+
+	s.Equal(uint64(0), worker.Stats().Reconnects, "Expected no reconnect once shutting down")
+	for _, workerSocket := range worker.sockets {
+		s.Nil(workerSocket.socket)
+	}
+	s.NoError(worker.Close())
+}
+
 func TestWorkerShutdownTestSuite(t *testing.T) {
 	suite.Run(t, new(WorkerShutdownTestSuite))
 }
+
+func (s *WorkerShutdownTestSuite) Test_Shutdown_FinalEventDeliveredBeforeReceiveReturns() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := s.config()
+	config.EventBuffer = 1
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY. Connected fills the buffer and nobody reads it.
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	receiveErr := make(chan error, 1)
+	go func() {
+		_, err := worker.Receive()
+		receiveErr <- err
+	}()
+
+	broker.shutdown <- struct{}{}
+
+	worker.Shutdown()
+	s.IsType(GracefulShutdown(""), <-receiveErr)
+
+	if s.Equal(1, len(worker.Events())) {
+		s.Equal(EventShutDown, (<-worker.Events()).Type)
+	}
+}
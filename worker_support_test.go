@@ -1,6 +1,8 @@
 package majordomo_worker
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/pebbe/zmq4"
@@ -59,3 +61,105 @@ type funcWorkerAction struct {
 func (f funcWorkerAction) Call(args [][]byte) [][]byte {
 	return f.call(args)
 }
+
+type batchWorkerAction struct {
+	batches [][]RequestContext
+}
+
+func (a *batchWorkerAction) Call(args [][]byte) [][]byte {
+	return args
+}
+
+func (a *batchWorkerAction) CallBatch(requests []RequestContext) [][][]byte {
+	a.batches = append(a.batches, requests)
+
+	replies := make([][][]byte, len(requests))
+	for i, request := range requests {
+		replies[i] = [][]byte{append([]byte("batched-"), request.Request[0]...)}
+	}
+
+	return replies
+}
+
+type contextWorkerAction struct {
+	ctxs []RequestContext
+}
+
+func (a *contextWorkerAction) Call(args [][]byte) [][]byte {
+	panic("Call should not be used when CallWithContext is available")
+}
+
+func (a *contextWorkerAction) CallWithContext(ctx RequestContext) [][]byte {
+	a.ctxs = append(a.ctxs, ctx)
+	return ctx.Request
+}
+
+type errorWorkerAction struct {
+	err error
+}
+
+func (a errorWorkerAction) Call(args [][]byte) [][]byte {
+	panic("Call should not be used when CallWithError is available")
+}
+
+func (a errorWorkerAction) CallWithError(ctx RequestContext) ([][]byte, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	return ctx.Request, nil
+}
+
+// Lets one caller through every interval, like a rate.Limiter with a burst of one
+type intervalLimiter struct {
+	sync.Mutex
+
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *intervalLimiter) Wait(ctx context.Context) error {
+	l.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.Unlock()
+
+	time.Sleep(at.Sub(now))
+	return nil
+}
+
+// Never allows a reconnect, only returning once the context is cancelled
+type blockingLimiter struct {
+	waiting chan struct{}
+}
+
+func (l blockingLimiter) Wait(ctx context.Context) error {
+	close(l.waiting)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Test-only hook to push the worker towards reconnecting as if the broker had gone quiet
+func (w *mdWorker) decrementLiveness(by int) {
+	for _, workerSocket := range w.sockets {
+		workerSocket.liveness -= by
+	}
+}
+
+// Reconnects straight away after every poll and remembers what it was asked
+type immediateReconnectStrategy struct {
+	states chan BrokerState
+}
+
+func (s immediateReconnectStrategy) ShouldReconnect(state BrokerState) (bool, time.Duration) {
+	select {
+	case s.states <- state:
+	default:
+	}
+
+	return true, 0
+}
@@ -1,7 +1,13 @@
 package majordomo_worker
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/pebbe/zmq4"
 	"github.com/stretchr/testify/suite"
@@ -60,8 +66,8 @@ func (s *WorkerTestSuite) Test_Receive_SendsHeartbeatIfThresholdHit() {
 	broker := createBroker()
 	go broker.run(s.ctx, s.brokerAddress)
 
-	// Give a low heartbeat values so we definitely trigger it
-	worker := s.createWorker(1, s.reconnectInMillis, s.defaultAction)
+	// Give a low heartbeat values so we definitely trigger it, polling no less often
+	worker := createWorker(s.ctx, s.brokerAddress, s.serviceName, 5, s.reconnectInMillis, 5, s.heartbeatLiveness, s.defaultAction, s.logger)
 	broker.performReceive <- struct{}{}
 	go worker.Receive()
 
@@ -82,6 +88,2256 @@ func (s *WorkerTestSuite) Test_Receive_SendsHeartbeatIfThresholdHit() {
 	worker.cleanup()
 }
 
+func (s *WorkerTestSuite) Test_Events_EmittedForRequestCycle() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	broker.performReceive <- struct{}{}
+
+	// We can ignore the initial READY
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("hello")}, msg)
+
+	var eventTypes []WorkerEventType
+	for len(worker.Events()) > 0 {
+		event := <-worker.Events()
+		eventTypes = append(eventTypes, event.Type)
+		s.Equal(s.brokerAddress, event.Address)
+	}
+
+	s.Equal([]WorkerEventType{EventConnected, EventRequestReceived, EventReplySent}, eventTypes)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Events_DroppedWhenBufferFull() {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		EventBuffer:          1,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// Connected fills the buffer, this one must not block
+	worker.emit(EventReconnecting, s.brokerAddress)
+
+	s.Equal(1, len(worker.Events()))
+	s.Equal(EventConnected, (<-worker.Events()).Type)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_HeartbeatFollowsClock() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	clock := newFakeClock()
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(10) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		Clock:                clock,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	// Nothing is due until the clock moves past the heartbeat interval
+	clock.Advance(time.Duration(s.heartbeatInMillis+1) * time.Millisecond)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_HEARTBEAT), workerMsg[3], "Expected HEARTBEAT from worker")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReconnectSleepsOnClock() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	clock := newFakeClock()
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Hour,
+		PollingInterval:      time.Duration(10) * time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		Clock:                clock,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	// Liveness runs out after a single empty poll, the hour long reconnect delay must not hold us up
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	s.True(clock.sleepCount() > 0)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReplyInterceptorModifiesReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var interceptedCtx RequestContext
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ReplyInterceptor: func(ctx RequestContext, reply [][]byte) [][]byte {
+			interceptedCtx = ctx
+			return append(reply, []byte("trace-id"))
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	worker.Receive()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([]byte("client"), workerMsg[4])
+		s.Equal([][]byte{[]byte("hello"), []byte("trace-id")}, workerMsg[6:])
+	}
+
+	s.Equal(s.serviceName, interceptedCtx.ServiceName)
+	s.Equal([]byte("client"), interceptedCtx.ReplyTo)
+	s.Equal([][]byte{[]byte("hello")}, interceptedCtx.Request)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReplyInterceptorReturningNilSendsEmptyReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ReplyInterceptor: func(ctx RequestContext, reply [][]byte) [][]byte {
+			return nil
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	worker.Receive()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([]byte("client"), workerMsg[4])
+		s.Equal(6, len(workerMsg))
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Stats_CountsRequests() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	worker.Receive()
+
+	stats := worker.Stats()
+	s.Equal(uint64(1), stats.Requests)
+	s.Equal(uint64(0), stats.Reconnects)
+	s.True(stats.Healthy)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Stats_UnhealthyWhenHealthFuncFailsDespiteConnection() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var degraded int32 = 1
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		HealthFunc:           func() bool { return atomic.LoadInt32(&degraded) == 0 },
+	})
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	stats := worker.Stats()
+	s.True(stats.Liveness > 0, "Expected the connection to be alive")
+	s.False(stats.Healthy)
+
+	atomic.StoreInt32(&degraded, 0)
+	s.True(worker.Stats().Healthy)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Stats_LastBrokerHeartbeatIgnoresRequests() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	worker.Receive()
+
+	s.True(worker.Stats().LastBrokerHeartbeat.IsZero(), "Expected requests not to count as heartbeats")
+
+	sendWorkerMessage(broker, MD_HEARTBEAT)
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	worker.Receive()
+
+	s.False(worker.Stats().LastBrokerHeartbeat.IsZero(), "Expected the heartbeat to be recorded")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Stats_HeartbeatLatencyToBrokerEcho() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := createWorker(s.ctx, s.brokerAddress, s.serviceName, 100, s.reconnectInMillis, 10, s.heartbeatLiveness, s.defaultAction, s.logger)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_HEARTBEAT), workerMsg[3], "Expected HEARTBEAT")
+	s.Equal(time.Duration(0), worker.Stats().HeartbeatLatency, "Expected no latency until the broker answers")
+
+	// The stub broker echoes the heartbeat after a known delay
+	delay := 30 * time.Millisecond
+	time.Sleep(delay)
+	sendWorkerMessage(broker, MD_HEARTBEAT)
+
+	timeout := time.After(time.Second)
+	for worker.Stats().HeartbeatLatency == 0 {
+		select {
+		case <-timeout:
+			s.FailNow("Heartbeat latency never measured")
+		default:
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	latency := worker.Stats().HeartbeatLatency
+	s.True(latency >= delay, "Expected at least %s, measured %s", delay, latency)
+	s.True(latency < 100*time.Millisecond, "Expected less than a heartbeat interval, measured %s", latency)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_ManualLiveness_DeterministicRequestReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	// Timings that would have the worker heartbeating and reconnecting constantly
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Millisecond,
+		ReconnectInMillis:    time.Millisecond,
+		PollingInterval:      time.Millisecond,
+		MaxHeartbeatLiveness: 1,
+		Action:               s.defaultAction,
+		ManualLiveness:       true,
+	})
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	time.Sleep(50 * time.Millisecond)
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	// The very next message is the reply, no heartbeat went out before it
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+	s.Equal([][]byte{[]byte("hello")}, workerMsg[6:])
+
+	s.Equal(1, worker.Liveness())
+	s.Equal(uint64(0), worker.Stats().Reconnects)
+
+	// Heartbeats are only sent when asked for
+	s.NoError(worker.sendHeartbeatsNow())
+	broker.performReceive <- struct{}{}
+	workerMsg = <-broker.receivedFromWorker
+	s.Equal([]byte(MD_HEARTBEAT), workerMsg[3], "Expected HEARTBEAT")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Heartbeat_NoneSentWhenDisabled() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    10 * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      10 * time.Millisecond,
+		MaxHeartbeatLiveness: 3,
+		Action:               s.defaultAction,
+		DisableHeartbeats:    true,
+	})
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	replies := make(chan [][]byte, 1)
+	go func() {
+		reply, _ := worker.Receive()
+		replies <- reply
+	}()
+
+	// Long enough for many heartbeats, and for liveness to run out if it were counted
+	time.Sleep(200 * time.Millisecond)
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	s.Equal([][]byte{[]byte("hello")}, <-replies)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected the REPLY without any heartbeats before it")
+	s.Equal(uint64(0), worker.Stats().Reconnects)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Stats_CountsBytes() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("hello, world")}
+	}}
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+
+	// We can ignore the initial READY, which isn't counted after Reset()
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+	worker.Reset()
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	worker.Receive()
+
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	stats := worker.Stats()
+	// "", MDPW01, \x02, client, "", hello
+	s.Equal(uint64(18), stats.TotalBytesReceived)
+	// "", MDPW01, \x03, client, "", hello, world
+	s.Equal(uint64(25), stats.TotalBytesSent)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReplyMetadataFramedAheadOfBody() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		var reply Reply
+		return reply.SetMetadata("status", "201").SetMetadata("content-type", "application/json").AddFrame(args[0]).Frames()
+	}}
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte(`{"id":1}`))
+	worker.Receive()
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+
+	// identity, "", MDPW01, \x03, client, "", then the reply
+	metadata, body, err := SplitReplyMetadata(workerMsg[6:])
+	s.NoError(err)
+	s.Equal(map[string]string{"status": "201", "content-type": "application/json"}, metadata)
+	s.Equal([][]byte{[]byte(`{"id":1}`)}, body)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReplyFramePrefixAfterDelimiter() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ReplyFramePrefix:     [][]byte{[]byte("route"), []byte("eu-west")},
+	})
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	worker.Receive()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+
+	// identity, "", MDPW01, \x03, client, "", then the prefix and the body
+	s.Equal([]byte(MD_REPLY), workerMsg[3])
+	s.Equal([]byte("client"), workerMsg[4])
+	s.Equal([]byte(""), workerMsg[5])
+	s.Equal([][]byte{[]byte("route"), []byte("eu-west"), []byte("hello")}, workerMsg[6:])
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_NegotiatedGzipRequestGetsGzipReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var received [][]byte
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		received = args
+		return [][]byte{[]byte("world")}
+	}}
+
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:          s.brokerAddress,
+		ServiceName:            s.serviceName,
+		HeartbeatInMillis:      time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:      time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:        time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:   s.heartbeatLiveness,
+		Action:                 action,
+		CompressionNegotiation: true,
+	})
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	ready := <-broker.receivedFromWorker
+	s.Equal([]byte("codecs=gzip,identity"), ready[len(ready)-1], "Expected the codecs advertised in READY")
+
+	body, err := gzipFrames([][]byte{[]byte("hello")})
+	s.NoError(err)
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte(ReplyGzip), body[0])
+	worker.Receive()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([][]byte{[]byte("hello")}, received, "Expected the action to get the decoded request")
+	s.Equal([]byte(ReplyGzip), workerMsg[6], "Expected the reply encoded to match")
+
+	reply, err := DecompressReply(workerMsg[6:])
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("world")}, reply)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReducedEnvelopeLayout() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var received [][]byte
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		received = args
+		return [][]byte{[]byte("world")}
+	}}
+
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		EnvelopeLayout:       reducedEnvelopeLayout,
+	})
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	// No empty delimiter before the protocol or between the client address and the body
+	broker.sendToWorker <- [][]byte{[]byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), []byte("hello")}
+
+	reply, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("world")}, reply)
+	s.Equal([][]byte{[]byte("hello")}, received)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3])
+	s.Equal([]byte("client"), workerMsg[4])
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_MultiFrameBodyPreserved() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var received [][]byte
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		received = args
+		return [][]byte{[]byte("reply-1"), []byte(""), []byte("reply-3")}
+	}}
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("frame-1"), []byte(""), []byte("frame-3"))
+	reply, err := worker.Receive()
+	s.NoError(err)
+
+	// Every frame arrives at the action as a slice of its own, empty frames included
+	if s.Len(received, 3) {
+		s.Equal([]byte("frame-1"), received[0])
+		s.Empty(received[1])
+		s.Equal([]byte("frame-3"), received[2])
+	}
+	s.Len(reply, 3)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([]byte("client"), workerMsg[4])
+		s.Empty(workerMsg[5], "Expected the empty delimiter before the reply body")
+		s.Equal([][]byte{[]byte("reply-1"), []byte(""), []byte("reply-3")}, workerMsg[6:])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_NilActionResponseSendsEmptyReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := funcWorkerAction{func(args [][]byte) [][]byte { return nil }}
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	_, err := worker.Receive()
+	s.NoError(err)
+
+	// Identity, delimiter, protocol, command, client and the delimiter before the body, which has no frames
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Len(workerMsg, 6) {
+		s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+		s.Equal([]byte("client"), workerMsg[4])
+		s.Empty(workerMsg[5], "Expected the empty delimiter")
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_AfterReply_CalledWithReplySent() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	type afterReply struct {
+		ctx   RequestContext
+		reply [][]byte
+		err   error
+	}
+	called := make(chan afterReply, 1)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		ReplyInterceptor: func(ctx RequestContext, reply [][]byte) [][]byte {
+			return append(reply, []byte("intercepted"))
+		},
+		AfterReply: func(ctx RequestContext, reply [][]byte, err error) {
+			called <- afterReply{ctx, reply, err}
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	select {
+	case after := <-called:
+		s.Equal([]byte("client"), after.ctx.ReplyTo)
+		s.Equal([][]byte{[]byte("hello"), []byte("intercepted")}, after.reply)
+		s.NoError(after.err)
+	case <-time.After(time.Second):
+		s.Fail("AfterReply wasn't called")
+	}
+
+	// The hook is only called once the reply has gone to the broker
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte("hello"), []byte("intercepted")}, workerMsg[6:])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_SessionTokenRoundTrips() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := &contextWorkerAction{}
+
+	config := WorkerConfig{
+		BrokerAddress:         s.brokerAddress,
+		ServiceName:           s.serviceName,
+		HeartbeatInMillis:     time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:     time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:       time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:  s.heartbeatLiveness,
+		Action:                action,
+		PropagateSessionToken: true,
+		SessionTokenFrame:     1,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"), []byte("session-1"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	if s.Len(action.ctxs, 1) {
+		s.Equal([]byte("session-1"), action.ctxs[0].SessionToken)
+	}
+
+	// The action echoes the request, the token is put ahead of it
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte("session-1"), []byte("hello"), []byte("session-1")}, workerMsg[6:])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ContextExtractorDeadlineSeenByAction() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := &contextWorkerAction{}
+	deadline := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	type traceKey struct{}
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		ContextExtractor: func(body [][]byte) context.Context {
+			ctx, cancel := context.WithDeadline(context.WithValue(context.Background(), traceKey{}, string(body[1])), deadline)
+			cancels = append(cancels, cancel)
+			return ctx
+		},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"), []byte("trace-1"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	if s.Len(action.ctxs, 1) {
+		ctx := action.ctxs[0]
+		actionDeadline, ok := ctx.Context.Deadline()
+		s.True(ok, "Expected the extracted deadline")
+		s.Equal(deadline, actionDeadline)
+		s.Equal(deadline, ctx.Deadline)
+		s.Equal("trace-1", ctx.Context.Value(traceKey{}))
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_DelayedReplySentAfterDelay() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	delay := 100 * time.Millisecond
+	worker := s.createWorker(60000, s.reconnectInMillis, delayedAction{delay: delay})
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	received := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := worker.Receive(); err != nil {
+				received <- err
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client-1"), []byte(""), []byte("later"))
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.True(time.Since(start) >= delay, "Expected the reply to be held back")
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([]byte("client-1"), workerMsg[4])
+		s.Equal([][]byte{[]byte("later")}, workerMsg[6:])
+	}
+
+	worker.Shutdown()
+	<-received
+	broker.shutdown <- struct{}{}
+}
+
+// Replies with the greeting held in the worker's state
+type greetingState struct {
+	greeting string
+}
+
+type stateWorkerAction struct{}
+
+func (stateWorkerAction) Call(args [][]byte) [][]byte {
+	return args
+}
+
+func (stateWorkerAction) CallWithContext(ctx RequestContext) [][]byte {
+	state := ctx.WorkerState.(*greetingState)
+	return [][]byte{[]byte(state.greeting), ctx.Request[0]}
+}
+
+func (s *WorkerTestSuite) Test_Receive_ActionSeesWorkerState() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               stateWorkerAction{},
+		State:                &greetingState{greeting: "hello"},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("world"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte("hello"), []byte("world")}, workerMsg[6:])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_RoutedRepliesSentToEachClient() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := routedWorkerAction{[]RoutedReply{
+		{ReplyTo: []byte("client-2"), Reply: [][]byte{[]byte("to client-2")}},
+		{ReplyTo: []byte("client-3"), Reply: [][]byte{[]byte("to client-3")}},
+	}}
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client-1"), []byte(""), []byte("hello"))
+	reply, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("hello")}, reply)
+
+	// The requester is answered first, then every routed reply in turn
+	expected := [][][]byte{
+		{[]byte("client-1"), []byte(""), []byte("hello")},
+		{[]byte("client-2"), []byte(""), []byte("to client-2")},
+		{[]byte("client-3"), []byte(""), []byte("to client-3")},
+	}
+	for _, frames := range expected {
+		workerMsg := readUntilNonHeartbeat(broker)
+		if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+			s.Equal(frames, workerMsg[4:])
+		}
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_IdempotencyCacheReplaysDuplicateRequest() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := 0
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		calls++
+		return [][]byte{[]byte(fmt.Sprintf("reply-%d", calls))}
+	}}
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		IdempotencyCacheSize: 10,
+		RequestIDFrame:       0,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	for i := 0; i < 2; i++ {
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("request-1"), []byte("body"))
+		worker.Receive()
+
+		workerMsg := readUntilNonHeartbeat(broker)
+		if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+			s.Equal([][]byte{[]byte("reply-1")}, workerMsg[6:])
+		}
+	}
+
+	s.Equal(1, calls)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_DeduplicatesIdenticalBodiesWithinWindow() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	calls := 0
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		calls++
+		return [][]byte{[]byte(fmt.Sprintf("reply-%d", calls))}
+	}}
+
+	clock := newFakeClock()
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		Clock:                clock,
+		DeduplicationWindow:  time.Minute,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	request := func(body string) []byte {
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte(body))
+		worker.Receive()
+
+		workerMsg := readUntilNonHeartbeat(broker)
+		s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+		return workerMsg[6]
+	}
+
+	s.Equal([]byte("reply-1"), request("body"))
+
+	clock.Advance(30 * time.Second)
+	s.Equal([]byte("reply-1"), request("body"), "Expected the reply to be replayed within the window")
+	s.Equal([]byte("reply-2"), request("other body"))
+
+	clock.Advance(30 * time.Second)
+	s.Equal([]byte("reply-3"), request("body"), "Expected the action to be called once the window has passed")
+	s.Equal(3, calls)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_StreamsReplyAsPartials() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	data := streamData(3*1024*1024 + 123)
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Minute,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               readerAction{data: data},
+		FrameEncoder:         MDP02Frames{},
+		StreamChunkSize:      64 * 1024,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	// The broker speaks MDP/0.1 to the worker, it is only the worker's replies that are MDP/0.2
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("file"))
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	var received []byte
+	partials := 0
+	for {
+		broker.performReceive <- struct{}{}
+		workerMsg := <-broker.receivedFromWorker
+		s.Equal([]byte("MDPW02"), workerMsg[2])
+		s.Equal([]byte("client"), workerMsg[4])
+		received = append(received, workerMsg[6]...)
+
+		if string(workerMsg[3]) == mdp02Final {
+			break
+		}
+		s.Equal(mdp02Partial, string(workerMsg[3]), "Expected PARTIAL")
+		partials++
+	}
+
+	s.True(bytes.Equal(data, received), "Expected the streamed bytes to reassemble into the reply")
+	s.Equal(48, partials)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_StreamedPartialsEncodedAsNegotiated() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:          s.brokerAddress,
+		ServiceName:            s.serviceName,
+		HeartbeatInMillis:      time.Minute,
+		ReconnectInMillis:      time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:        time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:   s.heartbeatLiveness,
+		Action:                 readerAction{data: []byte("abcdefgh")},
+		FrameEncoder:           MDP02Frames{},
+		StreamChunkSize:        3,
+		CompressionNegotiation: true,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	request, err := gzipFrames([][]byte{[]byte("file")})
+	s.NoError(err)
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte(ReplyGzip), request[0])
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	var received []byte
+	for {
+		broker.performReceive <- struct{}{}
+		workerMsg := <-broker.receivedFromWorker
+		s.Equal([]byte(ReplyGzip), workerMsg[6], "Expected every message to carry the request's codec")
+
+		chunk, err := DecompressReply(workerMsg[6:])
+		s.NoError(err)
+		for _, frame := range chunk {
+			received = append(received, frame...)
+		}
+
+		if string(workerMsg[3]) == mdp02Final {
+			break
+		}
+	}
+
+	s.Equal("abcdefgh", string(received))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReceiveErrorIsSkipped() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	err := worker.handleReceiveError(worker.sockets[0], zmq4.Errno(syscall.EAGAIN))
+	s.NoError(err)
+	s.NotEmpty(s.logger.errors)
+	s.Equal(uint64(1), worker.Stats().Errors)
+	s.Equal(uint64(0), worker.Stats().Reconnects)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReceiveErrorEFSMReconnects() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, 1, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	err := worker.handleReceiveError(worker.sockets[0], zmq4.EFSM)
+	s.NoError(err)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	s.Equal(uint64(1), worker.Stats().Reconnects)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReceiveErrorETERMStops() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	err := worker.handleReceiveError(worker.sockets[0], zmq4.ETERM)
+	s.IsType(GracefulShutdown(""), err)
+	s.Nil(worker.sockets[0].socket)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReceiveErrorReturnedIfConfigured() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.returnReceiveErrors = true
+
+	err := worker.handleReceiveError(worker.sockets[0], zmq4.EFSM)
+	s.Equal(zmq4.EFSM, err)
+	s.Equal(uint64(1), worker.Stats().Errors)
+	s.Equal(uint64(0), worker.Stats().Reconnects)
+
+	// Interrupted receives are still retried rather than returned
+	s.NoError(worker.handleReceiveError(worker.sockets[0], zmq4.Errno(syscall.EINTR)))
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_PollErrorReconnects() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, 1, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	err := worker.handlePollError(zmq4.Errno(syscall.EFAULT))
+	s.NoError(err)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	s.Equal(uint64(1), worker.Stats().Errors)
+	s.Equal(uint64(1), worker.Stats().Reconnects)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_PollErrorReturnedIfConfigured() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.returnReceiveErrors = true
+
+	err := worker.handlePollError(zmq4.Errno(syscall.EFAULT))
+	s.Equal(zmq4.Errno(syscall.EFAULT), err)
+	s.NotEmpty(s.logger.errors)
+	s.Equal(uint64(0), worker.Stats().Reconnects)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_ServiceNamePrefix_UsedForReadyAndMismatch() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:         s.brokerAddress,
+		ServiceName:           "orders",
+		ServiceNamePrefix:     "teamA/",
+		HeartbeatInMillis:     time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:     time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:       time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:  s.heartbeatLiveness,
+		Action:                s.defaultAction,
+		ServiceMismatchPolicy: ServiceMismatchReject,
+		ServiceFrame:          0,
+		ServiceMismatchReply:  [][]byte{[]byte("wrong service")},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	workerMsg := <-broker.receivedFromWorker
+	if s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY") {
+		s.Equal([]byte("teamA/orders"), workerMsg[4])
+	}
+
+	// The unprefixed name is someone else's service
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("orders"), []byte("hello"))
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("teamA/orders"), []byte("hello"))
+
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("teamA/orders"), []byte("hello")}, msg)
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte("wrong service")}, workerMsg[6:])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ServiceMismatchRejected() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	var calledWith [][][]byte
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		calledWith = append(calledWith, args)
+		return args
+	}}
+
+	config := WorkerConfig{
+		BrokerAddress:         s.brokerAddress,
+		ServiceName:           s.serviceName,
+		HeartbeatInMillis:     time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:     time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:       time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:  s.heartbeatLiveness,
+		Action:                action,
+		ServiceMismatchPolicy: ServiceMismatchReject,
+		ServiceFrame:          0,
+		ServiceMismatchReply:  [][]byte{[]byte("wrong service")},
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("other-service"), []byte("hello"))
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte(s.serviceName), []byte("hello"))
+
+	// Only returns once the matching request has been handled
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte(s.serviceName), []byte("hello")}, msg)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte("wrong service")}, workerMsg[6:])
+	}
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte(s.serviceName), []byte("hello")}, workerMsg[6:])
+	}
+
+	s.Equal(1, len(calledWith))
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+// Records the service each request came in on
+type serviceNameAction struct {
+	services chan string
+}
+
+func (a serviceNameAction) Call(args [][]byte) [][]byte {
+	panic("Call should not be used when CallWithContext is available")
+}
+
+func (a serviceNameAction) CallWithContext(ctx RequestContext) [][]byte {
+	a.services <- ctx.ServiceName
+	return ctx.Request
+}
+
+func (s *WorkerTestSuite) Test_Receive_ServiceAliasesShareAction() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := serviceNameAction{services: make(chan string, 2)}
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		ServiceAliases:       []string{"alias"},
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// One READY per service, each from a socket of its own
+	identities := map[string][]byte{}
+	for i := 0; i < 2; i++ {
+		broker.performReceive <- struct{}{}
+		workerMsg := <-broker.receivedFromWorker
+		s.Equal([]byte(MD_READY), workerMsg[3])
+		identities[string(workerMsg[4])] = workerMsg[0]
+	}
+	s.Len(identities, 2)
+	s.NotEqual(identities[s.serviceName], identities["alias"])
+
+	received := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := worker.Receive(); err != nil {
+				received <- err
+				return
+			}
+		}
+	}()
+
+	for _, service := range []string{s.serviceName, "alias"} {
+		// The broker sends to whichever socket it last heard from, so wait for this service's to heartbeat
+		for {
+			broker.performReceive <- struct{}{}
+			if workerMsg := <-broker.receivedFromWorker; bytes.Equal(identities[service], workerMsg[0]) {
+				break
+			}
+		}
+
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte(service))
+
+		s.Equal(service, <-action.services)
+
+		workerMsg := readUntilNonHeartbeat(broker)
+		if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+			s.Equal(identities[service], workerMsg[0])
+			s.Equal([][]byte{[]byte(service)}, workerMsg[6:])
+		}
+	}
+
+	worker.Shutdown()
+	<-received
+	broker.shutdown <- struct{}{}
+}
+
+func (s *WorkerTestSuite) Test_Receive_ServiceMismatchProcessedAnyway() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:         s.brokerAddress,
+		ServiceName:           s.serviceName,
+		HeartbeatInMillis:     time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:     time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:       time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:  s.heartbeatLiveness,
+		Action:                s.defaultAction,
+		ServiceMismatchPolicy: ServiceMismatchProcess,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("other-service"))
+
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("other-service")}, msg)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Context_CanOpenAuxiliarySockets() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	s.Equal(s.ctx, worker.Context())
+
+	// i.e. a side channel for publishing events
+	publisher, err := worker.Context().NewSocket(zmq4.PUB)
+	s.NoError(err)
+	s.NoError(publisher.Bind("inproc://test-worker-events"))
+	publisher.Close()
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Liveness_RestoredByHeartbeat() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	workerSocket := worker.sockets[0]
+	workerSocket.liveness = 1
+
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+	s.Equal(s.heartbeatLiveness, workerSocket.liveness)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Liveness_RestoredByRequest() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	workerSocket := worker.sockets[0]
+	workerSocket.liveness = 1
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	_, handled := worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+	s.True(handled)
+	s.Equal(s.heartbeatLiveness, workerSocket.liveness)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Liveness_NotRestoredByMalformedMessage() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	workerSocket := worker.sockets[0]
+	workerSocket.liveness = 1
+
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER)})
+	s.Equal(1, workerSocket.liveness)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Liveness_NotRestoredByDisconnect() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	workerSocket := worker.sockets[0]
+	workerSocket.liveness = 1
+
+	// Hold the circuit breaker open so the DISCONNECT can't trigger a reconnect, which would restore liveness
+	worker.breakerMaxReconnects = 1
+	worker.stats.setUnhealthyUntil(time.Now().Add(time.Hour))
+
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_DISCONNECT)})
+	s.Equal(1, workerSocket.liveness)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) createTimedLivenessWorker(clock Clock) *mdWorker {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      10 * time.Millisecond,
+		MaxHeartbeatLiveness: 3,
+		Action:               s.defaultAction,
+		Clock:                clock,
+		LivenessByTime:       true,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	return worker
+}
+
+func (s *WorkerTestSuite) Test_Liveness_ByTimeIgnoresPollCount() {
+	clock := newFakeClock()
+	worker := s.createTimedLivenessWorker(clock)
+	workerSocket := worker.sockets[0]
+
+	workerSocket.liveness = 0
+	reconnect, _ := worker.shouldReconnect(workerSocket)
+	s.False(reconnect)
+
+	clock.Advance(3 * time.Duration(s.heartbeatInMillis) * time.Millisecond)
+	reconnect, _ = worker.shouldReconnect(workerSocket)
+	s.True(reconnect)
+
+	// Hearing from the broker restarts the timeout
+	worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+	reconnect, _ = worker.shouldReconnect(workerSocket)
+	s.False(reconnect)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Liveness_ByTimeReconnectsSilentBroker() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	clock := newFakeClock()
+	worker := s.createTimedLivenessWorker(clock)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	// The connection stays open but the broker never says anything
+	clock.Advance(3 * time.Duration(s.heartbeatInMillis) * time.Millisecond)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_ReconnectStrategy_CustomStrategyReconnects() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	strategy := immediateReconnectStrategy{states: make(chan BrokerState, 1)}
+	worker.reconnectStrategy = strategy
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleReceiveError(worker.sockets[0], zmq4.Errno(syscall.EAGAIN))
+	s.Equal(1, worker.sockets[0].consecutiveErrors)
+
+	go worker.Receive()
+
+	state := <-strategy.states
+	s.Equal(s.brokerAddress, state.Address)
+	s.Equal(1, state.ConsecutiveErrors)
+	s.Equal(s.heartbeatLiveness, state.MaxLiveness)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Liveness_IndependentOfZMTPHeartbeat() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.zmtpHeartbeat = zmtpHeartbeat{interval: 10 * time.Millisecond, timeout: 50 * time.Millisecond}
+
+	// Reconnect so the new socket gets the ZMTP heartbeat options
+	worker.reconnectToBroker(worker.sockets[0], 0)
+
+	// We can ignore the initial READY and the one after reconnecting
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+
+	// ZMTP heartbeats keep flowing on the connection but are never seen by the worker, so a broker that sends no
+	// MDP messages still runs out of liveness
+	worker.sockets[0].liveness = 1
+	go worker.Receive()
+
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after the broker ran out of liveness")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_ProtocolMismatch_MessageDropped() {
+	called := false
+	action := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		called = true
+		return args
+	}}
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+	workerSocket := worker.sockets[0]
+	workerSocket.liveness = 1
+
+	reply, handled := worker.handleMessage(workerSocket, [][]byte{nil, []byte("MDPW02"), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+	s.Nil(reply)
+	s.False(handled)
+	s.False(called, "Expected the action not to be called")
+	s.Equal(1, workerSocket.liveness, "Expected liveness not to be restored")
+	s.Equal(uint64(1), worker.Stats().Errors)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_ProtocolMismatch_DisconnectsWhenConfigured() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.disconnectOnMismatch = true
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte("MDPW02"), []byte(MD_HEARTBEAT)})
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_UnexpectedCommand_IgnoredByDefault() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	workerSocket := worker.sockets[0]
+	socket := workerSocket.socket
+
+	for _, command := range []string{"\x09", MD_READY, MD_REPLY} {
+		reply, handled := worker.handleMessage(workerSocket, [][]byte{nil, []byte(MD_WORKER), []byte(command)})
+		s.Nil(reply)
+		s.False(handled)
+	}
+	s.True(socket == workerSocket.socket, "Expected the socket not to be replaced")
+	s.Equal(uint64(0), worker.Stats().Errors)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_UnexpectedCommand_ConfiguredToReconnect() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.unexpectedCommands[MD_REPLY] = UnexpectedCommandReconnect
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_REPLY)})
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after reconnect")
+	s.Equal(uint64(1), worker.Stats().Errors)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_UnexpectedCommand_ConfiguredToShutdown() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.unexpectedCommands["\x09"] = UnexpectedCommandShutdown
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte("\x09")})
+
+	_, err := worker.Receive()
+	s.IsType(GracefulShutdown(""), err)
+}
+
+func (s *WorkerTestSuite) Test_Heartbeat_AdoptsIntervalAdvertisedByBroker() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.heartbeatNegotiation = true
+	worker.minHeartbeat = 100 * time.Millisecond
+	worker.maxHeartbeat = 2000 * time.Millisecond
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT), []byte("250")})
+	s.Equal(250*time.Millisecond, worker.heartbeat)
+
+	// Bounded by the configured min/max
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT), []byte("10")})
+	s.Equal(100*time.Millisecond, worker.heartbeat)
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT), []byte("60000")})
+	s.Equal(2000*time.Millisecond, worker.heartbeat)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Heartbeat_KeepsIntervalWhenNothingAdvertised() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+	worker.heartbeatNegotiation = true
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT)})
+	s.Equal(time.Duration(s.heartbeatInMillis)*time.Millisecond, worker.heartbeat)
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT), []byte("garbage")})
+	s.Equal(time.Duration(s.heartbeatInMillis)*time.Millisecond, worker.heartbeat)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Heartbeat_IgnoresAdvertisedIntervalUnlessNegotiating() {
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_HEARTBEAT), []byte("250")})
+	s.Equal(time.Duration(s.heartbeatInMillis)*time.Millisecond, worker.heartbeat)
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) createDeadlineWorker(clock Clock, action WorkerAction) *mdWorker {
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		Clock:                clock,
+		PropagateDeadline:    true,
+		DeadlineFrame:        0,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	return worker
+}
+
+func deadlineFrame(deadline time.Time) []byte {
+	return []byte(fmt.Sprintf("%d", deadline.UnixNano()/int64(time.Millisecond)))
+}
+
+func (s *WorkerTestSuite) Test_Deadline_ExpiredRequestIsDropped() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	clock := newFakeClock()
+	action := &contextWorkerAction{}
+	worker := s.createDeadlineWorker(clock, action)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	go worker.Receive()
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), deadlineFrame(clock.Now().Add(-time.Second)), []byte("hello"))
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte("Deadline exceeded")}, workerMsg[6:])
+	}
+	s.Empty(action.ctxs)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Deadline_PassedToActionWhenStillValid() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	clock := newFakeClock()
+	action := &contextWorkerAction{}
+	worker := s.createDeadlineWorker(clock, action)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	deadline := clock.Now().Add(time.Second)
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), deadlineFrame(deadline), []byte("hello"))
+
+	_, err := worker.Receive()
+	s.NoError(err)
+
+	if s.Equal(1, len(action.ctxs)) {
+		s.True(deadline.Equal(action.ctxs[0].Deadline))
+		s.Equal(time.Second, action.ctxs[0].Deadline.Sub(clock.Now()))
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReceivedAtPopulatedAndMonotonic() {
+	action := &contextWorkerAction{}
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+
+	for i := 0; i < 3; i++ {
+		worker.handleMessage(worker.sockets[0], [][]byte{nil, []byte(MD_WORKER), []byte(MD_REQUEST), []byte("client"), nil, []byte("hello")})
+	}
+
+	if s.Len(action.ctxs, 3) {
+		s.False(action.ctxs[0].ReceivedAt.IsZero(), "Expected ReceivedAt to be set")
+		s.True(action.ctxs[0].EnqueuedAt.IsZero(), "Expected no EnqueuedAt unless configured")
+
+		for i := 1; i < len(action.ctxs); i++ {
+			s.False(action.ctxs[i].ReceivedAt.Before(action.ctxs[i-1].ReceivedAt), "Expected ReceivedAt never to go backwards")
+		}
+	}
+
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_NoReplyDoesNotSendReply() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		NoReply:              true,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("hello")}, msg)
+
+	// Anything the worker sent for the request would arrive before this marker
+	worker.sendReady(worker.sockets[0].socket, worker.sockets[0].serviceName)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected no REPLY")
+	s.Equal(uint64(1), worker.Stats().Requests)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_SetAction_InFlightRequestFinishesWithOldAction() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	oldAction := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		close(started)
+		<-release
+		return [][]byte{[]byte("old")}
+	}}
+	newAction := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		return [][]byte{[]byte("new")}
+	}}
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, oldAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+	replies := make(chan [][]byte)
+	go func() {
+		msg, _ := worker.Receive()
+		replies <- msg
+	}()
+
+	<-started
+	worker.SetAction(newAction)
+	close(release)
+
+	s.Equal([][]byte{[]byte("old")}, <-replies)
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+	msg, err := worker.Receive()
+	s.NoError(err)
+	s.Equal([][]byte{[]byte("new")}, msg)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_SetAction_ConcurrentWithReceive() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, s.defaultAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			worker.SetAction(defaultWorkerAction{})
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+		msg, err := worker.Receive()
+		s.NoError(err)
+		s.Equal([][]byte{[]byte("hello")}, msg)
+	}
+
+	<-done
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_SetAction_IgnoresActionWithoutBatchSupportWhenBatching() {
+	action := &batchWorkerAction{}
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               action,
+		BatchMaxSize:         2,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	worker.SetAction(s.defaultAction)
+	s.Equal(action, worker.action())
+
+	worker.cleanup()
+}
+
+type recordingTracer struct {
+	headers [][]byte
+}
+
+func (t *recordingTracer) StartRequest(ctx RequestContext, header []byte) func([][]byte) [][]byte {
+	t.headers = append(t.headers, header)
+
+	return func(reply [][]byte) [][]byte {
+		return append([][]byte{[]byte("trace-out")}, reply...)
+	}
+}
+
+func (s *WorkerTestSuite) Test_Receive_TracerWrapsAction() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	tracer := &recordingTracer{}
+	config := WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Duration(s.reconnectInMillis) * time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+		Tracer:               tracer,
+		TraceFrame:           0,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("trace-in"), []byte("hello"))
+
+	_, err = worker.Receive()
+	s.NoError(err)
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	if s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY") {
+		s.Equal([][]byte{[]byte("trace-out"), []byte("trace-in"), []byte("hello")}, workerMsg[6:])
+	}
+	s.Equal([][]byte{[]byte("trace-in")}, tracer.headers)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_QueueDepth_CountsRequestUntilReplied() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowAction := funcWorkerAction{call: func(args [][]byte) [][]byte {
+		close(started)
+		<-release
+		return args
+	}}
+
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, slowAction)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	s.Equal(0, worker.QueueDepth())
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		worker.Receive()
+	}()
+
+	<-started
+	s.Equal(1, worker.QueueDepth())
+	s.Equal(1, worker.Stats().QueueDepth)
+
+	close(release)
+	<-done
+
+	s.Equal(0, worker.QueueDepth())
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_RawRequestHoldsEveryFrame() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	action := &contextWorkerAction{}
+	worker := s.createWorker(s.heartbeatInMillis, s.reconnectInMillis, action)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("custom-header"), []byte("hello"))
+
+	_, err := worker.Receive()
+	s.NoError(err)
+
+	expected := [][]byte{
+		[]byte(""),
+		[]byte(MD_WORKER),
+		[]byte(MD_REQUEST),
+		[]byte("client"),
+		[]byte(""),
+		[]byte("custom-header"),
+		[]byte("hello"),
+	}
+
+	if s.Equal(1, len(action.ctxs)) {
+		ctx := action.ctxs[0]
+		s.Equal(expected, ctx.RawRequest)
+
+		// Changing the copy leaves the request alone
+		ctx.RawRequest[5][0] = 'X'
+		s.Equal([]byte("custom-header"), ctx.Request[0])
+	}
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
 func TestWorkerTestSuite(t *testing.T) {
 	suite.Run(t, new(WorkerTestSuite))
 }
+
+func (s *WorkerTestSuite) Test_Receive_RestartsAfterMaxRequests() {
+	broker := createBroker()
+	go broker.run(s.ctx, s.brokerAddress)
+
+	config := WorkerConfig{
+		BrokerAddress:            s.brokerAddress,
+		ServiceName:              s.serviceName,
+		HeartbeatInMillis:        time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:        time.Duration(1) * time.Millisecond,
+		PollingInterval:          time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness:     s.heartbeatLiveness,
+		Action:                   s.defaultAction,
+		MaxRequestsBeforeRestart: 2,
+	}
+
+	worker, err := newWorker(s.ctx, s.logger, config)
+	s.NoError(err)
+
+	// We can ignore the initial READY
+	broker.performReceive <- struct{}{}
+	<-broker.receivedFromWorker
+
+	for i := 0; i < 2; i++ {
+		sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+		_, err = worker.Receive()
+		s.NoError(err)
+
+		workerMsg := readUntilNonHeartbeat(broker)
+		s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY")
+	}
+	s.Equal(uint64(0), worker.Stats().Reconnects, "Expected no restart before the next Receive()")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := worker.Receive()
+		done <- err
+	}()
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT on restart")
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after restart")
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_REPLY), workerMsg[3], "Expected REPLY after restart")
+	s.NoError(<-done)
+
+	s.Equal(uint64(1), worker.Stats().Reconnects)
+	s.Equal(uint64(3), worker.Stats().Requests, "Expected the request count to carry on")
+	s.Equal(1, worker.requestsSinceRestart)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Restart_KeepsIdentityAndStats() {
+	broker := createBroker()
+	go broker.runHandingOver(s.ctx, s.brokerAddress)
+
+	worker, err := newWorker(s.ctx, s.logger, WorkerConfig{
+		BrokerAddress:        s.brokerAddress,
+		ServiceName:          s.serviceName,
+		HeartbeatInMillis:    time.Duration(s.heartbeatInMillis) * time.Millisecond,
+		ReconnectInMillis:    time.Millisecond,
+		PollingInterval:      time.Duration(s.pollInterval) * time.Millisecond,
+		MaxHeartbeatLiveness: s.heartbeatLiveness,
+		Action:               s.defaultAction,
+	})
+	s.NoError(err)
+
+	broker.performReceive <- struct{}{}
+	ready := <-broker.receivedFromWorker
+	identity := ready[0]
+
+	sendWorkerMessage(broker, MD_REQUEST, []byte("client"), []byte(""), []byte("hello"))
+	_, err = worker.Receive()
+	s.NoError(err)
+	readUntilNonHeartbeat(broker)
+
+	go worker.Receive()
+	s.NoError(worker.Restart())
+
+	workerMsg := readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_DISCONNECT), workerMsg[3], "Expected DISCONNECT on restart")
+	workerMsg = readUntilNonHeartbeat(broker)
+	s.Equal([]byte(MD_READY), workerMsg[3], "Expected READY after restart")
+	s.Equal(identity, workerMsg[0], "Expected the broker to see the same identity")
+
+	stats := worker.Stats()
+	s.Equal(uint64(1), stats.Requests, "Expected the request count to carry on")
+	s.Equal(uint64(1), stats.Reconnects)
+
+	broker.shutdown <- struct{}{}
+	worker.cleanup()
+}
+
+func (s *WorkerTestSuite) Test_Receive_ReplyTimeoutReconnects() {
+	worker := s.createWorker(s.heartbeatInMillis, 1, s.defaultAction)
+	worker.replyTimeout = 50 * time.Millisecond
+
+	// A DEALER with no peer never takes the reply, like a broker that stopped reading
+	stuck, err := s.ctx.NewSocket(zmq4.DEALER)
+	s.NoError(err)
+	worker.sockets[0].socket.Close()
+	worker.sockets[0].socket = stuck
+
+	start := time.Now()
+	err = worker.sendReplyOrReconnect(worker.sockets[0], []byte("client"), replyFrames(nil, [][]byte{[]byte("hello")}))
+
+	s.True(sendTimedOut(err), "Expected the reply send to time out")
+	s.True(time.Since(start) < time.Second, "Expected the reply timeout rather than blocking")
+	s.Equal(uint64(1), worker.Stats().Reconnects)
+	s.NotEqual(stuck, worker.sockets[0].socket, "Expected a fresh socket")
+
+	worker.cleanup()
+}